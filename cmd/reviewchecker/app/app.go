@@ -11,36 +11,103 @@ import (
 	"time"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 
 	"github.com/6ermvH/avito-reviewchecker/cmd/reviewchecker/config"
 	"github.com/6ermvH/avito-reviewchecker/cmd/reviewchecker/middleware"
+	"github.com/6ermvH/avito-reviewchecker/internal/escalation"
 	"github.com/6ermvH/avito-reviewchecker/internal/httpserver"
+	"github.com/6ermvH/avito-reviewchecker/internal/integration"
+	"github.com/6ermvH/avito-reviewchecker/internal/metrics"
+	"github.com/6ermvH/avito-reviewchecker/internal/model"
+	"github.com/6ermvH/avito-reviewchecker/internal/notify"
+	"github.com/6ermvH/avito-reviewchecker/internal/repository/memory"
 	"github.com/6ermvH/avito-reviewchecker/internal/repository/postgres"
+	"github.com/6ermvH/avito-reviewchecker/internal/repository/sqlite"
 	"github.com/6ermvH/avito-reviewchecker/internal/usecase"
+	"github.com/6ermvH/avito-reviewchecker/internal/webhook"
 
 	_ "github.com/jackc/pgx/v5/stdlib"
 )
 
 type App struct {
-	cfg    config.Config
-	logger *slog.Logger
-	server *http.Server
+	cfg        config.Config
+	logger     *slog.Logger
+	server     *http.Server
+	dispatcher *webhook.Dispatcher
+	// notifier is nil when no team has a notification webhook.
+	notifier *notify.Notifier
+	// mailer is nil when no SMTP host is configured.
+	mailer *notify.Mailer
+	// digests is nil when no team has a digest or there is nowhere to send it.
+	digests *notify.Digests
+	// escalations is nil when no team has an escalation policy.
+	escalations *escalation.Scheduler
+	metrics     *metrics.Domain
 }
 
 func New(cfg config.Config) (*App, error) {
 	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{
 		Level: parseLogLevel(cfg.Log.Level),
 	}))
+	// handlers without an injected logger, such as the exports, log through it
+	slog.SetDefault(logger)
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
 
 	router := chi.NewRouter()
 	router.Use(middleware.RequestLogger(logger))
+	router.Use(middleware.Metrics(registry))
+	router.Use(middleware.Idempotency(
+		middleware.NewIdempotencyStore(time.Duration(cfg.Idempotency.TTL)*time.Second),
+		cfg.Idempotency.ClientHeader,
+	))
+
+	repo, db, err := newRepository(cfg.DB)
+	if err != nil {
+		return nil, err
+	}
+
+	if db != nil {
+		registry.MustRegister(collectors.NewDBStatsCollector(db, cfg.DB.Driver))
+	}
+
+	svc := usecase.New(repo, logger)
+
+	domainMetrics := metrics.NewDomain(svc, logger)
+	registry.MustRegister(domainMetrics)
+
+	registerRoutes(router, svc)
+	router.Handle("/metrics", promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+	registerIntegrations(router, cfg.Integrations, svc, logger)
+
+	notifier, err := newNotifier(cfg, svc, repo, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	mailer, err := newMailer(cfg, svc, repo, logger)
+	if err != nil {
+		return nil, err
+	}
 
-	db, err := sql.Open("pgx", cfg.DB.DSN)
+	digests, err := newDigests(cfg.Teams, svc, repo, notifier, mailer, logger)
 	if err != nil {
-		return nil, fmt.Errorf("connect to db: %w", err)
+		return nil, err
 	}
 
-	registerRoutes(router, usecase.New(postgres.New(db), logger))
+	escalations := newEscalations(
+		cfg.Teams,
+		time.Duration(cfg.Escalation.Interval)*time.Second,
+		svc,
+		logger,
+	)
 
 	httpSrv := &http.Server{
 		Addr:         cfg.HTTP.Addr,
@@ -51,15 +118,40 @@ func New(cfg config.Config) (*App, error) {
 	}
 
 	return &App{
-		cfg:    cfg,
-		logger: logger,
-		server: httpSrv,
+		cfg:         cfg,
+		logger:      logger,
+		server:      httpSrv,
+		dispatcher:  newDispatcher(cfg.Webhooks, repo, logger),
+		notifier:    notifier,
+		mailer:      mailer,
+		digests:     digests,
+		escalations: escalations,
+		metrics:     domainMetrics,
 	}, nil
 }
 
 func (a *App) Run(ctx context.Context) error {
 	errCh := make(chan error, 1)
 
+	go a.dispatcher.Run(ctx)
+	go a.metrics.Run(ctx)
+
+	if a.notifier != nil {
+		go a.notifier.Run(ctx)
+	}
+
+	if a.mailer != nil {
+		go a.mailer.Run(ctx)
+	}
+
+	if a.digests != nil {
+		go a.digests.Run(ctx)
+	}
+
+	if a.escalations != nil {
+		go a.escalations.Run(ctx)
+	}
+
 	go func() {
 		a.logger.Info("starting http server", "addr", a.cfg.HTTP.Addr)
 
@@ -87,6 +179,246 @@ func (a *App) Run(ctx context.Context) error {
 	}
 }
 
+// newRepository returns the repository of the configured driver and its
+// connection pool, nil for the memory driver.
+func newRepository(cfg config.DBConfig) (usecase.Repository, *sql.DB, error) {
+	switch cfg.Driver {
+	case config.DriverMemory:
+		return memory.New(), nil, nil
+	case config.DriverSQLite:
+		db, err := sqlite.Open(cfg.DSN)
+		if err != nil {
+			return nil, nil, fmt.Errorf("connect to db: %w", err)
+		}
+
+		return sqlite.New(db), db, nil
+	default:
+		db, err := sql.Open("pgx", cfg.DSN)
+		if err != nil {
+			return nil, nil, fmt.Errorf("connect to db: %w", err)
+		}
+
+		return postgres.New(db), db, nil
+	}
+}
+
+// registerIntegrations mounts the webhook endpoints of configured VCS
+// integrations.
+func registerIntegrations(
+	r chi.Router,
+	cfg config.IntegrationsConfig,
+	svc integration.Service,
+	logger *slog.Logger,
+) {
+	identities := integration.NewIdentities()
+
+	for _, identity := range cfg.Identities {
+		if identity.GitHub != "" {
+			identities.Add(integration.ProviderGitHub, identity.GitHub, identity.UserID)
+		}
+
+		if identity.GitLab != "" {
+			identities.Add(integration.ProviderGitLab, identity.GitLab, identity.UserID)
+		}
+
+		if identity.GitLabID != 0 {
+			identities.AddID(integration.ProviderGitLab, identity.GitLabID, identity.UserID)
+		}
+	}
+
+	if cfg.GitHub.Secret != "" {
+		r.Method(
+			http.MethodPost,
+			"/integrations/github/webhook",
+			integration.NewGitHub(cfg.GitHub.Secret, svc, identities, logger),
+		)
+	}
+
+	if cfg.GitLab.Token != "" {
+		r.Method(
+			http.MethodPost,
+			"/integrations/gitlab/webhook",
+			integration.NewGitLab(cfg.GitLab.Token, svc, identities, logger),
+		)
+	}
+}
+
+func newDispatcher(
+	cfg config.WebhooksConfig,
+	store webhook.Store,
+	logger *slog.Logger,
+) *webhook.Dispatcher {
+	client := webhook.NewClient(cfg.AllowPrivateNetworks)
+
+	return webhook.NewDispatcher(store, client, logger, webhook.Config{
+		PollInterval: time.Duration(cfg.PollInterval) * time.Second,
+		Timeout:      time.Duration(cfg.Timeout) * time.Second,
+		BatchSize:    cfg.BatchSize,
+		MaxAttempts:  cfg.MaxAttempts,
+		BaseBackoff:  time.Duration(cfg.BaseBackoff) * time.Second,
+		MaxBackoff:   time.Duration(cfg.MaxBackoff) * time.Second,
+	})
+}
+
+func newNotifier(
+	cfg config.Config,
+	source notify.Source,
+	users notify.Users,
+	logger *slog.Logger,
+) (*notify.Notifier, error) {
+	if len(cfg.Notifications.Teams) == 0 {
+		return nil, nil //nolint:nilnil
+	}
+
+	teams := make(map[string]string, len(cfg.Notifications.Teams))
+	for _, team := range cfg.Notifications.Teams {
+		teams[team.TeamName] = team.WebhookURL
+	}
+
+	mentions := make(map[string]string)
+
+	for _, identity := range cfg.Integrations.Identities {
+		if identity.Chat != "" {
+			mentions[identity.UserID] = identity.Chat
+		}
+	}
+
+	n := cfg.Notifications
+
+	notifier, err := notify.NewNotifier(source, users, &http.Client{}, logger, notify.Config{
+		Teams:              teams,
+		Mentions:           mentions,
+		CreatedTemplate:    n.CreatedTemplate,
+		ReassignedTemplate: n.ReassignedTemplate,
+		EscalatedTemplate:  n.EscalatedTemplate,
+		DigestTemplate:     n.DigestTemplate,
+		Timeout:            time.Duration(n.Timeout) * time.Second,
+		MinInterval:        time.Duration(n.MinInterval) * time.Second,
+		MaxAttempts:        n.MaxAttempts,
+		BaseBackoff:        time.Duration(n.BaseBackoff) * time.Second,
+		MaxBackoff:         time.Duration(n.MaxBackoff) * time.Second,
+		QueueSize:          n.QueueSize,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("create notifier: %w", err)
+	}
+
+	return notifier, nil
+}
+
+func newMailer(
+	cfg config.Config,
+	source notify.Source,
+	users notify.Users,
+	logger *slog.Logger,
+) (*notify.Mailer, error) {
+	e := cfg.Notifications.Email
+	if e.Host == "" {
+		return nil, nil //nolint:nilnil
+	}
+
+	emails := make(map[string]string)
+
+	for _, identity := range cfg.Integrations.Identities {
+		if identity.Email != "" {
+			emails[identity.UserID] = identity.Email
+		}
+	}
+
+	mailer, err := notify.NewMailer(source, users, logger, notify.MailConfig{
+		Host:         e.Host,
+		Port:         e.Port,
+		Username:     e.Username,
+		Password:     e.Password,
+		From:         e.From,
+		Emails:       emails,
+		TemplatesDir: e.TemplatesDir,
+		Timeout:      time.Duration(e.Timeout) * time.Second,
+		MaxAttempts:  e.MaxAttempts,
+		BaseBackoff:  time.Duration(e.BaseBackoff) * time.Second,
+		MaxBackoff:   time.Duration(e.MaxBackoff) * time.Second,
+		QueueSize:    e.QueueSize,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("create mailer: %w", err)
+	}
+
+	return mailer, nil
+}
+
+func newDigests(
+	teams []config.TeamConfig,
+	source notify.DigestSource,
+	users notify.Users,
+	notifier *notify.Notifier,
+	mailer *notify.Mailer,
+	logger *slog.Logger,
+) (*notify.Digests, error) {
+	if notifier == nil && mailer == nil {
+		return nil, nil //nolint:nilnil
+	}
+
+	var scheduled []notify.DigestTeam
+
+	for _, team := range teams {
+		if team.Digest == "" {
+			continue
+		}
+
+		at, err := time.Parse("15:04", team.Digest)
+		if err != nil {
+			return nil, fmt.Errorf("parse digest time of team %q: %w", team.Name, err)
+		}
+
+		location, err := time.LoadLocation(team.Timezone)
+		if err != nil {
+			return nil, fmt.Errorf("load timezone of team %q: %w", team.Name, err)
+		}
+
+		scheduled = append(scheduled, notify.DigestTeam{
+			Name:     team.Name,
+			Hour:     at.Hour(),
+			Minute:   at.Minute(),
+			Location: location,
+			SLA:      time.Duration(team.SLA) * time.Hour,
+		})
+	}
+
+	if len(scheduled) == 0 {
+		return nil, nil //nolint:nilnil
+	}
+
+	return notify.NewDigests(source, users, notifier, mailer, logger, scheduled), nil
+}
+
+func newEscalations(
+	teams []config.TeamConfig,
+	interval time.Duration,
+	svc escalation.Service,
+	logger *slog.Logger,
+) *escalation.Scheduler {
+	var rules []model.EscalationRule
+
+	for _, team := range teams {
+		if team.Escalation == "" {
+			continue
+		}
+
+		rules = append(rules, model.EscalationRule{
+			TeamName: team.Name,
+			SLA:      time.Duration(team.SLA) * time.Hour,
+			Policy:   model.EscalationPolicy(team.Escalation),
+			LeadID:   team.Lead,
+		})
+	}
+
+	if len(rules) == 0 {
+		return nil
+	}
+
+	return escalation.NewScheduler(svc, logger, rules, interval)
+}
+
 func parseLogLevel(level string) slog.Level {
 	switch level {
 	case "debug":
@@ -108,13 +440,27 @@ func registerRoutes(r chi.Router, svc httpserver.Service) {
 	r.Get("/users/getReview", httpserver.HandleGetUserReview(svc))
 
 	r.Post("/pullRequest/create", httpserver.HandleCreatePR(svc))
+	r.Get("/pullRequest/get", httpserver.HandleGetPR(svc))
 	r.Post("/pullRequest/merge", httpserver.HandleMergePR(svc))
 	r.Post("/pullRequest/reassign", httpserver.HandleReassignPR(svc))
+	r.Get("/pullRequest/history", httpserver.HandlePullRequestHistory(svc))
 
 	r.Route("/stats", func(r chi.Router) {
 		r.Get("/reviewers", httpserver.HandleReviewerStats(svc))
 		r.Get("/pullRequests", httpserver.HandlePullRequestStats(svc))
+		r.Get("/teams", httpserver.HandleTeamStats(svc))
+		r.Get("/fairness", httpserver.HandleFairness(svc))
+		r.Get("/timeseries", httpserver.HandleTimeseries(svc))
 	})
 
+	r.Route("/webhooks", func(r chi.Router) {
+		r.Post("/add", httpserver.HandleWebhookAdd(svc))
+		r.Get("/list", httpserver.HandleWebhookList(svc))
+		r.Post("/delete", httpserver.HandleWebhookDelete(svc))
+		r.Get("/deliveries", httpserver.HandleWebhookDeliveries(svc))
+	})
+
+	r.Get("/events/stream", httpserver.HandleEventStream(svc))
+
 	r.Get("/healthz", httpserver.HandleHealthz())
 }
@@ -12,6 +12,15 @@ type Config struct {
 	HTTP HTTPConfig `yaml:"server"`
 	Log  LogConfig  `yaml:"log"`
 	DB   DBConfig   `yaml:"db"`
+
+	Idempotency IdempotencyConfig `yaml:"idempotency"`
+	Webhooks    WebhooksConfig    `yaml:"webhooks"`
+
+	Integrations  IntegrationsConfig  `yaml:"integrations"`
+	Notifications NotificationsConfig `yaml:"notifications"`
+
+	Teams      []TeamConfig     `validate:"dive" yaml:"teams"`
+	Escalation EscalationConfig `yaml:"escalation"`
 }
 
 type HTTPConfig struct {
@@ -25,8 +34,168 @@ type LogConfig struct {
 	Level string `validate:"required" yaml:"level"`
 }
 
+// IdempotencyConfig sets how long responses to requests with an
+// Idempotency-Key are kept, in seconds, and the header identifying the caller
+// the keys are scoped to.
+type IdempotencyConfig struct {
+	TTL          int    `validate:"gte=0" yaml:"ttl"`
+	ClientHeader string `yaml:"clientHeader"`
+}
+
+const (
+	defaultIdempotencyTTL          = 24 * 60 * 60
+	defaultIdempotencyClientHeader = "Authorization"
+)
+
+// WebhooksConfig tunes the webhook dispatcher. Durations are in seconds.
+type WebhooksConfig struct {
+	PollInterval int `validate:"gte=0" yaml:"pollInterval"`
+	Timeout      int `validate:"gte=0" yaml:"timeout"`
+	BatchSize    int `validate:"gte=0" yaml:"batchSize"`
+	MaxAttempts  int `validate:"gte=0" yaml:"maxAttempts"`
+	BaseBackoff  int `validate:"gte=0" yaml:"baseBackoff"`
+	MaxBackoff   int `validate:"gte=0" yaml:"maxBackoff"`
+	// AllowPrivateNetworks lets subscriptions target loopback, private and
+	// link-local addresses. Anyone can add a subscription, so this is only
+	// safe when the API is not reachable by untrusted callers.
+	AllowPrivateNetworks bool `yaml:"allowPrivateNetworks"`
+}
+
+var defaultWebhooks = WebhooksConfig{
+	PollInterval: 1,
+	Timeout:      10,
+	BatchSize:    100,
+	MaxAttempts:  8,
+	BaseBackoff:  5,
+	MaxBackoff:   60 * 60,
+}
+
+// IntegrationsConfig configures incoming VCS webhooks. Secrets are read from
+// the environment; an integration without a secret is disabled.
+type IntegrationsConfig struct {
+	Identities []IdentityConfig `validate:"dive" yaml:"identities"`
+	GitHub     GitHubConfig     `yaml:"-"`
+	GitLab     GitLabConfig     `yaml:"-"`
+}
+
+// IdentityConfig maps the logins of a user on VCS hosting services to users.id.
+// GitLabID is the numeric GitLab account id, needed to recognize the author of
+// merge request events triggered by someone else. Chat is the mention used in
+// notifications, e.g. "<@U024BE7LH>" for Slack, and Email the address email
+// notifications are sent to when the user has no email stored.
+type IdentityConfig struct {
+	UserID   string `validate:"required"        yaml:"userId"`
+	GitHub   string `yaml:"github"`
+	GitLab   string `yaml:"gitlab"`
+	GitLabID int64  `validate:"gte=0"           yaml:"gitlabId"`
+	Chat     string `yaml:"chat"`
+	Email    string `validate:"omitempty,email" yaml:"email"`
+}
+
+type GitHubConfig struct {
+	Secret string
+}
+
+type GitLabConfig struct {
+	Token string
+}
+
+// NotificationsConfig configures reviewer notifications sent to Slack-compatible
+// incoming webhooks. Durations are in seconds. Templates left empty use the
+// built-in ones.
+type NotificationsConfig struct {
+	Teams              []TeamNotificationConfig `validate:"dive"  yaml:"teams"`
+	CreatedTemplate    string                   `yaml:"createdTemplate"`
+	ReassignedTemplate string                   `yaml:"reassignedTemplate"`
+	EscalatedTemplate  string                   `yaml:"escalatedTemplate"`
+	DigestTemplate     string                   `yaml:"digestTemplate"`
+	Timeout            int                      `validate:"gte=0" yaml:"timeout"`
+	MinInterval        int                      `validate:"gte=0" yaml:"minInterval"`
+	MaxAttempts        int                      `validate:"gte=0" yaml:"maxAttempts"`
+	BaseBackoff        int                      `validate:"gte=0" yaml:"baseBackoff"`
+	MaxBackoff         int                      `validate:"gte=0" yaml:"maxBackoff"`
+	QueueSize          int                      `validate:"gte=0" yaml:"queueSize"`
+
+	Email EmailConfig `yaml:"email"`
+}
+
+// EmailConfig configures email notifications over SMTP, disabled while Host is
+// empty. The password is read from SMTP_PASSWORD. Durations are in seconds.
+type EmailConfig struct {
+	Host     string `yaml:"host"`
+	Port     int    `validate:"gte=0,lte=65535" yaml:"port"`
+	Username string `yaml:"username"`
+	Password string `yaml:"-"`
+	// From may include a display name, e.g. "Reviewchecker <noreply@example.com>".
+	From string `validate:"required_with=Host" yaml:"from"`
+	// TemplatesDir holds email.txt and email.html replacing the built-in
+	// templates.
+	TemplatesDir string `yaml:"templatesDir"`
+	Timeout      int    `validate:"gte=0" yaml:"timeout"`
+	MaxAttempts  int    `validate:"gte=0" yaml:"maxAttempts"`
+	BaseBackoff  int    `validate:"gte=0" yaml:"baseBackoff"`
+	MaxBackoff   int    `validate:"gte=0" yaml:"maxBackoff"`
+	QueueSize    int    `validate:"gte=0" yaml:"queueSize"`
+}
+
+// TeamNotificationConfig sets the incoming webhook of a team. ${VAR} in
+// WebhookURL is expanded from the environment, so the URL need not be stored
+// in the config.
+type TeamNotificationConfig struct {
+	TeamName   string `validate:"required"     yaml:"teamName"`
+	WebhookURL string `validate:"required,url" yaml:"webhookUrl"`
+}
+
+var defaultNotifications = NotificationsConfig{
+	Timeout:     10,
+	MinInterval: 1,
+	MaxAttempts: 5,
+	BaseBackoff: 1,
+	MaxBackoff:  60,
+	QueueSize:   100,
+	Email: EmailConfig{
+		Port:        587,
+		Timeout:     30,
+		MaxAttempts: 5,
+		BaseBackoff: 5,
+		MaxBackoff:  600,
+		QueueSize:   100,
+	},
+}
+
+// TeamConfig holds the settings of a team. Times are in Timezone, an IANA
+// name, UTC when empty.
+type TeamConfig struct {
+	Name     string `validate:"required"          yaml:"name"`
+	Timezone string `validate:"omitempty,timezone" yaml:"timezone"`
+	// SLA is how many hours reviewers have to respond, 0 for no SLA.
+	SLA int `validate:"gte=0,required_with=Escalation" yaml:"sla"`
+	// Digest is the time of the daily digest as "15:04", empty for none.
+	Digest string `validate:"omitempty,datetime=15:04" yaml:"digest"`
+	// Escalation is what happens to reviews past the SLA: "notify",
+	// "reassign" or "add_lead", which adds the user Lead as a reviewer.
+	// Empty for no escalation.
+	Escalation string `validate:"omitempty,oneof=notify reassign add_lead" yaml:"escalation"`
+	Lead       string `validate:"required_if=Escalation add_lead"         yaml:"lead"`
+}
+
+// EscalationConfig sets how often reviews are checked against the SLA of
+// their team, in seconds.
+type EscalationConfig struct {
+	Interval int `validate:"gte=0" yaml:"interval"`
+}
+
+const defaultEscalationInterval = 60
+
+const (
+	DriverPostgres = "postgres"
+	DriverSQLite   = "sqlite"
+	DriverMemory   = "memory"
+)
+
 type DBConfig struct {
-	DSN string `validate:"required" yaml:"dsn"`
+	Driver string `validate:"oneof=postgres sqlite memory"  yaml:"driver"`
+	DSN    string `validate:"required_unless=Driver memory" yaml:"dsn"`
 }
 
 func Load(path string) (*Config, error) {
@@ -43,7 +212,33 @@ func Load(path string) (*Config, error) {
 		return nil, fmt.Errorf("load config from %q: %w", path, err)
 	}
 
-	cfg.DB = DBConfig{DSN: os.Getenv("DSN")}
+	cfg.DB.DSN = os.Getenv("DSN")
+	cfg.Integrations.GitHub.Secret = os.Getenv("GITHUB_WEBHOOK_SECRET")
+	cfg.Integrations.GitLab.Token = os.Getenv("GITLAB_WEBHOOK_TOKEN")
+	cfg.Notifications.Email.Password = os.Getenv("SMTP_PASSWORD")
+	if cfg.DB.Driver == "" {
+		cfg.DB.Driver = DriverPostgres
+	}
+
+	if cfg.Idempotency.TTL == 0 {
+		cfg.Idempotency.TTL = defaultIdempotencyTTL
+	}
+
+	if cfg.Idempotency.ClientHeader == "" {
+		cfg.Idempotency.ClientHeader = defaultIdempotencyClientHeader
+	}
+
+	if cfg.Escalation.Interval == 0 {
+		cfg.Escalation.Interval = defaultEscalationInterval
+	}
+
+	setWebhookDefaults(&cfg.Webhooks)
+	setNotificationDefaults(&cfg.Notifications)
+
+	for i := range cfg.Notifications.Teams {
+		team := &cfg.Notifications.Teams[i]
+		team.WebhookURL = os.ExpandEnv(team.WebhookURL)
+	}
 
 	validate := validator.New()
 	if err := validate.Struct(cfg); err != nil {
@@ -52,3 +247,45 @@ func Load(path string) (*Config, error) {
 
 	return cfg, nil
 }
+
+func setWebhookDefaults(cfg *WebhooksConfig) {
+	for _, field := range []struct {
+		value    *int
+		fallback int
+	}{
+		{&cfg.PollInterval, defaultWebhooks.PollInterval},
+		{&cfg.Timeout, defaultWebhooks.Timeout},
+		{&cfg.BatchSize, defaultWebhooks.BatchSize},
+		{&cfg.MaxAttempts, defaultWebhooks.MaxAttempts},
+		{&cfg.BaseBackoff, defaultWebhooks.BaseBackoff},
+		{&cfg.MaxBackoff, defaultWebhooks.MaxBackoff},
+	} {
+		if *field.value == 0 {
+			*field.value = field.fallback
+		}
+	}
+}
+
+func setNotificationDefaults(cfg *NotificationsConfig) {
+	for _, field := range []struct {
+		value    *int
+		fallback int
+	}{
+		{&cfg.Timeout, defaultNotifications.Timeout},
+		{&cfg.MinInterval, defaultNotifications.MinInterval},
+		{&cfg.MaxAttempts, defaultNotifications.MaxAttempts},
+		{&cfg.BaseBackoff, defaultNotifications.BaseBackoff},
+		{&cfg.MaxBackoff, defaultNotifications.MaxBackoff},
+		{&cfg.QueueSize, defaultNotifications.QueueSize},
+		{&cfg.Email.Port, defaultNotifications.Email.Port},
+		{&cfg.Email.Timeout, defaultNotifications.Email.Timeout},
+		{&cfg.Email.MaxAttempts, defaultNotifications.Email.MaxAttempts},
+		{&cfg.Email.BaseBackoff, defaultNotifications.Email.BaseBackoff},
+		{&cfg.Email.MaxBackoff, defaultNotifications.Email.MaxBackoff},
+		{&cfg.Email.QueueSize, defaultNotifications.Email.QueueSize},
+	} {
+		if *field.value == 0 {
+			*field.value = field.fallback
+		}
+	}
+}
@@ -3,6 +3,8 @@ package main
 import (
 	"context"
 	"os"
+	// team timezones must load without tzdata on the host
+	_ "time/tzdata"
 
 	"github.com/6ermvH/avito-reviewchecker/cmd/reviewchecker/app"
 	"github.com/6ermvH/avito-reviewchecker/cmd/reviewchecker/config"
@@ -0,0 +1,308 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	httpmodel "github.com/6ermvH/avito-reviewchecker/internal/model/http"
+)
+
+const (
+	IdempotencyKeyHeader      = "Idempotency-Key"
+	IdempotentReplayedHeader  = "Idempotent-Replayed"
+	maxIdempotencyKeyLength   = 255
+	idempotencySweepInterval  = time.Minute
+	idempotencyScopeSeparator = "\n"
+	// maxIdempotentBodySize bounds the request bodies read into memory to
+	// fingerprint them.
+	maxIdempotentBodySize = 1 << 20
+)
+
+type idempotencyState int
+
+const (
+	idempotencyNew idempotencyState = iota
+	idempotencyReplay
+	idempotencyInFlight
+	idempotencyMismatch
+)
+
+// IdempotencyStore keeps responses of requests sent with an Idempotency-Key
+// for ttl. Entries live in process memory, so replays are only recognized by
+// the instance that served the first attempt.
+type IdempotencyStore struct {
+	mu        sync.Mutex
+	ttl       time.Duration
+	now       func() time.Time
+	entries   map[string]*idempotencyEntry
+	lastSweep time.Time
+}
+
+type idempotencyEntry struct {
+	fingerprint [sha256.Size]byte
+	done        bool
+	expiresAt   time.Time
+	response    storedResponse
+}
+
+type storedResponse struct {
+	status int
+	header http.Header
+	body   []byte
+}
+
+func NewIdempotencyStore(ttl time.Duration) *IdempotencyStore {
+	return &IdempotencyStore{
+		ttl:     ttl,
+		now:     time.Now,
+		entries: make(map[string]*idempotencyEntry),
+	}
+}
+
+// Idempotency replays the stored status, headers and body when a POST request
+// repeats an Idempotency-Key already seen for the same path and caller. The
+// caller is told apart by the value of clientHeader, so callers choosing the
+// same key do not see each other's responses; requests without it share one
+// anonymous scope. Reusing a key
+// with another body is rejected, as is a replay while the first attempt is
+// still running. Server errors and responses marked Cache-Control: no-store,
+// such as those carrying secrets, are not stored, so these requests run again.
+// Bodies over maxIdempotentBodySize are rejected with 413.
+func Idempotency(store *IdempotencyStore, clientHeader string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := r.Header.Get(IdempotencyKeyHeader)
+			if r.Method != http.MethodPost || key == "" {
+				next.ServeHTTP(w, r)
+
+				return
+			}
+
+			if len(key) > maxIdempotencyKeyLength {
+				writeError(
+					w,
+					http.StatusBadRequest,
+					httpmodel.ErrorCodeInvalidInput,
+					"Idempotency-Key is too long",
+				)
+
+				return
+			}
+
+			body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxIdempotentBodySize))
+			if maxBytesErr := new(http.MaxBytesError); errors.As(err, &maxBytesErr) {
+				writeError(
+					w,
+					http.StatusRequestEntityTooLarge,
+					httpmodel.ErrorCodeInvalidInput,
+					"request body is too large",
+				)
+
+				return
+			}
+
+			if err != nil {
+				writeError(
+					w,
+					http.StatusBadRequest,
+					httpmodel.ErrorCodeInvalidInput,
+					"failed to read request body",
+				)
+
+				return
+			}
+
+			r.Body = io.NopCloser(bytes.NewReader(body))
+
+			scopedKey := idempotencyScope(r.URL.Path, r.Header.Get(clientHeader), key)
+
+			state, stored := store.begin(scopedKey, sha256.Sum256(body))
+
+			switch state {
+			case idempotencyReplay:
+				replay(w, stored)
+
+				return
+			case idempotencyInFlight:
+				writeError(
+					w,
+					http.StatusConflict,
+					httpmodel.ErrorCodeConflict,
+					"request with this Idempotency-Key is still in progress",
+				)
+
+				return
+			case idempotencyMismatch:
+				writeError(
+					w,
+					http.StatusUnprocessableEntity,
+					httpmodel.ErrorCodeIdempotencyKeyReused,
+					"Idempotency-Key was already used with a different request body",
+				)
+
+				return
+			case idempotencyNew:
+			}
+
+			rec := &recordingWriter{ResponseWriter: w, status: http.StatusOK}
+			completed := false
+
+			defer func() {
+				if !completed {
+					store.release(scopedKey)
+				}
+			}()
+
+			next.ServeHTTP(rec, r)
+
+			if rec.status >= http.StatusInternalServerError ||
+				rec.header.Get("Cache-Control") == "no-store" {
+				return
+			}
+
+			store.complete(scopedKey, storedResponse{
+				status: rec.status,
+				header: rec.header,
+				body:   rec.body.Bytes(),
+			})
+
+			completed = true
+		})
+	}
+}
+
+// idempotencyScope keys the store by path, caller and key. The caller is
+// hashed, so credentials sent in clientHeader are not kept in memory.
+func idempotencyScope(path, caller, key string) string {
+	callerHash := sha256.Sum256([]byte(caller))
+
+	return path + idempotencyScopeSeparator +
+		hex.EncodeToString(callerHash[:]) + idempotencyScopeSeparator + key
+}
+
+func (s *IdempotencyStore) begin(
+	key string,
+	fingerprint [sha256.Size]byte,
+) (idempotencyState, storedResponse) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	s.sweep(now)
+
+	entry, ok := s.entries[key]
+	if ok && now.After(entry.expiresAt) {
+		delete(s.entries, key)
+
+		ok = false
+	}
+
+	switch {
+	case !ok:
+		s.entries[key] = &idempotencyEntry{
+			fingerprint: fingerprint,
+			expiresAt:   now.Add(s.ttl),
+		}
+
+		return idempotencyNew, storedResponse{}
+	case entry.fingerprint != fingerprint:
+		return idempotencyMismatch, storedResponse{}
+	case !entry.done:
+		return idempotencyInFlight, storedResponse{}
+	default:
+		return idempotencyReplay, entry.response
+	}
+}
+
+func (s *IdempotencyStore) complete(key string, response storedResponse) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.entries[key]
+	if !ok {
+		return
+	}
+
+	entry.done = true
+	entry.expiresAt = s.now().Add(s.ttl)
+	entry.response = response
+}
+
+func (s *IdempotencyStore) release(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.entries, key)
+}
+
+// sweep drops expired entries at most once per idempotencySweepInterval.
+func (s *IdempotencyStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < idempotencySweepInterval {
+		return
+	}
+
+	s.lastSweep = now
+
+	for key, entry := range s.entries {
+		if entry.done && now.After(entry.expiresAt) {
+			delete(s.entries, key)
+		}
+	}
+}
+
+func replay(w http.ResponseWriter, stored storedResponse) {
+	for name, values := range stored.header {
+		w.Header()[name] = append([]string(nil), values...)
+	}
+
+	w.Header().Set(IdempotentReplayedHeader, "true")
+	w.WriteHeader(stored.status)
+	_, _ = w.Write(stored.body)
+}
+
+type recordingWriter struct {
+	http.ResponseWriter
+	status      int
+	header      http.Header
+	wroteHeader bool
+	body        bytes.Buffer
+}
+
+func (w *recordingWriter) WriteHeader(code int) {
+	if !w.wroteHeader {
+		w.wroteHeader = true
+		w.status = code
+		w.header = w.ResponseWriter.Header().Clone()
+	}
+
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *recordingWriter) Write(p []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+
+	w.body.Write(p)
+
+	return w.ResponseWriter.Write(p)
+}
+
+func writeError(w http.ResponseWriter, status int, code httpmodel.ErrorCode, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	//nolint:errchkjson
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"error": map[string]string{
+			"code":    string(code),
+			"message": message,
+		},
+	})
+}
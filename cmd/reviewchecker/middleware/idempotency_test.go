@@ -0,0 +1,163 @@
+package middleware
+
+import (
+	"crypto/sha256"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestIdempotency(t *testing.T) {
+	const clientHeader = "Authorization"
+
+	newHandler := func(store *IdempotencyStore, status int) (http.Handler, *int) {
+		calls := 0
+
+		return Idempotency(store, clientHeader)(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			calls++
+
+			w.Header().Set("ETag", `"1"`)
+			w.WriteHeader(status)
+			_, _ = w.Write([]byte(`{"call":` + strconv.Itoa(calls) + `}`))
+		})), &calls
+	}
+
+	sendAs := func(h http.Handler, caller, key, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/pullRequest/create", strings.NewReader(body))
+		if key != "" {
+			req.Header.Set(IdempotencyKeyHeader, key)
+		}
+
+		if caller != "" {
+			req.Header.Set(clientHeader, caller)
+		}
+
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+
+		return rec
+	}
+
+	send := func(h http.Handler, key, body string) *httptest.ResponseRecorder {
+		return sendAs(h, "", key, body)
+	}
+
+	t.Run("Good: replay returns the original response", func(t *testing.T) {
+		handler, calls := newHandler(NewIdempotencyStore(time.Hour), http.StatusCreated)
+
+		first := send(handler, "k1", `{"id":1}`)
+		second := send(handler, "k1", `{"id":1}`)
+
+		require.Equal(t, 1, *calls)
+		require.Equal(t, http.StatusCreated, second.Code)
+		require.Equal(t, first.Body.String(), second.Body.String())
+		require.Equal(t, `"1"`, second.Header().Get("ETag"))
+		require.Equal(t, "true", second.Header().Get(IdempotentReplayedHeader))
+		require.Empty(t, first.Header().Get(IdempotentReplayedHeader))
+	})
+
+	t.Run("Good: requests without a key are not stored", func(t *testing.T) {
+		handler, calls := newHandler(NewIdempotencyStore(time.Hour), http.StatusCreated)
+
+		send(handler, "", `{}`)
+		send(handler, "", `{}`)
+
+		require.Equal(t, 2, *calls)
+	})
+
+	t.Run("Good: callers reusing a key do not share responses", func(t *testing.T) {
+		handler, calls := newHandler(NewIdempotencyStore(time.Hour), http.StatusCreated)
+
+		first := sendAs(handler, "Bearer ci-job-1", "k1", `{"id":1}`)
+		other := sendAs(handler, "Bearer ci-job-2", "k1", `{"id":2}`)
+		replayed := sendAs(handler, "Bearer ci-job-1", "k1", `{"id":1}`)
+
+		require.Equal(t, 2, *calls)
+		require.Equal(t, http.StatusCreated, other.Code)
+		require.Empty(t, other.Header().Get(IdempotentReplayedHeader))
+		require.NotEqual(t, first.Body.String(), other.Body.String())
+		require.Equal(t, first.Body.String(), replayed.Body.String())
+		require.Equal(t, "true", replayed.Header().Get(IdempotentReplayedHeader))
+	})
+
+	t.Run("Good: server errors can be retried", func(t *testing.T) {
+		handler, calls := newHandler(NewIdempotencyStore(time.Hour), http.StatusInternalServerError)
+
+		send(handler, "k1", `{}`)
+		send(handler, "k1", `{}`)
+
+		require.Equal(t, 2, *calls)
+	})
+
+	t.Run("Good: entries expire after ttl", func(t *testing.T) {
+		store := NewIdempotencyStore(time.Minute)
+		now := time.Now()
+		store.now = func() time.Time { return now }
+		handler, calls := newHandler(store, http.StatusCreated)
+
+		send(handler, "k1", `{}`)
+
+		now = now.Add(2 * time.Minute)
+		rec := send(handler, "k1", `{}`)
+
+		require.Equal(t, 2, *calls)
+		require.Empty(t, rec.Header().Get(IdempotentReplayedHeader))
+	})
+
+	t.Run("Good: responses marked no-store are not stored", func(t *testing.T) {
+		calls := 0
+		handler := Idempotency(NewIdempotencyStore(time.Hour), clientHeader)(
+			http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				calls++
+
+				w.Header().Set("Cache-Control", "no-store")
+				w.WriteHeader(http.StatusCreated)
+				_, _ = w.Write([]byte(`{"secret":"s3cr3t"}`))
+			}),
+		)
+
+		send(handler, "k1", `{}`)
+		rec := send(handler, "k1", `{}`)
+
+		require.Equal(t, 2, calls)
+		require.Empty(t, rec.Header().Get(IdempotentReplayedHeader))
+	})
+
+	t.Run("Bad: body too large", func(t *testing.T) {
+		handler, calls := newHandler(NewIdempotencyStore(time.Hour), http.StatusCreated)
+
+		rec := send(handler, "k1", strings.Repeat("x", maxIdempotentBodySize+1))
+
+		require.Equal(t, 0, *calls)
+		require.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+	})
+
+	t.Run("Bad: key reused with another body", func(t *testing.T) {
+		handler, calls := newHandler(NewIdempotencyStore(time.Hour), http.StatusCreated)
+
+		send(handler, "k1", `{"id":1}`)
+		rec := send(handler, "k1", `{"id":2}`)
+
+		require.Equal(t, 1, *calls)
+		require.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+		require.Contains(t, rec.Body.String(), "IDEMPOTENCY_KEY_REUSED")
+	})
+
+	t.Run("Bad: first attempt still in progress", func(t *testing.T) {
+		store := NewIdempotencyStore(time.Hour)
+		handler, calls := newHandler(store, http.StatusCreated)
+
+		state, _ := store.begin(idempotencyScope("/pullRequest/create", "", "k1"), sha256.Sum256(nil))
+		require.Equal(t, idempotencyNew, state)
+
+		rec := send(handler, "k1", ``)
+
+		require.Equal(t, 0, *calls)
+		require.Equal(t, http.StatusConflict, rec.Code)
+	})
+}
@@ -0,0 +1,57 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/6ermvH/avito-reviewchecker/internal/metrics"
+)
+
+// unmatchedRoute labels requests no route matched, so that unknown paths do
+// not create label values.
+const unmatchedRoute = "unmatched"
+
+// Metrics counts requests and observes their latency by method, route pattern
+// and status. It must be used by a chi router.
+func Metrics(registerer prometheus.Registerer) func(http.Handler) http.Handler {
+	labels := []string{"method", "route", "status"}
+
+	requests := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metrics.Namespace,
+		Subsystem: "http",
+		Name:      "requests_total",
+		Help:      "HTTP requests handled.",
+	}, labels)
+	duration := prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metrics.Namespace,
+		Subsystem: "http",
+		Name:      "request_duration_seconds",
+		Help:      "Time to handle HTTP requests, streamed responses included.",
+		Buckets:   prometheus.DefBuckets,
+	}, labels)
+
+	registerer.MustRegister(requests, duration)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			ww := &responseWriter{ResponseWriter: w, status: http.StatusOK}
+
+			next.ServeHTTP(ww, r)
+
+			// the pattern is known once the request is routed
+			route := chi.RouteContext(r.Context()).RoutePattern()
+			if route == "" {
+				route = unmatchedRoute
+			}
+
+			values := []string{r.Method, route, strconv.Itoa(ww.status)}
+			requests.WithLabelValues(values...).Inc()
+			duration.WithLabelValues(values...).Observe(time.Since(start).Seconds())
+		})
+	}
+}
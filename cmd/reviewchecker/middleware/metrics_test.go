@@ -0,0 +1,37 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetrics(t *testing.T) {
+	registry := prometheus.NewRegistry()
+
+	router := chi.NewRouter()
+	router.Use(Metrics(registry))
+	router.Get("/team/get", func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	})
+
+	for _, path := range []string{"/team/get?team_name=a", "/team/get?team_name=b", "/missing"} {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	err := testutil.GatherAndCompare(registry, strings.NewReader(`
+# HELP reviewchecker_http_requests_total HTTP requests handled.
+# TYPE reviewchecker_http_requests_total counter
+reviewchecker_http_requests_total{method="GET",route="/team/get",status="404"} 2
+reviewchecker_http_requests_total{method="GET",route="unmatched",status="404"} 1
+`), "reviewchecker_http_requests_total")
+	require.NoError(t, err)
+
+	require.Equal(t, 2, testutil.CollectAndCount(registry, "reviewchecker_http_request_duration_seconds"))
+}
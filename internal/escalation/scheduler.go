@@ -0,0 +1,92 @@
+// Package escalation periodically escalates reviewers who missed the review
+// SLA of their team.
+package escalation
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/6ermvH/avito-reviewchecker/internal/model"
+)
+
+// Service is the part of the service escalations are made by.
+type Service interface {
+	EscalateOverdueReviews(
+		ctx context.Context,
+		rule model.EscalationRule,
+		now time.Time,
+	) ([]model.Escalation, error)
+}
+
+// Scheduler checks the SLA of every team each Interval. Escalations are
+// recorded in the pull request history, so a restarted or second scheduler
+// does not escalate a review again.
+type Scheduler struct {
+	svc      Service
+	logger   *slog.Logger
+	rules    []model.EscalationRule
+	interval time.Duration
+	now      func() time.Time
+}
+
+func NewScheduler(
+	svc Service,
+	logger *slog.Logger,
+	rules []model.EscalationRule,
+	interval time.Duration,
+) *Scheduler {
+	return &Scheduler{
+		svc:      svc,
+		logger:   logger,
+		rules:    rules,
+		interval: interval,
+		now:      time.Now,
+	}
+}
+
+// Run escalates every interval until ctx is done.
+func (s *Scheduler) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.RunOnce(ctx); err != nil && ctx.Err() == nil {
+			s.logger.Error("escalate overdue reviews", "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunOnce escalates the overdue reviews of every team. A failing team does not
+// keep the others from being checked.
+func (s *Scheduler) RunOnce(ctx context.Context) error {
+	var errs []error
+
+	for _, rule := range s.rules {
+		escalations, err := s.svc.EscalateOverdueReviews(ctx, rule, s.now())
+
+		for _, e := range escalations {
+			s.logger.Info("review escalated",
+				"team", rule.TeamName,
+				"prID", e.PullRequestID,
+				"reviewerID", e.ReviewerID,
+				"assignedAt", e.AssignedAt,
+				"policy", e.Policy,
+				"newReviewerID", e.NewReviewerID,
+			)
+		}
+
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,157 @@
+package escalation
+
+import (
+	"context"
+	"log/slog"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/6ermvH/avito-reviewchecker/internal/model"
+	"github.com/6ermvH/avito-reviewchecker/internal/repository/memory"
+	"github.com/6ermvH/avito-reviewchecker/internal/usecase"
+)
+
+const sla = time.Hour
+
+func TestScheduler(t *testing.T) {
+	ctx := context.Background()
+
+	// setup creates pr-1 of u1 reviewed by u2 and u3 and returns the time it
+	// is done at; assignments made later by escalations are newer. u4 is
+	// activated afterwards to be free for reassignment.
+	setup := func(t *testing.T) (*usecase.Service, time.Time) {
+		t.Helper()
+
+		repo := memory.New()
+		_, err := repo.CreateTeam(ctx, "backend")
+		require.NoError(t, err)
+		require.NoError(t, repo.InsertTeamMembers(ctx, "backend", []model.User{
+			{ID: "u1", Username: "alice", IsActive: true},
+			{ID: "u2", Username: "bob", IsActive: true},
+			{ID: "u3", Username: "carol", IsActive: true},
+			{ID: "u4", Username: "dave", IsActive: false},
+		}))
+		_, err = repo.CreateTeam(ctx, "leads")
+		require.NoError(t, err)
+		require.NoError(t, repo.InsertTeamMembers(ctx, "leads", []model.User{
+			{ID: "l1", Username: "lena", IsActive: true},
+		}))
+
+		svc := usecase.New(repo, slog.New(slog.DiscardHandler))
+
+		_, err = svc.CreatePR(ctx, "pr-1", "Add search", "u1")
+		require.NoError(t, err)
+
+		_, err = svc.SetUserActive(ctx, "u4", true, model.ChangeInfo{})
+		require.NoError(t, err)
+
+		return svc, time.Now()
+	}
+
+	// run escalates once at now and returns the escalations in the history of
+	// pr-1.
+	run := func(
+		t *testing.T,
+		svc *usecase.Service,
+		rule model.EscalationRule,
+		now time.Time,
+	) []model.AssignmentEvent {
+		t.Helper()
+
+		scheduler := NewScheduler(
+			svc, slog.New(slog.DiscardHandler), []model.EscalationRule{rule}, time.Minute,
+		)
+		scheduler.now = func() time.Time { return now }
+		require.NoError(t, scheduler.RunOnce(ctx))
+
+		history, err := svc.GetPullRequestHistory(ctx, "pr-1")
+		require.NoError(t, err)
+
+		return slices.DeleteFunc(history, func(event model.AssignmentEvent) bool {
+			return !event.Type.IsEscalation()
+		})
+	}
+
+	t.Run("Good: overdue reviewers are notified once", func(t *testing.T) {
+		svc, start := setup(t)
+		rule := model.EscalationRule{TeamName: "backend", SLA: sla, Policy: model.EscalationNotify}
+
+		escalations := run(t, svc, rule, start.Add(2*sla))
+		require.Len(t, escalations, 2)
+
+		for _, event := range escalations {
+			require.Equal(t, model.AssignmentEventEscalationNotified, event.Type)
+			require.Contains(t, []string{"u2", "u3"}, event.OldReviewerID)
+			require.Equal(t, "no review within 1h", event.Reason)
+		}
+
+		require.Len(t, run(t, svc, rule, start.Add(3*sla)), 2, "reviews are escalated once")
+	})
+
+	t.Run("Good: reviews within the SLA are left alone", func(t *testing.T) {
+		svc, start := setup(t)
+
+		require.Empty(t, run(t, svc, model.EscalationRule{
+			TeamName: "backend",
+			SLA:      sla,
+			Policy:   model.EscalationNotify,
+		}, start.Add(sla/2)))
+	})
+
+	t.Run("Good: reassignment falls back to notifying without candidates", func(t *testing.T) {
+		svc, start := setup(t)
+		rule := model.EscalationRule{TeamName: "backend", SLA: sla, Policy: model.EscalationReassign}
+
+		escalations := run(t, svc, rule, start.Add(2*sla))
+		require.Len(t, escalations, 2)
+		require.Equal(t, model.AssignmentEventEscalationReassigned, escalations[0].Type)
+		require.Equal(t, "u4", escalations[0].NewReviewerID)
+		require.Equal(t, model.AssignmentEventEscalationNotified, escalations[1].Type,
+			"the escalated reviewer is not a candidate")
+
+		require.Len(t, run(t, svc, rule, start.Add(sla/2)), 2, "the replacement is within the SLA")
+	})
+
+	t.Run("Good: a new assignment is escalated again", func(t *testing.T) {
+		svc, start := setup(t)
+		rule := model.EscalationRule{TeamName: "backend", SLA: sla, Policy: model.EscalationReassign}
+
+		require.Len(t, run(t, svc, rule, start.Add(2*sla)), 2)
+
+		// the replacement was assigned after start
+		escalations := run(t, svc, rule, start.Add(sla+time.Minute))
+		require.Len(t, escalations, 3)
+		require.Equal(t, model.AssignmentEventEscalationNotified, escalations[2].Type)
+		require.Equal(t, "u4", escalations[2].OldReviewerID, "escalated reviewers are not candidates")
+	})
+
+	t.Run("Good: the team lead is added once", func(t *testing.T) {
+		svc, start := setup(t)
+		rule := model.EscalationRule{
+			TeamName: "backend",
+			SLA:      sla,
+			Policy:   model.EscalationAddLead,
+			LeadID:   "l1",
+		}
+
+		escalations := run(t, svc, rule, start.Add(2*sla))
+		require.Len(t, escalations, 2)
+		require.Equal(t, model.AssignmentEventEscalationLeadAdded, escalations[0].Type)
+		require.Equal(t, "l1", escalations[0].NewReviewerID)
+		require.Equal(t, model.AssignmentEventEscalationNotified, escalations[1].Type,
+			"the lead is already a reviewer")
+
+		reviews, err := svc.ReviewDigest(ctx, "l1")
+		require.NoError(t, err)
+		require.Len(t, reviews, 1)
+
+		require.Len(t, run(t, svc, rule, start.Add(4*sla)), 2, "a second tick escalates nobody again")
+
+		pr, err := svc.GetPullRequest(ctx, "pr-1")
+		require.NoError(t, err)
+		require.Len(t, pr.Reviewers, 3)
+	})
+}
@@ -0,0 +1,84 @@
+package httpserver
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/6ermvH/avito-reviewchecker/internal/model"
+	httpmodel "github.com/6ermvH/avito-reviewchecker/internal/model/http"
+	"github.com/6ermvH/avito-reviewchecker/internal/usecase"
+)
+
+var (
+	errInvalidIfMatch = errors.New("header If-Match must be * or a single ETag")
+	errWeakIfMatch    = errors.New("weak ETag never matches a pull request version")
+)
+
+func formatETag(version int) string {
+	return `"` + strconv.Itoa(version) + `"`
+}
+
+// parseIfMatch returns the pull request version required by the If-Match
+// header, or usecase.AnyVersion when the header is absent or "*".
+func parseIfMatch(r *http.Request) (int, error) {
+	raw := strings.TrimSpace(r.Header.Get("If-Match"))
+
+	switch {
+	case raw == "" || raw == "*":
+		return usecase.AnyVersion, nil
+	case strings.HasPrefix(raw, "W/"):
+		return 0, errWeakIfMatch
+	}
+
+	tag, ok := strings.CutPrefix(raw, `"`)
+	if !ok {
+		return 0, errInvalidIfMatch
+	}
+
+	tag, ok = strings.CutSuffix(tag, `"`)
+	if !ok {
+		return 0, errInvalidIfMatch
+	}
+
+	version, err := strconv.Atoi(tag)
+	if err != nil || version <= 0 {
+		return 0, errInvalidIfMatch
+	}
+
+	return version, nil
+}
+
+// readIfMatch writes the error response itself and reports whether the
+// handler may go on.
+func readIfMatch(w http.ResponseWriter, r *http.Request) (int, bool) {
+	version, err := parseIfMatch(r)
+
+	switch {
+	case errors.Is(err, errWeakIfMatch):
+		writeError(
+			w,
+			http.StatusPreconditionFailed,
+			string(httpmodel.ErrorCodePreconditionFailed),
+			err.Error(),
+		)
+
+		return 0, false
+	case err != nil:
+		writeError(
+			w,
+			http.StatusBadRequest,
+			string(httpmodel.ErrorCodeInvalidInput),
+			err.Error(),
+		)
+
+		return 0, false
+	}
+
+	return version, true
+}
+
+func setETag(w http.ResponseWriter, pr model.PullRequest) {
+	w.Header().Set("ETag", formatETag(pr.Version))
+}
@@ -0,0 +1,109 @@
+package httpserver
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/6ermvH/avito-reviewchecker/internal/model"
+	httpmodel "github.com/6ermvH/avito-reviewchecker/internal/model/http"
+)
+
+// streamHeartbeat keeps idle connections open through proxies.
+const streamHeartbeat = 15 * time.Second
+
+var errInvalidLastEventID = errors.New("header Last-Event-ID must be a non-negative integer")
+
+func HandleEventStream(svc Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		lastEventID, err := parseLastEventID(r)
+		if err != nil {
+			writeError(
+				w,
+				http.StatusBadRequest,
+				string(httpmodel.ErrorCodeInvalidInput),
+				err.Error(),
+			)
+
+			return
+		}
+
+		filter := model.StreamFilter{
+			TeamName: r.URL.Query().Get("team_name"),
+			UserID:   r.URL.Query().Get("user_id"),
+		}
+
+		backlog, events, err := svc.SubscribeEvents(r.Context(), filter, lastEventID)
+		if err != nil {
+			writeDomainError(w, err, map[string]int{})
+
+			return
+		}
+
+		rc := http.NewResponseController(w)
+		// the server write timeout would otherwise cut the stream
+		_ = rc.SetWriteDeadline(time.Time{})
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Connection", "keep-alive")
+		w.Header().Set("X-Accel-Buffering", "no")
+		w.WriteHeader(http.StatusOK)
+
+		for _, event := range backlog {
+			writeStreamEvent(w, event)
+		}
+
+		if rc.Flush() != nil {
+			return
+		}
+
+		heartbeat := time.NewTicker(streamHeartbeat)
+		defer heartbeat.Stop()
+
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case event, ok := <-events:
+				if !ok {
+					return
+				}
+
+				writeStreamEvent(w, event)
+			case <-heartbeat.C:
+				_, _ = fmt.Fprint(w, ": ping\n\n")
+			}
+
+			if rc.Flush() != nil {
+				return
+			}
+		}
+	}
+}
+
+// parseLastEventID reads the resume position from the Last-Event-ID header
+// sent by EventSource on reconnect, or from the last_event_id query parameter.
+func parseLastEventID(r *http.Request) (int64, error) {
+	raw := r.Header.Get("Last-Event-ID")
+	if raw == "" {
+		raw = r.URL.Query().Get("last_event_id")
+	}
+
+	if raw == "" {
+		return 0, nil
+	}
+
+	id, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil || id < 0 {
+		return 0, errInvalidLastEventID
+	}
+
+	return id, nil
+}
+
+func writeStreamEvent(w http.ResponseWriter, event model.StreamEvent) {
+	_, _ = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Type, event.Payload)
+}
@@ -0,0 +1,325 @@
+package httpserver
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"iter"
+	"log/slog"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	httpmodel "github.com/6ermvH/avito-reviewchecker/internal/model/http"
+)
+
+// exportFormat is the representation of a listing picked from the Accept
+// header.
+type exportFormat int
+
+const (
+	formatJSON exportFormat = iota
+	formatCSV
+	formatNDJSON
+)
+
+// exportFlushEvery is the number of records written between flushes, so
+// large exports reach the client while they are produced.
+const exportFlushEvery = 100
+
+var exportMediaTypes = map[string]exportFormat{
+	"application/json":     formatJSON,
+	"text/csv":             formatCSV,
+	"application/x-ndjson": formatNDJSON,
+}
+
+// negotiateFormat picks the supported media type of the Accept header with
+// the highest quality, the first one on ties. Anything else is JSON.
+func negotiateFormat(w http.ResponseWriter, r *http.Request) exportFormat {
+	w.Header().Add("Vary", "Accept")
+
+	best, bestQuality := formatJSON, 0.0
+
+	for _, mediaRange := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(mediaRange))
+		if err != nil {
+			continue
+		}
+
+		format, ok := exportMediaTypes[mediaType]
+		if !ok {
+			continue
+		}
+
+		quality := 1.0
+		if raw, ok := params["q"]; ok {
+			quality, err = strconv.ParseFloat(raw, 64)
+			if err != nil {
+				continue
+			}
+		}
+
+		if quality > bestQuality {
+			best, bestQuality = format, quality
+		}
+	}
+
+	return best
+}
+
+// exporter writes records as CSV rows or NDJSON lines.
+type exporter struct {
+	rc      *http.ResponseController
+	format  exportFormat
+	csv     *csv.Writer
+	json    *json.Encoder
+	written int
+}
+
+// newExporter starts a 200 response in format, CSV with the header row.
+func newExporter(w http.ResponseWriter, format exportFormat, header []string) *exporter {
+	e := &exporter{rc: http.NewResponseController(w), format: format}
+
+	if format == formatCSV {
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+
+		e.csv = csv.NewWriter(w)
+		_ = e.csv.Write(header)
+	} else {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		w.WriteHeader(http.StatusOK)
+
+		e.json = json.NewEncoder(w)
+	}
+
+	return e
+}
+
+// write adds record as an NDJSON line or row as a CSV row.
+func (e *exporter) write(record any, row []string) error {
+	var err error
+	if e.format == formatCSV {
+		err = e.csv.Write(row)
+	} else {
+		err = e.json.Encode(record)
+	}
+
+	if err != nil {
+		return fmt.Errorf("write export record: %w", err)
+	}
+
+	e.written++
+	if e.written%exportFlushEvery == 0 {
+		return e.flush()
+	}
+
+	return nil
+}
+
+func (e *exporter) flush() error {
+	if e.csv != nil {
+		e.csv.Flush()
+
+		if err := e.csv.Error(); err != nil {
+			return fmt.Errorf("flush export: %w", err)
+		}
+	}
+
+	// the writer may not support flushing, the rest is sent on return then
+	_ = e.rc.Flush()
+
+	return nil
+}
+
+// writeExport writes records in format as they are yielded, row renders a
+// record as a CSV row. A record error after the 200 has been sent is logged
+// and aborts the response, so the client sees a broken transfer instead of a
+// short file that looks complete.
+func writeExport[T any](
+	ctx context.Context,
+	w http.ResponseWriter,
+	format exportFormat,
+	header []string,
+	records iter.Seq2[T, error],
+	row func(T) []string,
+) {
+	e := newExporter(w, format, header)
+
+	for record, err := range records {
+		if err != nil {
+			_ = e.flush()
+
+			slog.ErrorContext(ctx, "export aborted", "written", e.written, "error", err)
+			panic(http.ErrAbortHandler)
+		}
+
+		if err := e.write(record, row(record)); err != nil {
+			return
+		}
+	}
+
+	_ = e.flush()
+}
+
+// exportRecords yields records mapped one at a time, so the response
+// representation of the whole listing is never built.
+func exportRecords[M, T any](records []M, mapRecord func(M) T) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		for _, record := range records {
+			if !yield(mapRecord(record), nil) {
+				return
+			}
+		}
+	}
+}
+
+// csvText keeps spreadsheets from evaluating free text as a formula.
+func csvText(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+
+	return value
+}
+
+func csvInt(value int) string {
+	return strconv.Itoa(value)
+}
+
+func csvFloat(value float64) string {
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
+
+var reviewerStatHeader = []string{
+	"user_id",
+	"username",
+	"team_name",
+	"is_active",
+	"total_assigned",
+	"open_assigned",
+	"last_assigned_at",
+	"days_since_last_review",
+}
+
+func reviewerStatRow(stat httpmodel.ReviewerStat) []string {
+	daysSinceLastReview := ""
+	if stat.DaysSinceLastReview != nil {
+		daysSinceLastReview = csvInt(*stat.DaysSinceLastReview)
+	}
+
+	return []string{
+		csvText(stat.UserID),
+		csvText(stat.Username),
+		csvText(stat.TeamName),
+		strconv.FormatBool(stat.IsActive),
+		csvInt(stat.TotalAssigned),
+		csvInt(stat.OpenAssigned),
+		stat.LastAssignedAt,
+		daysSinceLastReview,
+	}
+}
+
+// prStatsHeader flattens the totals of the pull request stats, the per author
+// and per team breakdowns are only part of the JSON representations.
+var prStatsHeader = []string{
+	"total",
+	"open",
+	"merged",
+	"average_reviewers",
+	"time_to_merge_p50_seconds",
+	"time_to_merge_p90_seconds",
+	"time_to_merge_p99_seconds",
+}
+
+func prStatsRow(stats httpmodel.PullRequestStatsResponse) []string {
+	row := []string{
+		csvInt(stats.Total),
+		csvInt(stats.Open),
+		csvInt(stats.Merged),
+		csvFloat(stats.AverageReview),
+		"",
+		"",
+		"",
+	}
+
+	if p := stats.TimeToMerge; p != nil {
+		row[4], row[5], row[6] = csvFloat(p.P50), csvFloat(p.P90), csvFloat(p.P99)
+	}
+
+	return row
+}
+
+var teamStatHeader = []string{
+	"team_name",
+	"open_prs",
+	"merged_prs",
+	"understaffed_prs",
+	"understaffed_share",
+	"active_members",
+	"inactive_members",
+	"min_open_assigned",
+	"max_open_assigned",
+	"mean_open_assigned",
+}
+
+func teamStatRow(stat httpmodel.TeamStat) []string {
+	return []string{
+		csvText(stat.TeamName),
+		csvInt(stat.PullRequests.Open),
+		csvInt(stat.PullRequests.Merged),
+		csvInt(stat.PullRequests.Understaffed),
+		csvFloat(stat.PullRequests.UnderstaffedShare),
+		csvInt(stat.Members.Active),
+		csvInt(stat.Members.Inactive),
+		csvInt(stat.OpenAssignments.Min),
+		csvInt(stat.OpenAssignments.Max),
+		csvFloat(stat.OpenAssignments.Mean),
+	}
+}
+
+var fairnessHeader = []string{
+	"team_name",
+	"active_members",
+	"total_assigned_mean",
+	"total_assigned_stddev",
+	"total_assigned_gini",
+	"open_assigned_mean",
+	"open_assigned_stddev",
+	"open_assigned_gini",
+	"outliers",
+}
+
+// fairnessRow lists the outliers by user id, separated by spaces.
+func fairnessRow(team httpmodel.TeamFairness) []string {
+	outliers := make([]string, 0, len(team.Outliers))
+	for _, outlier := range team.Outliers {
+		outliers = append(outliers, outlier.UserID)
+	}
+
+	return []string{
+		csvText(team.TeamName),
+		csvInt(team.ActiveMembers),
+		csvFloat(team.TotalAssigned.Mean),
+		csvFloat(team.TotalAssigned.StdDev),
+		csvFloat(team.TotalAssigned.Gini),
+		csvFloat(team.OpenAssigned.Mean),
+		csvFloat(team.OpenAssigned.StdDev),
+		csvFloat(team.OpenAssigned.Gini),
+		csvText(strings.Join(outliers, " ")),
+	}
+}
+
+var timeseriesHeader = []string{"start", "count"}
+
+func timeseriesRow(point httpmodel.TimeseriesPoint) []string {
+	return []string{point.Start, csvInt(point.Count)}
+}
+
+var pullRequestHeader = []string{"pull_request_id", "pull_request_name", "author_id", "status"}
+
+func pullRequestRow(pr httpmodel.PullRequestShort) []string {
+	return []string{csvText(pr.ID), csvText(pr.Name), csvText(pr.AuthorID), pr.Status}
+}
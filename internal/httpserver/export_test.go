@@ -0,0 +1,203 @@
+package httpserver
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/6ermvH/avito-reviewchecker/internal/model"
+	httpmodel "github.com/6ermvH/avito-reviewchecker/internal/model/http"
+)
+
+var errPageFailed = errors.New("page failed")
+
+// pagedReviews serves pages in order, the first from the handler call and
+// the rest for the cursors of the previous page. A page at failAt fails.
+type pagedReviews struct {
+	Service
+
+	pages   []model.PullRequestPage
+	failAt  int
+	cursors []*model.ReviewCursor
+}
+
+func (p *pagedReviews) ListReviews(
+	_ context.Context,
+	_ string,
+	filter model.ReviewFilter,
+) (model.PullRequestPage, error) {
+	call := len(p.cursors)
+	p.cursors = append(p.cursors, filter.After)
+
+	if call == p.failAt {
+		return model.PullRequestPage{}, errPageFailed
+	}
+
+	return p.pages[call], nil
+}
+
+func reviewPage(next string, prs ...model.PullRequest) model.PullRequestPage {
+	page := model.PullRequestPage{PullRequests: prs}
+	if next != "" {
+		page.Next = &model.ReviewCursor{CreatedAt: time.Unix(0, 0), ID: next}
+	}
+
+	return page
+}
+
+func exportRequest(accept string) *http.Request {
+	req := httptest.NewRequest(http.MethodGet, "/users/getReview?user_id=u2", nil)
+	req.Header.Set("Accept", accept)
+
+	return req
+}
+
+func ndjsonIDs(t *testing.T, body string) []string {
+	t.Helper()
+
+	var ids []string
+
+	scanner := bufio.NewScanner(strings.NewReader(body))
+	for scanner.Scan() {
+		var pr httpmodel.PullRequestShort
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &pr))
+
+		ids = append(ids, pr.ID)
+	}
+
+	return ids
+}
+
+func TestNegotiateFormat(t *testing.T) {
+	tests := []struct {
+		name   string
+		accept string
+		want   exportFormat
+	}{
+		{name: "no header", accept: "", want: formatJSON},
+		{name: "csv", accept: "text/csv", want: formatCSV},
+		{name: "ndjson", accept: "application/x-ndjson", want: formatNDJSON},
+		{name: "parameters", accept: "text/csv; charset=utf-8", want: formatCSV},
+		{name: "highest quality", accept: "text/csv;q=0.5, application/x-ndjson", want: formatNDJSON},
+		{name: "first on ties", accept: "application/x-ndjson, text/csv", want: formatNDJSON},
+		{name: "json preferred", accept: "application/json, text/csv;q=0.9", want: formatJSON},
+		{name: "unsupported", accept: "text/html, */*", want: formatJSON},
+		{name: "invalid quality", accept: "text/csv;q=high", want: formatJSON},
+		{name: "malformed range", accept: "text/csv;;, application/x-ndjson", want: formatNDJSON},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, "/stats/reviewers", nil)
+			req.Header.Set("Accept", tt.accept)
+
+			require.Equal(t, tt.want, negotiateFormat(rec, req))
+			require.Equal(t, "Accept", rec.Header().Get("Vary"))
+		})
+	}
+}
+
+func TestExportCSV(t *testing.T) {
+	svc := &pagedReviews{failAt: -1}
+	page := reviewPage("",
+		model.PullRequest{ID: "pr-1", Name: `Fix "quotes", commas`, AuthorID: "u1",
+			Status: model.PRStatusOpen},
+		model.PullRequest{ID: "pr-2", Name: "two\nlines", AuthorID: "u1",
+			Status: model.PRStatusMerged},
+		model.PullRequest{ID: "pr-3", Name: `=HYPERLINK("x")`, AuthorID: "-u1",
+			Status: model.PRStatusOpen},
+	)
+
+	rec := httptest.NewRecorder()
+	writeExport(
+		context.Background(),
+		rec,
+		formatCSV,
+		pullRequestHeader,
+		reviewRecords(context.Background(), svc, "u2", model.ReviewFilter{}, page),
+		pullRequestRow,
+	)
+
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, "text/csv; charset=utf-8", rec.Header().Get("Content-Type"))
+	require.Equal(t, "pull_request_id,pull_request_name,author_id,status\n"+
+		"pr-1,\"Fix \"\"quotes\"\", commas\",u1,OPEN\n"+
+		"pr-2,\"two\nlines\",u1,MERGED\n"+
+		"pr-3,\"'=HYPERLINK(\"\"x\"\")\",'-u1,OPEN\n",
+		rec.Body.String())
+	require.Empty(t, svc.cursors)
+}
+
+func TestExportReviewPages(t *testing.T) {
+	t.Run("Good: every page is written", func(t *testing.T) {
+		svc := &pagedReviews{
+			pages: []model.PullRequestPage{
+				reviewPage("pr-2", model.PullRequest{ID: "pr-2"}),
+				reviewPage("", model.PullRequest{ID: "pr-3"}, model.PullRequest{ID: "pr-4"}),
+			},
+			failAt: -1,
+		}
+
+		rec := httptest.NewRecorder()
+		writeExport(
+			context.Background(),
+			rec,
+			formatNDJSON,
+			pullRequestHeader,
+			reviewRecords(context.Background(), svc, "u2", model.ReviewFilter{},
+				reviewPage("pr-1", model.PullRequest{ID: "pr-1"})),
+			pullRequestRow,
+		)
+
+		require.Equal(t, "application/x-ndjson", rec.Header().Get("Content-Type"))
+		require.Equal(t, []string{"pr-1", "pr-2", "pr-3", "pr-4"}, ndjsonIDs(t, rec.Body.String()))
+		require.Len(t, svc.cursors, 2)
+		require.Equal(t, "pr-1", svc.cursors[0].ID)
+		require.Equal(t, "pr-2", svc.cursors[1].ID)
+	})
+
+	t.Run("Bad: a failed page aborts the response", func(t *testing.T) {
+		svc := &pagedReviews{
+			pages:  []model.PullRequestPage{reviewPage("pr-2", model.PullRequest{ID: "pr-2"})},
+			failAt: 1,
+		}
+
+		rec := httptest.NewRecorder()
+		require.PanicsWithValue(t, http.ErrAbortHandler, func() {
+			writeExport(
+				context.Background(),
+				rec,
+				formatNDJSON,
+				pullRequestHeader,
+				reviewRecords(context.Background(), svc, "u2", model.ReviewFilter{},
+					reviewPage("pr-1", model.PullRequest{ID: "pr-1"})),
+				pullRequestRow,
+			)
+		})
+
+		require.Equal(t, []string{"pr-1", "pr-2"}, ndjsonIDs(t, rec.Body.String()))
+	})
+
+	t.Run("Good: the handler follows the cursors of the service", func(t *testing.T) {
+		svc := newTestService(t)
+		_, err := svc.CreatePR(context.Background(), "pr-3", "Add filters", "u1")
+		require.NoError(t, err)
+
+		rec := httptest.NewRecorder()
+		req := exportRequest("application/x-ndjson")
+		req.URL.RawQuery += "&limit=1"
+		HandleGetUserReview(svc).ServeHTTP(rec, req)
+
+		require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+		require.ElementsMatch(t, []string{"pr-1", "pr-3"}, ndjsonIDs(t, rec.Body.String()))
+	})
+}
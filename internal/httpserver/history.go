@@ -0,0 +1,54 @@
+package httpserver
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/6ermvH/avito-reviewchecker/internal/model"
+	httpmodel "github.com/6ermvH/avito-reviewchecker/internal/model/http"
+)
+
+func HandlePullRequestHistory(svc Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		prID := r.URL.Query().Get("pull_request_id")
+		if prID == "" {
+			writeError(
+				w,
+				http.StatusBadRequest,
+				string(httpmodel.ErrorCodeInvalidInput),
+				"pull_request_id is required",
+			)
+
+			return
+		}
+
+		events, err := svc.GetPullRequestHistory(r.Context(), prID)
+		if err != nil {
+			writeDomainError(w, err, map[string]int{})
+
+			return
+		}
+
+		writeJSON(w, http.StatusOK, httpmodel.PullRequestHistoryResponse{
+			PullRequestID: prID,
+			Events:        mapAssignmentEvents(events),
+		})
+	}
+}
+
+func mapAssignmentEvents(events []model.AssignmentEvent) []httpmodel.AssignmentEvent {
+	resp := make([]httpmodel.AssignmentEvent, 0, len(events))
+	for _, event := range events {
+		resp = append(resp, httpmodel.AssignmentEvent{
+			EventID:       event.ID,
+			Type:          string(event.Type),
+			OldReviewerID: event.OldReviewerID,
+			NewReviewerID: event.NewReviewerID,
+			ActorID:       event.ActorID,
+			Reason:        event.Reason,
+			CreatedAt:     event.CreatedAt.UTC().Format(time.RFC3339),
+		})
+	}
+
+	return resp
+}
@@ -0,0 +1,122 @@
+package httpserver
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"iter"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/6ermvH/avito-reviewchecker/internal/model"
+	httpmodel "github.com/6ermvH/avito-reviewchecker/internal/model/http"
+)
+
+const cursorSeparator = "|"
+
+var (
+	errInvalidStatus = errors.New("status must be OPEN or MERGED")
+	errInvalidLimit  = errors.New("limit must be a positive integer")
+	errInvalidCursor = errors.New("invalid cursor")
+)
+
+func parseReviewFilter(r *http.Request) (model.ReviewFilter, error) {
+	query := r.URL.Query()
+
+	var filter model.ReviewFilter
+
+	switch status := model.PRStatus(query.Get("status")); status {
+	case "":
+	case model.PRStatusOpen, model.PRStatusMerged:
+		filter.Status = status
+	default:
+		return model.ReviewFilter{}, errInvalidStatus
+	}
+
+	if raw := query.Get("limit"); raw != "" {
+		limit, err := strconv.Atoi(raw)
+		if err != nil || limit <= 0 {
+			return model.ReviewFilter{}, errInvalidLimit
+		}
+
+		filter.Limit = limit
+	}
+
+	if raw := query.Get("cursor"); raw != "" {
+		cursor, err := decodeReviewCursor(raw)
+		if err != nil {
+			return model.ReviewFilter{}, err
+		}
+
+		filter.After = &cursor
+	}
+
+	return filter, nil
+}
+
+// reviewRecords yields page and the pages after it, fetching the next page
+// once the previous one is consumed. A failed page is yielded as the error.
+func reviewRecords(
+	ctx context.Context,
+	svc Service,
+	userID string,
+	filter model.ReviewFilter,
+	page model.PullRequestPage,
+) iter.Seq2[httpmodel.PullRequestShort, error] {
+	return func(yield func(httpmodel.PullRequestShort, error) bool) {
+		for {
+			for _, pr := range page.PullRequests {
+				if !yield(mapPRShort(pr), nil) {
+					return
+				}
+			}
+
+			if page.Next == nil {
+				return
+			}
+
+			filter.After = page.Next
+
+			var err error
+
+			page, err = svc.ListReviews(ctx, userID, filter)
+			if err != nil {
+				yield(httpmodel.PullRequestShort{}, fmt.Errorf("list reviews: %w", err))
+
+				return
+			}
+		}
+	}
+}
+
+func encodeReviewCursor(cursor *model.ReviewCursor) string {
+	if cursor == nil {
+		return ""
+	}
+
+	raw := cursor.CreatedAt.UTC().Format(time.RFC3339Nano) + cursorSeparator + cursor.ID
+
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeReviewCursor(value string) (model.ReviewCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return model.ReviewCursor{}, errInvalidCursor
+	}
+
+	createdAt, id, ok := strings.Cut(string(raw), cursorSeparator)
+	if !ok || id == "" {
+		return model.ReviewCursor{}, errInvalidCursor
+	}
+
+	ts, err := time.Parse(time.RFC3339Nano, createdAt)
+	if err != nil {
+		return model.ReviewCursor{}, errInvalidCursor
+	}
+
+	return model.ReviewCursor{CreatedAt: ts, ID: id}, nil
+}
@@ -0,0 +1,69 @@
+package httpserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/6ermvH/avito-reviewchecker/internal/model"
+	httpmodel "github.com/6ermvH/avito-reviewchecker/internal/model/http"
+	mocks_repository "github.com/6ermvH/avito-reviewchecker/internal/repository/mocks"
+	"github.com/6ermvH/avito-reviewchecker/internal/usecase"
+)
+
+func TestGetUserReview(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	repo := mocks_repository.NewMockRepository(ctrl)
+	h := HandleGetUserReview(usecase.New(repo, slog.New(slog.DiscardHandler)))
+
+	t.Run("Good: no limit and cursor return every review", func(t *testing.T) {
+		// more than the default page size
+		prs := make([]model.PullRequest, 0, 120)
+		for i := range cap(prs) {
+			prs = append(prs, model.PullRequest{
+				ID:        fmt.Sprintf("pr-%03d", i),
+				Status:    model.PRStatusOpen,
+				CreatedAt: time.Unix(int64(i), 0),
+			})
+		}
+
+		repo.EXPECT().
+			ListReviewerPullRequests(gomock.Any(), "u2", model.ReviewFilter{}).
+			Return(prs, nil)
+
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/users/getReview?user_id=u2", nil))
+
+		require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+		var resp httpmodel.UserReviewsResponse
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+		require.Len(t, resp.PullRequests, len(prs))
+		require.Empty(t, resp.NextCursor)
+	})
+
+	t.Run("Good: limit pages the reviews", func(t *testing.T) {
+		repo.EXPECT().
+			ListReviewerPullRequests(gomock.Any(), "u2", model.ReviewFilter{Limit: 2}).
+			Return([]model.PullRequest{{ID: "pr-1"}, {ID: "pr-2"}}, nil)
+
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/users/getReview?user_id=u2&limit=1", nil))
+
+		require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+		var resp httpmodel.UserReviewsResponse
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+		require.Len(t, resp.PullRequests, 1)
+		require.NotEmpty(t, resp.NextCursor)
+	})
+}
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"errors"
 	"net/http"
+	"net/mail"
 	"time"
 
 	"github.com/6ermvH/avito-reviewchecker/internal/model"
@@ -16,13 +17,65 @@ import (
 type Service interface {
 	UpdateTeam(ctx context.Context, teamName string, users []model.User) error
 	GetTeam(ctx context.Context, teamName string) (model.Team, []model.User, error)
-	ListReviews(ctx context.Context, userID string) ([]model.PullRequest, error)
-	SetUserActive(ctx context.Context, userID string, active bool) (model.User, error)
+	ListReviews(
+		ctx context.Context,
+		userID string,
+		filter model.ReviewFilter,
+	) (model.PullRequestPage, error)
+	SetUserActive(
+		ctx context.Context,
+		userID string,
+		active bool,
+		info model.ChangeInfo,
+	) (model.User, error)
 	CreatePR(ctx context.Context, prID, prName, authorID string) (model.PullRequest, error)
-	MergePR(ctx context.Context, prID string) (model.PullRequest, error)
-	ReassignReviewer(ctx context.Context, prID, oldUserID string) (model.PullRequest, string, error)
-	ListReviewerStats(ctx context.Context) ([]model.ReviewerStat, error)
-	GetPullRequestStats(ctx context.Context) (model.PullRequestStats, error)
+	GetPullRequest(ctx context.Context, prID string) (model.PullRequest, error)
+	MergePR(
+		ctx context.Context,
+		prID string,
+		expectedVersion int,
+		info model.ChangeInfo,
+	) (model.PullRequest, error)
+	ReassignReviewer(
+		ctx context.Context,
+		prID, oldUserID string,
+		expectedVersion int,
+		info model.ChangeInfo,
+	) (model.PullRequest, string, error)
+	GetPullRequestHistory(ctx context.Context, prID string) ([]model.AssignmentEvent, error)
+	ListReviewerStats(ctx context.Context, filter model.StatsFilter) ([]model.ReviewerStat, error)
+	GetPullRequestStats(
+		ctx context.Context,
+		filter model.StatsFilter,
+	) (model.PullRequestStats, error)
+	ListTeamStats(ctx context.Context, filter model.StatsFilter) ([]model.TeamStat, error)
+	ReviewFairness(
+		ctx context.Context,
+		filter model.StatsFilter,
+		sigma float64,
+	) ([]model.TeamFairness, error)
+	ListTimeseries(
+		ctx context.Context,
+		metric model.TimeseriesMetric,
+		bucket model.TimeseriesBucket,
+		filter model.StatsFilter,
+	) ([]model.TimeseriesPoint, error)
+	CreateWebhookSubscription(
+		ctx context.Context,
+		url, secret string,
+		eventTypes []model.DomainEventType,
+	) (model.WebhookSubscription, error)
+	ListWebhookSubscriptions(ctx context.Context) ([]model.WebhookSubscription, error)
+	DeleteWebhookSubscription(ctx context.Context, id string) error
+	ListWebhookDeliveries(
+		ctx context.Context,
+		filter model.DeliveryFilter,
+	) ([]model.WebhookDelivery, error)
+	SubscribeEvents(
+		ctx context.Context,
+		filter model.StreamFilter,
+		lastEventID int64,
+	) ([]model.StreamEvent, <-chan model.StreamEvent, error)
 }
 
 func HandleTeamAdd(svc Service) http.HandlerFunc {
@@ -136,7 +189,10 @@ func HandleSetUserActive(svc Service) http.HandlerFunc {
 			return
 		}
 
-		user, err := svc.SetUserActive(r.Context(), req.UserID, req.IsActive)
+		user, err := svc.SetUserActive(r.Context(), req.UserID, req.IsActive, model.ChangeInfo{
+			ActorID: req.ActorID,
+			Reason:  req.Reason,
+		})
 		if err != nil {
 			writeDomainError(w, err, map[string]int{
 				repository.ErrNotFound.Error(): http.StatusNotFound,
@@ -165,16 +221,42 @@ func HandleGetUserReview(svc Service) http.HandlerFunc {
 			return
 		}
 
-		prs, err := svc.ListReviews(r.Context(), userID)
+		filter, err := parseReviewFilter(r)
+		if err != nil {
+			writeError(
+				w,
+				http.StatusBadRequest,
+				string(httpmodel.ErrorCodeInvalidInput),
+				err.Error(),
+			)
+
+			return
+		}
+
+		page, err := svc.ListReviews(r.Context(), userID, filter)
 		if err != nil {
 			writeDomainError(w, err, map[string]int{})
 
 			return
 		}
 
+		if format := negotiateFormat(w, r); format != formatJSON {
+			writeExport(
+				r.Context(),
+				w,
+				format,
+				pullRequestHeader,
+				reviewRecords(r.Context(), svc, userID, filter, page),
+				pullRequestRow,
+			)
+
+			return
+		}
+
 		writeJSON(w, http.StatusOK, httpmodel.UserReviewsResponse{
 			UserID:       userID,
-			PullRequests: mapPRShortList(prs),
+			PullRequests: mapPRShortList(page.PullRequests),
+			NextCursor:   encodeReviewCursor(page.Next),
 		})
 	}
 }
@@ -211,12 +293,43 @@ func HandleCreatePR(svc Service) http.HandlerFunc {
 			return
 		}
 
+		setETag(w, pr)
 		writeJSON(w, http.StatusCreated, httpmodel.PullRequestResponse{
 			PR: mapPRResponse(pr),
 		})
 	}
 }
 
+// HandleGetPR returns the pull request with its version in the ETag header,
+// the value for If-Match of merge and reassign.
+func HandleGetPR(svc Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		prID := r.URL.Query().Get("pull_request_id")
+		if prID == "" {
+			writeError(
+				w,
+				http.StatusBadRequest,
+				string(httpmodel.ErrorCodeInvalidInput),
+				"pull_request_id is required",
+			)
+
+			return
+		}
+
+		pr, err := svc.GetPullRequest(r.Context(), prID)
+		if err != nil {
+			writeDomainError(w, err, map[string]int{})
+
+			return
+		}
+
+		setETag(w, pr)
+		writeJSON(w, http.StatusOK, httpmodel.PullRequestResponse{
+			PR: mapPRResponse(pr),
+		})
+	}
+}
+
 func HandleMergePR(svc Service) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		var req httpmodel.PullRequestMergeRequest
@@ -242,7 +355,15 @@ func HandleMergePR(svc Service) http.HandlerFunc {
 			return
 		}
 
-		pr, err := svc.MergePR(r.Context(), req.ID)
+		expectedVersion, ok := readIfMatch(w, r)
+		if !ok {
+			return
+		}
+
+		pr, err := svc.MergePR(r.Context(), req.ID, expectedVersion, model.ChangeInfo{
+			ActorID: req.ActorID,
+			Reason:  req.Reason,
+		})
 		if err != nil {
 			writeDomainError(w, err, map[string]int{
 				repository.ErrNotFound.Error(): http.StatusNotFound,
@@ -252,6 +373,7 @@ func HandleMergePR(svc Service) http.HandlerFunc {
 			return
 		}
 
+		setETag(w, pr)
 		writeJSON(w, http.StatusOK, httpmodel.PullRequestResponse{
 			PR: mapPRResponse(pr),
 		})
@@ -283,7 +405,18 @@ func HandleReassignPR(svc Service) http.HandlerFunc {
 			return
 		}
 
-		pr, newReviewer, err := svc.ReassignReviewer(r.Context(), req.ID, req.OldUserID)
+		expectedVersion, ok := readIfMatch(w, r)
+		if !ok {
+			return
+		}
+
+		pr, newReviewer, err := svc.ReassignReviewer(
+			r.Context(),
+			req.ID,
+			req.OldUserID,
+			expectedVersion,
+			model.ChangeInfo{ActorID: req.ActorID, Reason: req.Reason},
+		)
 		if err != nil {
 			writeDomainError(w, err, map[string]int{
 				repository.ErrNotFound.Error():            http.StatusNotFound,
@@ -295,6 +428,7 @@ func HandleReassignPR(svc Service) http.HandlerFunc {
 			return
 		}
 
+		setETag(w, pr)
 		writeJSON(w, http.StatusOK, httpmodel.PullRequestResponse{
 			PR:         mapPRResponse(pr),
 			ReplacedBy: newReviewer,
@@ -333,6 +467,12 @@ func writeDomainError(w http.ResponseWriter, err error, overrides map[string]int
 	case errors.Is(err, usecase.ErrPullRequestExists):
 		status = http.StatusConflict
 		code = httpmodel.ErrorCodePRExists
+	case errors.Is(err, usecase.ErrConflict):
+		status = http.StatusConflict
+		code = httpmodel.ErrorCodeConflict
+	case errors.Is(err, usecase.ErrVersionMismatch):
+		status = http.StatusPreconditionFailed
+		code = httpmodel.ErrorCodePreconditionFailed
 	}
 
 	if customStatus, ok := overrides[err.Error()]; ok {
@@ -367,6 +507,7 @@ func mapTeamResponse(team model.Team, members []model.User) httpmodel.Team {
 		payload.Members = append(payload.Members, httpmodel.TeamMember{
 			UserID:   member.ID,
 			Username: member.Username,
+			Email:    member.Email,
 			IsActive: member.IsActive,
 		})
 	}
@@ -379,6 +520,7 @@ func mapUserResponse(user model.User) httpmodel.User {
 		UserID:   user.ID,
 		Username: user.Username,
 		TeamName: user.TeamName,
+		Email:    user.Email,
 		IsActive: user.IsActive,
 	}
 }
@@ -405,21 +547,26 @@ func mapPRResponse(pr model.PullRequest) httpmodel.PullRequest {
 func mapPRShortList(prs []model.PullRequest) []httpmodel.PullRequestShort {
 	resp := make([]httpmodel.PullRequestShort, 0, len(prs))
 	for _, pr := range prs {
-		resp = append(resp, httpmodel.PullRequestShort{
-			ID:       pr.ID,
-			Name:     pr.Name,
-			AuthorID: pr.AuthorID,
-			Status:   string(pr.Status),
-		})
+		resp = append(resp, mapPRShort(pr))
 	}
 
 	return resp
 }
 
+func mapPRShort(pr model.PullRequest) httpmodel.PullRequestShort {
+	return httpmodel.PullRequestShort{
+		ID:       pr.ID,
+		Name:     pr.Name,
+		AuthorID: pr.AuthorID,
+		Status:   string(pr.Status),
+	}
+}
+
 var (
 	errUserIDRequired     = errors.New("user_id is required")
 	errUsernameRequired   = errors.New("username is required")
 	errDuplicateMemberIDs = errors.New("duplicate user_id in members")
+	errInvalidEmail       = errors.New("email is not a valid address")
 )
 
 func buildTeamUsers(members []httpmodel.TeamMember) ([]model.User, error) {
@@ -434,6 +581,10 @@ func buildTeamUsers(members []httpmodel.TeamMember) ([]model.User, error) {
 			return nil, errUsernameRequired
 		}
 
+		if member.Email != "" && !validEmail(member.Email) {
+			return nil, errInvalidEmail
+		}
+
 		if _, exists := seen[member.UserID]; exists {
 			return nil, errDuplicateMemberIDs
 		}
@@ -443,9 +594,17 @@ func buildTeamUsers(members []httpmodel.TeamMember) ([]model.User, error) {
 		users = append(users, model.User{
 			ID:       member.UserID,
 			Username: member.Username,
+			Email:    member.Email,
 			IsActive: member.IsActive,
 		})
 	}
 
 	return users, nil
 }
+
+// validEmail reports whether email is a bare address, without a display name.
+func validEmail(email string) bool {
+	addr, err := mail.ParseAddress(email)
+
+	return err == nil && addr.Address == email
+}
@@ -1,21 +1,66 @@
 package httpserver
 
 import (
+	"cmp"
+	"errors"
+	"math"
 	"net/http"
+	"slices"
+	"strconv"
+	"time"
 
 	"github.com/6ermvH/avito-reviewchecker/internal/model"
 	httpmodel "github.com/6ermvH/avito-reviewchecker/internal/model/http"
 )
 
+// defaultFairnessSigma is the distance from the mean in standard deviations
+// past which a reviewer is an outlier when the sigma parameter is omitted.
+const defaultFairnessSigma = 2.0
+
+var (
+	errInvalidSigma     = errors.New("sigma must be a positive number")
+	errInvalidMetric    = errors.New("metric must be prs_created, prs_merged or assignments")
+	errInvalidBucket    = errors.New("bucket must be day or week")
+	errInvalidFrom      = errors.New("from must be an RFC 3339 timestamp")
+	errInvalidTo        = errors.New("to must be an RFC 3339 timestamp")
+	errInvalidTimeRange = errors.New("from must be before to")
+	errTeamMismatch     = errors.New("team and team_name must be equal")
+)
+
 func HandleReviewerStats(svc Service) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		stats, err := svc.ListReviewerStats(r.Context())
+		filter, err := parseStatsFilter(r)
+		if err != nil {
+			writeError(
+				w,
+				http.StatusBadRequest,
+				string(httpmodel.ErrorCodeInvalidInput),
+				err.Error(),
+			)
+
+			return
+		}
+
+		stats, err := svc.ListReviewerStats(r.Context(), filter)
 		if err != nil {
 			writeDomainError(w, err, map[string]int{})
 
 			return
 		}
 
+		if format := negotiateFormat(w, r); format != formatJSON {
+			writeExport(
+				r.Context(),
+				w,
+				format,
+				reviewerStatHeader,
+				exportRecords(stats, mapReviewerStat),
+				reviewerStatRow,
+			)
+
+			return
+		}
+
 		writeJSON(w, http.StatusOK, httpmodel.ReviewerStatsResponse{
 			Reviewers: mapReviewerStats(stats),
 		})
@@ -24,32 +69,287 @@ func HandleReviewerStats(svc Service) http.HandlerFunc {
 
 func HandlePullRequestStats(svc Service) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		stats, err := svc.GetPullRequestStats(r.Context())
+		filter, err := parseStatsFilter(r)
+		if err != nil {
+			writeError(
+				w,
+				http.StatusBadRequest,
+				string(httpmodel.ErrorCodeInvalidInput),
+				err.Error(),
+			)
+
+			return
+		}
+
+		stats, err := svc.GetPullRequestStats(r.Context(), filter)
 		if err != nil {
 			writeDomainError(w, err, map[string]int{})
 
 			return
 		}
 
+		if format := negotiateFormat(w, r); format != formatJSON {
+			writeExport(
+				r.Context(),
+				w,
+				format,
+				prStatsHeader,
+				exportRecords([]model.PullRequestStats{stats}, mapPRStats),
+				prStatsRow,
+			)
+
+			return
+		}
+
 		writeJSON(w, http.StatusOK, mapPRStats(stats))
 	}
 }
 
+func HandleTeamStats(svc Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		filter, err := parseStatsFilter(r)
+		if err != nil {
+			writeError(
+				w,
+				http.StatusBadRequest,
+				string(httpmodel.ErrorCodeInvalidInput),
+				err.Error(),
+			)
+
+			return
+		}
+
+		stats, err := svc.ListTeamStats(r.Context(), filter)
+		if err != nil {
+			writeDomainError(w, err, map[string]int{})
+
+			return
+		}
+
+		if format := negotiateFormat(w, r); format != formatJSON {
+			writeExport(
+				r.Context(),
+				w,
+				format,
+				teamStatHeader,
+				exportRecords(stats, mapTeamStat),
+				teamStatRow,
+			)
+
+			return
+		}
+
+		writeJSON(w, http.StatusOK, httpmodel.TeamStatsResponse{
+			Teams: mapTeamStats(stats),
+		})
+	}
+}
+
+func HandleFairness(svc Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		filter, err := parseStatsFilter(r)
+		if err != nil {
+			writeError(
+				w,
+				http.StatusBadRequest,
+				string(httpmodel.ErrorCodeInvalidInput),
+				err.Error(),
+			)
+
+			return
+		}
+
+		sigma, err := parseSigma(r)
+		if err != nil {
+			writeError(
+				w,
+				http.StatusBadRequest,
+				string(httpmodel.ErrorCodeInvalidInput),
+				err.Error(),
+			)
+
+			return
+		}
+
+		fairness, err := svc.ReviewFairness(r.Context(), filter, sigma)
+		if err != nil {
+			writeDomainError(w, err, map[string]int{})
+
+			return
+		}
+
+		if format := negotiateFormat(w, r); format != formatJSON {
+			writeExport(
+				r.Context(),
+				w,
+				format,
+				fairnessHeader,
+				exportRecords(fairness, mapTeamFairness),
+				fairnessRow,
+			)
+
+			return
+		}
+
+		writeJSON(w, http.StatusOK, httpmodel.FairnessResponse{
+			Sigma: sigma,
+			Teams: mapFairness(fairness),
+		})
+	}
+}
+
+func HandleTimeseries(svc Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		filter, err := parseStatsFilter(r)
+		if err != nil {
+			writeError(
+				w,
+				http.StatusBadRequest,
+				string(httpmodel.ErrorCodeInvalidInput),
+				err.Error(),
+			)
+
+			return
+		}
+
+		metric, bucket, err := parseTimeseries(r)
+		if err != nil {
+			writeError(
+				w,
+				http.StatusBadRequest,
+				string(httpmodel.ErrorCodeInvalidInput),
+				err.Error(),
+			)
+
+			return
+		}
+
+		points, err := svc.ListTimeseries(r.Context(), metric, bucket, filter)
+		if err != nil {
+			writeDomainError(w, err, map[string]int{})
+
+			return
+		}
+
+		if format := negotiateFormat(w, r); format != formatJSON {
+			writeExport(
+				r.Context(),
+				w,
+				format,
+				timeseriesHeader,
+				exportRecords(points, mapTimeseriesPoint),
+				timeseriesRow,
+			)
+
+			return
+		}
+
+		writeJSON(w, http.StatusOK, httpmodel.TimeseriesResponse{
+			Metric: string(metric),
+			Bucket: string(bucket),
+			Points: mapTimeseries(points),
+		})
+	}
+}
+
+// parseTimeseries reads the required metric and the optional bucket query
+// parameters, buckets are days by default.
+func parseTimeseries(r *http.Request) (model.TimeseriesMetric, model.TimeseriesBucket, error) {
+	query := r.URL.Query()
+
+	metric := model.TimeseriesMetric(query.Get("metric"))
+	if !slices.Contains(model.TimeseriesMetrics, metric) {
+		return "", "", errInvalidMetric
+	}
+
+	switch bucket := model.TimeseriesBucket(query.Get("bucket")); bucket {
+	case "":
+		return metric, model.BucketDay, nil
+	case model.BucketDay, model.BucketWeek:
+		return metric, bucket, nil
+	default:
+		return "", "", errInvalidBucket
+	}
+}
+
+// parseSigma reads the optional sigma query parameter.
+func parseSigma(r *http.Request) (float64, error) {
+	raw := r.URL.Query().Get("sigma")
+	if raw == "" {
+		return defaultFairnessSigma, nil
+	}
+
+	sigma, err := strconv.ParseFloat(raw, 64)
+	if err != nil || math.IsNaN(sigma) || math.IsInf(sigma, 0) || sigma <= 0 {
+		return 0, errInvalidSigma
+	}
+
+	return sigma, nil
+}
+
+// parseStatsFilter reads the optional from, to and team query parameters.
+// team_name is accepted as an alias of team.
+func parseStatsFilter(r *http.Request) (model.StatsFilter, error) {
+	query := r.URL.Query()
+
+	team, alias := query.Get("team"), query.Get("team_name")
+	if team != "" && alias != "" && team != alias {
+		return model.StatsFilter{}, errTeamMismatch
+	}
+
+	filter := model.StatsFilter{TeamName: cmp.Or(team, alias)}
+
+	if raw := query.Get("from"); raw != "" {
+		from, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			return model.StatsFilter{}, errInvalidFrom
+		}
+
+		filter.From = &from
+	}
+
+	if raw := query.Get("to"); raw != "" {
+		to, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			return model.StatsFilter{}, errInvalidTo
+		}
+
+		filter.To = &to
+	}
+
+	if filter.From != nil && filter.To != nil && !filter.From.Before(*filter.To) {
+		return model.StatsFilter{}, errInvalidTimeRange
+	}
+
+	return filter, nil
+}
+
 func mapReviewerStats(stats []model.ReviewerStat) []httpmodel.ReviewerStat {
 	resp := make([]httpmodel.ReviewerStat, 0, len(stats))
 	for _, stat := range stats {
-		resp = append(resp, httpmodel.ReviewerStat{
-			UserID:        stat.UserID,
-			Username:      stat.Username,
-			TeamName:      stat.TeamName,
-			TotalAssigned: stat.TotalAssigned,
-			OpenAssigned:  stat.OpenAssigned,
-		})
+		resp = append(resp, mapReviewerStat(stat))
 	}
 
 	return resp
 }
 
+func mapReviewerStat(stat model.ReviewerStat) httpmodel.ReviewerStat {
+	reviewer := httpmodel.ReviewerStat{
+		UserID:              stat.UserID,
+		Username:            stat.Username,
+		TeamName:            stat.TeamName,
+		IsActive:            stat.IsActive,
+		TotalAssigned:       stat.TotalAssigned,
+		OpenAssigned:        stat.OpenAssigned,
+		DaysSinceLastReview: stat.DaysSinceLastReview,
+	}
+	if stat.LastAssignedAt != nil {
+		reviewer.LastAssignedAt = stat.LastAssignedAt.UTC().Format(time.RFC3339)
+	}
+
+	return reviewer
+}
+
 func mapPRStats(stats model.PullRequestStats) httpmodel.PullRequestStatsResponse {
 	resp := httpmodel.PullRequestStatsResponse{
 		Total:         stats.Total,
@@ -66,5 +366,115 @@ func mapPRStats(stats model.PullRequestStats) httpmodel.PullRequestStatsResponse
 		})
 	}
 
+	if stats.TimeToMerge != nil {
+		timeToMerge := mapPercentiles(*stats.TimeToMerge)
+		resp.TimeToMerge = &timeToMerge
+	}
+
+	resp.TimeToMergeByTeam = make([]httpmodel.TeamTimeToMerge, 0, len(stats.TimeToMergeByTeam))
+	for _, team := range stats.TimeToMergeByTeam {
+		resp.TimeToMergeByTeam = append(resp.TimeToMergeByTeam, httpmodel.TeamTimeToMerge{
+			TeamName:    team.TeamName,
+			TimeToMerge: mapPercentiles(team.TimeToMerge),
+		})
+	}
+
+	return resp
+}
+
+func mapTeamStats(stats []model.TeamStat) []httpmodel.TeamStat {
+	resp := make([]httpmodel.TeamStat, 0, len(stats))
+	for _, stat := range stats {
+		resp = append(resp, mapTeamStat(stat))
+	}
+
+	return resp
+}
+
+func mapTeamStat(stat model.TeamStat) httpmodel.TeamStat {
+	prs := httpmodel.TeamPullRequestStat{
+		Open:         stat.OpenPRs,
+		Merged:       stat.MergedPRs,
+		Understaffed: stat.UnderstaffedPRs,
+	}
+	if total := stat.OpenPRs + stat.MergedPRs; total > 0 {
+		prs.UnderstaffedShare = float64(stat.UnderstaffedPRs) / float64(total)
+	}
+
+	return httpmodel.TeamStat{
+		TeamName:     stat.TeamName,
+		PullRequests: prs,
+		Members: httpmodel.TeamMemberStat{
+			Active:   stat.ActiveMembers,
+			Inactive: stat.InactiveMembers,
+		},
+		OpenAssignments: httpmodel.OpenAssignmentStat{
+			Min:  stat.MinOpenAssigned,
+			Max:  stat.MaxOpenAssigned,
+			Mean: stat.MeanOpenAssigned,
+		},
+	}
+}
+
+func mapFairness(fairness []model.TeamFairness) []httpmodel.TeamFairness {
+	resp := make([]httpmodel.TeamFairness, 0, len(fairness))
+	for _, team := range fairness {
+		resp = append(resp, mapTeamFairness(team))
+	}
+
 	return resp
 }
+
+func mapTeamFairness(team model.TeamFairness) httpmodel.TeamFairness {
+	outliers := make([]httpmodel.ReviewerOutlier, 0, len(team.Outliers))
+	for _, outlier := range team.Outliers {
+		outliers = append(outliers, httpmodel.ReviewerOutlier{
+			UserID:        outlier.UserID,
+			Username:      outlier.Username,
+			TotalAssigned: outlier.TotalAssigned,
+			OpenAssigned:  outlier.OpenAssigned,
+			TotalScore:    outlier.TotalScore,
+			OpenScore:     outlier.OpenScore,
+		})
+	}
+
+	return httpmodel.TeamFairness{
+		TeamName:      team.TeamName,
+		ActiveMembers: team.ActiveMembers,
+		TotalAssigned: mapDistribution(team.TotalAssigned),
+		OpenAssigned:  mapDistribution(team.OpenAssigned),
+		Outliers:      outliers,
+	}
+}
+
+func mapDistribution(dist model.Distribution) httpmodel.Distribution {
+	return httpmodel.Distribution{
+		Mean:   dist.Mean,
+		StdDev: dist.StdDev,
+		Gini:   dist.Gini,
+	}
+}
+
+func mapTimeseries(points []model.TimeseriesPoint) []httpmodel.TimeseriesPoint {
+	resp := make([]httpmodel.TimeseriesPoint, 0, len(points))
+	for _, point := range points {
+		resp = append(resp, mapTimeseriesPoint(point))
+	}
+
+	return resp
+}
+
+func mapTimeseriesPoint(point model.TimeseriesPoint) httpmodel.TimeseriesPoint {
+	return httpmodel.TimeseriesPoint{
+		Start: point.Start.UTC().Format(time.RFC3339),
+		Count: point.Count,
+	}
+}
+
+func mapPercentiles(p model.Percentiles) httpmodel.Percentiles {
+	return httpmodel.Percentiles{
+		P50: p.P50.Seconds(),
+		P90: p.P90.Seconds(),
+		P99: p.P99.Seconds(),
+	}
+}
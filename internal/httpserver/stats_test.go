@@ -0,0 +1,147 @@
+package httpserver
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/6ermvH/avito-reviewchecker/internal/model"
+	httpmodel "github.com/6ermvH/avito-reviewchecker/internal/model/http"
+	"github.com/6ermvH/avito-reviewchecker/internal/repository/memory"
+	"github.com/6ermvH/avito-reviewchecker/internal/usecase"
+)
+
+// newTestService seeds the backend and frontend teams with an open pull
+// request each.
+func newTestService(t *testing.T) *usecase.Service {
+	t.Helper()
+
+	ctx := context.Background()
+	repo := memory.New()
+
+	teams := map[string][]model.User{
+		"backend": {
+			{ID: "u1", Username: "alice", IsActive: true},
+			{ID: "u2", Username: "bob", IsActive: true},
+			{ID: "u3", Username: "carol", IsActive: true},
+		},
+		"frontend": {
+			{ID: "u4", Username: "dave", IsActive: true},
+			{ID: "u5", Username: "erin", IsActive: true},
+		},
+	}
+
+	for name, members := range teams {
+		_, err := repo.CreateTeam(ctx, name)
+		require.NoError(t, err)
+		require.NoError(t, repo.InsertTeamMembers(ctx, name, members))
+	}
+
+	svc := usecase.New(repo, slog.New(slog.DiscardHandler))
+
+	_, err := svc.CreatePR(ctx, "pr-1", "Add search", "u1")
+	require.NoError(t, err)
+	_, err = svc.CreatePR(ctx, "pr-2", "Fix layout", "u4")
+	require.NoError(t, err)
+
+	return svc
+}
+
+func TestReviewerStats(t *testing.T) {
+	h := HandleReviewerStats(newTestService(t))
+
+	get := func(t *testing.T, query string) *httptest.ResponseRecorder {
+		t.Helper()
+
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/stats/reviewers?"+query, nil))
+
+		return rec
+	}
+
+	teams := func(t *testing.T, rec *httptest.ResponseRecorder) []string {
+		t.Helper()
+
+		require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+		var resp httpmodel.ReviewerStatsResponse
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+
+		names := make([]string, 0, len(resp.Reviewers))
+		for _, reviewer := range resp.Reviewers {
+			names = append(names, reviewer.TeamName)
+		}
+
+		return names
+	}
+
+	t.Run("Good: team filters reviewers", func(t *testing.T) {
+		require.Equal(t, []string{"backend", "backend", "backend"}, teams(t, get(t, "team=backend")))
+	})
+
+	t.Run("Good: team_name is an alias", func(t *testing.T) {
+		require.Equal(t, []string{"frontend", "frontend"}, teams(t, get(t, "team_name=frontend")))
+		require.Len(t, teams(t, get(t, "team=frontend&team_name=frontend")), 2)
+	})
+
+	t.Run("Good: all teams without a filter", func(t *testing.T) {
+		require.Len(t, teams(t, get(t, "")), 5)
+	})
+
+	t.Run("Bad: team and team_name differ", func(t *testing.T) {
+		rec := get(t, "team=backend&team_name=frontend")
+		require.Equal(t, http.StatusBadRequest, rec.Code)
+		require.Contains(t, rec.Body.String(), "team and team_name must be equal")
+	})
+
+	t.Run("Bad: invalid time range", func(t *testing.T) {
+		rec := get(t, "from=2025-10-20T00:00:00Z&to=2025-10-06T00:00:00Z")
+		require.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+}
+
+func TestTimeseries(t *testing.T) {
+	h := HandleTimeseries(newTestService(t))
+
+	// total sums the counts of the points of the response.
+	total := func(t *testing.T, query string) int {
+		t.Helper()
+
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/stats/timeseries?"+query, nil))
+		require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+		var resp httpmodel.TimeseriesResponse
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+
+		count := 0
+		for _, point := range resp.Points {
+			count += point.Count
+		}
+
+		return count
+	}
+
+	t.Run("Good: team filters pull requests by author", func(t *testing.T) {
+		require.Equal(t, 2, total(t, "metric=prs_created"))
+		require.Equal(t, 1, total(t, "metric=prs_created&team=backend"))
+		require.Equal(t, 1, total(t, "metric=prs_created&team_name=frontend"))
+	})
+
+	t.Run("Good: team filters assignments by reviewer", func(t *testing.T) {
+		require.Equal(t, 2, total(t, "metric=assignments&bucket=week&team=backend"))
+		require.Equal(t, 1, total(t, "metric=assignments&bucket=week&team=frontend"))
+		require.Zero(t, total(t, "metric=assignments&team=missing"))
+	})
+
+	t.Run("Bad: invalid metric", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/stats/timeseries?metric=x&team=backend", nil))
+		require.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+}
@@ -0,0 +1,225 @@
+package httpserver
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/6ermvH/avito-reviewchecker/internal/model"
+	httpmodel "github.com/6ermvH/avito-reviewchecker/internal/model/http"
+)
+
+var (
+	errInvalidWebhookURL     = errors.New("url must be an absolute http or https URL")
+	errInvalidDeliveryStatus = errors.New("status must be PENDING, DELIVERED or DEAD")
+	errUnknownEventType      = errors.New("unknown event type")
+)
+
+func HandleWebhookAdd(svc Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req httpmodel.WebhookSubscriptionCreateRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(
+				w,
+				http.StatusBadRequest,
+				string(httpmodel.ErrorCodeInvalidInput),
+				"invalid JSON",
+			)
+
+			return
+		}
+
+		eventTypes, err := validateWebhookRequest(req)
+		if err != nil {
+			writeError(
+				w,
+				http.StatusBadRequest,
+				string(httpmodel.ErrorCodeInvalidInput),
+				err.Error(),
+			)
+
+			return
+		}
+
+		sub, err := svc.CreateWebhookSubscription(r.Context(), req.URL, req.Secret, eventTypes)
+		if err != nil {
+			writeDomainError(w, err, map[string]int{})
+
+			return
+		}
+
+		payload := mapWebhookSubscription(sub)
+		payload.Secret = sub.Secret
+
+		// keeps the secret out of caches and the idempotency store
+		w.Header().Set("Cache-Control", "no-store")
+		writeJSON(w, http.StatusCreated, httpmodel.WebhookSubscriptionResponse{
+			Subscription: payload,
+		})
+	}
+}
+
+func HandleWebhookList(svc Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		subs, err := svc.ListWebhookSubscriptions(r.Context())
+		if err != nil {
+			writeDomainError(w, err, map[string]int{})
+
+			return
+		}
+
+		resp := make([]httpmodel.WebhookSubscription, 0, len(subs))
+		for _, sub := range subs {
+			resp = append(resp, mapWebhookSubscription(sub))
+		}
+
+		writeJSON(w, http.StatusOK, httpmodel.WebhookSubscriptionsResponse{
+			Subscriptions: resp,
+		})
+	}
+}
+
+func HandleWebhookDelete(svc Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req httpmodel.WebhookSubscriptionDeleteRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(
+				w,
+				http.StatusBadRequest,
+				string(httpmodel.ErrorCodeInvalidInput),
+				"invalid JSON",
+			)
+
+			return
+		}
+
+		if req.ID == "" {
+			writeError(
+				w,
+				http.StatusBadRequest,
+				string(httpmodel.ErrorCodeInvalidInput),
+				"subscription_id is required",
+			)
+
+			return
+		}
+
+		if err := svc.DeleteWebhookSubscription(r.Context(), req.ID); err != nil {
+			writeDomainError(w, err, map[string]int{})
+
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func HandleWebhookDeliveries(svc Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		filter, err := parseDeliveryFilter(r)
+		if err != nil {
+			writeError(
+				w,
+				http.StatusBadRequest,
+				string(httpmodel.ErrorCodeInvalidInput),
+				err.Error(),
+			)
+
+			return
+		}
+
+		deliveries, err := svc.ListWebhookDeliveries(r.Context(), filter)
+		if err != nil {
+			writeDomainError(w, err, map[string]int{})
+
+			return
+		}
+
+		resp := make([]httpmodel.WebhookDelivery, 0, len(deliveries))
+		for _, d := range deliveries {
+			resp = append(resp, httpmodel.WebhookDelivery{
+				DeliveryID:     d.ID,
+				SubscriptionID: d.SubscriptionID,
+				EventID:        d.EventID,
+				Status:         string(d.Status),
+				Attempts:       d.Attempts,
+				NextAttemptAt:  d.NextAttemptAt.UTC().Format(time.RFC3339),
+				LastError:      d.LastError,
+				CreatedAt:      d.CreatedAt.UTC().Format(time.RFC3339),
+				UpdatedAt:      d.UpdatedAt.UTC().Format(time.RFC3339),
+			})
+		}
+
+		writeJSON(w, http.StatusOK, httpmodel.WebhookDeliveriesResponse{
+			Deliveries: resp,
+		})
+	}
+}
+
+func validateWebhookRequest(
+	req httpmodel.WebhookSubscriptionCreateRequest,
+) ([]model.DomainEventType, error) {
+	target, err := url.Parse(req.URL)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		return nil, errInvalidWebhookURL
+	}
+
+	eventTypes := make([]model.DomainEventType, 0, len(req.EventTypes))
+
+	for _, raw := range req.EventTypes {
+		eventType := model.DomainEventType(raw)
+		if !slices.Contains(model.DomainEventTypes, eventType) {
+			return nil, fmt.Errorf("%w %q", errUnknownEventType, raw)
+		}
+
+		if !slices.Contains(eventTypes, eventType) {
+			eventTypes = append(eventTypes, eventType)
+		}
+	}
+
+	return eventTypes, nil
+}
+
+func parseDeliveryFilter(r *http.Request) (model.DeliveryFilter, error) {
+	query := r.URL.Query()
+
+	filter := model.DeliveryFilter{SubscriptionID: query.Get("subscription_id")}
+
+	switch status := model.DeliveryStatus(query.Get("status")); status {
+	case "":
+	case model.DeliveryPending, model.DeliveryDelivered, model.DeliveryDead:
+		filter.Status = status
+	default:
+		return model.DeliveryFilter{}, errInvalidDeliveryStatus
+	}
+
+	if raw := query.Get("limit"); raw != "" {
+		limit, err := strconv.Atoi(raw)
+		if err != nil || limit <= 0 {
+			return model.DeliveryFilter{}, errInvalidLimit
+		}
+
+		filter.Limit = limit
+	}
+
+	return filter, nil
+}
+
+func mapWebhookSubscription(sub model.WebhookSubscription) httpmodel.WebhookSubscription {
+	payload := httpmodel.WebhookSubscription{
+		ID:         sub.ID,
+		URL:        sub.URL,
+		EventTypes: make([]string, 0, len(sub.EventTypes)),
+		CreatedAt:  sub.CreatedAt.UTC().Format(time.RFC3339),
+	}
+	for _, eventType := range sub.EventTypes {
+		payload.EventTypes = append(payload.EventTypes, string(eventType))
+	}
+
+	return payload
+}
@@ -0,0 +1,120 @@
+package integration
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+)
+
+const (
+	githubEventHeader     = "X-GitHub-Event"
+	githubSignatureHeader = "X-Hub-Signature-256"
+	githubSignaturePrefix = "sha256="
+	reasonMergedOnGitHub  = "merged on GitHub"
+)
+
+var errInvalidGitHubPayload = errors.New("invalid pull_request payload")
+
+type githubPullRequestEvent struct {
+	Action      string `json:"action"`
+	Number      int    `json:"number"`
+	PullRequest struct {
+		Title  string     `json:"title"`
+		Draft  bool       `json:"draft"`
+		Merged bool       `json:"merged"`
+		User   githubUser `json:"user"`
+	} `json:"pull_request"`
+	Repository struct {
+		FullName string `json:"full_name"`
+	} `json:"repository"`
+	Sender githubUser `json:"sender"`
+}
+
+type githubUser struct {
+	Login string `json:"login"`
+}
+
+// GitHub handles pull_request webhooks of GitHub. Pull requests are created
+// when they are opened, reopened or marked ready for review, unless they are
+// drafts, and merged when they are closed with merged set. Other events and
+// actions are acknowledged and ignored.
+type GitHub struct {
+	secret  []byte
+	applier applier
+}
+
+func NewGitHub(secret string, svc Service, identities *Identities, logger *slog.Logger) *GitHub {
+	return &GitHub{
+		secret: []byte(secret),
+		applier: applier{
+			provider:   ProviderGitHub,
+			svc:        svc,
+			identities: identities,
+			logger:     logger,
+		},
+	}
+}
+
+func (g *GitHub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	g.applier.handle(w, r, g.verify, parseGitHubEvent)
+}
+
+func (g *GitHub) verify(r *http.Request, body []byte) bool {
+	signature, ok := strings.CutPrefix(r.Header.Get(githubSignatureHeader), githubSignaturePrefix)
+	if !ok {
+		return false
+	}
+
+	got, err := hex.DecodeString(signature)
+	if err != nil {
+		return false
+	}
+
+	mac := hmac.New(sha256.New, g.secret)
+	mac.Write(body)
+
+	return hmac.Equal(got, mac.Sum(nil))
+}
+
+func parseGitHubEvent(r *http.Request, body []byte) (change, error) {
+	if r.Header.Get(githubEventHeader) != "pull_request" {
+		return change{action: actionIgnore}, nil
+	}
+
+	var event githubPullRequestEvent
+	if err := json.Unmarshal(body, &event); err != nil {
+		return change{}, fmt.Errorf("%w: %w", errInvalidGitHubPayload, err)
+	}
+
+	if event.Repository.FullName == "" || event.Number == 0 {
+		return change{}, errInvalidGitHubPayload
+	}
+
+	c := change{
+		action:      actionIgnore,
+		prID:        fmt.Sprintf("github:%s:%d", event.Repository.FullName, event.Number),
+		title:       event.PullRequest.Title,
+		authorLogin: event.PullRequest.User.Login,
+		actorLogin:  event.Sender.Login,
+	}
+
+	switch event.Action {
+	case "opened", "reopened", "ready_for_review":
+		if !event.PullRequest.Draft {
+			c.action = actionOpen
+		}
+	case "closed":
+		if event.PullRequest.Merged {
+			c.action = actionMerge
+			c.reason = reasonMergedOnGitHub
+		}
+	}
+
+	return c, nil
+}
@@ -0,0 +1,191 @@
+package integration
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/6ermvH/avito-reviewchecker/internal/model"
+	"github.com/6ermvH/avito-reviewchecker/internal/repository/memory"
+	"github.com/6ermvH/avito-reviewchecker/internal/usecase"
+)
+
+const (
+	githubSecret = "It's a Secret to Everybody"
+	githubPRID   = "github:octo-org/reviewchecker:42"
+)
+
+// newTestService returns a service over an in-memory repository with team
+// backend of u1, u2 and u3.
+func newTestService(t *testing.T) (*memory.Repository, Service) {
+	t.Helper()
+
+	ctx := context.Background()
+	repo := memory.New()
+
+	_, err := repo.CreateTeam(ctx, "backend")
+	require.NoError(t, err)
+	require.NoError(t, repo.InsertTeamMembers(ctx, "backend", []model.User{
+		{ID: "u1", Username: "Octocat", IsActive: true},
+		{ID: "u2", Username: "Hubot", IsActive: true},
+		{ID: "u3", Username: "Monalisa", IsActive: true},
+	}))
+
+	return repo, usecase.New(repo, slog.New(slog.DiscardHandler))
+}
+
+func TestGitHub(t *testing.T) {
+	ctx := context.Background()
+
+	setup := func(t *testing.T) (*memory.Repository, http.Handler) {
+		t.Helper()
+
+		repo, svc := newTestService(t)
+
+		identities := NewIdentities()
+		identities.Add(ProviderGitHub, "octocat", "u1")
+		identities.Add(ProviderGitHub, "Hubot", "u2")
+
+		return repo, NewGitHub(githubSecret, svc, identities, slog.New(slog.DiscardHandler))
+	}
+
+	send := func(t *testing.T, h http.Handler, event, fixture string) *httptest.ResponseRecorder {
+		t.Helper()
+
+		body, err := os.ReadFile(filepath.Join("testdata", "github", fixture))
+		require.NoError(t, err)
+
+		mac := hmac.New(sha256.New, []byte(githubSecret))
+		mac.Write(body)
+
+		req := httptest.NewRequest(http.MethodPost, "/integrations/github/webhook", bytes.NewReader(body))
+		req.Header.Set(githubEventHeader, event)
+		req.Header.Set(githubSignatureHeader, "sha256="+hex.EncodeToString(mac.Sum(nil)))
+
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+
+		return rec
+	}
+
+	t.Run("Good: opened creates the pull request", func(t *testing.T) {
+		repo, h := setup(t)
+
+		rec := send(t, h, "pull_request", "pull_request_opened.json")
+		require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+		require.JSONEq(t, `{"result":"applied","pull_request_id":"`+githubPRID+`"}`, rec.Body.String())
+
+		pr, err := repo.GetPullRequest(ctx, githubPRID)
+		require.NoError(t, err)
+		require.Equal(t, "Add search by reviewer", pr.Name)
+		require.Equal(t, "u1", pr.AuthorID)
+		require.Equal(t, model.PRStatusOpen, pr.Status)
+		require.ElementsMatch(t, []string{"u2", "u3"}, pr.Reviewers)
+
+		rec = send(t, h, "pull_request", "pull_request_opened.json")
+		require.Equal(t, http.StatusOK, rec.Code)
+		require.Contains(t, rec.Body.String(), `"ignored"`, "redelivery is a no-op")
+	})
+
+	t.Run("Good: draft is created when ready for review", func(t *testing.T) {
+		repo, h := setup(t)
+
+		rec := send(t, h, "pull_request", "pull_request_opened_draft.json")
+		require.Equal(t, http.StatusOK, rec.Code)
+		require.Contains(t, rec.Body.String(), `"ignored"`)
+
+		_, err := repo.GetPullRequest(ctx, githubPRID)
+		require.Error(t, err)
+
+		rec = send(t, h, "pull_request", "pull_request_ready_for_review.json")
+		require.Equal(t, http.StatusOK, rec.Code)
+
+		_, err = repo.GetPullRequest(ctx, githubPRID)
+		require.NoError(t, err)
+	})
+
+	t.Run("Good: closed and merged merges with sender as actor", func(t *testing.T) {
+		repo, h := setup(t)
+		send(t, h, "pull_request", "pull_request_opened.json")
+
+		rec := send(t, h, "pull_request", "pull_request_closed_merged.json")
+		require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+		pr, err := repo.GetPullRequest(ctx, githubPRID)
+		require.NoError(t, err)
+		require.Equal(t, model.PRStatusMerged, pr.Status)
+
+		events, err := repo.ListAssignmentEvents(ctx, githubPRID)
+		require.NoError(t, err)
+
+		merged := events[len(events)-1]
+		require.Equal(t, model.AssignmentEventMerged, merged.Type)
+		require.Equal(t, "u2", merged.ActorID)
+		require.Equal(t, reasonMergedOnGitHub, merged.Reason)
+	})
+
+	t.Run("Good: closed without merge and reopened keep the pull request open", func(t *testing.T) {
+		repo, h := setup(t)
+		send(t, h, "pull_request", "pull_request_opened.json")
+
+		rec := send(t, h, "pull_request", "pull_request_closed.json")
+		require.Contains(t, rec.Body.String(), `"ignored"`)
+
+		rec = send(t, h, "pull_request", "pull_request_reopened.json")
+		require.Equal(t, http.StatusOK, rec.Code)
+
+		pr, err := repo.GetPullRequest(ctx, githubPRID)
+		require.NoError(t, err)
+		require.Equal(t, model.PRStatusOpen, pr.Status)
+	})
+
+	t.Run("Good: merge of unknown pull request is ignored", func(t *testing.T) {
+		_, h := setup(t)
+
+		rec := send(t, h, "pull_request", "pull_request_closed_merged.json")
+		require.Equal(t, http.StatusOK, rec.Code)
+		require.Contains(t, rec.Body.String(), `"ignored"`)
+	})
+
+	t.Run("Good: other events are acknowledged", func(t *testing.T) {
+		_, h := setup(t)
+
+		rec := send(t, h, "ping", "ping.json")
+		require.Equal(t, http.StatusOK, rec.Code)
+		require.JSONEq(t, `{"result":"ignored"}`, rec.Body.String())
+	})
+
+	t.Run("Bad: invalid signature", func(t *testing.T) {
+		_, h := setup(t)
+
+		for _, signature := range []string{"", "sha256=zz", "sha256=" + hex.EncodeToString(make([]byte, 32))} {
+			req := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader([]byte(`{}`)))
+			req.Header.Set(githubEventHeader, "pull_request")
+			req.Header.Set(githubSignatureHeader, signature)
+
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+
+			require.Equal(t, http.StatusUnauthorized, rec.Code)
+		}
+	})
+
+	t.Run("Bad: unmapped author", func(t *testing.T) {
+		_, h := setup(t)
+		h.(*GitHub).applier.identities = NewIdentities()
+
+		rec := send(t, h, "pull_request", "pull_request_opened.json")
+		require.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+		require.Contains(t, rec.Body.String(), "UNKNOWN_IDENTITY")
+	})
+}
@@ -0,0 +1,119 @@
+package integration
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+)
+
+const (
+	gitlabEventHeader      = "X-Gitlab-Event"
+	gitlabTokenHeader      = "X-Gitlab-Token"
+	gitlabMergeRequestHook = "Merge Request Hook"
+	reasonMergedOnGitLab   = "merged on GitLab"
+)
+
+var errInvalidGitLabPayload = errors.New("invalid merge request payload")
+
+type gitlabMergeRequestEvent struct {
+	User    gitlabUser `json:"user"`
+	Project struct {
+		PathWithNamespace string `json:"path_with_namespace"`
+	} `json:"project"`
+	ObjectAttributes struct {
+		IID      int    `json:"iid"`
+		AuthorID int64  `json:"author_id"`
+		Title    string `json:"title"`
+		Action   string `json:"action"`
+		Draft    bool   `json:"draft"`
+	} `json:"object_attributes"`
+	Changes struct {
+		Draft *struct {
+			Previous bool `json:"previous"`
+			Current  bool `json:"current"`
+		} `json:"draft"`
+	} `json:"changes"`
+}
+
+type gitlabUser struct {
+	ID       int64  `json:"id"`
+	Username string `json:"username"`
+}
+
+// GitLab handles Merge Request Hook events of GitLab. Merge requests are
+// created when they are opened or reopened, unless they are drafts, or when
+// their draft flag is cleared, and merged on the merge action. GitLab sends
+// only the account id of the author: it is resolved through the mapped GitLab
+// ids, or through the username when the author triggered the event. Events
+// of other users about an author without a mapped id are rejected.
+type GitLab struct {
+	token   []byte
+	applier applier
+}
+
+func NewGitLab(token string, svc Service, identities *Identities, logger *slog.Logger) *GitLab {
+	return &GitLab{
+		token: []byte(token),
+		applier: applier{
+			provider:   ProviderGitLab,
+			svc:        svc,
+			identities: identities,
+			logger:     logger,
+		},
+	}
+}
+
+func (g *GitLab) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	g.applier.handle(w, r, g.verify, parseGitLabEvent)
+}
+
+func (g *GitLab) verify(r *http.Request, _ []byte) bool {
+	return subtle.ConstantTimeCompare([]byte(r.Header.Get(gitlabTokenHeader)), g.token) == 1
+}
+
+func parseGitLabEvent(r *http.Request, body []byte) (change, error) {
+	if r.Header.Get(gitlabEventHeader) != gitlabMergeRequestHook {
+		return change{action: actionIgnore}, nil
+	}
+
+	var event gitlabMergeRequestEvent
+	if err := json.Unmarshal(body, &event); err != nil {
+		return change{}, fmt.Errorf("%w: %w", errInvalidGitLabPayload, err)
+	}
+
+	attrs := event.ObjectAttributes
+	if event.Project.PathWithNamespace == "" || attrs.IID == 0 || attrs.AuthorID == 0 {
+		return change{}, errInvalidGitLabPayload
+	}
+
+	c := change{
+		action:     actionIgnore,
+		prID:       fmt.Sprintf("gitlab:%s:%d", event.Project.PathWithNamespace, attrs.IID),
+		title:      attrs.Title,
+		authorID:   attrs.AuthorID,
+		actorLogin: event.User.Username,
+	}
+
+	if event.User.ID == attrs.AuthorID {
+		c.authorLogin = event.User.Username
+	}
+
+	switch attrs.Action {
+	case "open", "reopen":
+		if !attrs.Draft {
+			c.action = actionOpen
+		}
+	case "update":
+		if draft := event.Changes.Draft; draft != nil && draft.Previous && !draft.Current {
+			c.action = actionOpen
+		}
+	case "merge":
+		c.action = actionMerge
+		c.reason = reasonMergedOnGitLab
+	}
+
+	return c, nil
+}
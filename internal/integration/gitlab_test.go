@@ -0,0 +1,173 @@
+package integration
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/6ermvH/avito-reviewchecker/internal/model"
+	"github.com/6ermvH/avito-reviewchecker/internal/repository/memory"
+)
+
+const (
+	gitlabToken = "glpat-webhook-token"
+	gitlabPRID  = "gitlab:platform/reviewchecker:7"
+)
+
+func TestGitLab(t *testing.T) {
+	ctx := context.Background()
+
+	setup := func(t *testing.T) (*memory.Repository, http.Handler) {
+		t.Helper()
+
+		repo, svc := newTestService(t)
+
+		identities := NewIdentities()
+		identities.Add(ProviderGitLab, "alice", "u1")
+		identities.Add(ProviderGitLab, "bob", "u2")
+		identities.Add(ProviderGitHub, "alice", "u3")
+
+		return repo, NewGitLab(gitlabToken, svc, identities, slog.New(slog.DiscardHandler))
+	}
+
+	send := func(t *testing.T, h http.Handler, event, fixture string) *httptest.ResponseRecorder {
+		t.Helper()
+
+		body, err := os.ReadFile(filepath.Join("testdata", "gitlab", fixture))
+		require.NoError(t, err)
+
+		req := httptest.NewRequest(http.MethodPost, "/integrations/gitlab/webhook", bytes.NewReader(body))
+		req.Header.Set(gitlabEventHeader, event)
+		req.Header.Set(gitlabTokenHeader, gitlabToken)
+
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+
+		return rec
+	}
+
+	status := func(t *testing.T, repo *memory.Repository) model.PRStatus {
+		t.Helper()
+
+		pr, err := repo.GetPullRequest(ctx, gitlabPRID)
+		require.NoError(t, err)
+
+		return pr.Status
+	}
+
+	t.Run("Good: open creates the pull request", func(t *testing.T) {
+		repo, h := setup(t)
+
+		rec := send(t, h, gitlabMergeRequestHook, "merge_request_open.json")
+		require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+		require.JSONEq(t, `{"result":"applied","pull_request_id":"`+gitlabPRID+`"}`, rec.Body.String())
+
+		pr, err := repo.GetPullRequest(ctx, gitlabPRID)
+		require.NoError(t, err)
+		require.Equal(t, "Filter reviews by status", pr.Name)
+		require.Equal(t, "u1", pr.AuthorID, "logins are resolved per provider")
+	})
+
+	t.Run("Good: draft is created when marked ready", func(t *testing.T) {
+		repo, h := setup(t)
+
+		send(t, h, gitlabMergeRequestHook, "merge_request_open_draft.json")
+		rec := send(t, h, gitlabMergeRequestHook, "merge_request_update_draft.json")
+		require.Contains(t, rec.Body.String(), `"ignored"`)
+
+		_, err := repo.GetPullRequest(ctx, gitlabPRID)
+		require.Error(t, err)
+
+		rec = send(t, h, gitlabMergeRequestHook, "merge_request_update_ready.json")
+		require.Contains(t, rec.Body.String(), `"applied"`)
+		require.Equal(t, model.PRStatusOpen, status(t, repo))
+	})
+
+	t.Run("Good: close and reopen keep the pull request open", func(t *testing.T) {
+		repo, h := setup(t)
+		send(t, h, gitlabMergeRequestHook, "merge_request_open.json")
+
+		rec := send(t, h, gitlabMergeRequestHook, "merge_request_close.json")
+		require.Contains(t, rec.Body.String(), `"ignored"`)
+
+		rec = send(t, h, gitlabMergeRequestHook, "merge_request_reopen.json")
+		require.Contains(t, rec.Body.String(), `"ignored"`, "pull request already exists")
+		require.Equal(t, model.PRStatusOpen, status(t, repo))
+	})
+
+	t.Run("Good: author resolved by id when someone else triggers the event", func(t *testing.T) {
+		repo, h := setup(t)
+		h.(*GitLab).applier.identities.AddID(ProviderGitLab, 31, "u1")
+
+		rec := send(t, h, gitlabMergeRequestHook, "merge_request_update_ready_by_other.json")
+		require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+		pr, err := repo.GetPullRequest(ctx, gitlabPRID)
+		require.NoError(t, err)
+		require.Equal(t, "u1", pr.AuthorID, "the author, not bob who triggered the event")
+	})
+
+	t.Run("Good: merge", func(t *testing.T) {
+		repo, h := setup(t)
+		send(t, h, gitlabMergeRequestHook, "merge_request_open.json")
+
+		rec := send(t, h, gitlabMergeRequestHook, "merge_request_merge.json")
+		require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+		require.Equal(t, model.PRStatusMerged, status(t, repo))
+
+		events, err := repo.ListAssignmentEvents(ctx, gitlabPRID)
+		require.NoError(t, err)
+		require.Equal(t, "u2", events[len(events)-1].ActorID)
+		require.Equal(t, reasonMergedOnGitLab, events[len(events)-1].Reason)
+	})
+
+	t.Run("Good: other hooks are acknowledged", func(t *testing.T) {
+		_, h := setup(t)
+
+		rec := send(t, h, "Push Hook", "merge_request_open.json")
+		require.Equal(t, http.StatusOK, rec.Code)
+		require.JSONEq(t, `{"result":"ignored"}`, rec.Body.String())
+	})
+
+	t.Run("Bad: invalid token", func(t *testing.T) {
+		_, h := setup(t)
+
+		for _, token := range []string{"", "wrong"} {
+			req := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader([]byte(`{}`)))
+			req.Header.Set(gitlabEventHeader, gitlabMergeRequestHook)
+			req.Header.Set(gitlabTokenHeader, token)
+
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+
+			require.Equal(t, http.StatusUnauthorized, rec.Code)
+		}
+	})
+
+	t.Run("Bad: unmapped author", func(t *testing.T) {
+		_, h := setup(t)
+		h.(*GitLab).applier.identities = NewIdentities()
+
+		rec := send(t, h, gitlabMergeRequestHook, "merge_request_open.json")
+		require.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+		require.Contains(t, rec.Body.String(), "UNKNOWN_IDENTITY")
+	})
+
+	t.Run("Bad: author without a mapped id triggered by someone else", func(t *testing.T) {
+		repo, h := setup(t)
+
+		rec := send(t, h, gitlabMergeRequestHook, "merge_request_update_ready_by_other.json")
+		require.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+		require.Contains(t, rec.Body.String(), "UNKNOWN_IDENTITY")
+
+		_, err := repo.GetPullRequest(ctx, gitlabPRID)
+		require.Error(t, err, "bob is not taken as the author")
+	})
+}
@@ -0,0 +1,64 @@
+package integration
+
+import (
+	"errors"
+	"strings"
+)
+
+type Provider string
+
+const (
+	ProviderGitHub Provider = "github"
+	ProviderGitLab Provider = "gitlab"
+)
+
+var ErrUnknownIdentity = errors.New("no user is mapped to this login")
+
+// Identities maps VCS logins, and numeric account ids of providers that send
+// no author login, to users.id. It is shared by all providers; logins are
+// matched case insensitively.
+type Identities struct {
+	users map[Provider]map[string]string
+	ids   map[Provider]map[int64]string
+}
+
+func NewIdentities() *Identities {
+	return &Identities{
+		users: make(map[Provider]map[string]string),
+		ids:   make(map[Provider]map[int64]string),
+	}
+}
+
+func (i *Identities) Add(provider Provider, login, userID string) {
+	if i.users[provider] == nil {
+		i.users[provider] = make(map[string]string)
+	}
+
+	i.users[provider][strings.ToLower(login)] = userID
+}
+
+func (i *Identities) Resolve(provider Provider, login string) (string, error) {
+	userID, ok := i.users[provider][strings.ToLower(login)]
+	if !ok {
+		return "", ErrUnknownIdentity
+	}
+
+	return userID, nil
+}
+
+func (i *Identities) AddID(provider Provider, id int64, userID string) {
+	if i.ids[provider] == nil {
+		i.ids[provider] = make(map[int64]string)
+	}
+
+	i.ids[provider][id] = userID
+}
+
+func (i *Identities) ResolveID(provider Provider, id int64) (string, error) {
+	userID, ok := i.ids[provider][id]
+	if !ok {
+		return "", ErrUnknownIdentity
+	}
+
+	return userID, nil
+}
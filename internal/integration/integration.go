@@ -0,0 +1,199 @@
+// Package integration turns pull request webhooks of VCS hosting services
+// into calls of the usecase layer.
+package integration
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+
+	"github.com/6ermvH/avito-reviewchecker/internal/model"
+	httpmodel "github.com/6ermvH/avito-reviewchecker/internal/model/http"
+	"github.com/6ermvH/avito-reviewchecker/internal/repository"
+	"github.com/6ermvH/avito-reviewchecker/internal/usecase"
+)
+
+// maxPayloadSize matches the largest payload GitHub sends.
+const maxPayloadSize = 25 << 20
+
+type Service interface {
+	CreatePR(ctx context.Context, prID, prName, authorID string) (model.PullRequest, error)
+	MergePR(
+		ctx context.Context,
+		prID string,
+		expectedVersion int,
+		info model.ChangeInfo,
+	) (model.PullRequest, error)
+}
+
+type action int
+
+const (
+	actionIgnore action = iota
+	// actionOpen creates the pull request unless it already exists.
+	actionOpen
+	actionMerge
+)
+
+// change is a webhook event reduced to what the service cares about. The
+// author is given by login, by account id, or both.
+type change struct {
+	action      action
+	prID        string
+	title       string
+	authorLogin string
+	authorID    int64
+	actorLogin  string
+	reason      string
+}
+
+type result struct {
+	Result        string `json:"result"`
+	PullRequestID string `json:"pull_request_id,omitempty"`
+}
+
+const (
+	resultApplied = "applied"
+	resultIgnored = "ignored"
+)
+
+// applier applies changes of one provider.
+type applier struct {
+	provider   Provider
+	svc        Service
+	identities *Identities
+	logger     *slog.Logger
+}
+
+func (a applier) apply(ctx context.Context, c change) (result, error) {
+	switch c.action {
+	case actionOpen:
+		authorID, err := a.resolveAuthor(c)
+		if err != nil {
+			return result{}, err
+		}
+
+		_, err = a.svc.CreatePR(ctx, c.prID, c.title, authorID)
+		if errors.Is(err, usecase.ErrPullRequestExists) {
+			return result{Result: resultIgnored, PullRequestID: c.prID}, nil
+		}
+
+		if err != nil {
+			return result{}, fmt.Errorf("create pr %q: %w", c.prID, err)
+		}
+	case actionMerge:
+		// an unmapped sender only loses the actor in the history
+		actorID, _ := a.identities.Resolve(a.provider, c.actorLogin)
+
+		_, err := a.svc.MergePR(ctx, c.prID, usecase.AnyVersion, model.ChangeInfo{
+			ActorID: actorID,
+			Reason:  c.reason,
+		})
+		if errors.Is(err, repository.ErrNotFound) {
+			a.logger.Info("merge of unknown pull request ignored", "prID", c.prID)
+
+			return result{Result: resultIgnored, PullRequestID: c.prID}, nil
+		}
+
+		if err != nil {
+			return result{}, fmt.Errorf("merge pr %q: %w", c.prID, err)
+		}
+	case actionIgnore:
+		return result{Result: resultIgnored, PullRequestID: c.prID}, nil
+	}
+
+	return result{Result: resultApplied, PullRequestID: c.prID}, nil
+}
+
+// resolveAuthor maps the author by account id when one is mapped, and by
+// login otherwise.
+func (a applier) resolveAuthor(c change) (string, error) {
+	if c.authorID != 0 {
+		if userID, err := a.identities.ResolveID(a.provider, c.authorID); err == nil {
+			return userID, nil
+		}
+	}
+
+	if c.authorLogin == "" {
+		return "", fmt.Errorf("author with id %d: %w", c.authorID, ErrUnknownIdentity)
+	}
+
+	userID, err := a.identities.Resolve(a.provider, c.authorLogin)
+	if err != nil {
+		return "", fmt.Errorf("author %q: %w", c.authorLogin, err)
+	}
+
+	return userID, nil
+}
+
+// handle reads the body, lets verify check it and parse turn it into a change,
+// then applies the change.
+func (a applier) handle(
+	w http.ResponseWriter,
+	r *http.Request,
+	verify func(r *http.Request, body []byte) bool,
+	parse func(r *http.Request, body []byte) (change, error),
+) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxPayloadSize))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, httpmodel.ErrorCodeInvalidInput, "failed to read body")
+
+		return
+	}
+
+	if !verify(r, body) {
+		writeError(w, http.StatusUnauthorized, httpmodel.ErrorCodeUnauthorized, "invalid signature")
+
+		return
+	}
+
+	c, err := parse(r, body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, httpmodel.ErrorCodeInvalidInput, err.Error())
+
+		return
+	}
+
+	res, err := a.apply(r.Context(), c)
+	if err != nil {
+		a.logger.Warn("apply webhook", "provider", a.provider, "prID", c.prID, "error", err)
+		writeApplyError(w, err)
+
+		return
+	}
+
+	writeJSON(w, http.StatusOK, res)
+}
+
+func writeApplyError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ErrUnknownIdentity):
+		writeError(w, http.StatusUnprocessableEntity, httpmodel.ErrorCodeUnknownIdentity, err.Error())
+	case errors.Is(err, repository.ErrNotFound):
+		writeError(w, http.StatusNotFound, httpmodel.ErrorCodeNotFound, err.Error())
+	case errors.Is(err, usecase.ErrConflict):
+		writeError(w, http.StatusConflict, httpmodel.ErrorCodeConflict, err.Error())
+	default:
+		writeError(w, http.StatusInternalServerError, httpmodel.ErrorCodeInternal, err.Error())
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, payload interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	//nolint:errchkjson
+	_ = json.NewEncoder(w).Encode(payload)
+}
+
+func writeError(w http.ResponseWriter, status int, code httpmodel.ErrorCode, message string) {
+	writeJSON(w, status, map[string]interface{}{
+		"error": map[string]string{
+			"code":    string(code),
+			"message": message,
+		},
+	})
+}
@@ -0,0 +1,184 @@
+// Package metrics exposes the state and activity of the service to
+// Prometheus.
+package metrics
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/6ermvH/avito-reviewchecker/internal/model"
+)
+
+// Namespace prefixes the names of the metrics of the service.
+const Namespace = "reviewchecker"
+
+// scrapeTimeout bounds the queries made while collecting gauges.
+const scrapeTimeout = 5 * time.Second
+
+// Source is the part of the service domain metrics are read from.
+type Source interface {
+	SubscribeEvents(
+		ctx context.Context,
+		filter model.StreamFilter,
+		lastEventID int64,
+	) ([]model.StreamEvent, <-chan model.StreamEvent, error)
+	CountOpenPullRequests(ctx context.Context) ([]model.TeamCount, error)
+	NoReplacementCandidates() int64
+}
+
+// Domain counts assignments, reassignments and merges from the event stream
+// of this instance, and reads the open pull requests of every team when
+// scraped.
+type Domain struct {
+	source Source
+	logger *slog.Logger
+
+	assignments   prometheus.Counter
+	reassignments prometheus.Counter
+	merges        prometheus.Counter
+	noCandidates  *prometheus.Desc
+	openPRs       *prometheus.Desc
+}
+
+func NewDomain(source Source, logger *slog.Logger) *Domain {
+	return &Domain{
+		source: source,
+		logger: logger,
+		assignments: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: Namespace,
+			Name:      "assignments_total",
+			Help:      "Reviewers assigned on creation, reassignment or escalation.",
+		}),
+		reassignments: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: Namespace,
+			Name:      "reassignments_total",
+			Help:      "Reviewers replaced by another member of their team.",
+		}),
+		merges: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: Namespace,
+			Name:      "merges_total",
+			Help:      "Pull requests merged.",
+		}),
+		noCandidates: prometheus.NewDesc(
+			prometheus.BuildFQName(Namespace, "", "no_replacement_candidate_total"),
+			"Reassignments rejected because the team has no active candidate.",
+			nil, nil,
+		),
+		openPRs: prometheus.NewDesc(
+			prometheus.BuildFQName(Namespace, "", "open_pull_requests"),
+			"Open pull requests by the team of the author.",
+			[]string{"team"}, nil,
+		),
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (d *Domain) Describe(ch chan<- *prometheus.Desc) {
+	d.assignments.Describe(ch)
+	d.reassignments.Describe(ch)
+	d.merges.Describe(ch)
+	ch <- d.noCandidates
+	ch <- d.openPRs
+}
+
+// Collect implements prometheus.Collector. The open pull requests are left
+// out of the scrape when they can not be read.
+func (d *Domain) Collect(ch chan<- prometheus.Metric) {
+	d.assignments.Collect(ch)
+	d.reassignments.Collect(ch)
+	d.merges.Collect(ch)
+
+	ch <- prometheus.MustNewConstMetric(
+		d.noCandidates,
+		prometheus.CounterValue,
+		float64(d.source.NoReplacementCandidates()),
+	)
+
+	ctx, cancel := context.WithTimeout(context.Background(), scrapeTimeout)
+	defer cancel()
+
+	teams, err := d.source.CountOpenPullRequests(ctx)
+	if err != nil {
+		d.logger.Error("collect open pull requests", "error", err)
+
+		return
+	}
+
+	for _, team := range teams {
+		ch <- prometheus.MustNewConstMetric(
+			d.openPRs,
+			prometheus.GaugeValue,
+			float64(team.Count),
+			team.TeamName,
+		)
+	}
+}
+
+// Run counts the events of the service until ctx is done. When it falls
+// behind the stream it resubscribes from the last event it counted.
+func (d *Domain) Run(ctx context.Context) {
+	var lastID int64
+
+	for {
+		backlog, events, err := d.source.SubscribeEvents(ctx, model.StreamFilter{}, lastID)
+		if err != nil {
+			d.logger.Error("subscribe to events", "error", err)
+
+			return
+		}
+
+		for _, event := range backlog {
+			d.count(event)
+			lastID = event.ID
+		}
+
+		for event := range events {
+			d.count(event)
+			lastID = event.ID
+		}
+
+		if ctx.Err() != nil {
+			return
+		}
+
+		d.logger.Warn("metrics fell behind the event stream, resubscribing", "lastEventID", lastID)
+	}
+}
+
+// eventPayload is the part of the event data counted.
+type eventPayload struct {
+	PullRequest struct {
+		Reviewers []string `json:"assigned_reviewers"`
+	} `json:"pull_request"`
+	Escalation model.EscalationPolicy `json:"escalation"`
+}
+
+func (d *Domain) count(event model.StreamEvent) {
+	var data eventPayload
+	if err := json.Unmarshal(event.Payload, &data); err != nil {
+		d.logger.Error("decode event", "type", event.Type, "error", err)
+
+		return
+	}
+
+	switch event.Type {
+	case model.EventPRCreated:
+		d.assignments.Add(float64(len(data.PullRequest.Reviewers)))
+	case model.EventReviewerReassigned:
+		d.assignments.Inc()
+		d.reassignments.Inc()
+	case model.EventReviewEscalated:
+		// reassigning escalations publish reviewer.reassigned and are counted
+		// above, only an added team lead is a new assignment here
+		if data.Escalation == model.EscalationAddLead {
+			d.assignments.Inc()
+		}
+	case model.EventPRMerged:
+		d.merges.Inc()
+	case model.EventUserActivityChanged:
+	}
+}
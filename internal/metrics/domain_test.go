@@ -0,0 +1,149 @@
+package metrics
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+
+	"github.com/6ermvH/avito-reviewchecker/internal/model"
+	"github.com/6ermvH/avito-reviewchecker/internal/repository/memory"
+	"github.com/6ermvH/avito-reviewchecker/internal/usecase"
+)
+
+// readySource reports when Run has subscribed, so that no event of the test
+// is published before.
+type readySource struct {
+	Source
+	ready chan struct{}
+}
+
+func (s readySource) SubscribeEvents(
+	ctx context.Context,
+	filter model.StreamFilter,
+	lastEventID int64,
+) ([]model.StreamEvent, <-chan model.StreamEvent, error) {
+	backlog, events, err := s.Source.SubscribeEvents(ctx, filter, lastEventID)
+	s.ready <- struct{}{}
+
+	return backlog, events, err
+}
+
+func escalationPolicies(escalations []model.Escalation) []model.EscalationPolicy {
+	policies := make([]model.EscalationPolicy, 0, len(escalations))
+	for _, escalation := range escalations {
+		policies = append(policies, escalation.Policy)
+	}
+
+	return policies
+}
+
+func TestDomain(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	repo := memory.New()
+	_, err := repo.CreateTeam(ctx, "backend")
+	require.NoError(t, err)
+	require.NoError(t, repo.InsertTeamMembers(ctx, "backend", []model.User{
+		{ID: "u1", Username: "alice", IsActive: true},
+		{ID: "u2", Username: "bob", IsActive: true},
+		{ID: "u3", Username: "carol", IsActive: true},
+		{ID: "u4", Username: "dave", IsActive: true},
+	}))
+	_, err = repo.CreateTeam(ctx, "frontend")
+	require.NoError(t, err)
+	require.NoError(t, repo.InsertTeamMembers(ctx, "frontend", []model.User{
+		{ID: "f1", Username: "fred", IsActive: true},
+		{ID: "f2", Username: "gina", IsActive: true},
+		{ID: "f3", Username: "hank", IsActive: true},
+	}))
+	_, err = repo.CreateTeam(ctx, "leads")
+	require.NoError(t, err)
+	require.NoError(t, repo.InsertTeamMembers(ctx, "leads", []model.User{
+		{ID: "l1", Username: "lena", IsActive: true},
+	}))
+
+	logger := slog.New(slog.DiscardHandler)
+	svc := usecase.New(repo, logger)
+	source := readySource{Source: svc, ready: make(chan struct{}, 1)}
+	domain := NewDomain(source, logger)
+
+	go domain.Run(ctx)
+	<-source.ready
+
+	pr, err := svc.CreatePR(ctx, "pr-1", "Add search", "u1")
+	require.NoError(t, err)
+
+	_, err = svc.CreatePR(ctx, "pr-2", "Fix search", "u1")
+	require.NoError(t, err)
+
+	_, err = svc.CreatePR(ctx, "pr-3", "Add page", "f1")
+	require.NoError(t, err)
+
+	_, err = svc.MergePR(ctx, "pr-2", usecase.AnyVersion, model.ChangeInfo{})
+	require.NoError(t, err)
+
+	_, _, err = svc.ReassignReviewer(ctx, pr.ID, pr.Reviewers[0], usecase.AnyVersion, model.ChangeInfo{})
+	require.NoError(t, err)
+
+	// the author and both other members of frontend are on pr-3 already
+	_, _, err = svc.ReassignReviewer(ctx, "pr-3", "f2", usecase.AnyVersion, model.ChangeInfo{})
+	require.ErrorIs(t, err, usecase.ErrNoReplacementCandidate)
+
+	// one reviewer of pr-1 is replaced by the member reassigned away before,
+	// the other is notified
+	overdue := time.Now().Add(2 * time.Hour)
+	escalations, err := svc.EscalateOverdueReviews(ctx, model.EscalationRule{
+		TeamName: "backend",
+		SLA:      time.Hour,
+		Policy:   model.EscalationReassign,
+	}, overdue)
+	require.NoError(t, err)
+	require.ElementsMatch(t,
+		[]model.EscalationPolicy{model.EscalationReassign, model.EscalationNotify},
+		escalationPolicies(escalations),
+	)
+
+	// the lead is added for one reviewer of pr-3, the other is notified
+	escalations, err = svc.EscalateOverdueReviews(ctx, model.EscalationRule{
+		TeamName: "frontend",
+		SLA:      time.Hour,
+		Policy:   model.EscalationAddLead,
+		LeadID:   "l1",
+	}, overdue)
+	require.NoError(t, err)
+	require.ElementsMatch(t,
+		[]model.EscalationPolicy{model.EscalationAddLead, model.EscalationNotify},
+		escalationPolicies(escalations),
+	)
+
+	expected := `
+# HELP reviewchecker_assignments_total Reviewers assigned on creation, reassignment or escalation.
+# TYPE reviewchecker_assignments_total counter
+reviewchecker_assignments_total 9
+# HELP reviewchecker_merges_total Pull requests merged.
+# TYPE reviewchecker_merges_total counter
+reviewchecker_merges_total 1
+# HELP reviewchecker_no_replacement_candidate_total Reassignments rejected because the team has no active candidate.
+# TYPE reviewchecker_no_replacement_candidate_total counter
+reviewchecker_no_replacement_candidate_total 1
+# HELP reviewchecker_open_pull_requests Open pull requests by the team of the author.
+# TYPE reviewchecker_open_pull_requests gauge
+reviewchecker_open_pull_requests{team="backend"} 1
+reviewchecker_open_pull_requests{team="frontend"} 1
+reviewchecker_open_pull_requests{team="leads"} 0
+# HELP reviewchecker_reassignments_total Reviewers replaced by another member of their team.
+# TYPE reviewchecker_reassignments_total counter
+reviewchecker_reassignments_total 2
+`
+
+	// events are counted by Run in the background
+	require.Eventually(t, func() bool {
+		return testutil.CollectAndCompare(domain, strings.NewReader(expected)) == nil
+	}, time.Second, 10*time.Millisecond)
+}
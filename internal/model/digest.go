@@ -0,0 +1,9 @@
+package model
+
+import "time"
+
+// DigestItem is an open pull request waiting for a reviewer since AssignedAt.
+type DigestItem struct {
+	PullRequest PullRequest
+	AssignedAt  time.Time
+}
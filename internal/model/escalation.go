@@ -0,0 +1,45 @@
+package model
+
+import "time"
+
+// EscalationPolicy is what happens when a reviewer misses the review SLA.
+type EscalationPolicy string
+
+const (
+	// EscalationNotify only records the escalation and tells the team.
+	EscalationNotify EscalationPolicy = "notify"
+	// EscalationReassign replaces the reviewer with another team member.
+	EscalationReassign EscalationPolicy = "reassign"
+	// EscalationAddLead adds the team lead as an extra reviewer.
+	EscalationAddLead EscalationPolicy = "add_lead"
+)
+
+// EscalationRule is the review SLA of a team: reviewers of open pull requests
+// assigned longer than SLA ago are escalated according to Policy. LeadID is
+// the team lead added by EscalationAddLead.
+type EscalationRule struct {
+	TeamName string
+	SLA      time.Duration
+	Policy   EscalationPolicy
+	LeadID   string
+}
+
+// Assignment is a reviewer of a pull request since AssignedAt. Every
+// assignment is escalated at most once.
+type Assignment struct {
+	PullRequestID string
+	ReviewerID    string
+	AssignedAt    time.Time
+}
+
+// Escalation is a reviewer who missed the SLA and what was done about it.
+// Policy is the one applied, which falls back to EscalationNotify when the
+// reviewer can not be replaced or the lead can not be added. NewReviewerID is
+// the replacement or the lead.
+type Escalation struct {
+	PullRequestID string
+	ReviewerID    string
+	AssignedAt    time.Time
+	Policy        EscalationPolicy
+	NewReviewerID string
+}
@@ -0,0 +1,54 @@
+package model
+
+import "time"
+
+type AssignmentEventType string
+
+const (
+	// AssignmentEventCreated is written for every reviewer assigned when the
+	// pull request is created, or once without a reviewer if none was found.
+	AssignmentEventCreated AssignmentEventType = "CREATED"
+	// AssignmentEventReassigned is written when a reviewer is replaced on request.
+	AssignmentEventReassigned AssignmentEventType = "REASSIGNED"
+	AssignmentEventMerged     AssignmentEventType = "MERGED"
+	// AssignmentEventEscalationNotified, AssignmentEventEscalationReassigned
+	// and AssignmentEventEscalationLeadAdded are written when a reviewer in
+	// OldReviewerID misses the review SLA of the team. NewReviewerID is the
+	// replacement or the added team lead.
+	AssignmentEventEscalationNotified   AssignmentEventType = "ESCALATION_NOTIFIED"
+	AssignmentEventEscalationReassigned AssignmentEventType = "ESCALATION_REASSIGNED"
+	AssignmentEventEscalationLeadAdded  AssignmentEventType = "ESCALATION_LEAD_ADDED"
+)
+
+// IsEscalation reports whether the event records a missed review SLA.
+func (t AssignmentEventType) IsEscalation() bool {
+	switch t {
+	case AssignmentEventEscalationNotified,
+		AssignmentEventEscalationReassigned,
+		AssignmentEventEscalationLeadAdded:
+		return true
+	default:
+		return false
+	}
+}
+
+// AssignmentEvent is an append-only record of a change of pull request
+// reviewers or status. OldReviewerID, NewReviewerID and ActorID are empty when
+// they do not apply.
+type AssignmentEvent struct {
+	ID            int64
+	PullRequestID string
+	Type          AssignmentEventType
+	OldReviewerID string
+	NewReviewerID string
+	ActorID       string
+	Reason        string
+	CreatedAt     time.Time
+}
+
+// ChangeInfo tells who requested a change and why. It is copied into the
+// assignment events the change produces.
+type ChangeInfo struct {
+	ActorID string
+	Reason  string
+}
@@ -3,6 +3,7 @@ package httpmodel
 type TeamMember struct {
 	UserID   string `json:"user_id"`
 	Username string `json:"username"`
+	Email    string `json:"email,omitempty"`
 	IsActive bool   `json:"is_active"`
 }
 
@@ -18,12 +19,15 @@ type TeamResponse struct {
 type SetUserActiveRequest struct {
 	UserID   string `json:"user_id"`
 	IsActive bool   `json:"is_active"`
+	ActorID  string `json:"actor_id,omitempty"`
+	Reason   string `json:"reason,omitempty"`
 }
 
 type User struct {
 	UserID   string `json:"user_id"`
 	Username string `json:"username"`
 	TeamName string `json:"team_name"`
+	Email    string `json:"email,omitempty"`
 	IsActive bool   `json:"is_active"`
 }
 
@@ -34,6 +38,7 @@ type SetUserActiveResponse struct {
 type UserReviewsResponse struct {
 	UserID       string             `json:"user_id"`
 	PullRequests []PullRequestShort `json:"pull_requests"`
+	NextCursor   string             `json:"next_cursor,omitempty"`
 }
 
 type PullRequest struct {
@@ -49,14 +54,19 @@ type PullRequest struct {
 type ErrorCode string
 
 const (
-	ErrorCodeNotFound     ErrorCode = "NOT_FOUND"
-	ErrorCodePRMerged     ErrorCode = "PR_MERGED"
-	ErrorCodeNotAssigned  ErrorCode = "NOT_ASSIGNED"
-	ErrorCodeNoCandidate  ErrorCode = "NO_CANDIDATE"
-	ErrorCodeTeamExists   ErrorCode = "TEAM_EXISTS"
-	ErrorCodePRExists     ErrorCode = "PR_EXISTS"
-	ErrorCodeInternal     ErrorCode = "INTERNAL_ERROR"
-	ErrorCodeInvalidInput ErrorCode = "INVALID_REQUEST"
+	ErrorCodeNotFound             ErrorCode = "NOT_FOUND"
+	ErrorCodePRMerged             ErrorCode = "PR_MERGED"
+	ErrorCodeNotAssigned          ErrorCode = "NOT_ASSIGNED"
+	ErrorCodeNoCandidate          ErrorCode = "NO_CANDIDATE"
+	ErrorCodeTeamExists           ErrorCode = "TEAM_EXISTS"
+	ErrorCodePRExists             ErrorCode = "PR_EXISTS"
+	ErrorCodeConflict             ErrorCode = "CONFLICT"
+	ErrorCodePreconditionFailed   ErrorCode = "PRECONDITION_FAILED"
+	ErrorCodeIdempotencyKeyReused ErrorCode = "IDEMPOTENCY_KEY_REUSED"
+	ErrorCodeUnauthorized         ErrorCode = "UNAUTHORIZED"
+	ErrorCodeUnknownIdentity      ErrorCode = "UNKNOWN_IDENTITY"
+	ErrorCodeInternal             ErrorCode = "INTERNAL_ERROR"
+	ErrorCodeInvalidInput         ErrorCode = "INVALID_REQUEST"
 )
 
 type PullRequestResponse struct {
@@ -78,20 +88,42 @@ type PullRequestCreateRequest struct {
 }
 
 type PullRequestMergeRequest struct {
-	ID string `json:"pull_request_id"`
+	ID      string `json:"pull_request_id"`
+	ActorID string `json:"actor_id,omitempty"`
+	Reason  string `json:"reason,omitempty"`
 }
 
 type PullRequestReassignRequest struct {
 	ID        string `json:"pull_request_id"`
 	OldUserID string `json:"old_user_id"`
+	ActorID   string `json:"actor_id,omitempty"`
+	Reason    string `json:"reason,omitempty"`
+}
+
+type AssignmentEvent struct {
+	EventID       int64  `json:"event_id"`
+	Type          string `json:"type"`
+	OldReviewerID string `json:"old_reviewer_id,omitempty"`
+	NewReviewerID string `json:"new_reviewer_id,omitempty"`
+	ActorID       string `json:"actor_id,omitempty"`
+	Reason        string `json:"reason"`
+	CreatedAt     string `json:"created_at"`
+}
+
+type PullRequestHistoryResponse struct {
+	PullRequestID string            `json:"pull_request_id"`
+	Events        []AssignmentEvent `json:"events"`
 }
 
 type ReviewerStat struct {
-	UserID        string `json:"user_id"`
-	Username      string `json:"username"`
-	TeamName      string `json:"team_name"`
-	TotalAssigned int    `json:"total_assigned"`
-	OpenAssigned  int    `json:"open_assigned"`
+	UserID              string `json:"user_id"`
+	Username            string `json:"username"`
+	TeamName            string `json:"team_name"`
+	IsActive            bool   `json:"is_active"`
+	TotalAssigned       int    `json:"total_assigned"`
+	OpenAssigned        int    `json:"open_assigned"`
+	LastAssignedAt      string `json:"last_assigned_at,omitempty"`
+	DaysSinceLastReview *int   `json:"days_since_last_review,omitempty"`
 }
 
 type ReviewerStatsResponse struct {
@@ -103,10 +135,134 @@ type AuthorStat struct {
 	Count    int    `json:"count"`
 }
 
+type Percentiles struct {
+	P50 float64 `json:"p50_seconds"`
+	P90 float64 `json:"p90_seconds"`
+	P99 float64 `json:"p99_seconds"`
+}
+
+type TeamTimeToMerge struct {
+	TeamName    string      `json:"team_name"`
+	TimeToMerge Percentiles `json:"time_to_merge"`
+}
+
 type PullRequestStatsResponse struct {
-	Total         int          `json:"total"`
-	Open          int          `json:"open"`
-	Merged        int          `json:"merged"`
-	AverageReview float64      `json:"average_reviewers"`
-	ByAuthor      []AuthorStat `json:"by_author"`
+	Total             int               `json:"total"`
+	Open              int               `json:"open"`
+	Merged            int               `json:"merged"`
+	AverageReview     float64           `json:"average_reviewers"`
+	ByAuthor          []AuthorStat      `json:"by_author"`
+	TimeToMerge       *Percentiles      `json:"time_to_merge,omitempty"`
+	TimeToMergeByTeam []TeamTimeToMerge `json:"time_to_merge_by_team"`
+}
+
+type TeamPullRequestStat struct {
+	Open              int     `json:"open"`
+	Merged            int     `json:"merged"`
+	Understaffed      int     `json:"understaffed"`
+	UnderstaffedShare float64 `json:"understaffed_share"`
+}
+
+type TeamMemberStat struct {
+	Active   int `json:"active"`
+	Inactive int `json:"inactive"`
+}
+
+type OpenAssignmentStat struct {
+	Min  int     `json:"min"`
+	Max  int     `json:"max"`
+	Mean float64 `json:"mean"`
+}
+
+type TeamStat struct {
+	TeamName        string              `json:"team_name"`
+	PullRequests    TeamPullRequestStat `json:"pull_requests"`
+	Members         TeamMemberStat      `json:"members"`
+	OpenAssignments OpenAssignmentStat  `json:"open_assignments"`
+}
+
+type TeamStatsResponse struct {
+	Teams []TeamStat `json:"teams"`
+}
+
+type Distribution struct {
+	Mean   float64 `json:"mean"`
+	StdDev float64 `json:"stddev"`
+	Gini   float64 `json:"gini"`
+}
+
+type ReviewerOutlier struct {
+	UserID        string  `json:"user_id"`
+	Username      string  `json:"username"`
+	TotalAssigned int     `json:"total_assigned"`
+	OpenAssigned  int     `json:"open_assigned"`
+	TotalScore    float64 `json:"total_score"`
+	OpenScore     float64 `json:"open_score"`
+}
+
+type TeamFairness struct {
+	TeamName      string            `json:"team_name"`
+	ActiveMembers int               `json:"active_members"`
+	TotalAssigned Distribution      `json:"total_assigned"`
+	OpenAssigned  Distribution      `json:"open_assigned"`
+	Outliers      []ReviewerOutlier `json:"outliers"`
+}
+
+type FairnessResponse struct {
+	Sigma float64        `json:"sigma"`
+	Teams []TeamFairness `json:"teams"`
+}
+
+type TimeseriesPoint struct {
+	Start string `json:"start"`
+	Count int    `json:"count"`
+}
+
+type TimeseriesResponse struct {
+	Metric string            `json:"metric"`
+	Bucket string            `json:"bucket"`
+	Points []TimeseriesPoint `json:"points"`
+}
+
+type WebhookSubscriptionCreateRequest struct {
+	URL        string   `json:"url"`
+	Secret     string   `json:"secret,omitempty"`
+	EventTypes []string `json:"event_types,omitempty"`
+}
+
+type WebhookSubscriptionDeleteRequest struct {
+	ID string `json:"subscription_id"`
+}
+
+// WebhookSubscription carries the secret only in the create response.
+type WebhookSubscription struct {
+	ID         string   `json:"subscription_id"`
+	URL        string   `json:"url"`
+	Secret     string   `json:"secret,omitempty"`
+	EventTypes []string `json:"event_types"`
+	CreatedAt  string   `json:"created_at"`
+}
+
+type WebhookSubscriptionResponse struct {
+	Subscription WebhookSubscription `json:"subscription"`
+}
+
+type WebhookSubscriptionsResponse struct {
+	Subscriptions []WebhookSubscription `json:"subscriptions"`
+}
+
+type WebhookDelivery struct {
+	DeliveryID     int64  `json:"delivery_id"`
+	SubscriptionID string `json:"subscription_id"`
+	EventID        int64  `json:"event_id"`
+	Status         string `json:"status"`
+	Attempts       int    `json:"attempts"`
+	NextAttemptAt  string `json:"next_attempt_at"`
+	LastError      string `json:"last_error,omitempty"`
+	CreatedAt      string `json:"created_at"`
+	UpdatedAt      string `json:"updated_at"`
+}
+
+type WebhookDeliveriesResponse struct {
+	Deliveries []WebhookDelivery `json:"deliveries"`
 }
@@ -13,6 +13,8 @@ type User struct {
 	ID       string
 	Username string
 	TeamName string
+	// Email is where email notifications are sent, empty when unknown.
+	Email    string
 	IsActive bool
 }
 
@@ -20,6 +22,10 @@ type Team struct {
 	Name string
 }
 
+// DesiredReviewers is the number of reviewers assigned to a new pull request
+// when the team has enough candidates.
+const DesiredReviewers = 2
+
 type PullRequest struct {
 	ID        string
 	Name      string
@@ -28,4 +34,23 @@ type PullRequest struct {
 	Reviewers []string
 	CreatedAt time.Time
 	MergedAt  *time.Time
+	// Version grows by one on every change of the pull request and is
+	// exposed to clients as its ETag.
+	Version int
+}
+
+type ReviewCursor struct {
+	CreatedAt time.Time
+	ID        string
+}
+
+type ReviewFilter struct {
+	Status PRStatus
+	Limit  int
+	After  *ReviewCursor
+}
+
+type PullRequestPage struct {
+	PullRequests []PullRequest
+	Next         *ReviewCursor
 }
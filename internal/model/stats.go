@@ -1,11 +1,20 @@
 package model
 
+import "time"
+
 type ReviewerStat struct {
 	UserID        string
 	Username      string
 	TeamName      string
+	IsActive      bool
 	TotalAssigned int
 	OpenAssigned  int
+	// LastAssignedAt is nil when the user has no assignments.
+	LastAssignedAt *time.Time
+	// DaysSinceLastReview counts whole days from LastAssignedAt to now. The
+	// service has no review verdicts, so the last assignment stands for the
+	// last review.
+	DaysSinceLastReview *int
 }
 
 type AuthorStat struct {
@@ -13,10 +22,152 @@ type AuthorStat struct {
 	Count    int
 }
 
+// TeamCount counts pull requests by the team of their author.
+type TeamCount struct {
+	TeamName string
+	Count    int
+}
+
 type PullRequestStats struct {
 	Total         int
 	Open          int
 	Merged        int
 	AverageReview float64
 	ByAuthor      []AuthorStat
+	// TimeToMerge is nil when no pull request is merged.
+	TimeToMerge       *Percentiles
+	TimeToMergeByTeam []TeamTimeToMerge
+}
+
+// Percentiles are the 50th, 90th and 99th percentiles of a duration,
+// interpolated linearly like percentile_cont.
+type Percentiles struct {
+	P50 time.Duration
+	P90 time.Duration
+	P99 time.Duration
+}
+
+// TeamTimeToMerge is the time from creation to merge of the pull requests of
+// the team members.
+type TeamTimeToMerge struct {
+	TeamName    string
+	TimeToMerge Percentiles
+}
+
+// TeamStat describes the pull requests authored by a team and the review load
+// of its members.
+type TeamStat struct {
+	TeamName  string
+	OpenPRs   int
+	MergedPRs int
+	// UnderstaffedPRs have fewer than DesiredReviewers reviewers because the
+	// team had too few candidates.
+	UnderstaffedPRs int
+
+	ActiveMembers   int
+	InactiveMembers int
+	// MinOpenAssigned, MaxOpenAssigned and MeanOpenAssigned describe the open
+	// pull requests assigned per active member.
+	MinOpenAssigned  int
+	MaxOpenAssigned  int
+	MeanOpenAssigned float64
+}
+
+// Distribution summarizes the assignment counts of the active members of a
+// team. StdDev is the population standard deviation.
+type Distribution struct {
+	Mean   float64
+	StdDev float64
+	Gini   float64
+}
+
+// TeamFairness describes how evenly reviews are spread over the active
+// members of a team.
+type TeamFairness struct {
+	TeamName      string
+	ActiveMembers int
+	TotalAssigned Distribution
+	OpenAssigned  Distribution
+	Outliers      []ReviewerOutlier
+}
+
+// ReviewerOutlier is a member whose assignment counts are further from the
+// mean than the requested number of standard deviations. TotalScore and
+// OpenScore are the distances in standard deviations, negative below the mean.
+type ReviewerOutlier struct {
+	UserID        string
+	Username      string
+	TotalAssigned int
+	OpenAssigned  int
+	TotalScore    float64
+	OpenScore     float64
+}
+
+// StatsFilter narrows statistics to the half-open window [From, To) and to
+// the team TeamName. Nil bounds and an empty TeamName do not filter.
+type StatsFilter struct {
+	From     *time.Time
+	To       *time.Time
+	TeamName string
+}
+
+// TimeseriesMetric is what a time series counts.
+type TimeseriesMetric string
+
+const (
+	// MetricPRsCreated counts pull requests by created_at and author team.
+	MetricPRsCreated TimeseriesMetric = "prs_created"
+	// MetricPRsMerged counts pull requests by merged_at and author team.
+	MetricPRsMerged TimeseriesMetric = "prs_merged"
+	// MetricAssignments counts reviewer assignments by assigned_at and
+	// reviewer team.
+	MetricAssignments TimeseriesMetric = "assignments"
+)
+
+// TimeseriesMetrics lists every metric a time series may count.
+var TimeseriesMetrics = []TimeseriesMetric{
+	MetricPRsCreated,
+	MetricPRsMerged,
+	MetricAssignments,
+}
+
+// TimeseriesBucket is the width of a time series point. Buckets start at
+// midnight UTC, weeks on Monday like date_trunc.
+type TimeseriesBucket string
+
+const (
+	BucketDay  TimeseriesBucket = "day"
+	BucketWeek TimeseriesBucket = "week"
+)
+
+const daysPerWeek = 7
+
+// Truncate returns the start of the bucket containing t.
+func (b TimeseriesBucket) Truncate(t time.Time) time.Time {
+	t = t.UTC()
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+
+	if b == BucketWeek {
+		// time.Weekday starts on Sunday
+		sinceMonday := (int(day.Weekday()) + daysPerWeek - 1) % daysPerWeek
+
+		return day.AddDate(0, 0, -sinceMonday)
+	}
+
+	return day
+}
+
+// Next returns the start of the bucket after the one starting at start.
+func (b TimeseriesBucket) Next(start time.Time) time.Time {
+	if b == BucketWeek {
+		return start.AddDate(0, 0, daysPerWeek)
+	}
+
+	return start.AddDate(0, 0, 1)
+}
+
+// TimeseriesPoint is the count of a bucket starting at Start.
+type TimeseriesPoint struct {
+	Start time.Time
+	Count int
 }
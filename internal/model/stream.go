@@ -0,0 +1,28 @@
+package model
+
+import (
+	"encoding/json"
+	"slices"
+	"time"
+)
+
+// StreamEvent is a committed change pushed to live subscribers.
+type StreamEvent struct {
+	ID   int64
+	Type DomainEventType
+	// UserIDs lists the users the event concerns and is used for filtering.
+	UserIDs   []string
+	Payload   json.RawMessage
+	CreatedAt time.Time
+}
+
+func (e StreamEvent) Involves(userID string) bool {
+	return slices.Contains(e.UserIDs, userID)
+}
+
+// StreamFilter narrows the stream to events concerning a user and/or any
+// member of a team. Empty fields match everything.
+type StreamFilter struct {
+	TeamName string
+	UserID   string
+}
@@ -0,0 +1,89 @@
+package model
+
+import (
+	"encoding/json"
+	"slices"
+	"time"
+)
+
+type DomainEventType string
+
+const (
+	EventPRCreated          DomainEventType = "pr.created"
+	EventReviewerReassigned DomainEventType = "reviewer.reassigned"
+	EventPRMerged           DomainEventType = "pr.merged"
+	// EventReviewEscalated is published when a reviewer misses the review SLA
+	// and the team is notified or its lead added as a reviewer. Reassignments
+	// publish EventReviewerReassigned instead.
+	EventReviewEscalated DomainEventType = "review.escalated"
+	// EventUserActivityChanged is only pushed to the event stream, it is not
+	// stored in the outbox.
+	EventUserActivityChanged DomainEventType = "user.activity_changed"
+)
+
+// DomainEventTypes lists every event type subscriptions may filter on.
+var DomainEventTypes = []DomainEventType{
+	EventPRCreated,
+	EventReviewerReassigned,
+	EventPRMerged,
+	EventReviewEscalated,
+}
+
+// OutboxEvent is a domain event stored in the same transaction as the change
+// it describes. Payload holds the JSON document delivered to subscribers.
+type OutboxEvent struct {
+	ID            int64
+	Type          DomainEventType
+	PullRequestID string
+	Payload       json.RawMessage
+	CreatedAt     time.Time
+}
+
+// WebhookSubscription receives events of EventTypes, or all events when
+// EventTypes is empty, signed with Secret.
+type WebhookSubscription struct {
+	ID         string
+	URL        string
+	Secret     string
+	EventTypes []DomainEventType
+	CreatedAt  time.Time
+}
+
+func (s WebhookSubscription) Accepts(eventType DomainEventType) bool {
+	return len(s.EventTypes) == 0 || slices.Contains(s.EventTypes, eventType)
+}
+
+type DeliveryStatus string
+
+const (
+	DeliveryPending   DeliveryStatus = "PENDING"
+	DeliveryDelivered DeliveryStatus = "DELIVERED"
+	// DeliveryDead marks deliveries that ran out of attempts.
+	DeliveryDead DeliveryStatus = "DEAD"
+)
+
+type WebhookDelivery struct {
+	ID             int64
+	SubscriptionID string
+	EventID        int64
+	Status         DeliveryStatus
+	Attempts       int
+	NextAttemptAt  time.Time
+	LastError      string
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+}
+
+// PendingDelivery is a claimed delivery together with everything needed to
+// send it.
+type PendingDelivery struct {
+	Delivery     WebhookDelivery
+	Subscription WebhookSubscription
+	Event        OutboxEvent
+}
+
+type DeliveryFilter struct {
+	SubscriptionID string
+	Status         DeliveryStatus
+	Limit          int
+}
@@ -0,0 +1,241 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/6ermvH/avito-reviewchecker/internal/model"
+)
+
+// DigestSource is the part of the service the digest is built from.
+type DigestSource interface {
+	GetTeam(ctx context.Context, teamName string) (model.Team, []model.User, error)
+	ReviewDigest(ctx context.Context, userID string) ([]model.DigestItem, error)
+}
+
+// DigestTeam schedules the daily digest of a team at Hour:Minute in Location.
+type DigestTeam struct {
+	Name     string
+	Hour     int
+	Minute   int
+	Location *time.Location
+	// SLA is how long reviewers have before a pull request is highlighted,
+	// zero for never.
+	SLA time.Duration
+}
+
+// DigestEntry is an open pull request in a digest.
+type DigestEntry struct {
+	PullRequestID   string
+	PullRequestName string
+	Author          Recipient
+	AssignedAt      time.Time
+	Waiting         time.Duration
+	OverSLA         bool
+}
+
+// WaitingText formats Waiting in days and hours, like "2d 5h".
+func (e DigestEntry) WaitingText() string {
+	days := int(e.Waiting / (24 * time.Hour))
+	hours := int(e.Waiting % (24 * time.Hour) / time.Hour)
+
+	switch {
+	case days > 0:
+		return fmt.Sprintf("%dd %dh", days, hours)
+	case hours > 0:
+		return fmt.Sprintf("%dh", hours)
+	default:
+		return "<1h"
+	}
+}
+
+// Digest lists the pull requests waiting for one reviewer. Chat and email
+// templates are executed with it.
+type Digest struct {
+	Team     string
+	Reviewer Recipient
+	Entries  []DigestEntry
+	// OverSLA is the number of entries past the SLA.
+	OverSLA int
+}
+
+// Digests sends every member of a team a daily digest of open pull requests:
+// a message to the chat webhook of the team mentioning them and an email.
+// Inactive members and members with nothing to review are left out.
+type Digests struct {
+	source   DigestSource
+	resolver resolver
+	notifier *Notifier
+	mailer   *Mailer
+	logger   *slog.Logger
+	teams    []DigestTeam
+	now      func() time.Time
+}
+
+// NewDigests sends digests through notifier and mailer, either of which may be
+// nil.
+func NewDigests(
+	source DigestSource,
+	users Users,
+	notifier *Notifier,
+	mailer *Mailer,
+	logger *slog.Logger,
+	teams []DigestTeam,
+) *Digests {
+	r := resolver{users: users}
+
+	if notifier != nil {
+		r.mentions = notifier.resolver.mentions
+	}
+
+	if mailer != nil {
+		r.emails = mailer.resolver.emails
+	}
+
+	return &Digests{
+		source:   source,
+		resolver: r,
+		notifier: notifier,
+		mailer:   mailer,
+		logger:   logger,
+		teams:    teams,
+		now:      time.Now,
+	}
+}
+
+// Run sends the digest of every team at its time until ctx is done.
+func (d *Digests) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+
+	for _, team := range d.teams {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for {
+				now := d.now()
+				if !sleep(ctx, nextDigest(now, team).Sub(now)) {
+					return
+				}
+
+				if err := d.Send(ctx, team); err != nil {
+					d.logger.Error("send digest", "team", team.Name, "error", err)
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+}
+
+// nextDigest returns the first digest time of team after now.
+func nextDigest(now time.Time, team DigestTeam) time.Time {
+	local := now.In(team.Location)
+	year, month, day := local.Date()
+
+	next := time.Date(year, month, day, team.Hour, team.Minute, 0, 0, team.Location)
+	if !next.After(local) {
+		next = time.Date(year, month, day+1, team.Hour, team.Minute, 0, 0, team.Location)
+	}
+
+	return next
+}
+
+// Send builds the digests of the members of team now and queues them.
+func (d *Digests) Send(ctx context.Context, team DigestTeam) error {
+	digests, err := d.build(ctx, team)
+	if err != nil {
+		return err
+	}
+
+	for _, digest := range digests {
+		if d.notifier != nil {
+			d.notifier.sendDigest(digest)
+		}
+
+		if d.mailer != nil {
+			d.mailer.sendDigest(digest)
+		}
+	}
+
+	return nil
+}
+
+// build returns the digests of the active members of team with pull requests
+// waiting for them. A member whose digest can not be built is logged and left
+// out, the rest of the team still gets theirs.
+func (d *Digests) build(ctx context.Context, team DigestTeam) ([]Digest, error) {
+	_, members, err := d.source.GetTeam(ctx, team.Name)
+	if err != nil {
+		return nil, fmt.Errorf("get team %q: %w", team.Name, err)
+	}
+
+	now := d.now()
+
+	var digests []Digest
+
+	for _, member := range members {
+		if !member.IsActive {
+			continue
+		}
+
+		digest, err := d.buildMember(ctx, team, member, now)
+		if err != nil {
+			d.logger.Error("build review digest",
+				"team", team.Name,
+				"userID", member.ID,
+				"error", err,
+			)
+
+			continue
+		}
+
+		if len(digest.Entries) > 0 {
+			digests = append(digests, digest)
+		}
+	}
+
+	return digests, nil
+}
+
+func (d *Digests) buildMember(
+	ctx context.Context,
+	team DigestTeam,
+	member model.User,
+	now time.Time,
+) (Digest, error) {
+	items, err := d.source.ReviewDigest(ctx, member.ID)
+	if err != nil {
+		return Digest{}, fmt.Errorf("build digest of %q: %w", member.ID, err)
+	}
+
+	digest := Digest{Team: team.Name, Reviewer: d.resolver.recipient(member)}
+
+	for _, item := range items {
+		author, err := d.resolver.user(ctx, item.PullRequest.AuthorID)
+		if err != nil {
+			return Digest{}, err
+		}
+
+		entry := DigestEntry{
+			PullRequestID:   item.PullRequest.ID,
+			PullRequestName: item.PullRequest.Name,
+			Author:          d.resolver.recipient(author),
+			AssignedAt:      item.AssignedAt,
+			Waiting:         now.Sub(item.AssignedAt),
+		}
+
+		if team.SLA > 0 && entry.Waiting > team.SLA {
+			entry.OverSLA = true
+			digest.OverSLA++
+		}
+
+		digest.Entries = append(digest.Entries, entry)
+	}
+
+	return digest, nil
+}
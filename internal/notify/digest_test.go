@@ -0,0 +1,199 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/6ermvH/avito-reviewchecker/internal/model"
+	"github.com/6ermvH/avito-reviewchecker/internal/repository/memory"
+	"github.com/6ermvH/avito-reviewchecker/internal/usecase"
+)
+
+func TestNextDigest(t *testing.T) {
+	moscow, err := time.LoadLocation("Europe/Moscow")
+	require.NoError(t, err)
+
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	require.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		now      time.Time
+		team     DigestTeam
+		expected time.Time
+	}{
+		{
+			name:     "later today",
+			now:      time.Date(2025, 3, 10, 5, 0, 0, 0, time.UTC),
+			team:     DigestTeam{Hour: 9, Location: moscow},
+			expected: time.Date(2025, 3, 10, 6, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "exactly now is tomorrow",
+			now:      time.Date(2025, 3, 10, 6, 0, 0, 0, time.UTC),
+			team:     DigestTeam{Hour: 9, Location: moscow},
+			expected: time.Date(2025, 3, 11, 6, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "day in the team timezone",
+			now:      time.Date(2025, 3, 10, 22, 0, 0, 0, time.UTC),
+			team:     DigestTeam{Hour: 8, Minute: 30, Location: moscow},
+			expected: time.Date(2025, 3, 11, 5, 30, 0, 0, time.UTC),
+		},
+		{
+			name:     "daylight saving time change",
+			now:      time.Date(2025, 3, 29, 12, 0, 0, 0, time.UTC),
+			team:     DigestTeam{Hour: 9, Location: berlin},
+			expected: time.Date(2025, 3, 30, 7, 0, 0, 0, time.UTC),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.True(t, tt.expected.Equal(nextDigest(tt.now, tt.team)), nextDigest(tt.now, tt.team))
+		})
+	}
+}
+
+func TestWaitingText(t *testing.T) {
+	require.Equal(t, "<1h", DigestEntry{Waiting: 59 * time.Minute}.WaitingText())
+	require.Equal(t, "5h", DigestEntry{Waiting: 5*time.Hour + 30*time.Minute}.WaitingText())
+	require.Equal(t, "2d 3h", DigestEntry{Waiting: 51 * time.Hour}.WaitingText())
+}
+
+var errDigestFailed = errors.New("digest failed")
+
+// failingDigestSource fails to list the open reviews of userID.
+type failingDigestSource struct {
+	DigestSource
+	userID string
+}
+
+func (s failingDigestSource) ReviewDigest(
+	ctx context.Context,
+	userID string,
+) ([]model.DigestItem, error) {
+	if userID == s.userID {
+		return nil, errDigestFailed
+	}
+
+	return s.DigestSource.ReviewDigest(ctx, userID)
+}
+
+func TestDigests(t *testing.T) {
+	ctx := context.Background()
+
+	repo := memory.New()
+	_, err := repo.CreateTeam(ctx, "backend")
+	require.NoError(t, err)
+	require.NoError(t, repo.InsertTeamMembers(ctx, "backend", []model.User{
+		{ID: "u1", Username: "alice", IsActive: true},
+		{ID: "u2", Username: "bob", IsActive: true},
+		{ID: "u3", Username: "carol", IsActive: true},
+	}))
+
+	svc := usecase.New(repo, slog.New(slog.DiscardHandler))
+	logger := slog.New(slog.DiscardHandler)
+
+	st := &stub{received: make(chan struct{}, 16)}
+	chat := httptest.NewServer(st)
+	t.Cleanup(chat.Close)
+
+	notifier, err := NewNotifier(svc, repo, chat.Client(), logger, Config{
+		Teams:       map[string]string{"backend": chat.URL},
+		Mentions:    map[string]string{"u2": "<@U2>"},
+		Timeout:     time.Second,
+		MaxAttempts: 1,
+		QueueSize:   16,
+	})
+	require.NoError(t, err)
+
+	smtp := newSMTPServer(t)
+
+	mailer, err := NewMailer(svc, repo, logger, MailConfig{
+		Host:        "127.0.0.1",
+		Port:        smtp.port(),
+		From:        "reviewchecker@example.com",
+		Emails:      map[string]string{"u2": "bob@example.com"},
+		Timeout:     time.Second,
+		MaxAttempts: 1,
+		QueueSize:   16,
+	})
+	require.NoError(t, err)
+
+	runCtx, cancel := context.WithCancel(ctx)
+	t.Cleanup(cancel)
+
+	go notifier.work(runCtx, notifier.channels["backend"])
+	go mailer.work(runCtx)
+
+	_, err = svc.CreatePR(ctx, "pr-1", "Add search", "u1")
+	require.NoError(t, err)
+
+	team := DigestTeam{Name: "backend", Location: time.UTC, SLA: 24 * time.Hour}
+
+	digests := NewDigests(svc, repo, notifier, mailer, logger, []DigestTeam{team})
+
+	t.Run("Good: chat and email list waiting pull requests", func(t *testing.T) {
+		digests.now = func() time.Time { return time.Now().Add(5 * time.Hour) }
+		require.NoError(t, digests.Send(ctx, team))
+
+		texts := st.wait(t, 2)
+		require.Len(t, texts, 2, "one message per reviewer, none for the author")
+		slices.Sort(texts)
+		require.Contains(t, texts[0], "<@U2>, your review digest: 1 waiting for you")
+		require.Contains(t, texts[0], "Add search (pr-1), 5h")
+		require.NotContains(t, texts[0], "carol", "digests are per reviewer")
+		require.Contains(t, texts[1], "@carol, your review digest: 1 waiting for you")
+
+		subject, text, html := bodies(t, smtp.wait(t, 1)["bob@example.com"])
+		require.Equal(t, "1 pull requests wait for your review", subject)
+		require.Contains(t, text, "Add search (pr-1) by alice, waiting 5h")
+		require.NotContains(t, text, "SLA")
+		require.Contains(t, html, "<li>Add search (pr-1)")
+	})
+
+	t.Run("Good: pull requests past the SLA are highlighted", func(t *testing.T) {
+		digests.now = func() time.Time { return time.Now().Add(30 * time.Hour) }
+		require.NoError(t, digests.Send(ctx, team))
+
+		texts := st.wait(t, 2)
+		require.Contains(t, texts[2], ":warning: *Add search* (pr-1), 1d 6h, over SLA")
+
+		_, text, _ := bodies(t, smtp.wait(t, 1)["bob@example.com"])
+		require.Contains(t, text, "waiting 1d 6h, OVER SLA")
+		require.Contains(t, text, "1 of them are past the review SLA")
+	})
+
+	t.Run("Good: a failing member does not hold back the team", func(t *testing.T) {
+		source := failingDigestSource{DigestSource: svc, userID: "u2"}
+		failing := NewDigests(source, repo, notifier, mailer, logger, []DigestTeam{team})
+		failing.now = digests.now
+
+		require.NoError(t, failing.Send(ctx, team))
+
+		texts := st.wait(t, 1)
+		require.Len(t, texts, 5)
+		require.Contains(t, texts[4], "@carol, your review digest: 1 waiting for you")
+		smtp.none(t)
+	})
+
+	t.Run("Good: nothing is sent without pull requests", func(t *testing.T) {
+		_, err := svc.MergePR(ctx, "pr-1", usecase.AnyVersion, model.ChangeInfo{})
+		require.NoError(t, err)
+
+		require.NoError(t, digests.Send(ctx, team))
+		smtp.none(t)
+	})
+
+	t.Run("Bad: unknown team", func(t *testing.T) {
+		require.Error(t, digests.Send(ctx, DigestTeam{Name: "missing", Location: time.UTC}))
+	})
+}
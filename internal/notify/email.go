@@ -0,0 +1,449 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"embed"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"io"
+	"io/fs"
+	"log/slog"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	texttemplate "text/template"
+	"time"
+
+	"github.com/6ermvH/avito-reviewchecker/internal/model"
+)
+
+// implicitTLSPort is the SMTP submission port that expects TLS from the first
+// byte instead of STARTTLS.
+const implicitTLSPort = 465
+
+//go:embed templates/email.txt templates/email.html
+var defaultMailTemplates embed.FS
+
+var errMissingTemplate = errors.New("missing template")
+
+// digestTemplate names the email templates of the daily digest.
+const digestTemplate = "digest"
+
+// mailTemplates are the templates every email.txt and email.html define, named
+// after the events that send email and the digest.
+var mailTemplates = []string{
+	string(model.EventPRCreated),
+	string(model.EventReviewerReassigned),
+	string(model.EventPRMerged),
+	string(model.EventReviewEscalated),
+	digestTemplate,
+}
+
+type MailConfig struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	// From is the sender address, with an optional display name.
+	From string
+	// Emails maps users.id to email addresses of users with no email stored.
+	// Users without either get no email.
+	Emails map[string]string
+	// TemplatesDir replaces the built-in templates with email.txt and
+	// email.html from the directory. Both define a template named after every
+	// event type and "digest", and email.txt also "<name>.subject".
+	TemplatesDir string
+	// Timeout bounds a single SMTP session.
+	Timeout time.Duration
+	// MaxAttempts is the number of attempts after which an email is dropped.
+	MaxAttempts int
+	BaseBackoff time.Duration
+	MaxBackoff  time.Duration
+	// QueueSize is how many emails may wait to be sent before new ones are
+	// dropped.
+	QueueSize int
+}
+
+// Mail is the data email templates are executed with.
+type Mail struct {
+	Message
+	// Recipient is the user the email is sent to.
+	Recipient Recipient
+}
+
+// Mailer emails reviewers about assignments and reassignments, and authors
+// and reviewers about merges. Emails are sent one at a time, transient SMTP
+// failures are retried with exponential backoff. Like Notifier it keeps the
+// queue in memory only.
+type Mailer struct {
+	source   Source
+	resolver resolver
+	logger   *slog.Logger
+	cfg      MailConfig
+	from     *mail.Address
+	text     *texttemplate.Template
+	html     *htmltemplate.Template
+	queue    chan email
+}
+
+type email struct {
+	to      string
+	eventID int64
+	body    []byte
+}
+
+func NewMailer(source Source, users Users, logger *slog.Logger, cfg MailConfig) (*Mailer, error) {
+	from, err := mail.ParseAddress(cfg.From)
+	if err != nil {
+		return nil, fmt.Errorf("parse from address %q: %w", cfg.From, err)
+	}
+
+	text, html, err := parseMailTemplates(cfg.TemplatesDir)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Mailer{
+		source:   source,
+		resolver: resolver{users: users, emails: cfg.Emails},
+		logger:   logger,
+		cfg:      cfg,
+		from:     from,
+		text:     text,
+		html:     html,
+		queue:    make(chan email, cfg.QueueSize),
+	}, nil
+}
+
+func parseMailTemplates(dir string) (*texttemplate.Template, *htmltemplate.Template, error) {
+	fsys, err := fs.Sub(defaultMailTemplates, "templates")
+	if err != nil {
+		return nil, nil, fmt.Errorf("open built-in templates: %w", err)
+	}
+
+	if dir != "" {
+		fsys = os.DirFS(dir)
+	}
+
+	text, err := texttemplate.New("email.txt").Option("missingkey=error").ParseFS(fsys, "email.txt")
+	if err != nil {
+		return nil, nil, fmt.Errorf("parse text templates: %w", err)
+	}
+
+	html, err := htmltemplate.New("email.html").
+		Option("missingkey=error").
+		ParseFS(fsys, "email.html")
+	if err != nil {
+		return nil, nil, fmt.Errorf("parse html templates: %w", err)
+	}
+
+	for _, name := range mailTemplates {
+		for _, missing := range []bool{
+			text.Lookup(name) == nil,
+			text.Lookup(name+".subject") == nil,
+			html.Lookup(name) == nil,
+		} {
+			if missing {
+				return nil, nil, fmt.Errorf("%w for %s", errMissingTemplate, name)
+			}
+		}
+	}
+
+	return text, html, nil
+}
+
+// Run listens to the event stream and sends emails until ctx is done.
+func (m *Mailer) Run(ctx context.Context) {
+	go m.work(ctx)
+
+	listen(ctx, m.source, m.logger, m.handle)
+}
+
+// handle renders the emails of an event and queues them without blocking.
+func (m *Mailer) handle(ctx context.Context, event model.StreamEvent) {
+	if m.text.Lookup(string(event.Type)) == nil {
+		return
+	}
+
+	emails, err := m.render(ctx, event)
+	if err != nil {
+		m.logger.Error("render email", "eventID", event.ID, "error", err)
+
+		return
+	}
+
+	for _, e := range emails {
+		m.enqueue(e)
+	}
+}
+
+// sendDigest queues the digest for its reviewer if they have an email.
+func (m *Mailer) sendDigest(digest Digest) {
+	if digest.Reviewer.Email == "" {
+		return
+	}
+
+	body, err := m.compose(digestTemplate, digest.Reviewer, digest)
+	if err != nil {
+		m.logger.Error("render digest", "userID", digest.Reviewer.ID, "error", err)
+
+		return
+	}
+
+	m.enqueue(email{to: digest.Reviewer.Email, body: body})
+}
+
+// enqueue queues e without blocking.
+func (m *Mailer) enqueue(e email) {
+	select {
+	case m.queue <- e:
+	default:
+		m.logger.Warn("email queue is full, email dropped", "eventID", e.eventID)
+	}
+}
+
+func (m *Mailer) render(ctx context.Context, event model.StreamEvent) ([]email, error) {
+	msg, assigned, err := m.resolver.describe(ctx, event)
+	if err != nil {
+		return nil, err
+	}
+
+	msg.Reviewers = make([]Recipient, 0, len(assigned))
+	for _, user := range assigned {
+		msg.Reviewers = append(msg.Reviewers, m.resolver.recipient(user))
+	}
+
+	// reviewers hear about assignments, authors and reviewers about merges,
+	// overdue reviewers and added leads about escalations
+	recipients := slices.Clone(msg.Reviewers)
+
+	switch event.Type {
+	case model.EventReviewerReassigned:
+		recipients = append(recipients, *msg.Replaced)
+	case model.EventReviewEscalated:
+		if msg.Added != nil {
+			recipients = append(recipients, *msg.Added)
+		}
+	case model.EventPRMerged:
+		recipients = append([]Recipient{msg.Author}, recipients...)
+	}
+
+	seen := make(map[string]struct{}, len(recipients))
+	emails := make([]email, 0, len(recipients))
+
+	for _, recipient := range recipients {
+		if _, ok := seen[recipient.ID]; ok || recipient.Email == "" {
+			continue
+		}
+
+		seen[recipient.ID] = struct{}{}
+
+		data := Mail{Message: msg, Recipient: recipient}
+
+		body, err := m.compose(string(event.Type), recipient, data)
+		if err != nil {
+			return nil, err
+		}
+
+		emails = append(emails, email{to: recipient.Email, eventID: event.ID, body: body})
+	}
+
+	return emails, nil
+}
+
+// compose builds a multipart/alternative message to recipient with the text
+// and HTML bodies of the named templates.
+func (m *Mailer) compose(name string, recipient Recipient, data any) ([]byte, error) {
+	var subject, text, html strings.Builder
+
+	if err := m.text.ExecuteTemplate(&subject, name+".subject", data); err != nil {
+		return nil, fmt.Errorf("execute %s subject template: %w", name, err)
+	}
+
+	if err := m.text.ExecuteTemplate(&text, name, data); err != nil {
+		return nil, fmt.Errorf("execute %s text template: %w", name, err)
+	}
+
+	if err := m.html.ExecuteTemplate(&html, name, data); err != nil {
+		return nil, fmt.Errorf("execute %s html template: %w", name, err)
+	}
+
+	var body bytes.Buffer
+
+	parts := multipart.NewWriter(&body)
+
+	for _, part := range []struct {
+		contentType string
+		content     string
+	}{
+		{"text/plain; charset=utf-8", text.String()},
+		{"text/html; charset=utf-8", html.String()},
+	} {
+		w, err := parts.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, fmt.Errorf("create %s part: %w", part.contentType, err)
+		}
+
+		qp := quotedprintable.NewWriter(w)
+		if _, err := io.WriteString(qp, part.content); err != nil {
+			return nil, fmt.Errorf("write %s part: %w", part.contentType, err)
+		}
+
+		if err := qp.Close(); err != nil {
+			return nil, fmt.Errorf("write %s part: %w", part.contentType, err)
+		}
+	}
+
+	if err := parts.Close(); err != nil {
+		return nil, fmt.Errorf("close message: %w", err)
+	}
+
+	to := mail.Address{Name: recipient.Username, Address: recipient.Email}
+
+	var msg bytes.Buffer
+
+	fmt.Fprintf(&msg, "From: %s\r\n", m.from)
+	fmt.Fprintf(&msg, "To: %s\r\n", &to)
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject.String()))
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&msg, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&msg, "Content-Type: multipart/alternative; boundary=%q\r\n\r\n", parts.Boundary())
+	msg.Write(body.Bytes())
+
+	return msg.Bytes(), nil
+}
+
+func (m *Mailer) work(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case e := <-m.queue:
+			m.deliver(ctx, e)
+		}
+	}
+}
+
+// deliver sends e until it succeeds, the server rejects it permanently,
+// MaxAttempts is reached or ctx is done.
+func (m *Mailer) deliver(ctx context.Context, e email) {
+	for attempt := 1; ; attempt++ {
+		err := m.send(ctx, e)
+		if err == nil {
+			return
+		}
+
+		var reply *textproto.Error
+
+		permanent := errors.As(err, &reply) && reply.Code >= 500
+
+		if permanent || attempt >= m.cfg.MaxAttempts {
+			m.logger.Warn("email dropped",
+				"eventID", e.eventID,
+				"attempts", attempt,
+				"error", err,
+			)
+
+			return
+		}
+
+		if !sleep(ctx, backoff(m.cfg.BaseBackoff, m.cfg.MaxBackoff, attempt)) {
+			return
+		}
+	}
+}
+
+// send delivers e in one SMTP session. STARTTLS is used when the server
+// offers it, and authentication when a username is set.
+func (m *Mailer) send(ctx context.Context, e email) error {
+	addr := net.JoinHostPort(m.cfg.Host, strconv.Itoa(m.cfg.Port))
+
+	conn, err := m.dial(ctx, addr)
+	if err != nil {
+		return fmt.Errorf("dial %s: %w", addr, err)
+	}
+	//nolint:errcheck
+	defer conn.Close()
+
+	if err := conn.SetDeadline(time.Now().Add(m.cfg.Timeout)); err != nil {
+		return fmt.Errorf("set deadline: %w", err)
+	}
+
+	client, err := smtp.NewClient(conn, m.cfg.Host)
+	if err != nil {
+		return fmt.Errorf("start session: %w", err)
+	}
+	//nolint:errcheck
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		err := client.StartTLS(&tls.Config{ServerName: m.cfg.Host, MinVersion: tls.VersionTLS12})
+		if err != nil {
+			return fmt.Errorf("starttls: %w", err)
+		}
+	}
+
+	if m.cfg.Username != "" {
+		// PlainAuth refuses to send the password unencrypted to remote hosts
+		auth := smtp.PlainAuth("", m.cfg.Username, m.cfg.Password, m.cfg.Host)
+		if err := client.Auth(auth); err != nil {
+			return fmt.Errorf("auth: %w", err)
+		}
+	}
+
+	if err := client.Mail(m.from.Address); err != nil {
+		return fmt.Errorf("mail from: %w", err)
+	}
+
+	if err := client.Rcpt(e.to); err != nil {
+		return fmt.Errorf("rcpt to: %w", err)
+	}
+
+	w, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("data: %w", err)
+	}
+
+	if _, err := w.Write(e.body); err != nil {
+		return fmt.Errorf("write message: %w", err)
+	}
+
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("send message: %w", err)
+	}
+
+	if err := client.Quit(); err != nil {
+		return fmt.Errorf("quit: %w", err)
+	}
+
+	return nil
+}
+
+func (m *Mailer) dial(ctx context.Context, addr string) (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: m.cfg.Timeout}
+
+	if m.cfg.Port == implicitTLSPort {
+		tlsDialer := &tls.Dialer{
+			NetDialer: dialer,
+			Config:    &tls.Config{ServerName: m.cfg.Host, MinVersion: tls.VersionTLS12},
+		}
+
+		return tlsDialer.DialContext(ctx, "tcp", addr) //nolint:wrapcheck
+	}
+
+	return dialer.DialContext(ctx, "tcp", addr) //nolint:wrapcheck
+}
@@ -0,0 +1,406 @@
+package notify
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"log/slog"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/6ermvH/avito-reviewchecker/internal/model"
+	"github.com/6ermvH/avito-reviewchecker/internal/repository/memory"
+	"github.com/6ermvH/avito-reviewchecker/internal/usecase"
+)
+
+// smtpServer is a local fake SMTP server. It answers MAIL FROM with the
+// queued reply codes, then with 250, and keeps every accepted message.
+type smtpServer struct {
+	listener net.Listener
+	mu       sync.Mutex
+	replies  []int
+	received chan receivedMail
+}
+
+type receivedMail struct {
+	to  string
+	msg *mail.Message
+}
+
+func newSMTPServer(t *testing.T, replies ...int) *smtpServer {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = listener.Close() })
+
+	srv := &smtpServer{listener: listener, replies: replies, received: make(chan receivedMail, 16)}
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+
+			go srv.serve(conn)
+		}
+	}()
+
+	return srv
+}
+
+func (s *smtpServer) port() int {
+	return s.listener.Addr().(*net.TCPAddr).Port
+}
+
+func (s *smtpServer) serve(conn net.Conn) {
+	tp := textproto.NewConn(conn)
+	defer tp.Close()
+
+	var to string
+
+	_ = tp.PrintfLine("220 fake ESMTP")
+
+	for {
+		line, err := tp.ReadLine()
+		if err != nil {
+			return
+		}
+
+		verb, arg, _ := strings.Cut(line, " ")
+
+		switch strings.ToUpper(verb) {
+		case "EHLO", "HELO", "NOOP", "RSET":
+			_ = tp.PrintfLine("250 fake")
+		case "MAIL":
+			s.mu.Lock()
+
+			code := 250
+			if len(s.replies) > 0 {
+				code, s.replies = s.replies[0], s.replies[1:]
+			}
+
+			s.mu.Unlock()
+
+			_ = tp.PrintfLine("%d sender", code)
+		case "RCPT":
+			to = strings.Trim(strings.TrimPrefix(arg, "TO:"), "<>")
+			_ = tp.PrintfLine("250 recipient")
+		case "DATA":
+			_ = tp.PrintfLine("354 go ahead")
+
+			data, err := tp.ReadDotBytes()
+			if err != nil {
+				return
+			}
+
+			msg, err := mail.ReadMessage(strings.NewReader(string(data)))
+			if err != nil {
+				return
+			}
+
+			s.received <- receivedMail{to: to, msg: msg}
+			_ = tp.PrintfLine("250 queued")
+		case "QUIT":
+			_ = tp.PrintfLine("221 bye")
+
+			return
+		default:
+			_ = tp.PrintfLine("502 unknown command")
+		}
+	}
+}
+
+func (s *smtpServer) wait(t *testing.T, n int) map[string]*mail.Message {
+	t.Helper()
+
+	mails := make(map[string]*mail.Message, n)
+
+	for range n {
+		select {
+		case m := <-s.received:
+			mails[m.to] = m.msg
+		case <-time.After(5 * time.Second):
+			t.Fatal("email was not delivered")
+		}
+	}
+
+	return mails
+}
+
+func (s *smtpServer) none(t *testing.T) {
+	t.Helper()
+
+	select {
+	case m := <-s.received:
+		t.Fatalf("unexpected email to %s", m.to)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+// bodies returns the subject and the text and HTML parts of msg.
+func bodies(t *testing.T, msg *mail.Message) (string, string, string) {
+	t.Helper()
+
+	subject, err := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	require.NoError(t, err)
+
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	require.NoError(t, err)
+	require.Equal(t, "multipart/alternative", mediaType)
+
+	parts := map[string]string{}
+	reader := multipart.NewReader(msg.Body, params["boundary"])
+
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+
+		require.NoError(t, err)
+
+		content, err := io.ReadAll(bufio.NewReader(part))
+		require.NoError(t, err)
+
+		parts[strings.Split(part.Header.Get("Content-Type"), ";")[0]] = string(content)
+	}
+
+	return subject, parts["text/plain"], parts["text/html"]
+}
+
+func TestMailer(t *testing.T) {
+	ctx := context.Background()
+
+	emails := map[string]string{
+		"u1": "alice@example.com",
+		"u2": "bob@example.com",
+		"u3": "carol@example.com",
+		"u4": "dave@example.com",
+	}
+
+	setup := func(t *testing.T, cfg MailConfig, replies ...int) (*usecase.Service, *smtpServer) {
+		t.Helper()
+
+		repo := memory.New()
+		_, err := repo.CreateTeam(ctx, "backend")
+		require.NoError(t, err)
+		require.NoError(t, repo.InsertTeamMembers(ctx, "backend", []model.User{
+			{ID: "u1", Username: "alice", IsActive: true},
+			{ID: "u2", Username: "bob", IsActive: true},
+			{ID: "u3", Username: "carol", IsActive: true},
+			{ID: "u4", Username: "dave", Email: "dave@example.com", IsActive: false},
+		}))
+
+		svc := usecase.New(repo, slog.New(slog.DiscardHandler))
+		srv := newSMTPServer(t, replies...)
+
+		cfg.Host = "127.0.0.1"
+		cfg.Port = srv.port()
+		cfg.From = "Reviewchecker <reviewchecker@example.com>"
+		cfg.Timeout = time.Second
+		cfg.BaseBackoff = time.Millisecond
+		cfg.MaxBackoff = time.Second
+		cfg.QueueSize = 16
+
+		if cfg.Emails == nil {
+			cfg.Emails = emails
+		}
+
+		if cfg.MaxAttempts == 0 {
+			cfg.MaxAttempts = 3
+		}
+
+		source := readySource{Source: svc, ready: make(chan struct{}, 1)}
+
+		mailer, err := NewMailer(source, repo, slog.New(slog.DiscardHandler), cfg)
+		require.NoError(t, err)
+
+		runCtx, cancel := context.WithCancel(ctx)
+		t.Cleanup(cancel)
+
+		go mailer.Run(runCtx)
+		<-source.ready
+
+		return svc, srv
+	}
+
+	t.Run("Good: assignment is sent to reviewers with text and html", func(t *testing.T) {
+		svc, srv := setup(t, MailConfig{})
+
+		_, err := svc.CreatePR(ctx, "pr-1", "Add <search>", "u1")
+		require.NoError(t, err)
+
+		mails := srv.wait(t, 2)
+		require.Contains(t, mails, "bob@example.com")
+		require.Contains(t, mails, "carol@example.com")
+		srv.none(t)
+
+		msg := mails["bob@example.com"]
+		require.Equal(t, `"bob" <bob@example.com>`, msg.Header.Get("To"))
+		require.Equal(t, `"Reviewchecker" <reviewchecker@example.com>`, msg.Header.Get("From"))
+
+		subject, text, html := bodies(t, msg)
+		require.Equal(t, "Review requested: Add <search>", subject)
+		require.Contains(t, text, `alice asked you to review "Add <search>" (pr-1)`)
+		require.Contains(t, html, "<b>Add &lt;search&gt;</b>")
+	})
+
+	t.Run("Good: stored email is preferred over the configured one", func(t *testing.T) {
+		svc, srv := setup(t, MailConfig{Emails: map[string]string{
+			"u3": "carol@example.com",
+			"u4": "dave@old.example.com",
+		}})
+
+		_, err := svc.SetUserActive(ctx, "u2", false, model.ChangeInfo{})
+		require.NoError(t, err)
+		_, err = svc.SetUserActive(ctx, "u4", true, model.ChangeInfo{})
+		require.NoError(t, err)
+
+		_, err = svc.CreatePR(ctx, "pr-1", "Add search", "u1")
+		require.NoError(t, err)
+
+		mails := srv.wait(t, 2)
+		require.Contains(t, mails, "carol@example.com", "configured email is the fallback")
+		require.Contains(t, mails, "dave@example.com")
+		srv.none(t)
+	})
+
+	t.Run("Good: reassignment is sent to the new and the replaced reviewer", func(t *testing.T) {
+		svc, srv := setup(t, MailConfig{})
+
+		pr, err := svc.CreatePR(ctx, "pr-1", "Add search", "u1")
+		require.NoError(t, err)
+		srv.wait(t, 2)
+
+		_, err = svc.SetUserActive(ctx, "u4", true, model.ChangeInfo{})
+		require.NoError(t, err)
+
+		old := pr.Reviewers[0]
+		_, _, err = svc.ReassignReviewer(ctx, "pr-1", old, usecase.AnyVersion, model.ChangeInfo{
+			Reason: "on vacation",
+		})
+		require.NoError(t, err)
+
+		mails := srv.wait(t, 2)
+
+		_, text, _ := bodies(t, mails["dave@example.com"])
+		require.Contains(t, text, "You were assigned to review")
+		require.Contains(t, text, "Reason: on vacation")
+
+		_, text, _ = bodies(t, mails[emails[old]])
+		require.Contains(t, text, "You no longer need to review")
+		require.Contains(t, text, "it was reassigned to dave")
+	})
+
+	t.Run("Good: merge is sent to the author and reviewers", func(t *testing.T) {
+		svc, srv := setup(t, MailConfig{Emails: map[string]string{
+			"u1": "alice@example.com",
+			"u2": "bob@example.com",
+		}})
+
+		_, err := svc.CreatePR(ctx, "pr-1", "Add search", "u1")
+		require.NoError(t, err)
+		srv.wait(t, 1)
+
+		_, err = svc.MergePR(ctx, "pr-1", usecase.AnyVersion, model.ChangeInfo{ActorID: "u2"})
+		require.NoError(t, err)
+
+		mails := srv.wait(t, 2)
+		for _, to := range []string{"alice@example.com", "bob@example.com"} {
+			subject, _, _ := bodies(t, mails[to])
+			require.Equal(t, "Merged: Add search", subject)
+		}
+	})
+
+	t.Run("Good: escalation is sent to overdue reviewers and the added lead", func(t *testing.T) {
+		svc, srv := setup(t, MailConfig{})
+
+		_, err := svc.CreatePR(ctx, "pr-1", "Add search", "u1")
+		require.NoError(t, err)
+		srv.wait(t, 2)
+
+		_, err = svc.SetUserActive(ctx, "u4", true, model.ChangeInfo{})
+		require.NoError(t, err)
+
+		// the lead added now stays within the SLA
+		time.Sleep(100 * time.Millisecond)
+
+		escalations, err := svc.EscalateOverdueReviews(ctx, model.EscalationRule{
+			TeamName: "backend",
+			SLA:      50 * time.Millisecond,
+			Policy:   model.EscalationAddLead,
+			LeadID:   "u4",
+		}, time.Now())
+		require.NoError(t, err)
+		require.Len(t, escalations, 2)
+
+		overdue := map[string]string{"u2": "bob", "u3": "carol"}[escalations[0].ReviewerID]
+
+		mails := srv.wait(t, 3)
+
+		subject, text, html := bodies(t, mails["dave@example.com"])
+		require.Equal(t, "Review overdue: Add search", subject)
+		require.Contains(t, text, "You were added as a reviewer")
+		require.Contains(t, text, "because "+overdue+" did not review it in time")
+		require.Contains(t, html, "<b>Add search</b>")
+
+		_, text, _ = bodies(t, mails[overdue+"@example.com"])
+		require.Contains(t, text, "still waits for your review. dave was added as a reviewer.")
+		require.Contains(t, text, "Reason: no review within 50ms")
+	})
+
+	t.Run("Good: transient failures are retried", func(t *testing.T) {
+		svc, srv := setup(t, MailConfig{Emails: map[string]string{"u2": "bob@example.com"}}, 451, 421)
+
+		_, err := svc.CreatePR(ctx, "pr-1", "Add search", "u1")
+		require.NoError(t, err)
+
+		require.Contains(t, srv.wait(t, 1), "bob@example.com")
+	})
+
+	t.Run("Bad: permanent failures are not retried", func(t *testing.T) {
+		svc, srv := setup(t, MailConfig{Emails: map[string]string{"u2": "bob@example.com"}}, 550)
+
+		_, err := svc.CreatePR(ctx, "pr-1", "Add search", "u1")
+		require.NoError(t, err)
+		srv.none(t)
+
+		_, err = svc.CreatePR(ctx, "pr-2", "Add filters", "u1")
+		require.NoError(t, err)
+
+		subject, _, _ := bodies(t, srv.wait(t, 1)["bob@example.com"])
+		require.Equal(t, "Review requested: Add filters", subject)
+	})
+
+	t.Run("Bad: templates dir without every event", func(t *testing.T) {
+		dir := t.TempDir()
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "email.txt"),
+			[]byte(`{{define "pr.created.subject"}}x{{end}}{{define "pr.created"}}x{{end}}`), 0o600))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "email.html"),
+			[]byte(`{{define "pr.created"}}x{{end}}`), 0o600))
+
+		_, err := NewMailer(nil, nil, slog.New(slog.DiscardHandler), MailConfig{
+			From:         "reviewchecker@example.com",
+			TemplatesDir: dir,
+		})
+		require.ErrorIs(t, err, errMissingTemplate)
+	})
+
+	t.Run("Bad: invalid from address", func(t *testing.T) {
+		_, err := NewMailer(nil, nil, slog.New(slog.DiscardHandler), MailConfig{From: "nobody"})
+		require.Error(t, err)
+	})
+}
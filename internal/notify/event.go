@@ -0,0 +1,238 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/6ermvH/avito-reviewchecker/internal/model"
+)
+
+// Source is the stream of committed events notifiers listen to.
+type Source interface {
+	SubscribeEvents(
+		ctx context.Context,
+		filter model.StreamFilter,
+		lastEventID int64,
+	) ([]model.StreamEvent, <-chan model.StreamEvent, error)
+}
+
+type Users interface {
+	GetUserByID(ctx context.Context, userID string) (model.User, error)
+}
+
+// Recipient is a user as seen by message templates.
+type Recipient struct {
+	ID       string
+	Username string
+	Mention  string
+	Email    string
+}
+
+// Message is the data message templates are executed with.
+type Message struct {
+	EventType       model.DomainEventType
+	PullRequestID   string
+	PullRequestName string
+	Author          Recipient
+	// Reviewers are the users the message is about: the reviewers assigned by
+	// the event, the reviewer who missed the review SLA, or all reviewers of a
+	// merged pull request. Chat messages list only those of the notified team.
+	Reviewers []Recipient
+	// Mentions joins the mentions of Reviewers with spaces.
+	Mentions string
+	// Replaced is the reviewer who was replaced, set for reassignments only.
+	Replaced *Recipient
+	// Added is the team lead added as a reviewer by an escalation, if any.
+	Added  *Recipient
+	Reason string
+}
+
+// eventPayload is the part of the event data notifiers read.
+type eventPayload struct {
+	PullRequest struct {
+		ID        string   `json:"pull_request_id"`
+		Name      string   `json:"pull_request_name"`
+		AuthorID  string   `json:"author_id"`
+		Reviewers []string `json:"assigned_reviewers"`
+	} `json:"pull_request"`
+	OldReviewerID string `json:"old_reviewer_id"`
+	NewReviewerID string `json:"new_reviewer_id"`
+	Reason        string `json:"reason"`
+}
+
+// listen passes every event of source to handle until ctx is done. When the
+// listener falls behind the stream it resubscribes from the last event it
+// handled.
+func listen(
+	ctx context.Context,
+	source Source,
+	logger *slog.Logger,
+	handle func(ctx context.Context, event model.StreamEvent),
+) {
+	var lastID int64
+
+	for {
+		backlog, events, err := source.SubscribeEvents(ctx, model.StreamFilter{}, lastID)
+		if err != nil {
+			logger.Error("subscribe to events", "error", err)
+
+			return
+		}
+
+		for _, event := range backlog {
+			handle(ctx, event)
+			lastID = event.ID
+		}
+
+		for event := range events {
+			handle(ctx, event)
+			lastID = event.ID
+		}
+
+		if ctx.Err() != nil {
+			return
+		}
+
+		logger.Warn("notifier fell behind the event stream, resubscribing", "lastEventID", lastID)
+	}
+}
+
+// resolver turns events into messages, looking up the users they mention.
+type resolver struct {
+	users Users
+	// mentions and emails are keyed by users.id. emails is used for users
+	// without a stored email.
+	mentions map[string]string
+	emails   map[string]string
+}
+
+// describe returns the message of event without Reviewers and Mentions, and
+// the users the event assigned, the escalated reviewer, or all reviewers of a
+// merged pull request.
+func (r resolver) describe(
+	ctx context.Context,
+	event model.StreamEvent,
+) (Message, []model.User, error) {
+	var data eventPayload
+	if err := json.Unmarshal(event.Payload, &data); err != nil {
+		return Message{}, nil, fmt.Errorf("decode %s event: %w", event.Type, err)
+	}
+
+	msg := Message{
+		EventType:       event.Type,
+		PullRequestID:   data.PullRequest.ID,
+		PullRequestName: data.PullRequest.Name,
+		Reason:          data.Reason,
+	}
+
+	author, err := r.user(ctx, data.PullRequest.AuthorID)
+	if err != nil {
+		return Message{}, nil, err
+	}
+
+	msg.Author = r.recipient(author)
+
+	reviewerIDs := data.PullRequest.Reviewers
+
+	if event.Type == model.EventReviewerReassigned {
+		reviewerIDs = []string{data.NewReviewerID}
+
+		replaced, err := r.user(ctx, data.OldReviewerID)
+		if err != nil {
+			return Message{}, nil, err
+		}
+
+		recipient := r.recipient(replaced)
+		msg.Replaced = &recipient
+	}
+
+	if event.Type == model.EventReviewEscalated {
+		reviewerIDs = []string{data.OldReviewerID}
+
+		if data.NewReviewerID != "" {
+			added, err := r.user(ctx, data.NewReviewerID)
+			if err != nil {
+				return Message{}, nil, err
+			}
+
+			recipient := r.recipient(added)
+			msg.Added = &recipient
+		}
+	}
+
+	reviewers := make([]model.User, 0, len(reviewerIDs))
+
+	for _, userID := range reviewerIDs {
+		reviewer, err := r.user(ctx, userID)
+		if err != nil {
+			return Message{}, nil, err
+		}
+
+		reviewers = append(reviewers, reviewer)
+	}
+
+	return msg, reviewers, nil
+}
+
+func (r resolver) user(ctx context.Context, userID string) (model.User, error) {
+	user, err := r.users.GetUserByID(ctx, userID)
+	if err != nil {
+		return model.User{}, fmt.Errorf("get user %q: %w", userID, err)
+	}
+
+	return user, nil
+}
+
+func (r resolver) recipient(user model.User) Recipient {
+	mention, ok := r.mentions[user.ID]
+	if !ok {
+		mention = "@" + user.Username
+	}
+
+	address := user.Email
+	if address == "" {
+		address = r.emails[user.ID]
+	}
+
+	return Recipient{
+		ID:       user.ID,
+		Username: user.Username,
+		Mention:  mention,
+		Email:    address,
+	}
+}
+
+// backoff doubles the delay after every failed attempt, starting at base and
+// capped by maxDelay.
+func backoff(base, maxDelay time.Duration, attempts int) time.Duration {
+	delay := base
+
+	for range attempts - 1 {
+		delay *= 2
+		if delay >= maxDelay {
+			return maxDelay
+		}
+	}
+
+	return min(delay, maxDelay)
+}
+
+// sleep waits for d and reports whether ctx is still alive.
+func sleep(ctx context.Context, d time.Duration) bool {
+	if d <= 0 {
+		return ctx.Err() == nil
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
@@ -0,0 +1,344 @@
+// Package notify posts reviewer assignment messages to Slack-compatible
+// incoming webhooks (Slack, Mattermost) configured per team.
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/6ermvH/avito-reviewchecker/internal/model"
+)
+
+// maxErrorBody limits how much of a failed response is logged.
+const maxErrorBody = 512
+
+const (
+	DefaultCreatedTemplate = `{{.Mentions}} you were assigned to review *{{.PullRequestName}}*` +
+		` ({{.PullRequestID}}) by {{.Author.Username}}`
+	DefaultReassignedTemplate = `{{.Mentions}} you were assigned to review *{{.PullRequestName}}*` +
+		` ({{.PullRequestID}}) instead of {{.Replaced.Username}}`
+	DefaultEscalatedTemplate = `{{.Mentions}} *{{.PullRequestName}}* ({{.PullRequestID}})` +
+		` by {{.Author.Username}} still waits for your review, {{.Reason}}` +
+		`{{with .Added}}. {{.Mention}} was added as a reviewer{{end}}`
+	DefaultDigestTemplate = `{{.Reviewer.Mention}}, your review digest: {{len .Entries}}` +
+		` waiting for you:{{range .Entries}}` + "\n" + `• {{if .OverSLA}}:warning:` +
+		` *{{.PullRequestName}}* ({{.PullRequestID}}), {{.WaitingText}}, over SLA` +
+		`{{else}}{{.PullRequestName}} ({{.PullRequestID}}), {{.WaitingText}}{{end}}{{end}}`
+)
+
+var errUnexpectedStatus = errors.New("unexpected status")
+
+type Config struct {
+	// Teams maps team names to their incoming webhook URLs. Teams without a
+	// URL are not notified.
+	Teams map[string]string
+	// Mentions maps users.id to the mention used in messages, e.g.
+	// "<@U024BE7LH>" for Slack. Users without one are mentioned as
+	// "@username".
+	Mentions map[string]string
+	// CreatedTemplate, ReassignedTemplate and EscalatedTemplate are
+	// text/template sources executed with Message, DigestTemplate with
+	// Digest. Empty values select the defaults.
+	CreatedTemplate    string
+	ReassignedTemplate string
+	EscalatedTemplate  string
+	DigestTemplate     string
+	// Timeout bounds a single attempt.
+	Timeout time.Duration
+	// MinInterval is the least time between two requests to one webhook.
+	MinInterval time.Duration
+	// MaxAttempts is the number of attempts after which a message is dropped.
+	MaxAttempts int
+	BaseBackoff time.Duration
+	MaxBackoff  time.Duration
+	// QueueSize is how many messages may wait for one webhook before new ones
+	// are dropped.
+	QueueSize int
+}
+
+// Notifier tells reviewers about their assignments. Every team webhook has its
+// own queue served by one worker, which keeps MinInterval between requests and
+// retries failed ones with exponential backoff. Messages are kept in memory
+// only, so those still queued on shutdown are lost.
+type Notifier struct {
+	source    Source
+	resolver  resolver
+	client    *http.Client
+	logger    *slog.Logger
+	cfg       Config
+	templates map[model.DomainEventType]*template.Template
+	digest    *template.Template
+	channels  map[string]*channel
+}
+
+type channel struct {
+	team  string
+	url   string
+	queue chan string
+	last  time.Time
+}
+
+// payload is the body understood by Slack and Mattermost incoming webhooks.
+type payload struct {
+	Text string `json:"text"`
+}
+
+func NewNotifier(
+	source Source,
+	users Users,
+	client *http.Client,
+	logger *slog.Logger,
+	cfg Config,
+) (*Notifier, error) {
+	created, err := parseTemplate("created", cfg.CreatedTemplate, DefaultCreatedTemplate)
+	if err != nil {
+		return nil, err
+	}
+
+	reassigned, err := parseTemplate(
+		"reassigned", cfg.ReassignedTemplate, DefaultReassignedTemplate,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	escalated, err := parseTemplate("escalated", cfg.EscalatedTemplate, DefaultEscalatedTemplate)
+	if err != nil {
+		return nil, err
+	}
+
+	digest, err := parseTemplate("digest", cfg.DigestTemplate, DefaultDigestTemplate)
+	if err != nil {
+		return nil, err
+	}
+
+	channels := make(map[string]*channel, len(cfg.Teams))
+	for team, url := range cfg.Teams {
+		channels[team] = &channel{
+			team:  team,
+			url:   url,
+			queue: make(chan string, cfg.QueueSize),
+		}
+	}
+
+	return &Notifier{
+		source:   source,
+		resolver: resolver{users: users, mentions: cfg.Mentions},
+		client:   client,
+		logger:   logger,
+		cfg:      cfg,
+		templates: map[model.DomainEventType]*template.Template{
+			model.EventPRCreated:          created,
+			model.EventReviewerReassigned: reassigned,
+			model.EventReviewEscalated:    escalated,
+		},
+		digest:   digest,
+		channels: channels,
+	}, nil
+}
+
+func parseTemplate(name, text, fallback string) (*template.Template, error) {
+	if text == "" {
+		text = fallback
+	}
+
+	tmpl, err := template.New(name).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("parse %s template: %w", name, err)
+	}
+
+	return tmpl, nil
+}
+
+// Run listens to the event stream and sends messages until ctx is done.
+func (n *Notifier) Run(ctx context.Context) {
+	for _, ch := range n.channels {
+		go n.work(ctx, ch)
+	}
+
+	listen(ctx, n.source, n.logger, n.handle)
+}
+
+// handle renders the messages of an event and queues them without blocking.
+func (n *Notifier) handle(ctx context.Context, event model.StreamEvent) {
+	tmpl, ok := n.templates[event.Type]
+	if !ok {
+		return
+	}
+
+	messages, err := n.render(ctx, tmpl, event)
+	if err != nil {
+		n.logger.Error("render notification", "eventID", event.ID, "error", err)
+
+		return
+	}
+
+	for team, text := range messages {
+		n.enqueue(team, text, "eventID", event.ID)
+	}
+}
+
+// sendDigest queues the digest of a reviewer for the webhook of their team.
+func (n *Notifier) sendDigest(digest Digest) {
+	if _, ok := n.channels[digest.Team]; !ok {
+		return
+	}
+
+	var text strings.Builder
+	if err := n.digest.Execute(&text, digest); err != nil {
+		n.logger.Error("render digest", "team", digest.Team, "userID", digest.Reviewer.ID,
+			"error", err)
+
+		return
+	}
+
+	n.enqueue(digest.Team, text.String(), "userID", digest.Reviewer.ID)
+}
+
+// enqueue queues text for the webhook of team without blocking.
+func (n *Notifier) enqueue(team, text string, attrs ...any) {
+	select {
+	case n.channels[team].queue <- text:
+	default:
+		n.logger.Warn("notification queue is full, message dropped",
+			append([]any{"team", team}, attrs...)...,
+		)
+	}
+}
+
+// render returns the text of the event for every notified team the assigned
+// reviewers belong to.
+func (n *Notifier) render(
+	ctx context.Context,
+	tmpl *template.Template,
+	event model.StreamEvent,
+) (map[string]string, error) {
+	msg, assigned, err := n.resolver.describe(ctx, event)
+	if err != nil {
+		return nil, err
+	}
+
+	byTeam := make(map[string][]Recipient)
+
+	for _, user := range assigned {
+		if _, ok := n.channels[user.TeamName]; ok {
+			byTeam[user.TeamName] = append(byTeam[user.TeamName], n.resolver.recipient(user))
+		}
+	}
+
+	messages := make(map[string]string, len(byTeam))
+
+	for team, reviewers := range byTeam {
+		mentions := make([]string, 0, len(reviewers))
+		for _, reviewer := range reviewers {
+			mentions = append(mentions, reviewer.Mention)
+		}
+
+		msg.Reviewers = reviewers
+		msg.Mentions = strings.Join(mentions, " ")
+
+		var text strings.Builder
+		if err := tmpl.Execute(&text, msg); err != nil {
+			return nil, fmt.Errorf("execute %s template: %w", event.Type, err)
+		}
+
+		messages[team] = text.String()
+	}
+
+	return messages, nil
+}
+
+func (n *Notifier) work(ctx context.Context, ch *channel) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case text := <-ch.queue:
+			n.deliver(ctx, ch, text)
+		}
+	}
+}
+
+// deliver sends text until it succeeds, MaxAttempts is reached or ctx is done.
+func (n *Notifier) deliver(ctx context.Context, ch *channel, text string) {
+	for attempt := 1; ; attempt++ {
+		if !sleep(ctx, time.Until(ch.last.Add(n.cfg.MinInterval))) {
+			return
+		}
+
+		ch.last = time.Now()
+
+		retryAfter, err := n.send(ctx, ch.url, text)
+		if err == nil {
+			return
+		}
+
+		if attempt >= n.cfg.MaxAttempts {
+			n.logger.Warn("notification dropped",
+				"team", ch.team,
+				"attempts", attempt,
+				"error", err,
+			)
+
+			return
+		}
+
+		if !sleep(ctx, max(backoff(n.cfg.BaseBackoff, n.cfg.MaxBackoff, attempt), retryAfter)) {
+			return
+		}
+	}
+}
+
+// send posts text once. On 429 it returns the delay the server asked for in
+// Retry-After.
+func (n *Notifier) send(ctx context.Context, url, text string) (time.Duration, error) {
+	body, err := json.Marshal(payload{Text: text})
+	if err != nil {
+		return 0, fmt.Errorf("encode message: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, n.cfg.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return 0, fmt.Errorf("build request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("send request: %w", err)
+	}
+	//nolint:errcheck
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusOK && resp.StatusCode < http.StatusMultipleChoices {
+		return 0, nil
+	}
+
+	var retryAfter time.Duration
+
+	if resp.StatusCode == http.StatusTooManyRequests {
+		if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+			retryAfter = time.Duration(seconds) * time.Second
+		}
+	}
+
+	snippet, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+
+	return retryAfter, fmt.Errorf(
+		"%w %d: %s", errUnexpectedStatus, resp.StatusCode, bytes.TrimSpace(snippet),
+	)
+}
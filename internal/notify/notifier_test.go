@@ -0,0 +1,237 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/6ermvH/avito-reviewchecker/internal/model"
+	"github.com/6ermvH/avito-reviewchecker/internal/repository/memory"
+	"github.com/6ermvH/avito-reviewchecker/internal/usecase"
+)
+
+// stub is a local incoming webhook answering with the queued statuses, then
+// with 200.
+type stub struct {
+	mu       sync.Mutex
+	statuses []int
+	texts    []string
+	times    []time.Time
+	received chan struct{}
+}
+
+func (s *stub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var body payload
+	_ = json.NewDecoder(r.Body).Decode(&body)
+
+	status := http.StatusOK
+	if len(s.statuses) > 0 {
+		status, s.statuses = s.statuses[0], s.statuses[1:]
+	}
+
+	if status == http.StatusTooManyRequests {
+		w.Header().Set("Retry-After", "0")
+	}
+
+	w.WriteHeader(status)
+
+	if status == http.StatusOK {
+		s.texts = append(s.texts, body.Text)
+		s.times = append(s.times, time.Now())
+		s.received <- struct{}{}
+	}
+}
+
+func (s *stub) wait(t *testing.T, n int) []string {
+	t.Helper()
+
+	for range n {
+		select {
+		case <-s.received:
+		case <-time.After(5 * time.Second):
+			t.Fatal("notification was not delivered")
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return slices.Clone(s.texts)
+}
+
+// readySource reports when the notifier has subscribed, so that no event of a
+// test is published before.
+type readySource struct {
+	Source
+	ready chan struct{}
+}
+
+func (s readySource) SubscribeEvents(
+	ctx context.Context,
+	filter model.StreamFilter,
+	lastEventID int64,
+) ([]model.StreamEvent, <-chan model.StreamEvent, error) {
+	backlog, events, err := s.Source.SubscribeEvents(ctx, filter, lastEventID)
+	s.ready <- struct{}{}
+
+	return backlog, events, err
+}
+
+func TestNotifier(t *testing.T) {
+	ctx := context.Background()
+
+	setup := func(t *testing.T, cfg Config, statuses ...int) (*usecase.Service, *stub) {
+		t.Helper()
+
+		repo := memory.New()
+		_, err := repo.CreateTeam(ctx, "backend")
+		require.NoError(t, err)
+		require.NoError(t, repo.InsertTeamMembers(ctx, "backend", []model.User{
+			{ID: "u1", Username: "alice", IsActive: true},
+			{ID: "u2", Username: "bob", IsActive: true},
+			{ID: "u3", Username: "carol", IsActive: true},
+			{ID: "u4", Username: "dave", IsActive: false},
+		}))
+
+		svc := usecase.New(repo, slog.New(slog.DiscardHandler))
+
+		st := &stub{statuses: statuses, received: make(chan struct{}, 16)}
+		srv := httptest.NewServer(st)
+		t.Cleanup(srv.Close)
+
+		cfg.Teams = map[string]string{"backend": srv.URL}
+		cfg.Timeout = time.Second
+		cfg.MaxBackoff = time.Second
+		cfg.QueueSize = 16
+
+		if cfg.MaxAttempts == 0 {
+			cfg.MaxAttempts = 3
+		}
+
+		source := readySource{Source: svc, ready: make(chan struct{}, 1)}
+
+		notifier, err := NewNotifier(source, repo, srv.Client(), slog.New(slog.DiscardHandler), cfg)
+		require.NoError(t, err)
+
+		runCtx, cancel := context.WithCancel(ctx)
+		t.Cleanup(cancel)
+
+		go notifier.Run(runCtx)
+		<-source.ready
+
+		return svc, st
+	}
+
+	t.Run("Good: created pull request mentions reviewers", func(t *testing.T) {
+		svc, st := setup(t, Config{Mentions: map[string]string{"u2": "<@U024BE7LH>"}})
+
+		_, err := svc.CreatePR(ctx, "pr-1", "Add search", "u1")
+		require.NoError(t, err)
+
+		texts := st.wait(t, 1)
+		require.Len(t, texts, 1)
+		require.Contains(t, texts[0], "<@U024BE7LH>")
+		require.Contains(t, texts[0], "@carol")
+		require.Contains(t, texts[0], "*Add search* (pr-1) by alice")
+	})
+
+	t.Run("Good: reassignment mentions the new reviewer", func(t *testing.T) {
+		svc, st := setup(t, Config{
+			ReassignedTemplate: "{{.Mentions}} replaces {{.Replaced.Username}} on {{.PullRequestID}}",
+		})
+
+		pr, err := svc.CreatePR(ctx, "pr-1", "Add search", "u1")
+		require.NoError(t, err)
+		st.wait(t, 1)
+
+		_, err = svc.SetUserActive(ctx, "u4", true, model.ChangeInfo{})
+		require.NoError(t, err)
+
+		old := pr.Reviewers[0]
+		_, newID, err := svc.ReassignReviewer(ctx, "pr-1", old, usecase.AnyVersion, model.ChangeInfo{})
+		require.NoError(t, err)
+		require.Equal(t, "u4", newID)
+
+		replaced := map[string]string{"u2": "bob", "u3": "carol"}[old]
+
+		texts := st.wait(t, 1)
+		require.Equal(t, "@dave replaces "+replaced+" on pr-1", texts[1])
+	})
+
+	t.Run("Good: escalation mentions the overdue reviewer", func(t *testing.T) {
+		svc, st := setup(t, Config{Mentions: map[string]string{"u2": "<@U2>"}})
+
+		_, err := svc.CreatePR(ctx, "pr-1", "Add search", "u1")
+		require.NoError(t, err)
+		st.wait(t, 1)
+
+		_, err = svc.EscalateOverdueReviews(ctx, model.EscalationRule{
+			TeamName: "backend",
+			SLA:      24 * time.Hour,
+			Policy:   model.EscalationNotify,
+		}, time.Now().Add(25*time.Hour))
+		require.NoError(t, err)
+
+		texts := st.wait(t, 2)
+		require.ElementsMatch(t, []string{
+			"<@U2> *Add search* (pr-1) by alice still waits for your review, no review within 24h",
+			"@carol *Add search* (pr-1) by alice still waits for your review, no review within 24h",
+		}, texts[1:])
+	})
+
+	t.Run("Good: failed requests are retried", func(t *testing.T) {
+		svc, st := setup(t, Config{BaseBackoff: time.Millisecond},
+			http.StatusInternalServerError, http.StatusTooManyRequests)
+
+		_, err := svc.CreatePR(ctx, "pr-1", "Add search", "u1")
+		require.NoError(t, err)
+
+		require.Len(t, st.wait(t, 1), 1)
+		require.Empty(t, st.statuses)
+	})
+
+	t.Run("Good: requests to a webhook are rate limited", func(t *testing.T) {
+		svc, st := setup(t, Config{MinInterval: 100 * time.Millisecond})
+
+		_, err := svc.CreatePR(ctx, "pr-1", "Add search", "u1")
+		require.NoError(t, err)
+		_, err = svc.CreatePR(ctx, "pr-2", "Add filters", "u1")
+		require.NoError(t, err)
+
+		st.wait(t, 2)
+		// the interval is kept between sends, arrivals may be a little closer
+		require.GreaterOrEqual(t, st.times[1].Sub(st.times[0]), 90*time.Millisecond)
+	})
+
+	t.Run("Bad: message is dropped after max attempts", func(t *testing.T) {
+		svc, st := setup(t, Config{BaseBackoff: time.Millisecond, MaxAttempts: 2},
+			http.StatusBadGateway, http.StatusBadGateway)
+
+		_, err := svc.CreatePR(ctx, "pr-1", "Add search", "u1")
+		require.NoError(t, err)
+		_, err = svc.CreatePR(ctx, "pr-2", "Add filters", "u1")
+		require.NoError(t, err)
+
+		texts := st.wait(t, 1)
+		require.Len(t, texts, 1)
+		require.Contains(t, texts[0], "pr-2")
+	})
+
+	t.Run("Bad: invalid template", func(t *testing.T) {
+		_, err := NewNotifier(nil, nil, http.DefaultClient, slog.New(slog.DiscardHandler), Config{
+			CreatedTemplate: "{{.Mentions",
+		})
+		require.Error(t, err)
+	})
+}
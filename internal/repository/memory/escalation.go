@@ -0,0 +1,86 @@
+package memory
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/6ermvH/avito-reviewchecker/internal/model"
+)
+
+func (r *Repository) ListOverdueAssignments(
+	ctx context.Context,
+	teamName string,
+	assignedBefore time.Time,
+) ([]model.Assignment, error) {
+	unlock := r.rlock(ctx)
+	defer unlock()
+
+	var assignments []model.Assignment
+
+	for _, pr := range r.prs {
+		if pr.Status != model.PRStatusOpen {
+			continue
+		}
+
+		for _, reviewerID := range pr.Reviewers {
+			key := assignment{prID: pr.ID, userID: reviewerID}
+			assignedAt := r.assigned[key]
+
+			if r.users[reviewerID].TeamName != teamName || !assignedAt.Before(assignedBefore) ||
+				slices.ContainsFunc(r.escalated[key], assignedAt.Equal) {
+				continue
+			}
+
+			assignments = append(assignments, model.Assignment{
+				PullRequestID: pr.ID,
+				ReviewerID:    reviewerID,
+				AssignedAt:    assignedAt,
+			})
+		}
+	}
+
+	slices.SortFunc(assignments, func(a, b model.Assignment) int {
+		return cmp.Or(
+			a.AssignedAt.Compare(b.AssignedAt),
+			strings.Compare(a.PullRequestID, b.PullRequestID),
+			strings.Compare(a.ReviewerID, b.ReviewerID),
+		)
+	})
+
+	return assignments, nil
+}
+
+func (r *Repository) RecordEscalation(ctx context.Context, a model.Assignment) (bool, error) {
+	unlock := r.lock(ctx)
+	defer unlock()
+
+	key := assignment{prID: a.PullRequestID, userID: a.ReviewerID}
+	if slices.ContainsFunc(r.escalated[key], a.AssignedAt.Equal) {
+		return false, nil
+	}
+
+	// appending to a shared backing array would leak into snapshots
+	r.escalated[key] = append(slices.Clip(r.escalated[key]), a.AssignedAt)
+
+	return true, nil
+}
+
+func (r *Repository) ListEscalatedReviewers(ctx context.Context, prID string) ([]string, error) {
+	unlock := r.rlock(ctx)
+	defer unlock()
+
+	var reviewers []string
+
+	for key := range r.escalated {
+		if key.prID == prID {
+			reviewers = append(reviewers, key.userID)
+		}
+	}
+
+	slices.Sort(reviewers)
+
+	return reviewers, nil
+}
@@ -0,0 +1,55 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/6ermvH/avito-reviewchecker/internal/model"
+	"github.com/6ermvH/avito-reviewchecker/internal/repository"
+)
+
+func (r *Repository) AppendAssignmentEvents(
+	ctx context.Context,
+	events []model.AssignmentEvent,
+) error {
+	unlock := r.lock(ctx)
+	defer unlock()
+
+	for _, event := range events {
+		if _, ok := r.prs[event.PullRequestID]; !ok {
+			return fmt.Errorf(
+				"append assignment event, pr %q: %w",
+				event.PullRequestID,
+				repository.ErrNotFound,
+			)
+		}
+	}
+
+	now := r.timestamp()
+
+	for _, event := range events {
+		event.ID = int64(len(r.events) + 1)
+		event.CreatedAt = now
+		r.events = append(r.events, event)
+	}
+
+	return nil
+}
+
+func (r *Repository) ListAssignmentEvents(
+	ctx context.Context,
+	prID string,
+) ([]model.AssignmentEvent, error) {
+	unlock := r.rlock(ctx)
+	defer unlock()
+
+	var events []model.AssignmentEvent
+
+	for _, event := range r.events {
+		if event.PullRequestID == prID {
+			events = append(events, event)
+		}
+	}
+
+	return events, nil
+}
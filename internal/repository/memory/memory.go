@@ -0,0 +1,497 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/6ermvH/avito-reviewchecker/internal/model"
+	"github.com/6ermvH/avito-reviewchecker/internal/repository"
+)
+
+// Repository keeps all data in process memory. It mirrors the postgres
+// repository semantics and is safe for concurrent use.
+type Repository struct {
+	mu  sync.RWMutex
+	now func() time.Time
+	tables
+}
+
+type tables struct {
+	teams map[string]model.Team
+	users map[string]model.User
+	prs   map[string]model.PullRequest
+	// assigned holds when every current reviewer was assigned.
+	assigned map[assignment]time.Time
+	// escalated holds the assignment times escalated per reviewer.
+	escalated map[assignment][]time.Time
+	// events is append-only, so copying the slice header is enough for a
+	// snapshot.
+	events []model.AssignmentEvent
+
+	outbox        []outboxEntry
+	subscriptions map[string]model.WebhookSubscription
+	deliveries    map[int64]model.WebhookDelivery
+	// lastDeliveryID keeps ids unique after deliveries of deleted
+	// subscriptions are dropped.
+	lastDeliveryID int64
+}
+
+// assignment is a reviewer of a pull request.
+type assignment struct {
+	prID   string
+	userID string
+}
+
+// txKey marks contexts of InTx callbacks, which already hold the write lock.
+type txKey struct {
+	repo *Repository
+}
+
+func New() *Repository {
+	return &Repository{
+		now: time.Now,
+		tables: tables{
+			teams: make(map[string]model.Team),
+			users: make(map[string]model.User),
+			prs:   make(map[string]model.PullRequest),
+
+			assigned:  make(map[assignment]time.Time),
+			escalated: make(map[assignment][]time.Time),
+
+			subscriptions: make(map[string]model.WebhookSubscription),
+			deliveries:    make(map[int64]model.WebhookDelivery),
+		},
+	}
+}
+
+// InTx holds the write lock for the whole callback, so transactions are
+// serialized, and restores a snapshot of all tables when fn fails.
+func (r *Repository) InTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	if r.inTx(ctx) {
+		return fn(ctx)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	snapshot := r.clone()
+
+	if err := fn(context.WithValue(ctx, txKey{r}, true)); err != nil {
+		r.tables = snapshot
+
+		return err
+	}
+
+	return nil
+}
+
+func (r *Repository) inTx(ctx context.Context) bool {
+	return ctx.Value(txKey{r}) != nil
+}
+
+func (r *Repository) rlock(ctx context.Context) func() {
+	if r.inTx(ctx) {
+		return func() {}
+	}
+
+	r.mu.RLock()
+
+	return r.mu.RUnlock
+}
+
+func (r *Repository) lock(ctx context.Context) func() {
+	if r.inTx(ctx) {
+		return func() {}
+	}
+
+	r.mu.Lock()
+
+	return r.mu.Unlock
+}
+
+func (t *tables) clone() tables {
+	return tables{
+		teams:  maps.Clone(t.teams),
+		users:  maps.Clone(t.users),
+		prs:    maps.Clone(t.prs),
+		events: t.events,
+
+		assigned:  maps.Clone(t.assigned),
+		escalated: maps.Clone(t.escalated),
+
+		outbox:        slices.Clone(t.outbox),
+		subscriptions: maps.Clone(t.subscriptions),
+		deliveries:    maps.Clone(t.deliveries),
+
+		lastDeliveryID: t.lastDeliveryID,
+	}
+}
+
+func (r *Repository) GetTeamByName(ctx context.Context, name string) (model.Team, error) {
+	unlock := r.rlock(ctx)
+	defer unlock()
+
+	team, ok := r.teams[name]
+	if !ok {
+		return model.Team{}, repository.ErrNotFound
+	}
+
+	return team, nil
+}
+
+func (r *Repository) CreateTeam(ctx context.Context, name string) (model.Team, error) {
+	unlock := r.lock(ctx)
+	defer unlock()
+
+	if _, ok := r.teams[name]; ok {
+		return model.Team{}, repository.ErrAlreadyExists
+	}
+
+	team := model.Team{Name: name}
+	r.teams[name] = team
+
+	return team, nil
+}
+
+func (r *Repository) InsertTeamMembers(
+	ctx context.Context,
+	teamName string,
+	users []model.User,
+) error {
+	unlock := r.lock(ctx)
+	defer unlock()
+
+	if _, ok := r.teams[teamName]; !ok {
+		return fmt.Errorf("insert team members, team %q: %w", teamName, repository.ErrNotFound)
+	}
+
+	for _, user := range users {
+		user.TeamName = teamName
+		r.users[user.ID] = user
+	}
+
+	return nil
+}
+
+func (r *Repository) ListTeamMembers(ctx context.Context, teamName string) ([]model.User, error) {
+	unlock := r.rlock(ctx)
+	defer unlock()
+
+	var members []model.User
+
+	for _, user := range r.users {
+		if user.TeamName == teamName {
+			members = append(members, user)
+		}
+	}
+
+	slices.SortFunc(members, func(a, b model.User) int {
+		if c := strings.Compare(a.Username, b.Username); c != 0 {
+			return c
+		}
+
+		return strings.Compare(a.ID, b.ID)
+	})
+
+	return members, nil
+}
+
+func (r *Repository) GetUserByID(ctx context.Context, userID string) (model.User, error) {
+	unlock := r.rlock(ctx)
+	defer unlock()
+
+	user, ok := r.users[userID]
+	if !ok {
+		return model.User{}, repository.ErrNotFound
+	}
+
+	return user, nil
+}
+
+func (r *Repository) SetUserActivity(
+	ctx context.Context,
+	userID string,
+	active bool,
+) (model.User, error) {
+	unlock := r.lock(ctx)
+	defer unlock()
+
+	user, ok := r.users[userID]
+	if !ok {
+		return model.User{}, repository.ErrNotFound
+	}
+
+	user.IsActive = active
+	r.users[userID] = user
+
+	return user, nil
+}
+
+func (r *Repository) CreatePullRequest(
+	ctx context.Context,
+	pr model.PullRequest,
+) (model.PullRequest, error) {
+	unlock := r.lock(ctx)
+	defer unlock()
+
+	if _, ok := r.prs[pr.ID]; ok {
+		return model.PullRequest{}, repository.ErrAlreadyExists
+	}
+
+	if _, ok := r.users[pr.AuthorID]; !ok {
+		return model.PullRequest{}, fmt.Errorf("create pr, author %q: %w", pr.AuthorID, repository.ErrNotFound)
+	}
+
+	for _, reviewerID := range pr.Reviewers {
+		if _, ok := r.users[reviewerID]; !ok {
+			return model.PullRequest{}, fmt.Errorf(
+				"create pr, reviewer %q: %w",
+				reviewerID,
+				repository.ErrNotFound,
+			)
+		}
+	}
+
+	stored := model.PullRequest{
+		ID:        pr.ID,
+		Name:      pr.Name,
+		AuthorID:  pr.AuthorID,
+		Status:    pr.Status,
+		Reviewers: slices.Clone(pr.Reviewers),
+		CreatedAt: r.timestamp(),
+		Version:   1,
+	}
+	r.prs[pr.ID] = stored
+
+	for _, reviewerID := range stored.Reviewers {
+		r.assigned[assignment{prID: pr.ID, userID: reviewerID}] = stored.CreatedAt
+	}
+
+	return clonePR(stored), nil
+}
+
+func (r *Repository) GetPullRequestForUpdate(
+	ctx context.Context,
+	prID string,
+) (model.PullRequest, error) {
+	return r.GetPullRequest(ctx, prID)
+}
+
+func (r *Repository) GetPullRequest(ctx context.Context, prID string) (model.PullRequest, error) {
+	unlock := r.rlock(ctx)
+	defer unlock()
+
+	pr, ok := r.prs[prID]
+	if !ok {
+		return model.PullRequest{}, repository.ErrNotFound
+	}
+
+	return clonePR(pr), nil
+}
+
+func (r *Repository) UpdatePullRequestStatus(
+	ctx context.Context,
+	prID string,
+	status model.PRStatus,
+	mergedAt *time.Time,
+) (model.PullRequest, error) {
+	unlock := r.lock(ctx)
+	defer unlock()
+
+	pr, ok := r.prs[prID]
+	if !ok {
+		return model.PullRequest{}, repository.ErrNotFound
+	}
+
+	pr.Status = status
+	pr.MergedAt = nil
+
+	if mergedAt != nil {
+		ts := mergedAt.UTC().Truncate(time.Microsecond)
+		pr.MergedAt = &ts
+	}
+
+	pr.Version++
+	r.prs[prID] = pr
+
+	return clonePR(pr), nil
+}
+
+func (r *Repository) ListReviewerPullRequests(
+	ctx context.Context,
+	userID string,
+	filter model.ReviewFilter,
+) ([]model.PullRequest, error) {
+	unlock := r.rlock(ctx)
+	defer unlock()
+
+	var prs []model.PullRequest
+
+	for _, pr := range r.prs {
+		if !slices.Contains(pr.Reviewers, userID) {
+			continue
+		}
+
+		if filter.Status != "" && pr.Status != filter.Status {
+			continue
+		}
+
+		if filter.After != nil && comparePRPosition(pr, *filter.After) <= 0 {
+			continue
+		}
+
+		prs = append(prs, clonePR(pr))
+	}
+
+	slices.SortFunc(prs, func(a, b model.PullRequest) int {
+		return comparePRPosition(a, model.ReviewCursor{CreatedAt: b.CreatedAt, ID: b.ID})
+	})
+
+	if filter.Limit > 0 && len(prs) > filter.Limit {
+		prs = prs[:filter.Limit]
+	}
+
+	return prs, nil
+}
+
+func (r *Repository) ListOpenReviews(
+	ctx context.Context,
+	userID string,
+) ([]model.DigestItem, error) {
+	unlock := r.rlock(ctx)
+	defer unlock()
+
+	var items []model.DigestItem
+
+	for _, pr := range r.prs {
+		if pr.Status != model.PRStatusOpen || !slices.Contains(pr.Reviewers, userID) {
+			continue
+		}
+
+		items = append(items, model.DigestItem{
+			PullRequest: clonePR(pr),
+			AssignedAt:  r.assigned[assignment{prID: pr.ID, userID: userID}],
+		})
+	}
+
+	slices.SortFunc(items, func(a, b model.DigestItem) int {
+		if c := a.AssignedAt.Compare(b.AssignedAt); c != 0 {
+			return c
+		}
+
+		return strings.Compare(a.PullRequest.ID, b.PullRequest.ID)
+	})
+
+	return items, nil
+}
+
+func (r *Repository) ReplaceReviewer(
+	ctx context.Context,
+	prID, oldUserID, newUserID string,
+) (model.PullRequest, error) {
+	unlock := r.lock(ctx)
+	defer unlock()
+
+	pr, ok := r.prs[prID]
+	if !ok {
+		return model.PullRequest{}, repository.ErrNotFound
+	}
+
+	slot := slices.Index(pr.Reviewers, oldUserID)
+	if slot < 0 {
+		return model.PullRequest{}, repository.ErrNotFound
+	}
+
+	if slices.Contains(pr.Reviewers, newUserID) {
+		return model.PullRequest{}, fmt.Errorf(
+			"replace reviewer, %q already assigned: %w",
+			newUserID,
+			repository.ErrAlreadyExists,
+		)
+	}
+
+	if _, ok := r.users[newUserID]; !ok {
+		return model.PullRequest{}, fmt.Errorf(
+			"replace reviewer, user %q: %w",
+			newUserID,
+			repository.ErrNotFound,
+		)
+	}
+
+	pr.Reviewers = slices.Clone(pr.Reviewers)
+	pr.Reviewers[slot] = newUserID
+	pr.Version++
+	r.prs[prID] = pr
+
+	delete(r.assigned, assignment{prID: prID, userID: oldUserID})
+	r.assigned[assignment{prID: prID, userID: newUserID}] = r.timestamp()
+
+	return clonePR(pr), nil
+}
+
+func (r *Repository) AddReviewer(
+	ctx context.Context,
+	prID, userID string,
+) (model.PullRequest, error) {
+	unlock := r.lock(ctx)
+	defer unlock()
+
+	pr, ok := r.prs[prID]
+	if !ok {
+		return model.PullRequest{}, repository.ErrNotFound
+	}
+
+	if slices.Contains(pr.Reviewers, userID) {
+		return model.PullRequest{}, fmt.Errorf(
+			"add reviewer, %q already assigned: %w",
+			userID,
+			repository.ErrAlreadyExists,
+		)
+	}
+
+	if _, ok := r.users[userID]; !ok {
+		return model.PullRequest{}, fmt.Errorf(
+			"add reviewer, user %q: %w",
+			userID,
+			repository.ErrNotFound,
+		)
+	}
+
+	pr.Reviewers = append(slices.Clone(pr.Reviewers), userID)
+	pr.Version++
+	r.prs[prID] = pr
+
+	r.assigned[assignment{prID: prID, userID: userID}] = r.timestamp()
+
+	return clonePR(pr), nil
+}
+
+// timestamp matches the microsecond precision of postgres timestamps so that
+// cursors behave the same across implementations.
+func (r *Repository) timestamp() time.Time {
+	return r.now().UTC().Truncate(time.Microsecond)
+}
+
+func comparePRPosition(pr model.PullRequest, cursor model.ReviewCursor) int {
+	if c := pr.CreatedAt.Compare(cursor.CreatedAt); c != 0 {
+		return c
+	}
+
+	return strings.Compare(pr.ID, cursor.ID)
+}
+
+func clonePR(pr model.PullRequest) model.PullRequest {
+	pr.Reviewers = slices.Clone(pr.Reviewers)
+
+	if pr.MergedAt != nil {
+		mergedAt := *pr.MergedAt
+		pr.MergedAt = &mergedAt
+	}
+
+	return pr
+}
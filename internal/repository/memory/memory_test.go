@@ -0,0 +1,15 @@
+package memory_test
+
+import (
+	"testing"
+
+	"github.com/6ermvH/avito-reviewchecker/internal/repository/memory"
+	"github.com/6ermvH/avito-reviewchecker/internal/repository/repotest"
+	"github.com/6ermvH/avito-reviewchecker/internal/usecase"
+)
+
+func TestRepositoryConformance(t *testing.T) {
+	repotest.Run(t, func(_ *testing.T) usecase.Repository {
+		return memory.New()
+	})
+}
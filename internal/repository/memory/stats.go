@@ -0,0 +1,338 @@
+package memory
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/6ermvH/avito-reviewchecker/internal/model"
+	"github.com/6ermvH/avito-reviewchecker/internal/repository"
+)
+
+func (r *Repository) ListReviewerStats(
+	ctx context.Context,
+	filter model.StatsFilter,
+) ([]model.ReviewerStat, error) {
+	unlock := r.rlock(ctx)
+	defer unlock()
+
+	byReviewer := make(map[string]*model.ReviewerStat)
+
+	for _, user := range r.users {
+		if inTeam(user, filter) {
+			byReviewer[user.ID] = &model.ReviewerStat{
+				UserID:   user.ID,
+				Username: user.Username,
+				TeamName: user.TeamName,
+				IsActive: user.IsActive,
+			}
+		}
+	}
+
+	for _, pr := range r.prs {
+		for _, reviewerID := range pr.Reviewers {
+			stat, ok := byReviewer[reviewerID]
+			assignedAt := r.assigned[assignment{prID: pr.ID, userID: reviewerID}]
+
+			if !ok || !inWindow(assignedAt, filter) {
+				continue
+			}
+
+			stat.TotalAssigned++
+
+			if pr.Status == model.PRStatusOpen {
+				stat.OpenAssigned++
+			}
+
+			if stat.LastAssignedAt == nil || assignedAt.After(*stat.LastAssignedAt) {
+				stat.LastAssignedAt = &assignedAt
+			}
+		}
+	}
+
+	stats := make([]model.ReviewerStat, 0, len(byReviewer))
+	for _, stat := range byReviewer {
+		stats = append(stats, *stat)
+	}
+
+	slices.SortFunc(stats, func(a, b model.ReviewerStat) int {
+		if c := cmp.Compare(b.TotalAssigned, a.TotalAssigned); c != 0 {
+			return c
+		}
+
+		return strings.Compare(a.UserID, b.UserID)
+	})
+
+	return stats, nil
+}
+
+func (r *Repository) GetPullRequestStats(
+	ctx context.Context,
+	filter model.StatsFilter,
+) (model.PullRequestStats, error) {
+	unlock := r.rlock(ctx)
+	defer unlock()
+
+	var (
+		stats            model.PullRequestStats
+		totalAssignments int
+	)
+
+	byAuthor := make(map[string]int)
+	mergeTimes := make(map[string][]time.Duration)
+
+	for _, pr := range r.prs {
+		author := r.users[pr.AuthorID]
+		if !inTeam(author, filter) {
+			continue
+		}
+
+		if pr.MergedAt != nil && inWindow(*pr.MergedAt, filter) {
+			stats.Merged++
+
+			mergeTimes[author.TeamName] = append(
+				mergeTimes[author.TeamName], pr.MergedAt.Sub(pr.CreatedAt),
+			)
+		}
+
+		if !inWindow(pr.CreatedAt, filter) {
+			continue
+		}
+
+		stats.Total++
+
+		if pr.Status == model.PRStatusOpen {
+			stats.Open++
+		}
+
+		totalAssignments += len(pr.Reviewers)
+		byAuthor[pr.AuthorID]++
+	}
+
+	if stats.Total > 0 {
+		stats.AverageReview = float64(totalAssignments) / float64(stats.Total)
+	}
+
+	for authorID, count := range byAuthor {
+		stats.ByAuthor = append(stats.ByAuthor, model.AuthorStat{AuthorID: authorID, Count: count})
+	}
+
+	slices.SortFunc(stats.ByAuthor, func(a, b model.AuthorStat) int {
+		if c := cmp.Compare(b.Count, a.Count); c != 0 {
+			return c
+		}
+
+		return strings.Compare(a.AuthorID, b.AuthorID)
+	})
+
+	var all []time.Duration
+
+	for _, teamName := range slices.Sorted(maps.Keys(mergeTimes)) {
+		all = append(all, mergeTimes[teamName]...)
+		stats.TimeToMergeByTeam = append(stats.TimeToMergeByTeam, model.TeamTimeToMerge{
+			TeamName:    teamName,
+			TimeToMerge: percentiles(mergeTimes[teamName]),
+		})
+	}
+
+	if len(all) > 0 {
+		overall := percentiles(all)
+		stats.TimeToMerge = &overall
+	}
+
+	return stats, nil
+}
+
+// percentiles interpolates the percentiles of durations the way
+// percentile_cont does. durations must not be empty.
+func percentiles(durations []time.Duration) model.Percentiles {
+	sorted := slices.Sorted(slices.Values(durations))
+
+	percentile := func(p float64) time.Duration {
+		pos := p * float64(len(sorted)-1)
+		lo := int(pos)
+
+		if lo+1 >= len(sorted) {
+			return sorted[lo]
+		}
+
+		frac := pos - float64(lo)
+
+		return sorted[lo] + time.Duration(frac*float64(sorted[lo+1]-sorted[lo]))
+	}
+
+	return model.Percentiles{
+		P50: percentile(0.5),
+		P90: percentile(0.9),
+		P99: percentile(0.99),
+	}
+}
+
+func (r *Repository) ListTeamStats(
+	ctx context.Context,
+	filter model.StatsFilter,
+) ([]model.TeamStat, error) {
+	unlock := r.rlock(ctx)
+	defer unlock()
+
+	byTeam := make(map[string]*model.TeamStat)
+
+	for name := range r.teams {
+		if filter.TeamName == "" || name == filter.TeamName {
+			byTeam[name] = &model.TeamStat{TeamName: name}
+		}
+	}
+
+	openAssigned := make(map[string]int)
+
+	for _, pr := range r.prs {
+		if pr.Status == model.PRStatusOpen {
+			for _, reviewerID := range pr.Reviewers {
+				openAssigned[reviewerID]++
+			}
+		}
+
+		stat, ok := byTeam[r.users[pr.AuthorID].TeamName]
+		if !ok || !inWindow(pr.CreatedAt, filter) {
+			continue
+		}
+
+		if pr.Status == model.PRStatusOpen {
+			stat.OpenPRs++
+		} else {
+			stat.MergedPRs++
+		}
+
+		if len(pr.Reviewers) < model.DesiredReviewers {
+			stat.UnderstaffedPRs++
+		}
+	}
+
+	totalOpen := make(map[string]int)
+
+	for _, user := range r.users {
+		stat, ok := byTeam[user.TeamName]
+		if !ok {
+			continue
+		}
+
+		if !user.IsActive {
+			stat.InactiveMembers++
+
+			continue
+		}
+
+		load := openAssigned[user.ID]
+		if stat.ActiveMembers == 0 || load < stat.MinOpenAssigned {
+			stat.MinOpenAssigned = load
+		}
+
+		stat.MaxOpenAssigned = max(stat.MaxOpenAssigned, load)
+		stat.ActiveMembers++
+		totalOpen[user.TeamName] += load
+	}
+
+	stats := make([]model.TeamStat, 0, len(byTeam))
+
+	for _, name := range slices.Sorted(maps.Keys(byTeam)) {
+		stat := byTeam[name]
+		if stat.ActiveMembers > 0 {
+			stat.MeanOpenAssigned = float64(totalOpen[name]) / float64(stat.ActiveMembers)
+		}
+
+		stats = append(stats, *stat)
+	}
+
+	return stats, nil
+}
+
+func (r *Repository) CountOpenPullRequests(ctx context.Context) ([]model.TeamCount, error) {
+	unlock := r.rlock(ctx)
+	defer unlock()
+
+	open := make(map[string]int, len(r.teams))
+	for name := range r.teams {
+		open[name] = 0
+	}
+
+	for _, pr := range r.prs {
+		teamName := r.users[pr.AuthorID].TeamName
+		if _, ok := open[teamName]; ok && pr.Status == model.PRStatusOpen {
+			open[teamName]++
+		}
+	}
+
+	counts := make([]model.TeamCount, 0, len(open))
+	for _, name := range slices.Sorted(maps.Keys(open)) {
+		counts = append(counts, model.TeamCount{TeamName: name, Count: open[name]})
+	}
+
+	return counts, nil
+}
+
+func (r *Repository) ListTimeseries(
+	ctx context.Context,
+	metric model.TimeseriesMetric,
+	bucket model.TimeseriesBucket,
+	filter model.StatsFilter,
+) ([]model.TimeseriesPoint, error) {
+	if !slices.Contains(model.TimeseriesMetrics, metric) {
+		return nil, fmt.Errorf("%w: %q", repository.ErrUnknownMetric, metric)
+	}
+
+	unlock := r.rlock(ctx)
+	defer unlock()
+
+	var times []time.Time
+
+	for _, pr := range r.prs {
+		switch metric {
+		case model.MetricPRsCreated:
+			if inTeam(r.users[pr.AuthorID], filter) {
+				times = append(times, pr.CreatedAt)
+			}
+		case model.MetricPRsMerged:
+			if pr.MergedAt != nil && inTeam(r.users[pr.AuthorID], filter) {
+				times = append(times, *pr.MergedAt)
+			}
+		case model.MetricAssignments:
+			for _, reviewerID := range pr.Reviewers {
+				if inTeam(r.users[reviewerID], filter) {
+					times = append(times, r.assigned[assignment{prID: pr.ID, userID: reviewerID}])
+				}
+			}
+		}
+	}
+
+	counts := make(map[time.Time]int)
+
+	for _, t := range times {
+		if inWindow(t, filter) {
+			counts[bucket.Truncate(t)]++
+		}
+	}
+
+	points := make([]model.TimeseriesPoint, 0, len(counts))
+	for _, start := range slices.SortedFunc(maps.Keys(counts), time.Time.Compare) {
+		points = append(points, model.TimeseriesPoint{Start: start, Count: counts[start]})
+	}
+
+	return points, nil
+}
+
+func inTeam(user model.User, filter model.StatsFilter) bool {
+	return filter.TeamName == "" || user.TeamName == filter.TeamName
+}
+
+// inWindow reports whether t is within [filter.From, filter.To).
+func inWindow(t time.Time, filter model.StatsFilter) bool {
+	if filter.From != nil && t.Before(*filter.From) {
+		return false
+	}
+
+	return filter.To == nil || t.Before(*filter.To)
+}
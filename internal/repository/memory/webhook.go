@@ -0,0 +1,291 @@
+package memory
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/6ermvH/avito-reviewchecker/internal/model"
+	"github.com/6ermvH/avito-reviewchecker/internal/repository"
+)
+
+type outboxEntry struct {
+	event      model.OutboxEvent
+	dispatched bool
+}
+
+func (r *Repository) AppendOutboxEvents(ctx context.Context, events []model.OutboxEvent) error {
+	unlock := r.lock(ctx)
+	defer unlock()
+
+	for _, event := range events {
+		if _, ok := r.prs[event.PullRequestID]; !ok {
+			return fmt.Errorf(
+				"append outbox event, pr %q: %w",
+				event.PullRequestID,
+				repository.ErrNotFound,
+			)
+		}
+	}
+
+	now := r.timestamp()
+
+	for _, event := range events {
+		event.ID = int64(len(r.outbox) + 1)
+		event.CreatedAt = now
+		event.Payload = slices.Clone(event.Payload)
+		r.outbox = append(r.outbox, outboxEntry{event: event})
+	}
+
+	return nil
+}
+
+func (r *Repository) ClaimOutboxEvents(
+	ctx context.Context,
+	limit int,
+) ([]model.OutboxEvent, error) {
+	unlock := r.rlock(ctx)
+	defer unlock()
+
+	var events []model.OutboxEvent
+
+	for _, entry := range r.outbox {
+		if len(events) == limit {
+			break
+		}
+
+		if !entry.dispatched {
+			events = append(events, entry.event)
+		}
+	}
+
+	return events, nil
+}
+
+func (r *Repository) MarkOutboxEventsDispatched(ctx context.Context, ids []int64) error {
+	unlock := r.lock(ctx)
+	defer unlock()
+
+	for _, id := range ids {
+		if idx := int(id) - 1; idx >= 0 && idx < len(r.outbox) {
+			r.outbox[idx].dispatched = true
+		}
+	}
+
+	return nil
+}
+
+func (r *Repository) CreateWebhookSubscription(
+	ctx context.Context,
+	sub model.WebhookSubscription,
+) (model.WebhookSubscription, error) {
+	unlock := r.lock(ctx)
+	defer unlock()
+
+	if _, ok := r.subscriptions[sub.ID]; ok {
+		return model.WebhookSubscription{}, repository.ErrAlreadyExists
+	}
+
+	sub.EventTypes = slices.Clone(sub.EventTypes)
+	sub.CreatedAt = r.timestamp()
+	r.subscriptions[sub.ID] = sub
+
+	return sub, nil
+}
+
+func (r *Repository) ListWebhookSubscriptions(
+	ctx context.Context,
+) ([]model.WebhookSubscription, error) {
+	unlock := r.rlock(ctx)
+	defer unlock()
+
+	subs := slices.Collect(maps.Values(r.subscriptions))
+	for idx := range subs {
+		subs[idx].EventTypes = slices.Clone(subs[idx].EventTypes)
+	}
+
+	slices.SortFunc(subs, func(a, b model.WebhookSubscription) int {
+		if c := a.CreatedAt.Compare(b.CreatedAt); c != 0 {
+			return c
+		}
+
+		return strings.Compare(a.ID, b.ID)
+	})
+
+	return subs, nil
+}
+
+func (r *Repository) DeleteWebhookSubscription(ctx context.Context, id string) error {
+	unlock := r.lock(ctx)
+	defer unlock()
+
+	if _, ok := r.subscriptions[id]; !ok {
+		return repository.ErrNotFound
+	}
+
+	delete(r.subscriptions, id)
+
+	maps.DeleteFunc(r.deliveries, func(_ int64, d model.WebhookDelivery) bool {
+		return d.SubscriptionID == id
+	})
+
+	return nil
+}
+
+func (r *Repository) CreateWebhookDeliveries(
+	ctx context.Context,
+	deliveries []model.WebhookDelivery,
+) error {
+	unlock := r.lock(ctx)
+	defer unlock()
+
+	now := r.timestamp()
+
+	for _, delivery := range deliveries {
+		if r.hasDelivery(delivery.SubscriptionID, delivery.EventID) {
+			continue
+		}
+
+		if _, ok := r.subscriptions[delivery.SubscriptionID]; !ok {
+			return fmt.Errorf(
+				"create webhook delivery, subscription %q: %w",
+				delivery.SubscriptionID,
+				repository.ErrNotFound,
+			)
+		}
+
+		r.lastDeliveryID++
+
+		r.deliveries[r.lastDeliveryID] = model.WebhookDelivery{
+			ID:             r.lastDeliveryID,
+			SubscriptionID: delivery.SubscriptionID,
+			EventID:        delivery.EventID,
+			Status:         model.DeliveryPending,
+			NextAttemptAt:  delivery.NextAttemptAt.UTC().Truncate(time.Microsecond),
+			CreatedAt:      now,
+			UpdatedAt:      now,
+		}
+	}
+
+	return nil
+}
+
+func (r *Repository) hasDelivery(subscriptionID string, eventID int64) bool {
+	for _, d := range r.deliveries {
+		if d.SubscriptionID == subscriptionID && d.EventID == eventID {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (r *Repository) ClaimDueDeliveries(
+	ctx context.Context,
+	now time.Time,
+	lease time.Duration,
+	limit int,
+) ([]model.PendingDelivery, error) {
+	unlock := r.lock(ctx)
+	defer unlock()
+
+	var due []model.WebhookDelivery
+
+	for _, d := range r.deliveries {
+		if d.Status == model.DeliveryPending && !d.NextAttemptAt.After(now) {
+			due = append(due, d)
+		}
+	}
+
+	slices.SortFunc(due, func(a, b model.WebhookDelivery) int {
+		if c := a.NextAttemptAt.Compare(b.NextAttemptAt); c != 0 {
+			return c
+		}
+
+		return cmp.Compare(a.ID, b.ID)
+	})
+
+	if len(due) > limit {
+		due = due[:limit]
+	}
+
+	leaseUntil := now.Add(lease).UTC().Truncate(time.Microsecond)
+	pending := make([]model.PendingDelivery, 0, len(due))
+
+	for _, d := range due {
+		d.NextAttemptAt = leaseUntil
+		d.UpdatedAt = r.timestamp()
+		r.deliveries[d.ID] = d
+
+		sub := r.subscriptions[d.SubscriptionID]
+		sub.EventTypes = slices.Clone(sub.EventTypes)
+
+		pending = append(pending, model.PendingDelivery{
+			Delivery:     d,
+			Subscription: sub,
+			Event:        r.outbox[d.EventID-1].event,
+		})
+	}
+
+	return pending, nil
+}
+
+func (r *Repository) UpdateWebhookDelivery(
+	ctx context.Context,
+	delivery model.WebhookDelivery,
+	leaseUntil time.Time,
+) error {
+	unlock := r.lock(ctx)
+	defer unlock()
+
+	stored, ok := r.deliveries[delivery.ID]
+	if !ok || stored.Status != model.DeliveryPending ||
+		!stored.NextAttemptAt.Equal(leaseUntil.UTC().Truncate(time.Microsecond)) {
+		return repository.ErrLeaseLost
+	}
+
+	stored.Status = delivery.Status
+	stored.Attempts = delivery.Attempts
+	stored.NextAttemptAt = delivery.NextAttemptAt.UTC().Truncate(time.Microsecond)
+	stored.LastError = delivery.LastError
+	stored.UpdatedAt = r.timestamp()
+	r.deliveries[delivery.ID] = stored
+
+	return nil
+}
+
+func (r *Repository) ListWebhookDeliveries(
+	ctx context.Context,
+	filter model.DeliveryFilter,
+) ([]model.WebhookDelivery, error) {
+	unlock := r.rlock(ctx)
+	defer unlock()
+
+	var deliveries []model.WebhookDelivery
+
+	for _, d := range r.deliveries {
+		if filter.SubscriptionID != "" && d.SubscriptionID != filter.SubscriptionID {
+			continue
+		}
+
+		if filter.Status != "" && d.Status != filter.Status {
+			continue
+		}
+
+		deliveries = append(deliveries, d)
+	}
+
+	slices.SortFunc(deliveries, func(a, b model.WebhookDelivery) int {
+		return cmp.Compare(b.ID, a.ID)
+	})
+
+	if filter.Limit > 0 && len(deliveries) > filter.Limit {
+		deliveries = deliveries[:filter.Limit]
+	}
+
+	return deliveries, nil
+}
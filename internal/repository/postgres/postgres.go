@@ -8,25 +8,79 @@ import (
 	"time"
 
 	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
 
 	"github.com/6ermvH/avito-reviewchecker/internal/model"
 	"github.com/6ermvH/avito-reviewchecker/internal/repository"
 )
 
+type queryer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
 type Repository struct {
 	db *sql.DB
 }
 
+// txKey carries the transaction started by InTx in the context.
+type txKey struct {
+	repo *Repository
+}
+
 func New(db *sql.DB) *Repository {
 	return &Repository{db: db}
 }
 
+// InTx runs fn in a transaction, or in the one already carried by ctx.
+// Serialization failures and deadlocks are reported as ErrConflict.
+func (r *Repository) InTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	if _, ok := ctx.Value(txKey{r}).(*sql.Tx); ok {
+		return fn(ctx)
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+
+	if err := fn(context.WithValue(ctx, txKey{r}, tx)); err != nil {
+		_ = tx.Rollback()
+
+		if isConflict(err) {
+			return fmt.Errorf("%w: %w", repository.ErrConflict, err)
+		}
+
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		if isConflict(err) {
+			return fmt.Errorf("%w: commit: %w", repository.ErrConflict, err)
+		}
+
+		return fmt.Errorf("commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// conn returns the transaction carried by ctx or the database itself.
+func (r *Repository) conn(ctx context.Context) queryer {
+	if tx, ok := ctx.Value(txKey{r}).(*sql.Tx); ok {
+		return tx
+	}
+
+	return r.db
+}
+
 func (r *Repository) GetTeamByName(ctx context.Context, name string) (model.Team, error) {
 	query := `SELECT name FROM teams WHERE name = $1`
 
 	var team model.Team
 
-	err := r.db.QueryRowContext(ctx, query, name).Scan(&team.Name)
+	err := r.conn(ctx).QueryRowContext(ctx, query, name).Scan(&team.Name)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return model.Team{}, repository.ErrNotFound
@@ -43,7 +97,11 @@ func (r *Repository) CreateTeam(ctx context.Context, name string) (model.Team, e
 
 	var team model.Team
 
-	if err := r.db.QueryRowContext(ctx, query, name).Scan(&team.Name); err != nil {
+	if err := r.conn(ctx).QueryRowContext(ctx, query, name).Scan(&team.Name); err != nil {
+		if isUniqueViolation(err) {
+			return model.Team{}, repository.ErrAlreadyExists
+		}
+
 		return model.Team{}, fmt.Errorf("create team, get query row: %w", err)
 	}
 
@@ -55,39 +113,40 @@ func (r *Repository) InsertTeamMembers(
 	teamName string,
 	users []model.User,
 ) error {
-	tx, err := r.db.BeginTx(ctx, nil)
-	if err != nil {
-		return fmt.Errorf("insert team members, begin transaction: %w", err)
-	}
-
 	stmt := `
-INSERT INTO users (id, team_name, username, is_active, updated_at)
-VALUES ($1, $2, $3, $4, now())
+INSERT INTO users (id, team_name, username, email, is_active, updated_at)
+VALUES ($1, $2, $3, $4, $5, now())
 ON CONFLICT (id) DO UPDATE
 SET team_name = EXCLUDED.team_name,
     username = EXCLUDED.username,
+    email = EXCLUDED.email,
     is_active = EXCLUDED.is_active,
     updated_at = now()
 `
-	for _, user := range users {
-		if _, err := tx.ExecContext(ctx, stmt, user.ID, teamName, user.Username, user.IsActive); err != nil {
-			_ = tx.Rollback()
 
-			return fmt.Errorf("insert team members, exec: %w", err)
+	return r.InTx(ctx, func(ctx context.Context) error {
+		for _, user := range users {
+			_, err := r.conn(ctx).ExecContext(
+				ctx, stmt, user.ID, teamName, user.Username, user.Email, user.IsActive,
+			)
+			if err != nil {
+				return fmt.Errorf("insert team members, exec: %w", err)
+			}
 		}
-	}
-
-	if err := tx.Commit(); err != nil {
-		return fmt.Errorf("insert team members, commit: %w", err)
-	}
 
-	return nil
+		return nil
+	})
 }
 
 func (r *Repository) ListTeamMembers(ctx context.Context, teamName string) ([]model.User, error) {
-	query := `SELECT id, team_name, username, is_active FROM users WHERE team_name = $1 ORDER BY username`
+	query := `
+SELECT id, team_name, username, email, is_active
+FROM users
+WHERE team_name = $1
+ORDER BY username
+`
 
-	rows, err := r.db.QueryContext(ctx, query, teamName)
+	rows, err := r.conn(ctx).QueryContext(ctx, query, teamName)
 	if err != nil {
 		return nil, fmt.Errorf("list team members, get query: %w", err)
 	}
@@ -98,7 +157,8 @@ func (r *Repository) ListTeamMembers(ctx context.Context, teamName string) ([]mo
 
 	for rows.Next() {
 		var user model.User
-		if err := rows.Scan(&user.ID, &user.TeamName, &user.Username, &user.IsActive); err != nil {
+		err := rows.Scan(&user.ID, &user.TeamName, &user.Username, &user.Email, &user.IsActive)
+		if err != nil {
 			return nil, fmt.Errorf("list team members, scan user: %w", err)
 		}
 
@@ -113,12 +173,12 @@ func (r *Repository) ListTeamMembers(ctx context.Context, teamName string) ([]mo
 }
 
 func (r *Repository) GetUserByID(ctx context.Context, userID string) (model.User, error) {
-	query := `SELECT id, team_name, username, is_active FROM users WHERE id = $1`
+	query := `SELECT id, team_name, username, email, is_active FROM users WHERE id = $1`
 
 	var user model.User
 
-	err := r.db.QueryRowContext(ctx, query, userID).
-		Scan(&user.ID, &user.TeamName, &user.Username, &user.IsActive)
+	err := r.conn(ctx).QueryRowContext(ctx, query, userID).
+		Scan(&user.ID, &user.TeamName, &user.Username, &user.Email, &user.IsActive)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return model.User{}, repository.ErrNotFound
@@ -138,13 +198,13 @@ func (r *Repository) SetUserActivity(
 	query := `
 UPDATE users SET is_active = $1, updated_at = now()
 WHERE id = $2
-RETURNING id, team_name, username, is_active
+RETURNING id, team_name, username, email, is_active
 `
 
 	var user model.User
 
-	err := r.db.QueryRowContext(ctx, query, active, userID).
-		Scan(&user.ID, &user.TeamName, &user.Username, &user.IsActive)
+	err := r.conn(ctx).QueryRowContext(ctx, query, active, userID).
+		Scan(&user.ID, &user.TeamName, &user.Username, &user.Email, &user.IsActive)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return model.User{}, repository.ErrNotFound
@@ -160,62 +220,76 @@ func (r *Repository) CreatePullRequest(
 	ctx context.Context,
 	pr model.PullRequest,
 ) (model.PullRequest, error) {
-	tx, err := r.db.BeginTx(ctx, nil)
-	if err != nil {
-		return model.PullRequest{}, fmt.Errorf("create pr, begin transaction: %w", err)
-	}
-
 	insertPR := `
 INSERT INTO pull_requests (id, name, author_id, status)
 VALUES ($1, $2, $3, $4)
-RETURNING id, name, author_id, status, created_at, merged_at
 `
 
-	var stored model.PullRequest
-
-	if err := tx.QueryRowContext(ctx, insertPR, pr.ID, pr.Name, pr.AuthorID, pr.Status).
-		Scan(&stored.ID, &stored.Name, &stored.AuthorID, &stored.Status, &stored.CreatedAt, &stored.MergedAt); err != nil {
-		_ = tx.Rollback()
-
-		if isUniqueViolation(err) {
-			return model.PullRequest{}, repository.ErrAlreadyExists
-		}
-
-		return model.PullRequest{}, fmt.Errorf("create pr, get query row: %w", err)
-	}
-
 	insertReviewer := `
 INSERT INTO pull_request_reviewers (pull_request_id, slot, reviewer_id)
 VALUES ($1, $2, $3)
 `
 
-	for idx, reviewerID := range pr.Reviewers {
-		slot := idx + 1
-		if _, err := tx.ExecContext(ctx, insertReviewer, pr.ID, slot, reviewerID); err != nil {
-			_ = tx.Rollback()
+	var stored model.PullRequest
+
+	err := r.InTx(ctx, func(ctx context.Context) error {
+		if _, err := r.conn(ctx).ExecContext(ctx, insertPR, pr.ID, pr.Name, pr.AuthorID, pr.Status); err != nil {
+			if isUniqueViolation(err) {
+				return repository.ErrAlreadyExists
+			}
 
-			return model.PullRequest{}, fmt.Errorf("create pr, exec: %w", err)
+			return fmt.Errorf("create pr, exec: %w", err)
 		}
-	}
 
-	if err := tx.Commit(); err != nil {
-		return model.PullRequest{}, fmt.Errorf("create pr, bad commit: %w", err)
+		for idx, reviewerID := range pr.Reviewers {
+			slot := idx + 1
+			if _, err := r.conn(ctx).ExecContext(ctx, insertReviewer, pr.ID, slot, reviewerID); err != nil {
+				return fmt.Errorf("create pr, exec: %w", err)
+			}
+		}
+
+		var err error
+
+		stored, err = r.GetPullRequest(ctx, pr.ID)
+
+		return err
+	})
+	if err != nil {
+		return model.PullRequest{}, err
 	}
 
-	return r.GetPullRequest(ctx, pr.ID)
+	return stored, nil
 }
 
 func (r *Repository) GetPullRequest(ctx context.Context, prID string) (model.PullRequest, error) {
+	return r.getPullRequest(ctx, prID, false)
+}
+
+func (r *Repository) GetPullRequestForUpdate(
+	ctx context.Context,
+	prID string,
+) (model.PullRequest, error) {
+	return r.getPullRequest(ctx, prID, true)
+}
+
+func (r *Repository) getPullRequest(
+	ctx context.Context,
+	prID string,
+	forUpdate bool,
+) (model.PullRequest, error) {
 	query := `
-SELECT id, name, author_id, status, created_at, merged_at
+SELECT id, name, author_id, status, created_at, merged_at, version
 FROM pull_requests
 WHERE id = $1
 `
+	if forUpdate {
+		query += "FOR UPDATE\n"
+	}
 
 	var pr model.PullRequest
 
-	err := r.db.QueryRowContext(ctx, query, prID).
-		Scan(&pr.ID, &pr.Name, &pr.AuthorID, &pr.Status, &pr.CreatedAt, &pr.MergedAt)
+	err := r.conn(ctx).QueryRowContext(ctx, query, prID).
+		Scan(&pr.ID, &pr.Name, &pr.AuthorID, &pr.Status, &pr.CreatedAt, &pr.MergedAt, &pr.Version)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return model.PullRequest{}, repository.ErrNotFound
@@ -243,15 +317,16 @@ func (r *Repository) UpdatePullRequestStatus(
 	query := `
 UPDATE pull_requests
 SET status = $1,
-    merged_at = $2
+    merged_at = $2,
+    version = version + 1
 WHERE id = $3
-RETURNING id, name, author_id, status, created_at, merged_at
+RETURNING id, name, author_id, status, created_at, merged_at, version
 `
 
 	var pr model.PullRequest
 
-	if err := r.db.QueryRowContext(ctx, query, status, mergedAt, prID).
-		Scan(&pr.ID, &pr.Name, &pr.AuthorID, &pr.Status, &pr.CreatedAt, &pr.MergedAt); err != nil {
+	if err := r.conn(ctx).QueryRowContext(ctx, query, status, mergedAt, prID).
+		Scan(&pr.ID, &pr.Name, &pr.AuthorID, &pr.Status, &pr.CreatedAt, &pr.MergedAt, &pr.Version); err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return model.PullRequest{}, repository.ErrNotFound
 		}
@@ -272,35 +347,58 @@ RETURNING id, name, author_id, status, created_at, merged_at
 func (r *Repository) ListReviewerPullRequests(
 	ctx context.Context,
 	userID string,
+	filter model.ReviewFilter,
 ) ([]model.PullRequest, error) {
 	query := `
-SELECT pr.id, pr.name, pr.author_id, pr.status, pr.created_at, pr.merged_at
+SELECT pr.id, pr.name, pr.author_id, pr.status, pr.created_at, pr.merged_at,
+       pr.version, rv.reviewers
 FROM pull_requests pr
 JOIN pull_request_reviewers r ON pr.id = r.pull_request_id
+LEFT JOIN LATERAL (
+    SELECT array_agg(a.reviewer_id ORDER BY a.slot) AS reviewers
+    FROM pull_request_reviewers a
+    WHERE a.pull_request_id = pr.id
+) rv ON TRUE
 WHERE r.reviewer_id = $1
+  AND ($2::pr_status IS NULL OR pr.status = $2::pr_status)
+  AND ($3::timestamptz IS NULL OR (pr.created_at, pr.id) > ($3::timestamptz, $4::text))
+ORDER BY pr.created_at, pr.id
+LIMIT NULLIF($5::int, 0)
 `
 
-	rows, err := r.db.QueryContext(ctx, query, userID)
+	var (
+		status    sql.NullString
+		afterTime sql.NullTime
+		afterID   sql.NullString
+	)
+
+	if filter.Status != "" {
+		status = sql.NullString{String: string(filter.Status), Valid: true}
+	}
+
+	if filter.After != nil {
+		afterTime = sql.NullTime{Time: filter.After.CreatedAt, Valid: true}
+		afterID = sql.NullString{String: filter.After.ID, Valid: true}
+	}
+
+	rows, err := r.conn(ctx).QueryContext(ctx, query, userID, status, afterTime, afterID, filter.Limit)
 	if err != nil {
-		return nil, fmt.Errorf("load reviewers, get query: %w", err)
+		return nil, fmt.Errorf("list reviewer, get query: %w", err)
 	}
 	//nolint:errcheck
 	defer rows.Close()
 
 	var prs []model.PullRequest
 
+	typeMap := pgtype.NewMap()
+
 	for rows.Next() {
 		var pr model.PullRequest
-		if err := rows.Scan(&pr.ID, &pr.Name, &pr.AuthorID, &pr.Status, &pr.CreatedAt, &pr.MergedAt); err != nil {
+		if err := rows.Scan(&pr.ID, &pr.Name, &pr.AuthorID, &pr.Status, &pr.CreatedAt, &pr.MergedAt,
+			&pr.Version, typeMap.SQLScanner(&pr.Reviewers)); err != nil {
 			return nil, fmt.Errorf("list reviewer, scan pr: %w", err)
 		}
 
-		reviewers, err := r.loadReviewers(ctx, pr.ID)
-		if err != nil {
-			return nil, err
-		}
-
-		pr.Reviewers = reviewers
 		prs = append(prs, pr)
 	}
 
@@ -311,15 +409,59 @@ WHERE r.reviewer_id = $1
 	return prs, nil
 }
 
-func (r *Repository) ReplaceReviewer(
+func (r *Repository) ListOpenReviews(
 	ctx context.Context,
-	prID, oldUserID, newUserID string,
-) (model.PullRequest, error) {
-	tx, err := r.db.BeginTx(ctx, nil)
+	userID string,
+) ([]model.DigestItem, error) {
+	query := `
+SELECT pr.id, pr.name, pr.author_id, pr.status, pr.created_at, pr.merged_at,
+       pr.version, rv.reviewers, r.assigned_at
+FROM pull_requests pr
+JOIN pull_request_reviewers r ON pr.id = r.pull_request_id
+LEFT JOIN LATERAL (
+    SELECT array_agg(a.reviewer_id ORDER BY a.slot) AS reviewers
+    FROM pull_request_reviewers a
+    WHERE a.pull_request_id = pr.id
+) rv ON TRUE
+WHERE r.reviewer_id = $1
+  AND pr.status = 'OPEN'
+ORDER BY r.assigned_at, pr.id
+`
+
+	rows, err := r.conn(ctx).QueryContext(ctx, query, userID)
 	if err != nil {
-		return model.PullRequest{}, fmt.Errorf("bad transaction begin: %w", err)
+		return nil, fmt.Errorf("list open reviews, get query: %w", err)
+	}
+	//nolint:errcheck
+	defer rows.Close()
+
+	var items []model.DigestItem
+
+	typeMap := pgtype.NewMap()
+
+	for rows.Next() {
+		var item model.DigestItem
+
+		pr := &item.PullRequest
+		if err := rows.Scan(&pr.ID, &pr.Name, &pr.AuthorID, &pr.Status, &pr.CreatedAt, &pr.MergedAt,
+			&pr.Version, typeMap.SQLScanner(&pr.Reviewers), &item.AssignedAt); err != nil {
+			return nil, fmt.Errorf("list open reviews, scan pr: %w", err)
+		}
+
+		items = append(items, item)
+	}
+
+	if err := rows.Err(); err != nil {
+		return items, fmt.Errorf("list open reviews of user %q: %w", userID, err)
 	}
 
+	return items, nil
+}
+
+func (r *Repository) ReplaceReviewer(
+	ctx context.Context,
+	prID, oldUserID, newUserID string,
+) (model.PullRequest, error) {
 	query := `
 UPDATE pull_request_reviewers
 SET reviewer_id = $3,
@@ -328,31 +470,99 @@ WHERE pull_request_id = $1
   AND reviewer_id = $2
 `
 
-	res, err := tx.ExecContext(ctx, query, prID, oldUserID, newUserID)
-	if err != nil {
-		_ = tx.Rollback()
+	bumpVersion := `
+UPDATE pull_requests
+SET version = version + 1
+WHERE id = $1
+`
 
-		return model.PullRequest{}, fmt.Errorf("exec in replace reviewer: %w", err)
-	}
+	var updated model.PullRequest
 
-	affected, err := res.RowsAffected()
-	if err != nil {
-		_ = tx.Rollback()
+	err := r.InTx(ctx, func(ctx context.Context) error {
+		res, err := r.conn(ctx).ExecContext(ctx, query, prID, oldUserID, newUserID)
+		if err != nil {
+			if isUniqueViolation(err) {
+				return repository.ErrAlreadyExists
+			}
 
-		return model.PullRequest{}, fmt.Errorf("get affected rows: %w", err)
-	}
+			return fmt.Errorf("exec in replace reviewer: %w", err)
+		}
 
-	if affected == 0 {
-		_ = tx.Rollback()
+		affected, err := res.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("get affected rows: %w", err)
+		}
 
-		return model.PullRequest{}, repository.ErrNotFound
+		if affected == 0 {
+			return repository.ErrNotFound
+		}
+
+		if _, err := r.conn(ctx).ExecContext(ctx, bumpVersion, prID); err != nil {
+			return fmt.Errorf("exec in replace reviewer, bump version: %w", err)
+		}
+
+		updated, err = r.GetPullRequest(ctx, prID)
+
+		return err
+	})
+	if err != nil {
+		return model.PullRequest{}, err
 	}
 
-	if err := tx.Commit(); err != nil {
-		return model.PullRequest{}, fmt.Errorf("bad commit in replace review: %w", err)
+	return updated, nil
+}
+
+func (r *Repository) AddReviewer(
+	ctx context.Context,
+	prID, userID string,
+) (model.PullRequest, error) {
+	bumpVersion := `
+UPDATE pull_requests
+SET version = version + 1
+WHERE id = $1
+`
+
+	query := `
+INSERT INTO pull_request_reviewers (pull_request_id, slot, reviewer_id)
+SELECT $1, COALESCE(MAX(slot), 0) + 1, $2
+FROM pull_request_reviewers
+WHERE pull_request_id = $1
+`
+
+	var updated model.PullRequest
+
+	err := r.InTx(ctx, func(ctx context.Context) error {
+		res, err := r.conn(ctx).ExecContext(ctx, bumpVersion, prID)
+		if err != nil {
+			return fmt.Errorf("exec in add reviewer, bump version: %w", err)
+		}
+
+		affected, err := res.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("get affected rows: %w", err)
+		}
+
+		if affected == 0 {
+			return repository.ErrNotFound
+		}
+
+		if _, err := r.conn(ctx).ExecContext(ctx, query, prID, userID); err != nil {
+			if isUniqueViolation(err) {
+				return repository.ErrAlreadyExists
+			}
+
+			return fmt.Errorf("exec in add reviewer: %w", err)
+		}
+
+		updated, err = r.GetPullRequest(ctx, prID)
+
+		return err
+	})
+	if err != nil {
+		return model.PullRequest{}, err
 	}
 
-	return r.GetPullRequest(ctx, prID)
+	return updated, nil
 }
 
 func (r *Repository) loadReviewers(ctx context.Context, prID string) ([]string, error) {
@@ -363,7 +573,7 @@ WHERE pull_request_id = $1
 ORDER BY slot
 `
 
-	rows, err := r.db.QueryContext(ctx, query, prID)
+	rows, err := r.conn(ctx).QueryContext(ctx, query, prID)
 	if err != nil {
 		return nil, fmt.Errorf("load reviewers, get query: %w", err)
 	}
@@ -388,6 +598,16 @@ ORDER BY slot
 	return reviewers, nil
 }
 
+func isConflict(err error) bool {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		// 40001 = serialization_failure, 40P01 = deadlock_detected
+		return pgErr.Code == "40001" || pgErr.Code == "40P01"
+	}
+
+	return false
+}
+
 func isUniqueViolation(err error) bool {
 	var pgErr *pgconn.PgError
 	if errors.As(err, &pgErr) {
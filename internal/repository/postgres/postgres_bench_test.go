@@ -0,0 +1,153 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	_ "github.com/jackc/pgx/v5/stdlib"
+
+	"github.com/6ermvH/avito-reviewchecker/internal/model"
+)
+
+const benchReviewedPRs = 1000
+
+// BenchmarkListReviewerPullRequests compares the aggregated query with the
+// previous per-row reviewer loading for a reviewer with 1k pull requests.
+// It needs a migrated database in TEST_POSTGRES_DSN.
+func BenchmarkListReviewerPullRequests(b *testing.B) {
+	dsn := os.Getenv("TEST_POSTGRES_DSN")
+	if dsn == "" {
+		b.Skip("TEST_POSTGRES_DSN is not set")
+	}
+
+	db, err := sql.Open("pgx", dsn)
+	if err != nil {
+		b.Fatalf("open db: %v", err)
+	}
+	//nolint:errcheck
+	defer db.Close()
+
+	ctx := context.Background()
+	prefix := fmt.Sprintf("bench-%d", time.Now().UnixNano())
+	reviewerID := seedReviewerPullRequests(ctx, b, db, prefix, benchReviewedPRs)
+
+	repo := New(db)
+
+	b.Run("aggregated", func(b *testing.B) {
+		for b.Loop() {
+			prs, err := repo.ListReviewerPullRequests(ctx, reviewerID, model.ReviewFilter{})
+			if err != nil {
+				b.Fatal(err)
+			}
+
+			if len(prs) != benchReviewedPRs {
+				b.Fatalf("expected %d prs, got %d", benchReviewedPRs, len(prs))
+			}
+		}
+	})
+
+	b.Run("per_row", func(b *testing.B) {
+		for b.Loop() {
+			prs, err := listReviewerPullRequestsPerRow(ctx, repo, reviewerID)
+			if err != nil {
+				b.Fatal(err)
+			}
+
+			if len(prs) != benchReviewedPRs {
+				b.Fatalf("expected %d prs, got %d", benchReviewedPRs, len(prs))
+			}
+		}
+	})
+}
+
+// listReviewerPullRequestsPerRow is the former N+1 implementation kept as a
+// baseline for the benchmark.
+func listReviewerPullRequestsPerRow(
+	ctx context.Context,
+	r *Repository,
+	userID string,
+) ([]model.PullRequest, error) {
+	rows, err := r.db.QueryContext(ctx, `
+SELECT pr.id, pr.name, pr.author_id, pr.status, pr.created_at, pr.merged_at
+FROM pull_requests pr
+JOIN pull_request_reviewers r ON pr.id = r.pull_request_id
+WHERE r.reviewer_id = $1
+`, userID)
+	if err != nil {
+		return nil, err
+	}
+	//nolint:errcheck
+	defer rows.Close()
+
+	var prs []model.PullRequest
+
+	for rows.Next() {
+		var pr model.PullRequest
+		if err := rows.Scan(&pr.ID, &pr.Name, &pr.AuthorID, &pr.Status, &pr.CreatedAt, &pr.MergedAt); err != nil {
+			return nil, err
+		}
+
+		if pr.Reviewers, err = r.loadReviewers(ctx, pr.ID); err != nil {
+			return nil, err
+		}
+
+		prs = append(prs, pr)
+	}
+
+	return prs, rows.Err()
+}
+
+func seedReviewerPullRequests(
+	ctx context.Context,
+	b *testing.B,
+	db *sql.DB,
+	prefix string,
+	count int,
+) string {
+	b.Helper()
+
+	authorID, reviewerID, secondID := prefix+"-author", prefix+"-reviewer", prefix+"-second"
+
+	statements := []struct {
+		query string
+		args  []any
+	}{
+		{`INSERT INTO teams (name) VALUES ($1)`, []any{prefix}},
+		{
+			`INSERT INTO users (id, team_name, username) VALUES ($1, $4, 'author'), ($2, $4, 'reviewer'), ($3, $4, 'second')`,
+			[]any{authorID, reviewerID, secondID, prefix},
+		},
+		{
+			`INSERT INTO pull_requests (id, name, author_id)
+SELECT $1::text || '-pr-' || g, 'bench', $2 FROM generate_series(1, $3::int) g`,
+			[]any{prefix, authorID, count},
+		},
+		{
+			`INSERT INTO pull_request_reviewers (pull_request_id, slot, reviewer_id)
+SELECT $1::text || '-pr-' || g, s.slot, CASE s.slot WHEN 1 THEN $2 ELSE $3 END
+FROM generate_series(1, $4::int) g CROSS JOIN (VALUES (1), (2)) AS s(slot)`,
+			[]any{prefix, reviewerID, secondID, count},
+		},
+	}
+
+	b.Cleanup(func() {
+		//nolint:errcheck
+		db.ExecContext(context.Background(), `DELETE FROM pull_requests WHERE author_id = $1`, authorID)
+		//nolint:errcheck
+		db.ExecContext(context.Background(), `DELETE FROM users WHERE team_name = $1`, prefix)
+		//nolint:errcheck
+		db.ExecContext(context.Background(), `DELETE FROM teams WHERE name = $1`, prefix)
+	})
+
+	for _, stmt := range statements {
+		if _, err := db.ExecContext(ctx, stmt.query, stmt.args...); err != nil {
+			b.Fatalf("seed benchmark data: %v", err)
+		}
+	}
+
+	return reviewerID
+}
@@ -0,0 +1,42 @@
+package postgres_test
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"testing"
+
+	_ "github.com/jackc/pgx/v5/stdlib"
+	"github.com/stretchr/testify/require"
+
+	"github.com/6ermvH/avito-reviewchecker/internal/repository/postgres"
+	"github.com/6ermvH/avito-reviewchecker/internal/repository/repotest"
+	"github.com/6ermvH/avito-reviewchecker/internal/usecase"
+)
+
+// TestRepositoryConformance needs a migrated, disposable database in
+// TEST_POSTGRES_DSN: every test case truncates all tables.
+func TestRepositoryConformance(t *testing.T) {
+	dsn := os.Getenv("TEST_POSTGRES_DSN")
+	if dsn == "" {
+		t.Skip("TEST_POSTGRES_DSN is not set")
+	}
+
+	db, err := sql.Open("pgx", dsn)
+	require.NoError(t, err)
+
+	t.Cleanup(func() {
+		//nolint:errcheck
+		db.Close()
+	})
+
+	repotest.Run(t, func(t *testing.T) usecase.Repository {
+		t.Helper()
+
+		_, err := db.ExecContext(context.Background(),
+			`TRUNCATE webhook_deliveries, webhook_subscriptions, outbox_events, assignment_events, pull_request_reviewers, pull_requests, users, teams`)
+		require.NoError(t, err)
+
+		return postgres.New(db)
+	})
+}
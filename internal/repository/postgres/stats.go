@@ -4,25 +4,37 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"time"
 
 	"github.com/6ermvH/avito-reviewchecker/internal/model"
+	"github.com/6ermvH/avito-reviewchecker/internal/repository"
 )
 
-func (r *Repository) ListReviewerStats(ctx context.Context) ([]model.ReviewerStat, error) {
+func (r *Repository) ListReviewerStats(
+	ctx context.Context,
+	filter model.StatsFilter,
+) ([]model.ReviewerStat, error) {
 	query := `
 SELECT u.id,
        u.username,
        u.team_name,
-       COUNT(*) AS total_assigned,
-       COALESCE(SUM(CASE WHEN pr.status = 'OPEN' THEN 1 ELSE 0 END), 0) AS open_assigned
-FROM pull_request_reviewers r
-JOIN users u ON u.id = r.reviewer_id
-JOIN pull_requests pr ON pr.id = r.pull_request_id
-GROUP BY u.id, u.username, u.team_name
+       u.is_active,
+       COUNT(r.reviewer_id) AS total_assigned,
+       COALESCE(SUM(CASE WHEN pr.status = 'OPEN' THEN 1 ELSE 0 END), 0) AS open_assigned,
+       MAX(r.assigned_at) AS last_assigned_at
+FROM users u
+LEFT JOIN pull_request_reviewers r ON r.reviewer_id = u.id
+    AND ($1::timestamptz IS NULL OR r.assigned_at >= $1)
+    AND ($2::timestamptz IS NULL OR r.assigned_at < $2)
+LEFT JOIN pull_requests pr ON pr.id = r.pull_request_id
+WHERE $3 = '' OR u.team_name = $3
+GROUP BY u.id, u.username, u.team_name, u.is_active
 ORDER BY total_assigned DESC, u.id
 `
 
-	rows, err := r.db.QueryContext(ctx, query)
+	from, to := statsWindow(filter)
+
+	rows, err := r.conn(ctx).QueryContext(ctx, query, from, to, filter.TeamName)
 	if err != nil {
 		return nil, fmt.Errorf("list reviewer stats: %w", err)
 	}
@@ -32,13 +44,21 @@ ORDER BY total_assigned DESC, u.id
 	var stats []model.ReviewerStat
 
 	for rows.Next() {
-		var stat model.ReviewerStat
+		var (
+			stat         model.ReviewerStat
+			lastAssigned sql.NullTime
+		)
+
 		if err := rows.Scan(&stat.UserID, &stat.Username,
-			&stat.TeamName, &stat.TotalAssigned,
-			&stat.OpenAssigned); err != nil {
+			&stat.TeamName, &stat.IsActive, &stat.TotalAssigned,
+			&stat.OpenAssigned, &lastAssigned); err != nil {
 			return nil, fmt.Errorf("scan reviewer stat: %w", err)
 		}
 
+		if lastAssigned.Valid {
+			stat.LastAssignedAt = &lastAssigned.Time
+		}
+
 		stats = append(stats, stat)
 	}
 
@@ -49,19 +69,37 @@ ORDER BY total_assigned DESC, u.id
 	return stats, nil
 }
 
-func (r *Repository) GetPullRequestStats(ctx context.Context) (model.PullRequestStats, error) {
+func (r *Repository) GetPullRequestStats(
+	ctx context.Context,
+	filter model.StatsFilter,
+) (model.PullRequestStats, error) {
 	type aggregate struct {
 		Total  sql.NullInt64
 		Open   sql.NullInt64
 		Merged sql.NullInt64
 	}
 
-	row := r.db.QueryRowContext(ctx, `
-SELECT COUNT(*) AS total,
-       SUM(CASE WHEN status = 'OPEN' THEN 1 ELSE 0 END) AS open,
-       SUM(CASE WHEN status = 'MERGED' THEN 1 ELSE 0 END) AS merged
-FROM pull_requests
-`)
+	from, to := statsWindow(filter)
+
+	// created and merged select the pull requests of the team created and
+	// merged within the window.
+	row := r.conn(ctx).QueryRowContext(ctx, `
+WITH scoped AS (
+    SELECT pr.status,
+           ($1::timestamptz IS NULL OR pr.created_at >= $1)
+               AND ($2::timestamptz IS NULL OR pr.created_at < $2) AS created,
+           pr.merged_at IS NOT NULL
+               AND ($1::timestamptz IS NULL OR pr.merged_at >= $1)
+               AND ($2::timestamptz IS NULL OR pr.merged_at < $2) AS merged
+    FROM pull_requests pr
+    JOIN users u ON u.id = pr.author_id
+    WHERE $3 = '' OR u.team_name = $3
+)
+SELECT SUM(CASE WHEN created THEN 1 ELSE 0 END) AS total,
+       SUM(CASE WHEN created AND status = 'OPEN' THEN 1 ELSE 0 END) AS open,
+       SUM(CASE WHEN merged THEN 1 ELSE 0 END) AS merged
+FROM scoped
+`, from, to, filter.TeamName)
 
 	var agg aggregate
 	if err := row.Scan(&agg.Total, &agg.Open, &agg.Merged); err != nil {
@@ -71,8 +109,15 @@ FROM pull_requests
 	totalPR := int(agg.Total.Int64)
 
 	var totalAssignments int
-	if err := r.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM pull_request_reviewers`).
-		Scan(&totalAssignments); err != nil {
+	if err := r.conn(ctx).QueryRowContext(ctx, `
+SELECT COUNT(*)
+FROM pull_request_reviewers r
+JOIN pull_requests pr ON pr.id = r.pull_request_id
+JOIN users u ON u.id = pr.author_id
+WHERE ($1::timestamptz IS NULL OR pr.created_at >= $1)
+  AND ($2::timestamptz IS NULL OR pr.created_at < $2)
+  AND ($3 = '' OR u.team_name = $3)
+`, from, to, filter.TeamName).Scan(&totalAssignments); err != nil {
 		return model.PullRequestStats{}, fmt.Errorf("count reviewer assignments: %w", err)
 	}
 
@@ -85,12 +130,23 @@ FROM pull_requests
 		stats.AverageReview = float64(totalAssignments) / float64(totalPR)
 	}
 
-	rows, err := r.db.QueryContext(ctx, `
-SELECT author_id, COUNT(*) AS count
-FROM pull_requests
-GROUP BY author_id
-ORDER BY count DESC, author_id
-`)
+	overall, byTeam, err := r.timeToMerge(ctx, from, to, filter.TeamName)
+	if err != nil {
+		return stats, err
+	}
+
+	stats.TimeToMerge, stats.TimeToMergeByTeam = overall, byTeam
+
+	rows, err := r.conn(ctx).QueryContext(ctx, `
+SELECT pr.author_id, COUNT(*) AS count
+FROM pull_requests pr
+JOIN users u ON u.id = pr.author_id
+WHERE ($1::timestamptz IS NULL OR pr.created_at >= $1)
+  AND ($2::timestamptz IS NULL OR pr.created_at < $2)
+  AND ($3 = '' OR u.team_name = $3)
+GROUP BY pr.author_id
+ORDER BY count DESC, pr.author_id
+`, from, to, filter.TeamName)
 	if err != nil {
 		return stats, fmt.Errorf("pull request stats by author: %w", err)
 	}
@@ -112,3 +168,285 @@ ORDER BY count DESC, author_id
 
 	return stats, nil
 }
+
+func (r *Repository) ListTeamStats(
+	ctx context.Context,
+	filter model.StatsFilter,
+) ([]model.TeamStat, error) {
+	from, to := statsWindow(filter)
+
+	// load counts the open pull requests assigned to every member, prs the
+	// pull requests of the team created within the window.
+	rows, err := r.conn(ctx).QueryContext(ctx, `
+WITH load AS (
+    SELECT u.team_name, u.is_active, COUNT(pr.id) AS open_assigned
+    FROM users u
+    LEFT JOIN pull_request_reviewers r ON r.reviewer_id = u.id
+    LEFT JOIN pull_requests pr ON pr.id = r.pull_request_id AND pr.status = 'OPEN'
+    GROUP BY u.team_name, u.id, u.is_active
+),
+members AS (
+    SELECT team_name,
+           SUM(CASE WHEN is_active THEN 1 ELSE 0 END) AS active,
+           SUM(CASE WHEN is_active THEN 0 ELSE 1 END) AS inactive,
+           MIN(CASE WHEN is_active THEN open_assigned END) AS min_open,
+           MAX(CASE WHEN is_active THEN open_assigned END) AS max_open,
+           AVG(CASE WHEN is_active THEN open_assigned END)::double precision AS mean_open
+    FROM load
+    GROUP BY team_name
+),
+prs AS (
+    SELECT u.team_name,
+           SUM(CASE WHEN pr.status = 'OPEN' THEN 1 ELSE 0 END) AS open,
+           SUM(CASE WHEN pr.status = 'MERGED' THEN 1 ELSE 0 END) AS merged,
+           SUM(CASE WHEN (
+               SELECT COUNT(*) FROM pull_request_reviewers r WHERE r.pull_request_id = pr.id
+           ) < $4 THEN 1 ELSE 0 END) AS understaffed
+    FROM pull_requests pr
+    JOIN users u ON u.id = pr.author_id
+    WHERE ($1::timestamptz IS NULL OR pr.created_at >= $1)
+      AND ($2::timestamptz IS NULL OR pr.created_at < $2)
+    GROUP BY u.team_name
+)
+SELECT t.name,
+       COALESCE(p.open, 0),
+       COALESCE(p.merged, 0),
+       COALESCE(p.understaffed, 0),
+       COALESCE(m.active, 0),
+       COALESCE(m.inactive, 0),
+       COALESCE(m.min_open, 0),
+       COALESCE(m.max_open, 0),
+       COALESCE(m.mean_open, 0)
+FROM teams t
+LEFT JOIN members m ON m.team_name = t.name
+LEFT JOIN prs p ON p.team_name = t.name
+WHERE $3 = '' OR t.name = $3
+ORDER BY t.name
+`, from, to, filter.TeamName, model.DesiredReviewers)
+	if err != nil {
+		return nil, fmt.Errorf("list team stats: %w", err)
+	}
+	//nolint:errcheck
+	defer rows.Close()
+
+	var stats []model.TeamStat
+
+	for rows.Next() {
+		var stat model.TeamStat
+		if err := rows.Scan(&stat.TeamName, &stat.OpenPRs, &stat.MergedPRs,
+			&stat.UnderstaffedPRs, &stat.ActiveMembers, &stat.InactiveMembers,
+			&stat.MinOpenAssigned, &stat.MaxOpenAssigned,
+			&stat.MeanOpenAssigned); err != nil {
+			return nil, fmt.Errorf("scan team stat: %w", err)
+		}
+
+		stats = append(stats, stat)
+	}
+
+	if err := rows.Err(); err != nil {
+		return stats, fmt.Errorf("list team stats: %w", err)
+	}
+
+	return stats, nil
+}
+
+func (r *Repository) CountOpenPullRequests(ctx context.Context) ([]model.TeamCount, error) {
+	rows, err := r.conn(ctx).QueryContext(ctx, `
+SELECT t.name, COUNT(pr.id)
+FROM teams t
+LEFT JOIN users u ON u.team_name = t.name
+LEFT JOIN pull_requests pr ON pr.author_id = u.id AND pr.status = 'OPEN'
+GROUP BY t.name
+ORDER BY t.name
+`)
+	if err != nil {
+		return nil, fmt.Errorf("count open pull requests: %w", err)
+	}
+	//nolint:errcheck
+	defer rows.Close()
+
+	var counts []model.TeamCount
+
+	for rows.Next() {
+		var count model.TeamCount
+		if err := rows.Scan(&count.TeamName, &count.Count); err != nil {
+			return nil, fmt.Errorf("scan open pull requests: %w", err)
+		}
+
+		counts = append(counts, count)
+	}
+
+	if err := rows.Err(); err != nil {
+		return counts, fmt.Errorf("count open pull requests: %w", err)
+	}
+
+	return counts, nil
+}
+
+// timeseriesSources select the timestamps counted by every metric, along with
+// the team they are filtered by.
+var timeseriesSources = map[model.TimeseriesMetric]string{
+	model.MetricPRsCreated: `
+SELECT pr.created_at AS ts
+FROM pull_requests pr
+JOIN users u ON u.id = pr.author_id
+WHERE $3 = '' OR u.team_name = $3`,
+	model.MetricPRsMerged: `
+SELECT pr.merged_at AS ts
+FROM pull_requests pr
+JOIN users u ON u.id = pr.author_id
+WHERE pr.merged_at IS NOT NULL AND ($3 = '' OR u.team_name = $3)`,
+	model.MetricAssignments: `
+SELECT r.assigned_at AS ts
+FROM pull_request_reviewers r
+JOIN users u ON u.id = r.reviewer_id
+WHERE $3 = '' OR u.team_name = $3`,
+}
+
+func (r *Repository) ListTimeseries(
+	ctx context.Context,
+	metric model.TimeseriesMetric,
+	bucket model.TimeseriesBucket,
+	filter model.StatsFilter,
+) ([]model.TimeseriesPoint, error) {
+	source, ok := timeseriesSources[metric]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", repository.ErrUnknownMetric, metric)
+	}
+
+	// bucket names are date_trunc fields, anything else counts per day like
+	// the other backends do
+	field := model.BucketDay
+	if bucket == model.BucketWeek {
+		field = model.BucketWeek
+	}
+
+	from, to := statsWindow(filter)
+
+	rows, err := r.conn(ctx).QueryContext(ctx, `
+SELECT date_trunc($4, s.ts, 'UTC') AS bucket, COUNT(*)
+FROM (`+source+`) s
+WHERE ($1::timestamptz IS NULL OR s.ts >= $1)
+  AND ($2::timestamptz IS NULL OR s.ts < $2)
+GROUP BY bucket
+ORDER BY bucket
+`, from, to, filter.TeamName, string(field))
+	if err != nil {
+		return nil, fmt.Errorf("list %s timeseries: %w", metric, err)
+	}
+	//nolint:errcheck
+	defer rows.Close()
+
+	var points []model.TimeseriesPoint
+
+	for rows.Next() {
+		var point model.TimeseriesPoint
+		if err := rows.Scan(&point.Start, &point.Count); err != nil {
+			return nil, fmt.Errorf("scan timeseries point: %w", err)
+		}
+
+		point.Start = point.Start.UTC()
+		points = append(points, point)
+	}
+
+	if err := rows.Err(); err != nil {
+		return points, fmt.Errorf("list %s timeseries: %w", metric, err)
+	}
+
+	return points, nil
+}
+
+// timeToMerge computes the percentiles of the time from creation to merge of
+// the pull requests merged within the window, overall and per author team.
+func (r *Repository) timeToMerge(
+	ctx context.Context,
+	from, to sql.NullTime,
+	teamName string,
+) (*model.Percentiles, []model.TeamTimeToMerge, error) {
+	rows, err := r.conn(ctx).QueryContext(ctx, `
+SELECT u.team_name,
+       percentile_cont(0.5) WITHIN GROUP (ORDER BY m.seconds) AS p50,
+       percentile_cont(0.9) WITHIN GROUP (ORDER BY m.seconds) AS p90,
+       percentile_cont(0.99) WITHIN GROUP (ORDER BY m.seconds) AS p99
+FROM (
+    SELECT pr.author_id,
+           EXTRACT(EPOCH FROM pr.merged_at - pr.created_at)::double precision AS seconds
+    FROM pull_requests pr
+    WHERE pr.merged_at IS NOT NULL
+      AND ($1::timestamptz IS NULL OR pr.merged_at >= $1)
+      AND ($2::timestamptz IS NULL OR pr.merged_at < $2)
+) m
+JOIN users u ON u.id = m.author_id
+WHERE $3 = '' OR u.team_name = $3
+GROUP BY GROUPING SETS ((), (u.team_name))
+ORDER BY GROUPING(u.team_name) DESC, u.team_name
+`, from, to, teamName)
+	if err != nil {
+		return nil, nil, fmt.Errorf("time to merge percentiles: %w", err)
+	}
+	//nolint:errcheck
+	defer rows.Close()
+
+	var (
+		overall *model.Percentiles
+		byTeam  []model.TeamTimeToMerge
+	)
+
+	for rows.Next() {
+		var (
+			team          sql.NullString
+			p50, p90, p99 sql.NullFloat64
+		)
+
+		if err := rows.Scan(&team, &p50, &p90, &p99); err != nil {
+			return nil, nil, fmt.Errorf("scan time to merge percentiles: %w", err)
+		}
+
+		// the overall row of an empty set has no percentiles
+		if !p50.Valid {
+			continue
+		}
+
+		percentiles := model.Percentiles{
+			P50: seconds(p50.Float64),
+			P90: seconds(p90.Float64),
+			P99: seconds(p99.Float64),
+		}
+
+		if !team.Valid {
+			overall = &percentiles
+
+			continue
+		}
+
+		byTeam = append(byTeam, model.TeamTimeToMerge{
+			TeamName:    team.String,
+			TimeToMerge: percentiles,
+		})
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, nil, fmt.Errorf("iterate time to merge percentiles: %w", err)
+	}
+
+	return overall, byTeam, nil
+}
+
+func seconds(v float64) time.Duration {
+	return time.Duration(v * float64(time.Second))
+}
+
+// statsWindow returns the bounds of filter as query arguments, NULL when unset.
+func statsWindow(filter model.StatsFilter) (sql.NullTime, sql.NullTime) {
+	var from, to sql.NullTime
+
+	if filter.From != nil {
+		from = sql.NullTime{Time: *filter.From, Valid: true}
+	}
+
+	if filter.To != nil {
+		to = sql.NullTime{Time: *filter.To, Valid: true}
+	}
+
+	return from, to
+}
@@ -0,0 +1,408 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+
+	"github.com/6ermvH/avito-reviewchecker/internal/model"
+	"github.com/6ermvH/avito-reviewchecker/internal/repository"
+)
+
+func (r *Repository) AppendOutboxEvents(ctx context.Context, events []model.OutboxEvent) error {
+	query := `
+INSERT INTO outbox_events (event_type, pull_request_id, payload)
+VALUES ($1, $2, $3)
+`
+
+	return r.InTx(ctx, func(ctx context.Context) error {
+		for _, event := range events {
+			if _, err := r.conn(ctx).ExecContext(ctx, query,
+				event.Type,
+				event.PullRequestID,
+				[]byte(event.Payload),
+			); err != nil {
+				return fmt.Errorf("append outbox event %q: %w", event.Type, err)
+			}
+		}
+
+		return nil
+	})
+}
+
+// ClaimOutboxEvents locks up to limit undispatched events in id order. Rows
+// locked by a concurrent dispatcher are skipped.
+func (r *Repository) ClaimOutboxEvents(
+	ctx context.Context,
+	limit int,
+) ([]model.OutboxEvent, error) {
+	query := `
+SELECT id, event_type, pull_request_id, payload, created_at
+FROM outbox_events
+WHERE dispatched_at IS NULL
+ORDER BY id
+LIMIT $1
+FOR UPDATE SKIP LOCKED
+`
+
+	rows, err := r.conn(ctx).QueryContext(ctx, query, limit)
+	if err != nil {
+		return nil, fmt.Errorf("claim outbox events: %w", err)
+	}
+	//nolint:errcheck
+	defer rows.Close()
+
+	var events []model.OutboxEvent
+
+	for rows.Next() {
+		var (
+			event   model.OutboxEvent
+			payload []byte
+		)
+
+		if err := rows.Scan(
+			&event.ID,
+			&event.Type,
+			&event.PullRequestID,
+			&payload,
+			&event.CreatedAt,
+		); err != nil {
+			return nil, fmt.Errorf("scan outbox event: %w", err)
+		}
+
+		event.Payload = payload
+
+		events = append(events, event)
+	}
+
+	if err := rows.Err(); err != nil {
+		return events, fmt.Errorf("claim outbox events: %w", err)
+	}
+
+	return events, nil
+}
+
+func (r *Repository) MarkOutboxEventsDispatched(ctx context.Context, ids []int64) error {
+	query := `
+UPDATE outbox_events
+SET dispatched_at = now()
+WHERE id = ANY($1)
+`
+
+	if _, err := r.conn(ctx).ExecContext(ctx, query, ids); err != nil {
+		return fmt.Errorf("mark outbox events dispatched: %w", err)
+	}
+
+	return nil
+}
+
+func (r *Repository) CreateWebhookSubscription(
+	ctx context.Context,
+	sub model.WebhookSubscription,
+) (model.WebhookSubscription, error) {
+	query := `
+INSERT INTO webhook_subscriptions (id, url, secret, event_types)
+VALUES ($1, $2, $3, $4)
+RETURNING created_at
+`
+
+	eventTypes := make([]string, 0, len(sub.EventTypes))
+	for _, eventType := range sub.EventTypes {
+		eventTypes = append(eventTypes, string(eventType))
+	}
+
+	err := r.conn(ctx).QueryRowContext(ctx, query, sub.ID, sub.URL, sub.Secret, eventTypes).
+		Scan(&sub.CreatedAt)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return model.WebhookSubscription{}, repository.ErrAlreadyExists
+		}
+
+		return model.WebhookSubscription{}, fmt.Errorf("create webhook subscription: %w", err)
+	}
+
+	return sub, nil
+}
+
+func (r *Repository) ListWebhookSubscriptions(
+	ctx context.Context,
+) ([]model.WebhookSubscription, error) {
+	query := `
+SELECT id, url, secret, event_types, created_at
+FROM webhook_subscriptions
+ORDER BY created_at, id
+`
+
+	rows, err := r.conn(ctx).QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("list webhook subscriptions: %w", err)
+	}
+	//nolint:errcheck
+	defer rows.Close()
+
+	var subs []model.WebhookSubscription
+
+	typeMap := pgtype.NewMap()
+
+	for rows.Next() {
+		var (
+			sub        model.WebhookSubscription
+			eventTypes []string
+		)
+
+		if err := rows.Scan(
+			&sub.ID,
+			&sub.URL,
+			&sub.Secret,
+			typeMap.SQLScanner(&eventTypes),
+			&sub.CreatedAt,
+		); err != nil {
+			return nil, fmt.Errorf("scan webhook subscription: %w", err)
+		}
+
+		for _, eventType := range eventTypes {
+			sub.EventTypes = append(sub.EventTypes, model.DomainEventType(eventType))
+		}
+
+		subs = append(subs, sub)
+	}
+
+	if err := rows.Err(); err != nil {
+		return subs, fmt.Errorf("list webhook subscriptions: %w", err)
+	}
+
+	return subs, nil
+}
+
+func (r *Repository) DeleteWebhookSubscription(ctx context.Context, id string) error {
+	query := `
+DELETE FROM webhook_subscriptions
+WHERE id = $1
+`
+
+	res, err := r.conn(ctx).ExecContext(ctx, query, id)
+	if err != nil {
+		return fmt.Errorf("delete webhook subscription: %w", err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("get affected rows: %w", err)
+	}
+
+	if affected == 0 {
+		return repository.ErrNotFound
+	}
+
+	return nil
+}
+
+func (r *Repository) CreateWebhookDeliveries(
+	ctx context.Context,
+	deliveries []model.WebhookDelivery,
+) error {
+	query := `
+INSERT INTO webhook_deliveries (subscription_id, event_id, next_attempt_at)
+VALUES ($1, $2, $3)
+ON CONFLICT (subscription_id, event_id) DO NOTHING
+`
+
+	return r.InTx(ctx, func(ctx context.Context) error {
+		for _, delivery := range deliveries {
+			if _, err := r.conn(ctx).ExecContext(ctx, query,
+				delivery.SubscriptionID,
+				delivery.EventID,
+				delivery.NextAttemptAt,
+			); err != nil {
+				return fmt.Errorf("create webhook delivery: %w", err)
+			}
+		}
+
+		return nil
+	})
+}
+
+// ClaimDueDeliveries returns up to limit pending deliveries due at now and
+// moves their next attempt lease into the future, so that other dispatchers
+// skip them while they are being sent.
+func (r *Repository) ClaimDueDeliveries(
+	ctx context.Context,
+	now time.Time,
+	lease time.Duration,
+	limit int,
+) ([]model.PendingDelivery, error) {
+	query := `
+WITH due AS (
+    SELECT id
+    FROM webhook_deliveries
+    WHERE status = 'PENDING'
+      AND next_attempt_at <= $1
+    ORDER BY next_attempt_at, id
+    LIMIT $3
+    FOR UPDATE SKIP LOCKED
+)
+UPDATE webhook_deliveries d
+SET next_attempt_at = $2,
+    updated_at = now()
+FROM due, webhook_subscriptions s, outbox_events e
+WHERE d.id = due.id
+  AND s.id = d.subscription_id
+  AND e.id = d.event_id
+RETURNING d.id, d.subscription_id, d.event_id, d.status, d.attempts, d.next_attempt_at,
+          d.last_error, d.created_at, d.updated_at,
+          s.url, s.secret,
+          e.event_type, e.pull_request_id, e.payload, e.created_at
+`
+
+	rows, err := r.conn(ctx).QueryContext(ctx, query, now, now.Add(lease), limit)
+	if err != nil {
+		return nil, fmt.Errorf("claim due deliveries: %w", err)
+	}
+	//nolint:errcheck
+	defer rows.Close()
+
+	var pending []model.PendingDelivery
+
+	for rows.Next() {
+		var (
+			p       model.PendingDelivery
+			payload []byte
+		)
+
+		if err := rows.Scan(
+			&p.Delivery.ID,
+			&p.Delivery.SubscriptionID,
+			&p.Delivery.EventID,
+			&p.Delivery.Status,
+			&p.Delivery.Attempts,
+			&p.Delivery.NextAttemptAt,
+			&p.Delivery.LastError,
+			&p.Delivery.CreatedAt,
+			&p.Delivery.UpdatedAt,
+			&p.Subscription.URL,
+			&p.Subscription.Secret,
+			&p.Event.Type,
+			&p.Event.PullRequestID,
+			&payload,
+			&p.Event.CreatedAt,
+		); err != nil {
+			return nil, fmt.Errorf("scan due delivery: %w", err)
+		}
+
+		p.Event.Payload = payload
+
+		p.Subscription.ID = p.Delivery.SubscriptionID
+		p.Event.ID = p.Delivery.EventID
+
+		pending = append(pending, p)
+	}
+
+	if err := rows.Err(); err != nil {
+		return pending, fmt.Errorf("claim due deliveries: %w", err)
+	}
+
+	return pending, nil
+}
+
+func (r *Repository) UpdateWebhookDelivery(
+	ctx context.Context,
+	delivery model.WebhookDelivery,
+	leaseUntil time.Time,
+) error {
+	query := `
+UPDATE webhook_deliveries
+SET status = $2,
+    attempts = $3,
+    next_attempt_at = $4,
+    last_error = $5,
+    updated_at = now()
+WHERE id = $1
+  AND status = 'PENDING'
+  AND next_attempt_at = $6
+`
+
+	res, err := r.conn(ctx).ExecContext(ctx, query,
+		delivery.ID,
+		delivery.Status,
+		delivery.Attempts,
+		delivery.NextAttemptAt,
+		delivery.LastError,
+		leaseUntil,
+	)
+	if err != nil {
+		return fmt.Errorf("update webhook delivery: %w", err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("get affected rows: %w", err)
+	}
+
+	if affected == 0 {
+		return repository.ErrLeaseLost
+	}
+
+	return nil
+}
+
+func (r *Repository) ListWebhookDeliveries(
+	ctx context.Context,
+	filter model.DeliveryFilter,
+) ([]model.WebhookDelivery, error) {
+	query := `
+SELECT id, subscription_id, event_id, status, attempts, next_attempt_at, last_error,
+       created_at, updated_at
+FROM webhook_deliveries
+WHERE ($1::text IS NULL OR subscription_id = $1::text)
+  AND ($2::text IS NULL OR status = $2::text)
+ORDER BY id DESC
+LIMIT NULLIF($3::int, 0)
+`
+
+	var subscriptionID, status sql.NullString
+
+	if filter.SubscriptionID != "" {
+		subscriptionID = sql.NullString{String: filter.SubscriptionID, Valid: true}
+	}
+
+	if filter.Status != "" {
+		status = sql.NullString{String: string(filter.Status), Valid: true}
+	}
+
+	rows, err := r.conn(ctx).QueryContext(ctx, query, subscriptionID, status, filter.Limit)
+	if err != nil {
+		return nil, fmt.Errorf("list webhook deliveries: %w", err)
+	}
+	//nolint:errcheck
+	defer rows.Close()
+
+	var deliveries []model.WebhookDelivery
+
+	for rows.Next() {
+		var d model.WebhookDelivery
+		if err := rows.Scan(
+			&d.ID,
+			&d.SubscriptionID,
+			&d.EventID,
+			&d.Status,
+			&d.Attempts,
+			&d.NextAttemptAt,
+			&d.LastError,
+			&d.CreatedAt,
+			&d.UpdatedAt,
+		); err != nil {
+			return nil, fmt.Errorf("scan webhook delivery: %w", err)
+		}
+
+		deliveries = append(deliveries, d)
+	}
+
+	if err := rows.Err(); err != nil {
+		return deliveries, fmt.Errorf("list webhook deliveries: %w", err)
+	}
+
+	return deliveries, nil
+}
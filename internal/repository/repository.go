@@ -5,4 +5,13 @@ import "errors"
 var (
 	ErrNotFound      = errors.New("not found")
 	ErrAlreadyExists = errors.New("already exists")
+	// ErrConflict is returned when a transaction could not be completed
+	// because of a concurrent one and may be retried.
+	ErrConflict = errors.New("conflict")
+	// ErrUnknownMetric is returned for a time series metric the repository
+	// can not count.
+	ErrUnknownMetric = errors.New("unknown metric")
+	// ErrLeaseLost is returned when a claimed webhook delivery was claimed
+	// again after its lease expired, or is gone.
+	ErrLeaseLost = errors.New("lease lost")
 )
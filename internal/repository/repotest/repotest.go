@@ -0,0 +1,1035 @@
+// Package repotest contains the conformance suite every usecase.Repository
+// implementation is expected to pass.
+package repotest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/6ermvH/avito-reviewchecker/internal/model"
+	"github.com/6ermvH/avito-reviewchecker/internal/repository"
+	"github.com/6ermvH/avito-reviewchecker/internal/usecase"
+)
+
+// Factory returns an empty repository. It is called once per test case, so
+// implementations backed by a shared database must reset it before returning.
+type Factory func(t *testing.T) usecase.Repository
+
+func Run(t *testing.T, newRepo Factory) {
+	t.Helper()
+
+	t.Run("Teams", func(t *testing.T) { testTeams(t, newRepo(t)) })
+	t.Run("Users", func(t *testing.T) { testUsers(t, newRepo(t)) })
+	t.Run("PullRequests", func(t *testing.T) { testPullRequests(t, newRepo(t)) })
+	t.Run("ReplaceReviewer", func(t *testing.T) { testReplaceReviewer(t, newRepo(t)) })
+	t.Run("AddReviewer", func(t *testing.T) { testAddReviewer(t, newRepo(t)) })
+	t.Run("ListReviewerPullRequests", func(t *testing.T) { testListReviewerPullRequests(t, newRepo(t)) })
+	t.Run("ListOpenReviews", func(t *testing.T) { testListOpenReviews(t, newRepo(t)) })
+	t.Run("Stats", func(t *testing.T) { testStats(t, newRepo(t)) })
+	t.Run("StatsFilter", func(t *testing.T) { testStatsFilter(t, newRepo(t)) })
+	t.Run("TimeToMerge", func(t *testing.T) { testTimeToMerge(t, newRepo(t)) })
+	t.Run("TeamStats", func(t *testing.T) { testTeamStats(t, newRepo(t)) })
+	t.Run("Timeseries", func(t *testing.T) { testTimeseries(t, newRepo(t)) })
+	t.Run("AssignmentEvents", func(t *testing.T) { testAssignmentEvents(t, newRepo(t)) })
+	t.Run("Escalations", func(t *testing.T) { testEscalations(t, newRepo(t)) })
+	t.Run("Outbox", func(t *testing.T) { testOutbox(t, newRepo(t)) })
+	t.Run("WebhookSubscriptions", func(t *testing.T) { testWebhookSubscriptions(t, newRepo(t)) })
+	t.Run("WebhookDeliveries", func(t *testing.T) { testWebhookDeliveries(t, newRepo(t)) })
+	t.Run("Transactions", func(t *testing.T) { testTransactions(t, newRepo(t)) })
+	t.Run("ConcurrentReassign", func(t *testing.T) { testConcurrentReassign(t, newRepo(t)) })
+}
+
+func testTeams(t *testing.T, repo usecase.Repository) {
+	ctx := context.Background()
+
+	_, err := repo.GetTeamByName(ctx, "backend")
+	require.ErrorIs(t, err, repository.ErrNotFound)
+
+	created, err := repo.CreateTeam(ctx, "backend")
+	require.NoError(t, err)
+	require.Equal(t, model.Team{Name: "backend"}, created)
+
+	found, err := repo.GetTeamByName(ctx, "backend")
+	require.NoError(t, err)
+	require.Equal(t, created, found)
+
+	_, err = repo.CreateTeam(ctx, "backend")
+	require.ErrorIs(t, err, repository.ErrAlreadyExists)
+}
+
+func testUsers(t *testing.T, repo usecase.Repository) {
+	ctx := context.Background()
+
+	_, err := repo.GetUserByID(ctx, "u1")
+	require.ErrorIs(t, err, repository.ErrNotFound)
+
+	_, err = repo.SetUserActivity(ctx, "u1", false)
+	require.ErrorIs(t, err, repository.ErrNotFound)
+
+	require.Error(t, repo.InsertTeamMembers(ctx, "missing", []model.User{
+		{ID: "u1", Username: "Alice", IsActive: true},
+	}), "members of a missing team must be rejected")
+
+	seedTeam(t, repo, "backend",
+		model.User{ID: "u2", Username: "Bob", IsActive: true},
+		model.User{ID: "u1", Username: "Alice", Email: "alice@example.com", IsActive: true},
+	)
+	seedTeam(t, repo, "frontend", model.User{ID: "u3", Username: "Carol", IsActive: false})
+
+	members, err := repo.ListTeamMembers(ctx, "backend")
+	require.NoError(t, err)
+	require.Equal(t, []model.User{
+		{ID: "u1", Username: "Alice", TeamName: "backend", Email: "alice@example.com", IsActive: true},
+		{ID: "u2", Username: "Bob", TeamName: "backend", IsActive: true},
+	}, members, "members are ordered by username")
+
+	members, err = repo.ListTeamMembers(ctx, "nobody")
+	require.NoError(t, err)
+	require.Empty(t, members)
+
+	// re-inserting a user moves it to the new team and updates its fields
+	require.NoError(t, repo.InsertTeamMembers(ctx, "frontend", []model.User{
+		{ID: "u2", Username: "Bobby", Email: "bob@example.com", IsActive: false},
+	}))
+
+	user, err := repo.GetUserByID(ctx, "u2")
+	require.NoError(t, err)
+	require.Equal(t, model.User{
+		ID: "u2", Username: "Bobby", TeamName: "frontend", Email: "bob@example.com", IsActive: false,
+	}, user)
+
+	user, err = repo.SetUserActivity(ctx, "u3", true)
+	require.NoError(t, err)
+	require.Equal(t, model.User{ID: "u3", Username: "Carol", TeamName: "frontend", IsActive: true}, user)
+}
+
+func testPullRequests(t *testing.T, repo usecase.Repository) {
+	ctx := context.Background()
+
+	seedTeam(t, repo, "backend",
+		model.User{ID: "author", Username: "Author", IsActive: true},
+		model.User{ID: "r1", Username: "R1", IsActive: true},
+		model.User{ID: "r2", Username: "R2", IsActive: true},
+	)
+
+	_, err := repo.GetPullRequest(ctx, "pr-1")
+	require.ErrorIs(t, err, repository.ErrNotFound)
+
+	_, err = repo.UpdatePullRequestStatus(ctx, "pr-1", model.PRStatusMerged, nil)
+	require.ErrorIs(t, err, repository.ErrNotFound)
+
+	created, err := repo.CreatePullRequest(ctx, model.PullRequest{
+		ID:        "pr-1",
+		Name:      "Add search",
+		AuthorID:  "author",
+		Status:    model.PRStatusOpen,
+		Reviewers: []string{"r2", "r1"},
+	})
+	require.NoError(t, err)
+	require.Equal(t, "pr-1", created.ID)
+	require.Equal(t, "Add search", created.Name)
+	require.Equal(t, "author", created.AuthorID)
+	require.Equal(t, model.PRStatusOpen, created.Status)
+	require.Equal(t, []string{"r2", "r1"}, created.Reviewers, "reviewers keep slot order")
+	require.False(t, created.CreatedAt.IsZero())
+	require.Nil(t, created.MergedAt)
+	require.Equal(t, 1, created.Version)
+
+	_, err = repo.CreatePullRequest(ctx, model.PullRequest{
+		ID:       "pr-1",
+		Name:     "Duplicate",
+		AuthorID: "author",
+		Status:   model.PRStatusOpen,
+	})
+	require.ErrorIs(t, err, repository.ErrAlreadyExists)
+
+	_, err = repo.CreatePullRequest(ctx, model.PullRequest{
+		ID:       "pr-2",
+		Name:     "Ghost",
+		AuthorID: "ghost",
+		Status:   model.PRStatusOpen,
+	})
+	require.Error(t, err, "unknown author must be rejected")
+
+	found, err := repo.GetPullRequest(ctx, "pr-1")
+	require.NoError(t, err)
+	require.Equal(t, created.Reviewers, found.Reviewers)
+	require.True(t, created.CreatedAt.Equal(found.CreatedAt))
+	require.Equal(t, created.Version, found.Version)
+
+	mergedAt := time.Now().UTC().Truncate(time.Second)
+
+	merged, err := repo.UpdatePullRequestStatus(ctx, "pr-1", model.PRStatusMerged, &mergedAt)
+	require.NoError(t, err)
+	require.Equal(t, model.PRStatusMerged, merged.Status)
+	require.NotNil(t, merged.MergedAt)
+	require.True(t, mergedAt.Equal(*merged.MergedAt))
+	require.Equal(t, []string{"r2", "r1"}, merged.Reviewers)
+	require.Equal(t, created.Version+1, merged.Version)
+}
+
+func testReplaceReviewer(t *testing.T, repo usecase.Repository) {
+	ctx := context.Background()
+
+	seedTeam(t, repo, "backend",
+		model.User{ID: "author", Username: "Author", IsActive: true},
+		model.User{ID: "r1", Username: "R1", IsActive: true},
+		model.User{ID: "r2", Username: "R2", IsActive: true},
+		model.User{ID: "r3", Username: "R3", IsActive: true},
+	)
+	seedPR(t, repo, "pr-1", "author", "r1", "r2")
+
+	_, err := repo.ReplaceReviewer(ctx, "missing", "r1", "r3")
+	require.ErrorIs(t, err, repository.ErrNotFound)
+
+	_, err = repo.ReplaceReviewer(ctx, "pr-1", "r3", "r1")
+	require.ErrorIs(t, err, repository.ErrNotFound, "old reviewer is not assigned")
+
+	_, err = repo.ReplaceReviewer(ctx, "pr-1", "r1", "r2")
+	require.ErrorIs(t, err, repository.ErrAlreadyExists, "new reviewer is already assigned")
+
+	found, err := repo.GetPullRequest(ctx, "pr-1")
+	require.NoError(t, err)
+	require.Equal(t, 1, found.Version, "failed replacements keep the version")
+
+	updated, err := repo.ReplaceReviewer(ctx, "pr-1", "r1", "r3")
+	require.NoError(t, err)
+	require.Equal(t, []string{"r3", "r2"}, updated.Reviewers, "replacement keeps the slot")
+	require.Equal(t, 2, updated.Version)
+
+	found, err = repo.GetPullRequest(ctx, "pr-1")
+	require.NoError(t, err)
+	require.Equal(t, []string{"r3", "r2"}, found.Reviewers)
+	require.Equal(t, 2, found.Version)
+}
+
+func testAddReviewer(t *testing.T, repo usecase.Repository) {
+	ctx := context.Background()
+
+	seedTeam(t, repo, "backend",
+		model.User{ID: "author", Username: "Author", IsActive: true},
+		model.User{ID: "r1", Username: "R1", IsActive: true},
+		model.User{ID: "r2", Username: "R2", IsActive: true},
+		model.User{ID: "lead", Username: "Lead", IsActive: true},
+	)
+	seedPR(t, repo, "pr-1", "author", "r1", "r2")
+
+	_, err := repo.AddReviewer(ctx, "missing", "lead")
+	require.ErrorIs(t, err, repository.ErrNotFound)
+
+	_, err = repo.AddReviewer(ctx, "pr-1", "r2")
+	require.ErrorIs(t, err, repository.ErrAlreadyExists)
+
+	found, err := repo.GetPullRequest(ctx, "pr-1")
+	require.NoError(t, err)
+	require.Equal(t, 1, found.Version, "failed additions keep the version")
+
+	updated, err := repo.AddReviewer(ctx, "pr-1", "lead")
+	require.NoError(t, err)
+	require.Equal(t, []string{"r1", "r2", "lead"}, updated.Reviewers, "added reviewer goes last")
+	require.Equal(t, 2, updated.Version)
+
+	listed, err := repo.ListReviewerPullRequests(ctx, "lead", model.ReviewFilter{})
+	require.NoError(t, err)
+	require.Equal(t, []string{"pr-1"}, prIDs(listed))
+}
+
+func testListReviewerPullRequests(t *testing.T, repo usecase.Repository) {
+	ctx := context.Background()
+
+	seedTeam(t, repo, "backend",
+		model.User{ID: "author", Username: "Author", IsActive: true},
+		model.User{ID: "r1", Username: "R1", IsActive: true},
+		model.User{ID: "r2", Username: "R2", IsActive: true},
+	)
+
+	// ids grow with creation order, so ties on created_at keep the same order
+	seedPR(t, repo, "pr-1", "author", "r1", "r2")
+	seedPR(t, repo, "pr-2", "author", "r2")
+	seedPR(t, repo, "pr-3", "author", "r2", "r1")
+	seedPR(t, repo, "pr-4", "author", "r1")
+
+	_, err := repo.UpdatePullRequestStatus(ctx, "pr-3", model.PRStatusMerged, ptr(time.Now().UTC()))
+	require.NoError(t, err)
+
+	prs, err := repo.ListReviewerPullRequests(ctx, "nobody", model.ReviewFilter{})
+	require.NoError(t, err)
+	require.Empty(t, prs)
+
+	prs, err = repo.ListReviewerPullRequests(ctx, "r1", model.ReviewFilter{})
+	require.NoError(t, err)
+	require.Equal(t, []string{"pr-1", "pr-3", "pr-4"}, prIDs(prs))
+	require.Equal(t, []string{"r1", "r2"}, prs[0].Reviewers)
+	require.Equal(t, []string{"r2", "r1"}, prs[1].Reviewers)
+	require.Equal(t, []string{"r1"}, prs[2].Reviewers)
+
+	prs, err = repo.ListReviewerPullRequests(ctx, "r1", model.ReviewFilter{Status: model.PRStatusOpen})
+	require.NoError(t, err)
+	require.Equal(t, []string{"pr-1", "pr-4"}, prIDs(prs))
+
+	prs, err = repo.ListReviewerPullRequests(ctx, "r2", model.ReviewFilter{Limit: 2})
+	require.NoError(t, err)
+	require.Equal(t, []string{"pr-1", "pr-2"}, prIDs(prs))
+
+	last := prs[len(prs)-1]
+
+	prs, err = repo.ListReviewerPullRequests(ctx, "r2", model.ReviewFilter{
+		Limit: 2,
+		After: &model.ReviewCursor{CreatedAt: last.CreatedAt, ID: last.ID},
+	})
+	require.NoError(t, err)
+	require.Equal(t, []string{"pr-3"}, prIDs(prs))
+}
+
+func testListOpenReviews(t *testing.T, repo usecase.Repository) {
+	ctx := context.Background()
+
+	seedTeam(t, repo, "backend",
+		model.User{ID: "author", Username: "Author", IsActive: true},
+		model.User{ID: "r1", Username: "R1", IsActive: true},
+		model.User{ID: "r2", Username: "R2", IsActive: true},
+	)
+
+	seedPR(t, repo, "pr-1", "author", "r1")
+	seedPR(t, repo, "pr-2", "author", "r2")
+	seedPR(t, repo, "pr-3", "author", "r2")
+
+	_, err := repo.UpdatePullRequestStatus(ctx, "pr-3", model.PRStatusMerged, ptr(time.Now().UTC()))
+	require.NoError(t, err)
+
+	_, err = repo.ReplaceReviewer(ctx, "pr-1", "r1", "r2")
+	require.NoError(t, err)
+
+	items, err := repo.ListOpenReviews(ctx, "nobody")
+	require.NoError(t, err)
+	require.Empty(t, items)
+
+	items, err = repo.ListOpenReviews(ctx, "r2")
+	require.NoError(t, err)
+	require.Len(t, items, 2)
+	require.Equal(t, "pr-2", items[0].PullRequest.ID)
+	require.Equal(t, "pr-1", items[1].PullRequest.ID, "ordered by the time of the assignment")
+	require.Equal(t, []string{"r2"}, items[1].PullRequest.Reviewers)
+	require.True(t, items[1].AssignedAt.After(items[1].PullRequest.CreatedAt),
+		"replacement resets the assignment time")
+	require.True(t, items[0].AssignedAt.Before(items[1].AssignedAt))
+}
+
+func testStats(t *testing.T, repo usecase.Repository) {
+	ctx := context.Background()
+
+	stats, err := repo.GetPullRequestStats(ctx, model.StatsFilter{})
+	require.NoError(t, err)
+	require.Zero(t, stats.Total)
+	require.Zero(t, stats.AverageReview)
+	require.Nil(t, stats.TimeToMerge)
+	require.Empty(t, stats.TimeToMergeByTeam)
+
+	seedTeam(t, repo, "backend",
+		model.User{ID: "a1", Username: "A1", IsActive: true},
+		model.User{ID: "a2", Username: "A2", IsActive: true},
+		model.User{ID: "r1", Username: "R1", IsActive: true},
+		model.User{ID: "r2", Username: "R2", IsActive: true},
+		model.User{ID: "x1", Username: "X1", IsActive: false},
+	)
+	seedPR(t, repo, "pr-1", "a1", "r1", "r2")
+	seedPR(t, repo, "pr-2", "a1", "r1")
+	seedPR(t, repo, "pr-3", "a2")
+
+	_, err = repo.UpdatePullRequestStatus(ctx, "pr-2", model.PRStatusMerged, ptr(time.Now().UTC()))
+	require.NoError(t, err)
+
+	reviewers, err := repo.ListReviewerStats(ctx, model.StatsFilter{})
+	require.NoError(t, err)
+
+	pr2, err := repo.GetPullRequest(ctx, "pr-2")
+	require.NoError(t, err)
+	require.NotNil(t, reviewers[0].LastAssignedAt)
+	require.WithinDuration(t, pr2.CreatedAt, *reviewers[0].LastAssignedAt, time.Second,
+		"r1 is last assigned to pr-2")
+
+	require.Equal(t, []model.ReviewerStat{
+		{
+			UserID:        "r1",
+			Username:      "R1",
+			TeamName:      "backend",
+			IsActive:      true,
+			TotalAssigned: 2,
+			OpenAssigned:  1,
+		},
+		{
+			UserID:        "r2",
+			Username:      "R2",
+			TeamName:      "backend",
+			IsActive:      true,
+			TotalAssigned: 1,
+			OpenAssigned:  1,
+		},
+		{UserID: "a1", Username: "A1", TeamName: "backend", IsActive: true},
+		{UserID: "a2", Username: "A2", TeamName: "backend", IsActive: true},
+		{UserID: "x1", Username: "X1", TeamName: "backend"},
+	}, withoutLastAssigned(reviewers), "users without assignments are included")
+
+	stats, err = repo.GetPullRequestStats(ctx, model.StatsFilter{})
+	require.NoError(t, err)
+	require.Equal(t, 3, stats.Total)
+	require.Equal(t, 2, stats.Open)
+	require.Equal(t, 1, stats.Merged)
+	require.InDelta(t, 1.0, stats.AverageReview, 1e-9)
+	require.Equal(t, []model.AuthorStat{
+		{AuthorID: "a1", Count: 2},
+		{AuthorID: "a2", Count: 1},
+	}, stats.ByAuthor)
+}
+
+func testStatsFilter(t *testing.T, repo usecase.Repository) {
+	ctx := context.Background()
+
+	seedTeam(t, repo, "backend",
+		model.User{ID: "a1", Username: "A1", IsActive: true},
+		model.User{ID: "r1", Username: "R1", IsActive: true},
+		model.User{ID: "r2", Username: "R2", IsActive: true},
+	)
+	seedTeam(t, repo, "frontend",
+		model.User{ID: "a2", Username: "A2", IsActive: true},
+		model.User{ID: "r3", Username: "R3", IsActive: true},
+	)
+
+	// pauses keep the creation times apart
+	seedPR(t, repo, "pr-1", "a1", "r1", "r2")
+	time.Sleep(2 * time.Millisecond)
+	seedPR(t, repo, "pr-2", "a1", "r1")
+	time.Sleep(2 * time.Millisecond)
+	seedPR(t, repo, "pr-3", "a2", "r3")
+
+	pr2, err := repo.GetPullRequest(ctx, "pr-2")
+	require.NoError(t, err)
+
+	pr3, err := repo.GetPullRequest(ctx, "pr-3")
+	require.NoError(t, err)
+
+	_, err = repo.UpdatePullRequestStatus(ctx, "pr-1", model.PRStatusMerged,
+		ptr(pr3.CreatedAt.Add(time.Millisecond)))
+	require.NoError(t, err)
+
+	since := model.StatsFilter{From: &pr2.CreatedAt}
+
+	reviewers, err := repo.ListReviewerStats(ctx, since)
+	require.NoError(t, err)
+	require.Equal(t, []model.ReviewerStat{
+		{
+			UserID:        "r1",
+			Username:      "R1",
+			TeamName:      "backend",
+			IsActive:      true,
+			TotalAssigned: 1,
+			OpenAssigned:  1,
+		},
+		{
+			UserID:        "r3",
+			Username:      "R3",
+			TeamName:      "frontend",
+			IsActive:      true,
+			TotalAssigned: 1,
+			OpenAssigned:  1,
+		},
+		{UserID: "a1", Username: "A1", TeamName: "backend", IsActive: true},
+		{UserID: "a2", Username: "A2", TeamName: "frontend", IsActive: true},
+		{UserID: "r2", Username: "R2", TeamName: "backend", IsActive: true},
+	}, withoutLastAssigned(reviewers), "assignments from the start of the window on")
+
+	stats, err := repo.GetPullRequestStats(ctx, since)
+	require.NoError(t, err)
+	require.Equal(t, 2, stats.Total)
+	require.Equal(t, 2, stats.Open)
+	require.Equal(t, 1, stats.Merged, "pr-1 is merged within the window")
+	require.InDelta(t, 1.0, stats.AverageReview, 1e-9)
+	require.Equal(t, []model.AuthorStat{
+		{AuthorID: "a1", Count: 1},
+		{AuthorID: "a2", Count: 1},
+	}, stats.ByAuthor)
+
+	until := model.StatsFilter{To: &pr2.CreatedAt}
+
+	reviewers, err = repo.ListReviewerStats(ctx, until)
+	require.NoError(t, err)
+	require.Equal(t, []model.ReviewerStat{
+		{UserID: "r1", Username: "R1", TeamName: "backend", IsActive: true, TotalAssigned: 1},
+		{UserID: "r2", Username: "R2", TeamName: "backend", IsActive: true, TotalAssigned: 1},
+		{UserID: "a1", Username: "A1", TeamName: "backend", IsActive: true},
+		{UserID: "a2", Username: "A2", TeamName: "frontend", IsActive: true},
+		{UserID: "r3", Username: "R3", TeamName: "frontend", IsActive: true},
+	}, withoutLastAssigned(reviewers), "the end of the window is excluded")
+
+	stats, err = repo.GetPullRequestStats(ctx, until)
+	require.NoError(t, err)
+	require.Equal(t, 1, stats.Total)
+	require.Zero(t, stats.Open)
+	require.Zero(t, stats.Merged, "pr-1 is merged after the window")
+
+	frontend := model.StatsFilter{TeamName: "frontend"}
+
+	reviewers, err = repo.ListReviewerStats(ctx, frontend)
+	require.NoError(t, err)
+	require.Equal(t, []model.ReviewerStat{
+		{
+			UserID:        "r3",
+			Username:      "R3",
+			TeamName:      "frontend",
+			IsActive:      true,
+			TotalAssigned: 1,
+			OpenAssigned:  1,
+		},
+		{UserID: "a2", Username: "A2", TeamName: "frontend", IsActive: true},
+	}, withoutLastAssigned(reviewers))
+
+	stats, err = repo.GetPullRequestStats(ctx, frontend)
+	require.NoError(t, err)
+	require.Equal(t, 1, stats.Total)
+	require.Zero(t, stats.Merged)
+	require.Equal(t, []model.AuthorStat{{AuthorID: "a2", Count: 1}}, stats.ByAuthor)
+}
+
+func testTimeToMerge(t *testing.T, repo usecase.Repository) {
+	ctx := context.Background()
+
+	seedTeam(t, repo, "backend", model.User{ID: "a1", Username: "A1", IsActive: true})
+	seedTeam(t, repo, "frontend", model.User{ID: "a2", Username: "A2", IsActive: true})
+
+	merge := func(id, authorID string, after time.Duration) {
+		t.Helper()
+
+		seedPR(t, repo, id, authorID)
+
+		pr, err := repo.GetPullRequest(ctx, id)
+		require.NoError(t, err)
+
+		_, err = repo.UpdatePullRequestStatus(ctx, id, model.PRStatusMerged,
+			ptr(pr.CreatedAt.Add(after)))
+		require.NoError(t, err)
+	}
+
+	merge("pr-1", "a1", time.Hour)
+	merge("pr-2", "a1", 3*time.Hour)
+	merge("pr-3", "a1", 2*time.Hour)
+	merge("pr-4", "a2", 10*time.Hour)
+	seedPR(t, repo, "pr-5", "a2")
+
+	requirePercentiles := func(want, got model.Percentiles) {
+		t.Helper()
+
+		require.InDelta(t, want.P50, got.P50, float64(time.Second), "p50")
+		require.InDelta(t, want.P90, got.P90, float64(time.Second), "p90")
+		require.InDelta(t, want.P99, got.P99, float64(time.Second), "p99")
+	}
+
+	hours := func(h float64) time.Duration { return time.Duration(h * float64(time.Hour)) }
+
+	stats, err := repo.GetPullRequestStats(ctx, model.StatsFilter{})
+	require.NoError(t, err)
+	require.NotNil(t, stats.TimeToMerge)
+	requirePercentiles(model.Percentiles{
+		P50: hours(2.5),
+		P90: hours(7.9),
+		P99: hours(9.79),
+	}, *stats.TimeToMerge)
+
+	require.Len(t, stats.TimeToMergeByTeam, 2)
+	require.Equal(t, "backend", stats.TimeToMergeByTeam[0].TeamName)
+	requirePercentiles(model.Percentiles{
+		P50: hours(2),
+		P90: hours(2.8),
+		P99: hours(2.98),
+	}, stats.TimeToMergeByTeam[0].TimeToMerge)
+	require.Equal(t, "frontend", stats.TimeToMergeByTeam[1].TeamName)
+	requirePercentiles(model.Percentiles{
+		P50: hours(10),
+		P90: hours(10),
+		P99: hours(10),
+	}, stats.TimeToMergeByTeam[1].TimeToMerge)
+
+	stats, err = repo.GetPullRequestStats(ctx, model.StatsFilter{TeamName: "frontend"})
+	require.NoError(t, err)
+	require.NotNil(t, stats.TimeToMerge)
+	requirePercentiles(model.Percentiles{
+		P50: hours(10),
+		P90: hours(10),
+		P99: hours(10),
+	}, *stats.TimeToMerge)
+	require.Len(t, stats.TimeToMergeByTeam, 1)
+
+	since := time.Now().Add(24 * time.Hour)
+
+	stats, err = repo.GetPullRequestStats(ctx, model.StatsFilter{From: &since})
+	require.NoError(t, err)
+	require.Nil(t, stats.TimeToMerge, "no pull request is merged within the window")
+	require.Empty(t, stats.TimeToMergeByTeam)
+}
+
+func testTeamStats(t *testing.T, repo usecase.Repository) {
+	ctx := context.Background()
+
+	seedTeam(t, repo, "backend",
+		model.User{ID: "a1", Username: "A1", IsActive: true},
+		model.User{ID: "r1", Username: "R1", IsActive: true},
+		model.User{ID: "r2", Username: "R2", IsActive: true},
+		model.User{ID: "x1", Username: "X1", IsActive: false},
+	)
+	seedTeam(t, repo, "frontend", model.User{ID: "a2", Username: "A2", IsActive: true})
+	seedTeam(t, repo, "ops")
+
+	seedPR(t, repo, "pr-1", "a1", "r1", "r2")
+	seedPR(t, repo, "pr-2", "a1", "r1")
+	seedPR(t, repo, "pr-3", "a2")
+
+	_, err := repo.UpdatePullRequestStatus(ctx, "pr-2", model.PRStatusMerged, ptr(time.Now().UTC()))
+	require.NoError(t, err)
+
+	stats, err := repo.ListTeamStats(ctx, model.StatsFilter{})
+	require.NoError(t, err)
+	require.Len(t, stats, 3)
+	require.InDelta(t, 2.0/3, stats[0].MeanOpenAssigned, 1e-9)
+
+	stats[0].MeanOpenAssigned = 0
+	require.Equal(t, []model.TeamStat{
+		{
+			TeamName:        "backend",
+			OpenPRs:         1,
+			MergedPRs:       1,
+			UnderstaffedPRs: 1,
+			ActiveMembers:   3,
+			InactiveMembers: 1,
+			MaxOpenAssigned: 1,
+		},
+		{TeamName: "frontend", OpenPRs: 1, UnderstaffedPRs: 1, ActiveMembers: 1},
+		{TeamName: "ops"},
+	}, stats)
+
+	since := time.Now().Add(time.Hour)
+
+	stats, err = repo.ListTeamStats(ctx, model.StatsFilter{From: &since, TeamName: "backend"})
+	require.NoError(t, err)
+	require.Len(t, stats, 1)
+	require.Zero(t, stats[0].OpenPRs, "pull requests are created before the window")
+	require.Zero(t, stats[0].MergedPRs)
+	require.Equal(t, 3, stats[0].ActiveMembers, "members do not depend on the window")
+	require.Equal(t, 1, stats[0].MaxOpenAssigned)
+
+	counts, err := repo.CountOpenPullRequests(ctx)
+	require.NoError(t, err)
+	require.Equal(t, []model.TeamCount{
+		{TeamName: "backend", Count: 1},
+		{TeamName: "frontend", Count: 1},
+		{TeamName: "ops"},
+	}, counts)
+}
+
+func testTimeseries(t *testing.T, repo usecase.Repository) {
+	ctx := context.Background()
+
+	seedTeam(t, repo, "backend",
+		model.User{ID: "a1", Username: "A1", IsActive: true},
+		model.User{ID: "r1", Username: "R1", IsActive: true},
+		model.User{ID: "r2", Username: "R2", IsActive: true},
+	)
+	seedTeam(t, repo, "frontend",
+		model.User{ID: "a2", Username: "A2", IsActive: true},
+		model.User{ID: "r3", Username: "R3", IsActive: true},
+	)
+	seedPR(t, repo, "pr-1", "a1", "r1", "r2")
+	seedPR(t, repo, "pr-2", "a1", "r1")
+	seedPR(t, repo, "pr-3", "a2", "r3")
+
+	// 2025-03-03 is a Monday, 2025-03-09 the Sunday of the same week
+	date := func(day, hour int) time.Time {
+		return time.Date(2025, 3, day, hour, 0, 0, 0, time.UTC)
+	}
+
+	for id, mergedAt := range map[string]time.Time{
+		"pr-1": date(3, 10),
+		"pr-2": date(9, 23),
+		"pr-3": date(10, 1),
+	} {
+		_, err := repo.UpdatePullRequestStatus(ctx, id, model.PRStatusMerged, &mergedAt)
+		require.NoError(t, err)
+	}
+
+	requirePoints := func(want, got []model.TimeseriesPoint, msgAndArgs ...any) {
+		t.Helper()
+
+		require.Len(t, got, len(want), msgAndArgs...)
+
+		for i := range want {
+			require.True(t, want[i].Start.Equal(got[i].Start),
+				"point %d starts at %s, want %s", i, got[i].Start, want[i].Start)
+			require.Equal(t, want[i].Count, got[i].Count, msgAndArgs...)
+		}
+	}
+
+	points, err := repo.ListTimeseries(ctx, model.MetricPRsMerged, model.BucketDay,
+		model.StatsFilter{})
+	require.NoError(t, err)
+	requirePoints([]model.TimeseriesPoint{
+		{Start: date(3, 0), Count: 1},
+		{Start: date(9, 0), Count: 1},
+		{Start: date(10, 0), Count: 1},
+	}, points)
+
+	points, err = repo.ListTimeseries(ctx, model.MetricPRsMerged, model.BucketWeek,
+		model.StatsFilter{})
+	require.NoError(t, err)
+	requirePoints([]model.TimeseriesPoint{
+		{Start: date(3, 0), Count: 2},
+		{Start: date(10, 0), Count: 1},
+	}, points, "weeks start on Monday")
+
+	points, err = repo.ListTimeseries(ctx, model.MetricPRsMerged, model.BucketWeek,
+		model.StatsFilter{TeamName: "frontend"})
+	require.NoError(t, err)
+	requirePoints([]model.TimeseriesPoint{{Start: date(10, 0), Count: 1}}, points)
+
+	points, err = repo.ListTimeseries(ctx, model.MetricPRsMerged, model.BucketDay,
+		model.StatsFilter{From: ptr(date(4, 0)), To: ptr(date(10, 0))})
+	require.NoError(t, err)
+	requirePoints([]model.TimeseriesPoint{{Start: date(9, 0), Count: 1}}, points)
+
+	pr1, err := repo.GetPullRequest(ctx, "pr-1")
+	require.NoError(t, err)
+
+	today := model.BucketDay.Truncate(pr1.CreatedAt)
+
+	points, err = repo.ListTimeseries(ctx, model.MetricPRsCreated, model.BucketDay,
+		model.StatsFilter{})
+	require.NoError(t, err)
+	requirePoints([]model.TimeseriesPoint{{Start: today, Count: 3}}, points)
+
+	points, err = repo.ListTimeseries(ctx, model.MetricAssignments, model.BucketDay,
+		model.StatsFilter{})
+	require.NoError(t, err)
+	requirePoints([]model.TimeseriesPoint{{Start: today, Count: 4}}, points)
+
+	points, err = repo.ListTimeseries(ctx, model.MetricAssignments, model.BucketDay,
+		model.StatsFilter{TeamName: "frontend"})
+	require.NoError(t, err)
+	requirePoints([]model.TimeseriesPoint{{Start: today, Count: 1}}, points,
+		"assignments are filtered by the team of the reviewer")
+
+	_, err = repo.ListTimeseries(ctx, "reviews", model.BucketDay, model.StatsFilter{})
+	require.ErrorIs(t, err, repository.ErrUnknownMetric)
+}
+
+func testAssignmentEvents(t *testing.T, repo usecase.Repository) {
+	ctx := context.Background()
+
+	seedTeam(t, repo, "backend",
+		model.User{ID: "author", Username: "Author", IsActive: true},
+		model.User{ID: "r1", Username: "R1", IsActive: true},
+		model.User{ID: "r2", Username: "R2", IsActive: true},
+	)
+	seedPR(t, repo, "pr-1", "author", "r1")
+	seedPR(t, repo, "pr-2", "author")
+
+	events, err := repo.ListAssignmentEvents(ctx, "pr-1")
+	require.NoError(t, err)
+	require.Empty(t, events)
+
+	err = repo.AppendAssignmentEvents(ctx, []model.AssignmentEvent{
+		{
+			PullRequestID: "pr-1",
+			Type:          model.AssignmentEventCreated,
+			NewReviewerID: "r1",
+			ActorID:       "author",
+			Reason:        "created",
+		},
+		{PullRequestID: "pr-2", Type: model.AssignmentEventMerged},
+	})
+	require.NoError(t, err)
+
+	err = repo.AppendAssignmentEvents(ctx, []model.AssignmentEvent{{
+		PullRequestID: "pr-1",
+		Type:          model.AssignmentEventReassigned,
+		OldReviewerID: "r1",
+		NewReviewerID: "r2",
+		Reason:        "on vacation",
+	}})
+	require.NoError(t, err)
+
+	errRollback := errors.New("rollback")
+	err = repo.InTx(ctx, func(ctx context.Context) error {
+		err := repo.AppendAssignmentEvents(ctx, []model.AssignmentEvent{{
+			PullRequestID: "pr-1",
+			Type:          model.AssignmentEventMerged,
+		}})
+		require.NoError(t, err)
+
+		return errRollback
+	})
+	require.ErrorIs(t, err, errRollback)
+
+	events, err = repo.ListAssignmentEvents(ctx, "pr-1")
+	require.NoError(t, err)
+	require.Len(t, events, 2, "rolled back events must not be visible")
+
+	created, reassigned := events[0], events[1]
+	require.Less(t, created.ID, reassigned.ID)
+	require.Equal(t, "pr-1", created.PullRequestID)
+	require.Equal(t, model.AssignmentEventCreated, created.Type)
+	require.Empty(t, created.OldReviewerID)
+	require.Equal(t, "r1", created.NewReviewerID)
+	require.Equal(t, "author", created.ActorID)
+	require.Equal(t, "created", created.Reason)
+	require.False(t, created.CreatedAt.IsZero())
+
+	require.Equal(t, model.AssignmentEventReassigned, reassigned.Type)
+	require.Equal(t, "r1", reassigned.OldReviewerID)
+	require.Equal(t, "r2", reassigned.NewReviewerID)
+	require.Empty(t, reassigned.ActorID)
+	require.Equal(t, "on vacation", reassigned.Reason)
+	require.False(t, reassigned.CreatedAt.Before(created.CreatedAt))
+
+	events, err = repo.ListAssignmentEvents(ctx, "pr-2")
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	require.Equal(t, model.AssignmentEventMerged, events[0].Type)
+}
+
+func testEscalations(t *testing.T, repo usecase.Repository) {
+	ctx := context.Background()
+
+	seedTeam(t, repo, "backend",
+		model.User{ID: "author", Username: "Author", IsActive: true},
+		model.User{ID: "r1", Username: "R1", IsActive: true},
+		model.User{ID: "r2", Username: "R2", IsActive: true},
+	)
+	seedTeam(t, repo, "frontend", model.User{ID: "f1", Username: "F1", IsActive: true})
+	seedPR(t, repo, "pr-1", "author", "r1", "f1")
+	seedPR(t, repo, "pr-2", "author", "r2")
+
+	_, err := repo.UpdatePullRequestStatus(ctx, "pr-2", model.PRStatusMerged, ptr(time.Now().UTC()))
+	require.NoError(t, err)
+
+	overdue, err := repo.ListOverdueAssignments(ctx, "backend", time.Now().Add(-time.Hour))
+	require.NoError(t, err)
+	require.Empty(t, overdue, "assigned within the SLA")
+
+	overdue, err = repo.ListOverdueAssignments(ctx, "backend", time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	require.Len(t, overdue, 1, "other teams and merged pull requests are left out")
+	require.Equal(t, "pr-1", overdue[0].PullRequestID)
+	require.Equal(t, "r1", overdue[0].ReviewerID)
+
+	recorded, err := repo.RecordEscalation(ctx, overdue[0])
+	require.NoError(t, err)
+	require.True(t, recorded)
+
+	recorded, err = repo.RecordEscalation(ctx, overdue[0])
+	require.NoError(t, err)
+	require.False(t, recorded, "an assignment is escalated once")
+
+	overdue, err = repo.ListOverdueAssignments(ctx, "backend", time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	require.Empty(t, overdue)
+
+	escalated, err := repo.ListEscalatedReviewers(ctx, "pr-1")
+	require.NoError(t, err)
+	require.Equal(t, []string{"r1"}, escalated)
+
+	// a reviewer assigned again starts a new assignment
+	_, err = repo.ReplaceReviewer(ctx, "pr-1", "r1", "r2")
+	require.NoError(t, err)
+	_, err = repo.ReplaceReviewer(ctx, "pr-1", "r2", "r1")
+	require.NoError(t, err)
+
+	overdue, err = repo.ListOverdueAssignments(ctx, "backend", time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	require.Len(t, overdue, 1)
+	require.Equal(t, "r1", overdue[0].ReviewerID)
+}
+
+func testTransactions(t *testing.T, repo usecase.Repository) {
+	ctx := context.Background()
+	errRollback := errors.New("rollback")
+
+	seedTeam(t, repo, "backend",
+		model.User{ID: "author", Username: "Author", IsActive: true},
+		model.User{ID: "r1", Username: "R1", IsActive: true},
+	)
+
+	err := repo.InTx(ctx, func(ctx context.Context) error {
+		_, err := repo.CreateTeam(ctx, "frontend")
+		require.NoError(t, err)
+
+		_, err = repo.SetUserActivity(ctx, "r1", false)
+		require.NoError(t, err)
+
+		return errRollback
+	})
+	require.ErrorIs(t, err, errRollback)
+
+	_, err = repo.GetTeamByName(ctx, "frontend")
+	require.ErrorIs(t, err, repository.ErrNotFound, "rolled back team must not exist")
+
+	user, err := repo.GetUserByID(ctx, "r1")
+	require.NoError(t, err)
+	require.True(t, user.IsActive, "rolled back update must not be visible")
+
+	err = repo.InTx(ctx, func(ctx context.Context) error {
+		_, err := repo.GetPullRequestForUpdate(ctx, "missing")
+		require.ErrorIs(t, err, repository.ErrNotFound)
+
+		// nested transactions join the outer one
+		return repo.InTx(ctx, func(ctx context.Context) error {
+			_, err := repo.CreatePullRequest(ctx, model.PullRequest{
+				ID:        "pr-1",
+				Name:      "pr-1",
+				AuthorID:  "author",
+				Status:    model.PRStatusOpen,
+				Reviewers: []string{"r1"},
+			})
+
+			return err
+		})
+	})
+	require.NoError(t, err)
+
+	pr, err := repo.GetPullRequestForUpdate(ctx, "pr-1")
+	require.NoError(t, err)
+	require.Equal(t, []string{"r1"}, pr.Reviewers)
+}
+
+// testConcurrentReassign hammers a single pull request with concurrent
+// reassignments and a merge through the usecase layer: every call must end
+// with either success or a domain error and the PR must stay consistent.
+func testConcurrentReassign(t *testing.T, repo usecase.Repository) {
+	const workers = 8
+
+	ctx := context.Background()
+	svc := usecase.New(repo, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	members := []model.User{{ID: "author", Username: "Author", IsActive: true}}
+	for i := range 6 {
+		id := fmt.Sprintf("r%d", i)
+		members = append(members, model.User{ID: id, Username: id, IsActive: true})
+	}
+
+	seedTeam(t, repo, "backend", members...)
+	seedPR(t, repo, "pr-1", "author", "r0", "r1")
+
+	var (
+		wg   sync.WaitGroup
+		errs = make(chan error, workers*10+1)
+	)
+
+	for worker := range workers {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for i := range 10 {
+				_, _, err := svc.ReassignReviewer(
+					ctx, "pr-1", fmt.Sprintf("r%d", (worker+i)%6), usecase.AnyVersion, model.ChangeInfo{})
+				errs <- err
+			}
+		}()
+	}
+
+	wg.Add(1)
+
+	go func() {
+		defer wg.Done()
+
+		time.Sleep(5 * time.Millisecond)
+
+		_, err := svc.MergePR(ctx, "pr-1", usecase.AnyVersion, model.ChangeInfo{})
+		errs <- err
+	}()
+
+	wg.Wait()
+	close(errs)
+
+	changes := 0
+
+	for err := range errs {
+		if err == nil {
+			changes++
+
+			continue
+		}
+
+		if errors.Is(err, usecase.ErrReviewerNotAssigned) ||
+			errors.Is(err, usecase.ErrPRMerged) ||
+			errors.Is(err, usecase.ErrNoReplacementCandidate) {
+			continue
+		}
+
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	pr, err := repo.GetPullRequest(ctx, "pr-1")
+	require.NoError(t, err)
+	require.Equal(t, model.PRStatusMerged, pr.Status)
+	require.Len(t, pr.Reviewers, 2)
+	require.NotEqual(t, pr.Reviewers[0], pr.Reviewers[1])
+	require.NotContains(t, pr.Reviewers, "author")
+	require.Equal(t, 1+changes, pr.Version, "every successful change bumps the version once")
+
+	events, err := repo.ListAssignmentEvents(ctx, "pr-1")
+	require.NoError(t, err)
+	require.Len(t, events, changes, "every successful change is recorded once")
+	require.Equal(t, model.AssignmentEventMerged, events[len(events)-1].Type)
+}
+
+func seedTeam(t *testing.T, repo usecase.Repository, name string, members ...model.User) {
+	t.Helper()
+
+	ctx := context.Background()
+
+	_, err := repo.CreateTeam(ctx, name)
+	require.NoError(t, err)
+	require.NoError(t, repo.InsertTeamMembers(ctx, name, members))
+}
+
+func seedPR(t *testing.T, repo usecase.Repository, id, authorID string, reviewers ...string) {
+	t.Helper()
+
+	_, err := repo.CreatePullRequest(context.Background(), model.PullRequest{
+		ID:        id,
+		Name:      id,
+		AuthorID:  authorID,
+		Status:    model.PRStatusOpen,
+		Reviewers: reviewers,
+	})
+	require.NoError(t, err)
+}
+
+// withoutLastAssigned drops the assignment times, which differ between
+// backends, to compare the counts.
+func withoutLastAssigned(stats []model.ReviewerStat) []model.ReviewerStat {
+	for i := range stats {
+		stats[i].LastAssignedAt = nil
+	}
+
+	return stats
+}
+
+func prIDs(prs []model.PullRequest) []string {
+	ids := make([]string, 0, len(prs))
+	for _, pr := range prs {
+		ids = append(ids, pr.ID)
+	}
+
+	return ids
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
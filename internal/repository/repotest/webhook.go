@@ -0,0 +1,211 @@
+package repotest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/6ermvH/avito-reviewchecker/internal/model"
+	"github.com/6ermvH/avito-reviewchecker/internal/repository"
+	"github.com/6ermvH/avito-reviewchecker/internal/usecase"
+)
+
+func testOutbox(t *testing.T, repo usecase.Repository) {
+	ctx := context.Background()
+
+	seedTeam(t, repo, "backend", model.User{ID: "author", Username: "Author", IsActive: true})
+	seedPR(t, repo, "pr-1", "author")
+
+	err := repo.AppendOutboxEvents(ctx, []model.OutboxEvent{
+		{Type: model.EventPRCreated, PullRequestID: "pr-1", Payload: json.RawMessage(`{"n":1}`)},
+		{Type: model.EventPRMerged, PullRequestID: "pr-1", Payload: json.RawMessage(`{"n":2}`)},
+	})
+	require.NoError(t, err)
+
+	errRollback := errors.New("rollback")
+	err = repo.InTx(ctx, func(ctx context.Context) error {
+		require.NoError(t, repo.AppendOutboxEvents(ctx, []model.OutboxEvent{{
+			Type:          model.EventPRMerged,
+			PullRequestID: "pr-1",
+			Payload:       json.RawMessage(`{}`),
+		}}))
+
+		return errRollback
+	})
+	require.ErrorIs(t, err, errRollback)
+
+	events, err := repo.ClaimOutboxEvents(ctx, 1)
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	require.Equal(t, model.EventPRCreated, events[0].Type)
+	require.Equal(t, "pr-1", events[0].PullRequestID)
+	require.JSONEq(t, `{"n":1}`, string(events[0].Payload))
+	require.False(t, events[0].CreatedAt.IsZero())
+
+	require.NoError(t, repo.MarkOutboxEventsDispatched(ctx, []int64{events[0].ID}))
+
+	events, err = repo.ClaimOutboxEvents(ctx, 10)
+	require.NoError(t, err)
+	require.Len(t, events, 1, "dispatched and rolled back events must not be claimed")
+	require.Equal(t, model.EventPRMerged, events[0].Type)
+}
+
+func testWebhookSubscriptions(t *testing.T, repo usecase.Repository) {
+	ctx := context.Background()
+
+	all, err := repo.CreateWebhookSubscription(ctx, model.WebhookSubscription{
+		ID:     "wh_all",
+		URL:    "http://example.com/all",
+		Secret: "s1",
+	})
+	require.NoError(t, err)
+	require.False(t, all.CreatedAt.IsZero())
+
+	_, err = repo.CreateWebhookSubscription(ctx, model.WebhookSubscription{
+		ID:         "wh_merged",
+		URL:        "http://example.com/merged",
+		Secret:     "s2",
+		EventTypes: []model.DomainEventType{model.EventPRMerged},
+	})
+	require.NoError(t, err)
+
+	_, err = repo.CreateWebhookSubscription(ctx, model.WebhookSubscription{ID: "wh_all"})
+	require.ErrorIs(t, err, repository.ErrAlreadyExists)
+
+	subs, err := repo.ListWebhookSubscriptions(ctx)
+	require.NoError(t, err)
+	require.Len(t, subs, 2)
+
+	byID := make(map[string]model.WebhookSubscription, len(subs))
+	for _, sub := range subs {
+		byID[sub.ID] = sub
+	}
+
+	require.Empty(t, byID["wh_all"].EventTypes)
+	require.Equal(t, "s1", byID["wh_all"].Secret)
+	require.Equal(t, []model.DomainEventType{model.EventPRMerged}, byID["wh_merged"].EventTypes)
+
+	require.NoError(t, repo.DeleteWebhookSubscription(ctx, "wh_all"))
+	require.ErrorIs(t, repo.DeleteWebhookSubscription(ctx, "wh_all"), repository.ErrNotFound)
+
+	subs, err = repo.ListWebhookSubscriptions(ctx)
+	require.NoError(t, err)
+	require.Len(t, subs, 1)
+}
+
+func testWebhookDeliveries(t *testing.T, repo usecase.Repository) {
+	ctx := context.Background()
+	now := time.Now().UTC().Truncate(time.Second)
+
+	seedTeam(t, repo, "backend", model.User{ID: "author", Username: "Author", IsActive: true})
+	seedPR(t, repo, "pr-1", "author")
+
+	require.NoError(t, repo.AppendOutboxEvents(ctx, []model.OutboxEvent{{
+		Type:          model.EventPRCreated,
+		PullRequestID: "pr-1",
+		Payload:       json.RawMessage(`{"id":"pr-1"}`),
+	}}))
+
+	events, err := repo.ClaimOutboxEvents(ctx, 10)
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+
+	for _, id := range []string{"wh_1", "wh_2"} {
+		_, err := repo.CreateWebhookSubscription(ctx, model.WebhookSubscription{
+			ID:     id,
+			URL:    "http://example.com/" + id,
+			Secret: "secret-" + id,
+		})
+		require.NoError(t, err)
+	}
+
+	deliveries := []model.WebhookDelivery{
+		{SubscriptionID: "wh_1", EventID: events[0].ID, NextAttemptAt: now},
+		{SubscriptionID: "wh_2", EventID: events[0].ID, NextAttemptAt: now.Add(time.Hour)},
+	}
+	require.NoError(t, repo.CreateWebhookDeliveries(ctx, deliveries))
+	require.NoError(t, repo.CreateWebhookDeliveries(ctx, deliveries), "duplicates are ignored")
+
+	listed, err := repo.ListWebhookDeliveries(ctx, model.DeliveryFilter{})
+	require.NoError(t, err)
+	require.Len(t, listed, 2)
+
+	pending, err := repo.ClaimDueDeliveries(ctx, now, time.Minute, 10)
+	require.NoError(t, err)
+	require.Len(t, pending, 1, "only due deliveries are claimed")
+
+	claimed := pending[0]
+	require.Equal(t, "wh_1", claimed.Delivery.SubscriptionID)
+	require.Equal(t, model.DeliveryPending, claimed.Delivery.Status)
+	require.Equal(t, 0, claimed.Delivery.Attempts)
+	require.True(t, claimed.Delivery.NextAttemptAt.Equal(now.Add(time.Minute)))
+	require.Equal(t, "wh_1", claimed.Subscription.ID)
+	require.Equal(t, "http://example.com/wh_1", claimed.Subscription.URL)
+	require.Equal(t, "secret-wh_1", claimed.Subscription.Secret)
+	require.Equal(t, events[0].ID, claimed.Event.ID)
+	require.Equal(t, model.EventPRCreated, claimed.Event.Type)
+	require.JSONEq(t, `{"id":"pr-1"}`, string(claimed.Event.Payload))
+
+	pending, err = repo.ClaimDueDeliveries(ctx, now, time.Minute, 10)
+	require.NoError(t, err)
+	require.Empty(t, pending, "leased deliveries are not claimed twice")
+
+	// the lease expires and another dispatcher claims the delivery again
+	expired := claimed.Delivery.NextAttemptAt.Add(time.Second)
+	pending, err = repo.ClaimDueDeliveries(ctx, expired, time.Minute, 10)
+	require.NoError(t, err)
+	require.Len(t, pending, 1)
+
+	delivery := claimed.Delivery
+	delivery.Status = model.DeliveryDelivered
+	delivery.Attempts = 1
+	require.ErrorIs(t,
+		repo.UpdateWebhookDelivery(ctx, delivery, claimed.Delivery.NextAttemptAt),
+		repository.ErrLeaseLost,
+		"the result of an expired lease is dropped",
+	)
+
+	leaseUntil := pending[0].Delivery.NextAttemptAt
+	delivery.Status = model.DeliveryDead
+	delivery.Attempts = 3
+	delivery.LastError = "unexpected status 500"
+	require.NoError(t, repo.UpdateWebhookDelivery(ctx, delivery, leaseUntil))
+	require.ErrorIs(t,
+		repo.UpdateWebhookDelivery(ctx, delivery, leaseUntil),
+		repository.ErrLeaseLost,
+		"finished deliveries are not updated again",
+	)
+
+	missing := delivery
+	missing.ID = delivery.ID + 1000
+	require.ErrorIs(t,
+		repo.UpdateWebhookDelivery(ctx, missing, leaseUntil),
+		repository.ErrLeaseLost,
+	)
+
+	dead, err := repo.ListWebhookDeliveries(ctx, model.DeliveryFilter{Status: model.DeliveryDead})
+	require.NoError(t, err)
+	require.Len(t, dead, 1)
+	require.Equal(t, 3, dead[0].Attempts)
+	require.Equal(t, "unexpected status 500", dead[0].LastError)
+
+	bySub, err := repo.ListWebhookDeliveries(ctx, model.DeliveryFilter{SubscriptionID: "wh_2"})
+	require.NoError(t, err)
+	require.Len(t, bySub, 1)
+	require.Equal(t, model.DeliveryPending, bySub[0].Status)
+
+	limited, err := repo.ListWebhookDeliveries(ctx, model.DeliveryFilter{Limit: 1})
+	require.NoError(t, err)
+	require.Len(t, limited, 1)
+	require.Equal(t, bySub[0].ID, limited[0].ID, "newest deliveries come first")
+
+	require.NoError(t, repo.DeleteWebhookSubscription(ctx, "wh_2"))
+
+	listed, err = repo.ListWebhookDeliveries(ctx, model.DeliveryFilter{})
+	require.NoError(t, err)
+	require.Len(t, listed, 1, "deliveries are removed with their subscription")
+}
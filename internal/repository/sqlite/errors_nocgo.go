@@ -0,0 +1,14 @@
+//go:build !cgo
+
+package sqlite
+
+// Without cgo the driver is a stub and Open fails, so no query error reaches
+// these.
+
+func isBusy(error) bool {
+	return false
+}
+
+func isUniqueViolation(error) bool {
+	return false
+}
@@ -0,0 +1,111 @@
+package sqlite
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/6ermvH/avito-reviewchecker/internal/model"
+)
+
+func (r *Repository) ListOverdueAssignments(
+	ctx context.Context,
+	teamName string,
+	assignedBefore time.Time,
+) ([]model.Assignment, error) {
+	query := `
+SELECT r.pull_request_id, r.reviewer_id, r.assigned_at
+FROM pull_request_reviewers r
+JOIN pull_requests pr ON pr.id = r.pull_request_id
+JOIN users u ON u.id = r.reviewer_id
+WHERE u.team_name = ?1
+  AND pr.status = 'OPEN'
+  AND r.assigned_at < ?2
+  AND NOT EXISTS (
+      SELECT 1
+      FROM review_escalations e
+      WHERE e.pull_request_id = r.pull_request_id
+        AND e.reviewer_id = r.reviewer_id
+        AND e.assigned_at = r.assigned_at
+  )
+ORDER BY r.assigned_at, r.pull_request_id, r.reviewer_id
+`
+
+	rows, err := r.conn(ctx).QueryContext(ctx, query, teamName, formatTime(assignedBefore))
+	if err != nil {
+		return nil, fmt.Errorf("list overdue assignments, get query: %w", err)
+	}
+	//nolint:errcheck
+	defer rows.Close()
+
+	var assignments []model.Assignment
+
+	for rows.Next() {
+		var a model.Assignment
+		if err := rows.Scan(&a.PullRequestID, &a.ReviewerID, &a.AssignedAt); err != nil {
+			return nil, fmt.Errorf("list overdue assignments, scan: %w", err)
+		}
+
+		assignments = append(assignments, a)
+	}
+
+	if err := rows.Err(); err != nil {
+		return assignments, fmt.Errorf("list overdue assignments of team %q: %w", teamName, err)
+	}
+
+	return assignments, nil
+}
+
+func (r *Repository) RecordEscalation(ctx context.Context, assignment model.Assignment) (bool, error) {
+	query := `
+INSERT INTO review_escalations (pull_request_id, reviewer_id, assigned_at)
+VALUES (?1, ?2, ?3)
+ON CONFLICT DO NOTHING
+`
+
+	res, err := r.conn(ctx).ExecContext(ctx, query,
+		assignment.PullRequestID, assignment.ReviewerID, formatTime(assignment.AssignedAt))
+	if err != nil {
+		return false, fmt.Errorf("record escalation, exec: %w", err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("get affected rows: %w", err)
+	}
+
+	return affected > 0, nil
+}
+
+func (r *Repository) ListEscalatedReviewers(ctx context.Context, prID string) ([]string, error) {
+	query := `
+SELECT DISTINCT reviewer_id
+FROM review_escalations
+WHERE pull_request_id = ?1
+ORDER BY reviewer_id
+`
+
+	rows, err := r.conn(ctx).QueryContext(ctx, query, prID)
+	if err != nil {
+		return nil, fmt.Errorf("list escalated reviewers, get query: %w", err)
+	}
+	//nolint:errcheck
+	defer rows.Close()
+
+	var reviewers []string
+
+	for rows.Next() {
+		var reviewerID string
+		if err := rows.Scan(&reviewerID); err != nil {
+			return nil, fmt.Errorf("list escalated reviewers, scan: %w", err)
+		}
+
+		reviewers = append(reviewers, reviewerID)
+	}
+
+	if err := rows.Err(); err != nil {
+		return reviewers, fmt.Errorf("list escalated reviewers of pr %q: %w", prID, err)
+	}
+
+	return reviewers, nil
+}
@@ -0,0 +1,95 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/6ermvH/avito-reviewchecker/internal/model"
+)
+
+func (r *Repository) AppendAssignmentEvents(
+	ctx context.Context,
+	events []model.AssignmentEvent,
+) error {
+	query := `
+INSERT INTO assignment_events
+    (pull_request_id, event_type, old_reviewer_id, new_reviewer_id, actor_id, reason, created_at)
+VALUES (?, ?, ?, ?, ?, ?, ?)
+`
+
+	return r.InTx(ctx, func(ctx context.Context) error {
+		for _, event := range events {
+			if _, err := r.conn(ctx).ExecContext(ctx, query,
+				event.PullRequestID,
+				event.Type,
+				nullIfEmpty(event.OldReviewerID),
+				nullIfEmpty(event.NewReviewerID),
+				nullIfEmpty(event.ActorID),
+				event.Reason,
+				r.timestamp(),
+			); err != nil {
+				return fmt.Errorf("append assignment event for pr %q: %w", event.PullRequestID, err)
+			}
+		}
+
+		return nil
+	})
+}
+
+func (r *Repository) ListAssignmentEvents(
+	ctx context.Context,
+	prID string,
+) ([]model.AssignmentEvent, error) {
+	query := `
+SELECT id, pull_request_id, event_type, old_reviewer_id, new_reviewer_id, actor_id, reason, created_at
+FROM assignment_events
+WHERE pull_request_id = ?
+ORDER BY id
+`
+
+	rows, err := r.conn(ctx).QueryContext(ctx, query, prID)
+	if err != nil {
+		return nil, fmt.Errorf("list assignment events: %w", err)
+	}
+	//nolint:errcheck
+	defer rows.Close()
+
+	var events []model.AssignmentEvent
+
+	for rows.Next() {
+		var (
+			event                           model.AssignmentEvent
+			oldReviewer, newReviewer, actor sql.NullString
+		)
+
+		if err := rows.Scan(
+			&event.ID,
+			&event.PullRequestID,
+			&event.Type,
+			&oldReviewer,
+			&newReviewer,
+			&actor,
+			&event.Reason,
+			&event.CreatedAt,
+		); err != nil {
+			return nil, fmt.Errorf("scan assignment event: %w", err)
+		}
+
+		event.OldReviewerID = oldReviewer.String
+		event.NewReviewerID = newReviewer.String
+		event.ActorID = actor.String
+
+		events = append(events, event)
+	}
+
+	if err := rows.Err(); err != nil {
+		return events, fmt.Errorf("list assignment events for pr %q: %w", prID, err)
+	}
+
+	return events, nil
+}
+
+func nullIfEmpty(value string) sql.NullString {
+	return sql.NullString{String: value, Valid: value != ""}
+}
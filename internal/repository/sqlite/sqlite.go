@@ -0,0 +1,667 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	// registers the sqlite3 driver, a stub failing on connect without cgo
+	_ "github.com/mattn/go-sqlite3"
+
+	"github.com/6ermvH/avito-reviewchecker/internal/model"
+	"github.com/6ermvH/avito-reviewchecker/internal/repository"
+)
+
+// timestampLayout is fixed-width so stored timestamps sort lexicographically.
+const timestampLayout = "2006-01-02T15:04:05.000000Z"
+
+type queryer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+type Repository struct {
+	db  *sql.DB
+	now func() time.Time
+}
+
+// txKey carries the transaction started by InTx in the context.
+type txKey struct {
+	repo *Repository
+}
+
+func New(db *sql.DB) *Repository {
+	return &Repository{db: db, now: time.Now}
+}
+
+// InTx runs fn in a transaction, or in the one already carried by ctx.
+// Transactions start with BEGIN IMMEDIATE (see Open), so they take the
+// database write lock up front instead of failing on commit.
+func (r *Repository) InTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	if _, ok := ctx.Value(txKey{r}).(*sql.Tx); ok {
+		return fn(ctx)
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		if isBusy(err) {
+			return fmt.Errorf("%w: begin transaction: %w", repository.ErrConflict, err)
+		}
+
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+
+	if err := fn(context.WithValue(ctx, txKey{r}, tx)); err != nil {
+		_ = tx.Rollback()
+
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// conn returns the transaction carried by ctx or the database itself.
+func (r *Repository) conn(ctx context.Context) queryer {
+	if tx, ok := ctx.Value(txKey{r}).(*sql.Tx); ok {
+		return tx
+	}
+
+	return r.db
+}
+
+// Open opens a SQLite database with foreign keys enabled. SQLite serializes
+// writers anyway, so the pool is limited to a single connection; this also
+// keeps ":memory:" databases shared across queries. The database is pinged,
+// so binaries built without cgo, where the driver is a stub, fail here.
+func Open(dsn string) (*sql.DB, error) {
+	params := []string{"_foreign_keys=on", "_busy_timeout=5000", "_txlock=immediate"}
+
+	separator := "?"
+	if strings.Contains(dsn, "?") {
+		separator = "&"
+	}
+
+	for _, param := range params {
+		key, _, _ := strings.Cut(param, "=")
+		if strings.Contains(dsn, key+"=") {
+			continue
+		}
+
+		dsn += separator + param
+		separator = "&"
+	}
+
+	db, err := sql.Open("sqlite3", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("open sqlite: %w", err)
+	}
+
+	db.SetMaxOpenConns(1)
+
+	if err := db.Ping(); err != nil {
+		_ = db.Close()
+
+		return nil, fmt.Errorf("open sqlite: %w", err)
+	}
+
+	return db, nil
+}
+
+func (r *Repository) GetTeamByName(ctx context.Context, name string) (model.Team, error) {
+	query := `SELECT name FROM teams WHERE name = ?`
+
+	var team model.Team
+
+	err := r.conn(ctx).QueryRowContext(ctx, query, name).Scan(&team.Name)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return model.Team{}, repository.ErrNotFound
+		}
+
+		return model.Team{}, fmt.Errorf("get team by name, get query row: %w", err)
+	}
+
+	return team, nil
+}
+
+func (r *Repository) CreateTeam(ctx context.Context, name string) (model.Team, error) {
+	query := `INSERT INTO teams (name, created_at) VALUES (?, ?) RETURNING name`
+
+	var team model.Team
+
+	if err := r.conn(ctx).QueryRowContext(ctx, query, name, r.timestamp()).Scan(&team.Name); err != nil {
+		if isUniqueViolation(err) {
+			return model.Team{}, repository.ErrAlreadyExists
+		}
+
+		return model.Team{}, fmt.Errorf("create team, get query row: %w", err)
+	}
+
+	return team, nil
+}
+
+func (r *Repository) InsertTeamMembers(
+	ctx context.Context,
+	teamName string,
+	users []model.User,
+) error {
+	stmt := `
+INSERT INTO users (id, team_name, username, email, is_active, created_at, updated_at)
+VALUES (?1, ?2, ?3, ?4, ?5, ?6, ?6)
+ON CONFLICT (id) DO UPDATE
+SET team_name = excluded.team_name,
+    username = excluded.username,
+    email = excluded.email,
+    is_active = excluded.is_active,
+    updated_at = excluded.updated_at
+`
+	now := r.timestamp()
+
+	return r.InTx(ctx, func(ctx context.Context) error {
+		for _, user := range users {
+			_, err := r.conn(ctx).ExecContext(
+				ctx, stmt, user.ID, teamName, user.Username, user.Email, user.IsActive, now,
+			)
+			if err != nil {
+				return fmt.Errorf("insert team members, exec: %w", err)
+			}
+		}
+
+		return nil
+	})
+}
+
+func (r *Repository) ListTeamMembers(ctx context.Context, teamName string) ([]model.User, error) {
+	query := `
+SELECT id, team_name, username, email, is_active
+FROM users
+WHERE team_name = ?
+ORDER BY username, id
+`
+
+	rows, err := r.conn(ctx).QueryContext(ctx, query, teamName)
+	if err != nil {
+		return nil, fmt.Errorf("list team members, get query: %w", err)
+	}
+	//nolint:errcheck
+	defer rows.Close()
+
+	var members []model.User
+
+	for rows.Next() {
+		var user model.User
+		err := rows.Scan(&user.ID, &user.TeamName, &user.Username, &user.Email, &user.IsActive)
+		if err != nil {
+			return nil, fmt.Errorf("list team members, scan user: %w", err)
+		}
+
+		members = append(members, user)
+	}
+
+	if err := rows.Err(); err != nil {
+		return members, fmt.Errorf("list team members, bad rows: %w", err)
+	}
+
+	return members, nil
+}
+
+func (r *Repository) GetUserByID(ctx context.Context, userID string) (model.User, error) {
+	query := `SELECT id, team_name, username, email, is_active FROM users WHERE id = ?`
+
+	var user model.User
+
+	err := r.conn(ctx).QueryRowContext(ctx, query, userID).
+		Scan(&user.ID, &user.TeamName, &user.Username, &user.Email, &user.IsActive)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return model.User{}, repository.ErrNotFound
+		}
+
+		return model.User{}, fmt.Errorf("get user, get query row: %w", err)
+	}
+
+	return user, nil
+}
+
+func (r *Repository) SetUserActivity(
+	ctx context.Context,
+	userID string,
+	active bool,
+) (model.User, error) {
+	query := `
+UPDATE users SET is_active = ?, updated_at = ?
+WHERE id = ?
+RETURNING id, team_name, username, email, is_active
+`
+
+	var user model.User
+
+	err := r.conn(ctx).QueryRowContext(ctx, query, active, r.timestamp(), userID).
+		Scan(&user.ID, &user.TeamName, &user.Username, &user.Email, &user.IsActive)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return model.User{}, repository.ErrNotFound
+		}
+
+		return model.User{}, fmt.Errorf("set user active, get query row: %w", err)
+	}
+
+	return user, nil
+}
+
+func (r *Repository) CreatePullRequest(
+	ctx context.Context,
+	pr model.PullRequest,
+) (model.PullRequest, error) {
+	now := r.timestamp()
+
+	insertPR := `
+INSERT INTO pull_requests (id, name, author_id, status, created_at)
+VALUES (?, ?, ?, ?, ?)
+`
+
+	insertReviewer := `
+INSERT INTO pull_request_reviewers (pull_request_id, slot, reviewer_id, assigned_at)
+VALUES (?, ?, ?, ?)
+`
+
+	var stored model.PullRequest
+
+	err := r.InTx(ctx, func(ctx context.Context) error {
+		if _, err := r.conn(ctx).ExecContext(ctx, insertPR, pr.ID, pr.Name, pr.AuthorID, pr.Status, now); err != nil {
+			if isUniqueViolation(err) {
+				return repository.ErrAlreadyExists
+			}
+
+			return fmt.Errorf("create pr, exec: %w", err)
+		}
+
+		for idx, reviewerID := range pr.Reviewers {
+			slot := idx + 1
+			if _, err := r.conn(ctx).ExecContext(ctx, insertReviewer, pr.ID, slot, reviewerID, now); err != nil {
+				return fmt.Errorf("create pr, exec: %w", err)
+			}
+		}
+
+		var err error
+
+		stored, err = r.GetPullRequest(ctx, pr.ID)
+
+		return err
+	})
+	if err != nil {
+		return model.PullRequest{}, err
+	}
+
+	return stored, nil
+}
+
+// GetPullRequestForUpdate needs no row lock: transactions already hold the
+// database write lock.
+func (r *Repository) GetPullRequestForUpdate(
+	ctx context.Context,
+	prID string,
+) (model.PullRequest, error) {
+	return r.GetPullRequest(ctx, prID)
+}
+
+func (r *Repository) GetPullRequest(ctx context.Context, prID string) (model.PullRequest, error) {
+	query := `
+SELECT id, name, author_id, status, created_at, merged_at, version
+FROM pull_requests
+WHERE id = ?
+`
+
+	var pr model.PullRequest
+
+	err := r.conn(ctx).QueryRowContext(ctx, query, prID).
+		Scan(&pr.ID, &pr.Name, &pr.AuthorID, &pr.Status, &pr.CreatedAt, &pr.MergedAt, &pr.Version)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return model.PullRequest{}, repository.ErrNotFound
+		}
+
+		return model.PullRequest{}, fmt.Errorf("get pr, get query row: %w", err)
+	}
+
+	reviewers, err := r.loadReviewers(ctx, prID)
+	if err != nil {
+		return model.PullRequest{}, err
+	}
+
+	pr.Reviewers = reviewers
+
+	return pr, nil
+}
+
+func (r *Repository) UpdatePullRequestStatus(
+	ctx context.Context,
+	prID string,
+	status model.PRStatus,
+	mergedAt *time.Time,
+) (model.PullRequest, error) {
+	query := `
+UPDATE pull_requests
+SET status = ?,
+    merged_at = ?,
+    version = version + 1
+WHERE id = ?
+RETURNING id, name, author_id, status, created_at, merged_at, version
+`
+
+	var pr model.PullRequest
+
+	if err := r.conn(ctx).QueryRowContext(ctx, query, status, formatNullableTime(mergedAt), prID).
+		Scan(&pr.ID, &pr.Name, &pr.AuthorID, &pr.Status, &pr.CreatedAt, &pr.MergedAt, &pr.Version); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return model.PullRequest{}, repository.ErrNotFound
+		}
+
+		return model.PullRequest{}, fmt.Errorf("update pr, get query row: %w", err)
+	}
+
+	reviewers, err := r.loadReviewers(ctx, prID)
+	if err != nil {
+		return model.PullRequest{}, err
+	}
+
+	pr.Reviewers = reviewers
+
+	return pr, nil
+}
+
+func (r *Repository) ListReviewerPullRequests(
+	ctx context.Context,
+	userID string,
+	filter model.ReviewFilter,
+) ([]model.PullRequest, error) {
+	query := `
+SELECT pr.id, pr.name, pr.author_id, pr.status, pr.created_at, pr.merged_at,
+       pr.version,
+       (SELECT json_group_array(a.reviewer_id ORDER BY a.slot)
+        FROM pull_request_reviewers a
+        WHERE a.pull_request_id = pr.id) AS reviewers
+FROM pull_requests pr
+JOIN pull_request_reviewers r ON pr.id = r.pull_request_id
+WHERE r.reviewer_id = ?1
+  AND (?2 IS NULL OR pr.status = ?2)
+  AND (?3 IS NULL OR (pr.created_at, pr.id) > (?3, ?4))
+ORDER BY pr.created_at, pr.id
+LIMIT COALESCE(NULLIF(?5, 0), -1)
+`
+
+	var (
+		status    sql.NullString
+		afterTime sql.NullString
+		afterID   sql.NullString
+	)
+
+	if filter.Status != "" {
+		status = sql.NullString{String: string(filter.Status), Valid: true}
+	}
+
+	if filter.After != nil {
+		afterTime = sql.NullString{String: formatTime(filter.After.CreatedAt), Valid: true}
+		afterID = sql.NullString{String: filter.After.ID, Valid: true}
+	}
+
+	rows, err := r.conn(ctx).QueryContext(ctx, query, userID, status, afterTime, afterID, filter.Limit)
+	if err != nil {
+		return nil, fmt.Errorf("list reviewer, get query: %w", err)
+	}
+	//nolint:errcheck
+	defer rows.Close()
+
+	var prs []model.PullRequest
+
+	for rows.Next() {
+		var (
+			pr        model.PullRequest
+			reviewers []byte
+		)
+
+		if err := rows.Scan(&pr.ID, &pr.Name, &pr.AuthorID, &pr.Status, &pr.CreatedAt, &pr.MergedAt,
+			&pr.Version, &reviewers); err != nil {
+			return nil, fmt.Errorf("list reviewer, scan pr: %w", err)
+		}
+
+		if err := json.Unmarshal(reviewers, &pr.Reviewers); err != nil {
+			return nil, fmt.Errorf("list reviewer, decode reviewers: %w", err)
+		}
+
+		prs = append(prs, pr)
+	}
+
+	if err := rows.Err(); err != nil {
+		return prs, fmt.Errorf("list reviewers for user %q: %w", userID, err)
+	}
+
+	return prs, nil
+}
+
+func (r *Repository) ListOpenReviews(
+	ctx context.Context,
+	userID string,
+) ([]model.DigestItem, error) {
+	query := `
+SELECT pr.id, pr.name, pr.author_id, pr.status, pr.created_at, pr.merged_at,
+       pr.version,
+       (SELECT json_group_array(a.reviewer_id ORDER BY a.slot)
+        FROM pull_request_reviewers a
+        WHERE a.pull_request_id = pr.id) AS reviewers,
+       r.assigned_at
+FROM pull_requests pr
+JOIN pull_request_reviewers r ON pr.id = r.pull_request_id
+WHERE r.reviewer_id = ?
+  AND pr.status = 'OPEN'
+ORDER BY r.assigned_at, pr.id
+`
+
+	rows, err := r.conn(ctx).QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("list open reviews, get query: %w", err)
+	}
+	//nolint:errcheck
+	defer rows.Close()
+
+	var items []model.DigestItem
+
+	for rows.Next() {
+		var (
+			item      model.DigestItem
+			reviewers []byte
+		)
+
+		pr := &item.PullRequest
+		if err := rows.Scan(&pr.ID, &pr.Name, &pr.AuthorID, &pr.Status, &pr.CreatedAt, &pr.MergedAt,
+			&pr.Version, &reviewers, &item.AssignedAt); err != nil {
+			return nil, fmt.Errorf("list open reviews, scan pr: %w", err)
+		}
+
+		if err := json.Unmarshal(reviewers, &pr.Reviewers); err != nil {
+			return nil, fmt.Errorf("list open reviews, decode reviewers: %w", err)
+		}
+
+		items = append(items, item)
+	}
+
+	if err := rows.Err(); err != nil {
+		return items, fmt.Errorf("list open reviews of user %q: %w", userID, err)
+	}
+
+	return items, nil
+}
+
+func (r *Repository) ReplaceReviewer(
+	ctx context.Context,
+	prID, oldUserID, newUserID string,
+) (model.PullRequest, error) {
+	query := `
+UPDATE pull_request_reviewers
+SET reviewer_id = ?3,
+    assigned_at = ?4
+WHERE pull_request_id = ?1
+  AND reviewer_id = ?2
+`
+
+	bumpVersion := `
+UPDATE pull_requests
+SET version = version + 1
+WHERE id = ?
+`
+
+	var updated model.PullRequest
+
+	err := r.InTx(ctx, func(ctx context.Context) error {
+		res, err := r.conn(ctx).ExecContext(ctx, query, prID, oldUserID, newUserID, r.timestamp())
+		if err != nil {
+			if isUniqueViolation(err) {
+				return repository.ErrAlreadyExists
+			}
+
+			return fmt.Errorf("exec in replace reviewer: %w", err)
+		}
+
+		affected, err := res.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("get affected rows: %w", err)
+		}
+
+		if affected == 0 {
+			return repository.ErrNotFound
+		}
+
+		if _, err := r.conn(ctx).ExecContext(ctx, bumpVersion, prID); err != nil {
+			return fmt.Errorf("exec in replace reviewer, bump version: %w", err)
+		}
+
+		updated, err = r.GetPullRequest(ctx, prID)
+
+		return err
+	})
+	if err != nil {
+		return model.PullRequest{}, err
+	}
+
+	return updated, nil
+}
+
+func (r *Repository) AddReviewer(
+	ctx context.Context,
+	prID, userID string,
+) (model.PullRequest, error) {
+	bumpVersion := `
+UPDATE pull_requests
+SET version = version + 1
+WHERE id = ?
+`
+
+	query := `
+INSERT INTO pull_request_reviewers (pull_request_id, slot, reviewer_id, assigned_at)
+SELECT ?1, COALESCE(MAX(slot), 0) + 1, ?2, ?3
+FROM pull_request_reviewers
+WHERE pull_request_id = ?1
+`
+
+	var updated model.PullRequest
+
+	err := r.InTx(ctx, func(ctx context.Context) error {
+		res, err := r.conn(ctx).ExecContext(ctx, bumpVersion, prID)
+		if err != nil {
+			return fmt.Errorf("exec in add reviewer, bump version: %w", err)
+		}
+
+		affected, err := res.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("get affected rows: %w", err)
+		}
+
+		if affected == 0 {
+			return repository.ErrNotFound
+		}
+
+		if _, err := r.conn(ctx).ExecContext(ctx, query, prID, userID, r.timestamp()); err != nil {
+			if isUniqueViolation(err) {
+				return repository.ErrAlreadyExists
+			}
+
+			return fmt.Errorf("exec in add reviewer: %w", err)
+		}
+
+		updated, err = r.GetPullRequest(ctx, prID)
+
+		return err
+	})
+	if err != nil {
+		return model.PullRequest{}, err
+	}
+
+	return updated, nil
+}
+
+func (r *Repository) loadReviewers(ctx context.Context, prID string) ([]string, error) {
+	query := `
+SELECT reviewer_id
+FROM pull_request_reviewers
+WHERE pull_request_id = ?
+ORDER BY slot
+`
+
+	rows, err := r.conn(ctx).QueryContext(ctx, query, prID)
+	if err != nil {
+		return nil, fmt.Errorf("load reviewers, get query: %w", err)
+	}
+	//nolint:errcheck
+	defer rows.Close()
+
+	var reviewers []string
+
+	for rows.Next() {
+		var reviewerID string
+		if err := rows.Scan(&reviewerID); err != nil {
+			return nil, fmt.Errorf("scan reviewerID: %w", err)
+		}
+
+		reviewers = append(reviewers, reviewerID)
+	}
+
+	if err := rows.Err(); err != nil {
+		return reviewers, fmt.Errorf("load reviewers for pr %q: %w", prID, err)
+	}
+
+	return reviewers, nil
+}
+
+func (r *Repository) timestamp() string {
+	return formatTime(r.now())
+}
+
+func formatTime(t time.Time) string {
+	return t.UTC().Format(timestampLayout)
+}
+
+func formatNullableTime(t *time.Time) sql.NullString {
+	if t == nil {
+		return sql.NullString{}
+	}
+
+	return sql.NullString{String: formatTime(*t), Valid: true}
+}
+
+func parseTime(value string) (time.Time, error) {
+	t, err := time.Parse(time.RFC3339Nano, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("parse timestamp %q: %w", value, err)
+	}
+
+	return t, nil
+}
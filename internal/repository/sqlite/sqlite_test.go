@@ -0,0 +1,46 @@
+package sqlite_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/6ermvH/avito-reviewchecker/internal/repository/repotest"
+	"github.com/6ermvH/avito-reviewchecker/internal/repository/sqlite"
+	"github.com/6ermvH/avito-reviewchecker/internal/usecase"
+)
+
+const migrationsDir = "../../../migrations/sqlite"
+
+func TestRepositoryConformance(t *testing.T) {
+	repotest.Run(t, func(t *testing.T) usecase.Repository {
+		t.Helper()
+
+		db, err := sqlite.Open(filepath.Join(t.TempDir(), "reviewchecker.db"))
+		require.NoError(t, err)
+
+		t.Cleanup(func() {
+			//nolint:errcheck
+			db.Close()
+		})
+
+		migrations, err := filepath.Glob(filepath.Join(migrationsDir, "*.up.sql"))
+		require.NoError(t, err)
+		require.NotEmpty(t, migrations)
+		sort.Strings(migrations)
+
+		for _, path := range migrations {
+			stmt, err := os.ReadFile(path)
+			require.NoError(t, err)
+
+			_, err = db.ExecContext(context.Background(), string(stmt))
+			require.NoError(t, err, "apply %s", filepath.Base(path))
+		}
+
+		return sqlite.New(db)
+	})
+}
@@ -0,0 +1,487 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/6ermvH/avito-reviewchecker/internal/model"
+	"github.com/6ermvH/avito-reviewchecker/internal/repository"
+)
+
+func (r *Repository) ListReviewerStats(
+	ctx context.Context,
+	filter model.StatsFilter,
+) ([]model.ReviewerStat, error) {
+	query := `
+SELECT u.id,
+       u.username,
+       u.team_name,
+       u.is_active,
+       COUNT(r.reviewer_id) AS total_assigned,
+       COALESCE(SUM(CASE WHEN pr.status = 'OPEN' THEN 1 ELSE 0 END), 0) AS open_assigned,
+       MAX(r.assigned_at) AS last_assigned_at
+FROM users u
+LEFT JOIN pull_request_reviewers r ON r.reviewer_id = u.id
+    AND (?1 IS NULL OR r.assigned_at >= ?1)
+    AND (?2 IS NULL OR r.assigned_at < ?2)
+LEFT JOIN pull_requests pr ON pr.id = r.pull_request_id
+WHERE ?3 = '' OR u.team_name = ?3
+GROUP BY u.id, u.username, u.team_name, u.is_active
+ORDER BY total_assigned DESC, u.id
+`
+
+	from, to := formatNullableTime(filter.From), formatNullableTime(filter.To)
+
+	rows, err := r.conn(ctx).QueryContext(ctx, query, from, to, filter.TeamName)
+	if err != nil {
+		return nil, fmt.Errorf("list reviewer stats: %w", err)
+	}
+	//nolint:errcheck
+	defer rows.Close()
+
+	var stats []model.ReviewerStat
+
+	for rows.Next() {
+		var (
+			stat         model.ReviewerStat
+			lastAssigned sql.NullString
+		)
+
+		if err := rows.Scan(&stat.UserID, &stat.Username,
+			&stat.TeamName, &stat.IsActive, &stat.TotalAssigned,
+			&stat.OpenAssigned, &lastAssigned); err != nil {
+			return nil, fmt.Errorf("scan reviewer stat: %w", err)
+		}
+
+		// MAX loses the column type, so the driver returns the stored text.
+		if lastAssigned.Valid {
+			t, err := parseTime(lastAssigned.String)
+			if err != nil {
+				return nil, fmt.Errorf("scan reviewer stat: %w", err)
+			}
+
+			stat.LastAssignedAt = &t
+		}
+
+		stats = append(stats, stat)
+	}
+
+	if err := rows.Err(); err != nil {
+		return stats, fmt.Errorf("list reviewer stats: %w", err)
+	}
+
+	return stats, nil
+}
+
+func (r *Repository) GetPullRequestStats(
+	ctx context.Context,
+	filter model.StatsFilter,
+) (model.PullRequestStats, error) {
+	type aggregate struct {
+		Total  sql.NullInt64
+		Open   sql.NullInt64
+		Merged sql.NullInt64
+	}
+
+	from, to := formatNullableTime(filter.From), formatNullableTime(filter.To)
+
+	// created and merged select the pull requests of the team created and
+	// merged within the window.
+	row := r.conn(ctx).QueryRowContext(ctx, `
+WITH scoped AS (
+    SELECT pr.status,
+           (?1 IS NULL OR pr.created_at >= ?1)
+               AND (?2 IS NULL OR pr.created_at < ?2) AS created,
+           pr.merged_at IS NOT NULL
+               AND (?1 IS NULL OR pr.merged_at >= ?1)
+               AND (?2 IS NULL OR pr.merged_at < ?2) AS merged
+    FROM pull_requests pr
+    JOIN users u ON u.id = pr.author_id
+    WHERE ?3 = '' OR u.team_name = ?3
+)
+SELECT SUM(CASE WHEN created THEN 1 ELSE 0 END) AS total,
+       SUM(CASE WHEN created AND status = 'OPEN' THEN 1 ELSE 0 END) AS open,
+       SUM(CASE WHEN merged THEN 1 ELSE 0 END) AS merged
+FROM scoped
+`, from, to, filter.TeamName)
+
+	var agg aggregate
+	if err := row.Scan(&agg.Total, &agg.Open, &agg.Merged); err != nil {
+		return model.PullRequestStats{}, fmt.Errorf("pull request aggregates: %w", err)
+	}
+
+	totalPR := int(agg.Total.Int64)
+
+	var totalAssignments int
+	if err := r.conn(ctx).QueryRowContext(ctx, `
+SELECT COUNT(*)
+FROM pull_request_reviewers r
+JOIN pull_requests pr ON pr.id = r.pull_request_id
+JOIN users u ON u.id = pr.author_id
+WHERE (?1 IS NULL OR pr.created_at >= ?1)
+  AND (?2 IS NULL OR pr.created_at < ?2)
+  AND (?3 = '' OR u.team_name = ?3)
+`, from, to, filter.TeamName).Scan(&totalAssignments); err != nil {
+		return model.PullRequestStats{}, fmt.Errorf("count reviewer assignments: %w", err)
+	}
+
+	stats := model.PullRequestStats{
+		Total:  totalPR,
+		Open:   int(agg.Open.Int64),
+		Merged: int(agg.Merged.Int64),
+	}
+	if totalPR > 0 {
+		stats.AverageReview = float64(totalAssignments) / float64(totalPR)
+	}
+
+	overall, byTeam, err := r.timeToMerge(ctx, from, to, filter.TeamName)
+	if err != nil {
+		return stats, err
+	}
+
+	stats.TimeToMerge, stats.TimeToMergeByTeam = overall, byTeam
+
+	rows, err := r.conn(ctx).QueryContext(ctx, `
+SELECT pr.author_id, COUNT(*) AS count
+FROM pull_requests pr
+JOIN users u ON u.id = pr.author_id
+WHERE (?1 IS NULL OR pr.created_at >= ?1)
+  AND (?2 IS NULL OR pr.created_at < ?2)
+  AND (?3 = '' OR u.team_name = ?3)
+GROUP BY pr.author_id
+ORDER BY count DESC, pr.author_id
+`, from, to, filter.TeamName)
+	if err != nil {
+		return stats, fmt.Errorf("pull request stats by author: %w", err)
+	}
+	//nolint:errcheck
+	defer rows.Close()
+
+	for rows.Next() {
+		var stat model.AuthorStat
+		if err := rows.Scan(&stat.AuthorID, &stat.Count); err != nil {
+			return stats, fmt.Errorf("scan author stat: %w", err)
+		}
+
+		stats.ByAuthor = append(stats.ByAuthor, stat)
+	}
+
+	if err := rows.Err(); err != nil {
+		return stats, fmt.Errorf("iterate author stats: %w", err)
+	}
+
+	return stats, nil
+}
+
+func (r *Repository) ListTeamStats(
+	ctx context.Context,
+	filter model.StatsFilter,
+) ([]model.TeamStat, error) {
+	from, to := formatNullableTime(filter.From), formatNullableTime(filter.To)
+
+	// load counts the open pull requests assigned to every member, prs the
+	// pull requests of the team created within the window.
+	rows, err := r.conn(ctx).QueryContext(ctx, `
+WITH load AS (
+    SELECT u.team_name, u.is_active, COUNT(pr.id) AS open_assigned
+    FROM users u
+    LEFT JOIN pull_request_reviewers r ON r.reviewer_id = u.id
+    LEFT JOIN pull_requests pr ON pr.id = r.pull_request_id AND pr.status = 'OPEN'
+    GROUP BY u.team_name, u.id, u.is_active
+),
+members AS (
+    SELECT team_name,
+           SUM(CASE WHEN is_active THEN 1 ELSE 0 END) AS active,
+           SUM(CASE WHEN is_active THEN 0 ELSE 1 END) AS inactive,
+           MIN(CASE WHEN is_active THEN open_assigned END) AS min_open,
+           MAX(CASE WHEN is_active THEN open_assigned END) AS max_open,
+           AVG(CASE WHEN is_active THEN open_assigned END) AS mean_open
+    FROM load
+    GROUP BY team_name
+),
+prs AS (
+    SELECT u.team_name,
+           SUM(CASE WHEN pr.status = 'OPEN' THEN 1 ELSE 0 END) AS open,
+           SUM(CASE WHEN pr.status = 'MERGED' THEN 1 ELSE 0 END) AS merged,
+           SUM(CASE WHEN (
+               SELECT COUNT(*) FROM pull_request_reviewers r WHERE r.pull_request_id = pr.id
+           ) < ?4 THEN 1 ELSE 0 END) AS understaffed
+    FROM pull_requests pr
+    JOIN users u ON u.id = pr.author_id
+    WHERE (?1 IS NULL OR pr.created_at >= ?1)
+      AND (?2 IS NULL OR pr.created_at < ?2)
+    GROUP BY u.team_name
+)
+SELECT t.name,
+       COALESCE(p.open, 0),
+       COALESCE(p.merged, 0),
+       COALESCE(p.understaffed, 0),
+       COALESCE(m.active, 0),
+       COALESCE(m.inactive, 0),
+       COALESCE(m.min_open, 0),
+       COALESCE(m.max_open, 0),
+       COALESCE(m.mean_open, 0)
+FROM teams t
+LEFT JOIN members m ON m.team_name = t.name
+LEFT JOIN prs p ON p.team_name = t.name
+WHERE ?3 = '' OR t.name = ?3
+ORDER BY t.name
+`, from, to, filter.TeamName, model.DesiredReviewers)
+	if err != nil {
+		return nil, fmt.Errorf("list team stats: %w", err)
+	}
+	//nolint:errcheck
+	defer rows.Close()
+
+	var stats []model.TeamStat
+
+	for rows.Next() {
+		var stat model.TeamStat
+		if err := rows.Scan(&stat.TeamName, &stat.OpenPRs, &stat.MergedPRs,
+			&stat.UnderstaffedPRs, &stat.ActiveMembers, &stat.InactiveMembers,
+			&stat.MinOpenAssigned, &stat.MaxOpenAssigned,
+			&stat.MeanOpenAssigned); err != nil {
+			return nil, fmt.Errorf("scan team stat: %w", err)
+		}
+
+		stats = append(stats, stat)
+	}
+
+	if err := rows.Err(); err != nil {
+		return stats, fmt.Errorf("list team stats: %w", err)
+	}
+
+	return stats, nil
+}
+
+func (r *Repository) CountOpenPullRequests(ctx context.Context) ([]model.TeamCount, error) {
+	rows, err := r.conn(ctx).QueryContext(ctx, `
+SELECT t.name, COUNT(pr.id)
+FROM teams t
+LEFT JOIN users u ON u.team_name = t.name
+LEFT JOIN pull_requests pr ON pr.author_id = u.id AND pr.status = 'OPEN'
+GROUP BY t.name
+ORDER BY t.name
+`)
+	if err != nil {
+		return nil, fmt.Errorf("count open pull requests: %w", err)
+	}
+	//nolint:errcheck
+	defer rows.Close()
+
+	var counts []model.TeamCount
+
+	for rows.Next() {
+		var count model.TeamCount
+		if err := rows.Scan(&count.TeamName, &count.Count); err != nil {
+			return nil, fmt.Errorf("scan open pull requests: %w", err)
+		}
+
+		counts = append(counts, count)
+	}
+
+	if err := rows.Err(); err != nil {
+		return counts, fmt.Errorf("count open pull requests: %w", err)
+	}
+
+	return counts, nil
+}
+
+// timeseriesSources select the timestamps counted by every metric, along with
+// the team they are filtered by.
+var timeseriesSources = map[model.TimeseriesMetric]string{
+	model.MetricPRsCreated: `
+SELECT pr.created_at AS ts
+FROM pull_requests pr
+JOIN users u ON u.id = pr.author_id
+WHERE ?3 = '' OR u.team_name = ?3`,
+	model.MetricPRsMerged: `
+SELECT pr.merged_at AS ts
+FROM pull_requests pr
+JOIN users u ON u.id = pr.author_id
+WHERE pr.merged_at IS NOT NULL AND (?3 = '' OR u.team_name = ?3)`,
+	model.MetricAssignments: `
+SELECT r.assigned_at AS ts
+FROM pull_request_reviewers r
+JOIN users u ON u.id = r.reviewer_id
+WHERE ?3 = '' OR u.team_name = ?3`,
+}
+
+// timeseriesBuckets truncate s.ts the way date_trunc does, weeks start on
+// Monday. Unknown buckets count per day.
+var timeseriesBuckets = map[model.TimeseriesBucket]string{
+	model.BucketDay:  `strftime('%Y-%m-%dT00:00:00Z', s.ts)`,
+	model.BucketWeek: `strftime('%Y-%m-%dT00:00:00Z', s.ts, 'weekday 0', '-6 days')`,
+}
+
+func (r *Repository) ListTimeseries(
+	ctx context.Context,
+	metric model.TimeseriesMetric,
+	bucket model.TimeseriesBucket,
+	filter model.StatsFilter,
+) ([]model.TimeseriesPoint, error) {
+	source, ok := timeseriesSources[metric]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", repository.ErrUnknownMetric, metric)
+	}
+
+	truncate, ok := timeseriesBuckets[bucket]
+	if !ok {
+		truncate = timeseriesBuckets[model.BucketDay]
+	}
+
+	from, to := formatNullableTime(filter.From), formatNullableTime(filter.To)
+
+	rows, err := r.conn(ctx).QueryContext(ctx, `
+SELECT `+truncate+` AS bucket, COUNT(*)
+FROM (`+source+`) s
+WHERE (?1 IS NULL OR s.ts >= ?1)
+  AND (?2 IS NULL OR s.ts < ?2)
+GROUP BY bucket
+ORDER BY bucket
+`, from, to, filter.TeamName)
+	if err != nil {
+		return nil, fmt.Errorf("list %s timeseries: %w", metric, err)
+	}
+	//nolint:errcheck
+	defer rows.Close()
+
+	var points []model.TimeseriesPoint
+
+	for rows.Next() {
+		var (
+			point model.TimeseriesPoint
+			start string
+		)
+
+		if err := rows.Scan(&start, &point.Count); err != nil {
+			return nil, fmt.Errorf("scan timeseries point: %w", err)
+		}
+
+		point.Start, err = parseTime(start)
+		if err != nil {
+			return nil, fmt.Errorf("scan timeseries point: %w", err)
+		}
+
+		points = append(points, point)
+	}
+
+	if err := rows.Err(); err != nil {
+		return points, fmt.Errorf("list %s timeseries: %w", metric, err)
+	}
+
+	return points, nil
+}
+
+// timeToMerge computes the percentiles of the time from creation to merge of
+// the pull requests merged within the window, overall and per author team.
+// SQLite has no percentile_cont, so the query interpolates between the two
+// closest ranks the same way.
+func (r *Repository) timeToMerge(
+	ctx context.Context,
+	from, to sql.NullString,
+	teamName string,
+) (*model.Percentiles, []model.TeamTimeToMerge, error) {
+	rows, err := r.conn(ctx).QueryContext(ctx, `
+WITH merged AS (
+    SELECT u.team_name,
+           unixepoch(pr.merged_at, 'subsec') - unixepoch(pr.created_at, 'subsec') AS seconds
+    FROM pull_requests pr
+    JOIN users u ON u.id = pr.author_id
+    WHERE pr.merged_at IS NOT NULL
+      AND (?1 IS NULL OR pr.merged_at >= ?1)
+      AND (?2 IS NULL OR pr.merged_at < ?2)
+      AND (?3 = '' OR u.team_name = ?3)
+),
+grouped AS (
+    SELECT team_name, seconds FROM merged
+    UNION ALL
+    SELECT NULL, seconds FROM merged
+),
+ranked AS (
+    SELECT team_name,
+           seconds,
+           ROW_NUMBER() OVER (PARTITION BY team_name ORDER BY seconds) - 1 AS rn,
+           COUNT(*) OVER (PARTITION BY team_name) - 1 AS last
+    FROM grouped
+),
+positioned AS (
+    SELECT ranked.team_name,
+           ranked.seconds,
+           ranked.rn,
+           q.p,
+           CAST(q.p * ranked.last AS INTEGER) AS lo,
+           q.p * ranked.last - CAST(q.p * ranked.last AS INTEGER) AS frac
+    FROM ranked
+    CROSS JOIN (SELECT 0.5 AS p UNION ALL SELECT 0.9 UNION ALL SELECT 0.99) q
+),
+percentiles AS (
+    SELECT team_name,
+           p,
+           SUM(CASE
+                   WHEN rn = lo THEN seconds * (1 - frac)
+                   WHEN rn = lo + 1 THEN seconds * frac
+                   ELSE 0
+               END) AS seconds
+    FROM positioned
+    GROUP BY team_name, p
+)
+SELECT team_name,
+       MAX(CASE WHEN p = 0.5 THEN seconds END) AS p50,
+       MAX(CASE WHEN p = 0.9 THEN seconds END) AS p90,
+       MAX(CASE WHEN p = 0.99 THEN seconds END) AS p99
+FROM percentiles
+GROUP BY team_name
+ORDER BY team_name IS NOT NULL, team_name
+`, from, to, teamName)
+	if err != nil {
+		return nil, nil, fmt.Errorf("time to merge percentiles: %w", err)
+	}
+	//nolint:errcheck
+	defer rows.Close()
+
+	var (
+		overall *model.Percentiles
+		byTeam  []model.TeamTimeToMerge
+	)
+
+	for rows.Next() {
+		var (
+			team          sql.NullString
+			p50, p90, p99 float64
+		)
+
+		if err := rows.Scan(&team, &p50, &p90, &p99); err != nil {
+			return nil, nil, fmt.Errorf("scan time to merge percentiles: %w", err)
+		}
+
+		percentiles := model.Percentiles{
+			P50: seconds(p50),
+			P90: seconds(p90),
+			P99: seconds(p99),
+		}
+
+		if !team.Valid {
+			overall = &percentiles
+
+			continue
+		}
+
+		byTeam = append(byTeam, model.TeamTimeToMerge{
+			TeamName:    team.String,
+			TimeToMerge: percentiles,
+		})
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, nil, fmt.Errorf("iterate time to merge percentiles: %w", err)
+	}
+
+	return overall, byTeam, nil
+}
+
+func seconds(v float64) time.Duration {
+	return time.Duration(v * float64(time.Second))
+}
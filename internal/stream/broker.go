@@ -0,0 +1,125 @@
+package stream
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/6ermvH/avito-reviewchecker/internal/model"
+)
+
+// subscriberBuffer is how many events a subscriber may fall behind before it
+// is disconnected.
+const subscriberBuffer = 64
+
+// Broker fans out stream events to subscribers and keeps the last historySize
+// events so that reconnecting clients can resume from Last-Event-ID. Events
+// live in process memory only.
+type Broker struct {
+	mu          sync.Mutex
+	lastID      int64
+	history     []model.StreamEvent
+	historySize int
+	subscribers map[*subscriber]struct{}
+	now         func() time.Time
+}
+
+type subscriber struct {
+	match func(model.StreamEvent) bool
+	ch    chan model.StreamEvent
+}
+
+func NewBroker(historySize int) *Broker {
+	return &Broker{
+		// ids continue from the current time in microseconds, so they keep
+		// growing across restarts and a stale Last-Event-ID skips nothing new
+		lastID:      time.Now().UnixMicro(),
+		historySize: historySize,
+		subscribers: make(map[*subscriber]struct{}),
+		now:         time.Now,
+	}
+}
+
+// Publish assigns ids to events and sends them to matching subscribers. A
+// subscriber whose buffer is full is disconnected instead of blocking the
+// publisher.
+func (b *Broker) Publish(events ...model.StreamEvent) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, event := range events {
+		b.lastID++
+		event.ID = b.lastID
+
+		if event.CreatedAt.IsZero() {
+			event.CreatedAt = b.now().UTC()
+		}
+
+		b.history = append(b.history, event)
+		if len(b.history) > b.historySize {
+			b.history = b.history[len(b.history)-b.historySize:]
+		}
+
+		for sub := range b.subscribers {
+			if !sub.match(event) {
+				continue
+			}
+
+			select {
+			case sub.ch <- event:
+			default:
+				b.remove(sub)
+			}
+		}
+	}
+}
+
+// Subscribe returns the retained events newer than lastEventID that match,
+// and a channel receiving new matching events. No events are replayed when
+// lastEventID is zero. The channel is closed when ctx is done or the
+// subscriber falls behind.
+func (b *Broker) Subscribe(
+	ctx context.Context,
+	lastEventID int64,
+	match func(model.StreamEvent) bool,
+) ([]model.StreamEvent, <-chan model.StreamEvent) {
+	sub := &subscriber{
+		match: match,
+		ch:    make(chan model.StreamEvent, subscriberBuffer),
+	}
+
+	b.mu.Lock()
+
+	var backlog []model.StreamEvent
+
+	if lastEventID > 0 {
+		for _, event := range b.history {
+			if event.ID > lastEventID && match(event) {
+				backlog = append(backlog, event)
+			}
+		}
+	}
+
+	b.subscribers[sub] = struct{}{}
+	b.mu.Unlock()
+
+	go func() {
+		<-ctx.Done()
+
+		b.mu.Lock()
+		defer b.mu.Unlock()
+
+		b.remove(sub)
+	}()
+
+	return backlog, sub.ch
+}
+
+func (b *Broker) remove(sub *subscriber) {
+	if _, ok := b.subscribers[sub]; !ok {
+		return
+	}
+
+	delete(b.subscribers, sub)
+	close(sub.ch)
+}
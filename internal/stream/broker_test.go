@@ -0,0 +1,89 @@
+package stream
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/6ermvH/avito-reviewchecker/internal/model"
+)
+
+func TestBroker(t *testing.T) {
+	all := func(model.StreamEvent) bool { return true }
+
+	event := func(userID string) model.StreamEvent {
+		return model.StreamEvent{Type: model.EventPRCreated, UserIDs: []string{userID}}
+	}
+
+	t.Run("Good: delivers matching events", func(t *testing.T) {
+		broker := NewBroker(10)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		backlog, events := broker.Subscribe(ctx, 0, func(e model.StreamEvent) bool {
+			return e.Involves("u1")
+		})
+		require.Empty(t, backlog)
+
+		broker.Publish(event("u2"), event("u1"))
+
+		got := <-events
+		require.Equal(t, []string{"u1"}, got.UserIDs)
+		require.False(t, got.CreatedAt.IsZero())
+		require.Empty(t, events)
+	})
+
+	t.Run("Good: resumes after last event id", func(t *testing.T) {
+		broker := NewBroker(10)
+		broker.Publish(event("u1"), event("u2"), event("u3"))
+
+		backlog, _ := broker.Subscribe(context.Background(), 0, all)
+		require.Empty(t, backlog, "fresh subscribers get no history")
+
+		_, live := broker.Subscribe(context.Background(), 0, all)
+		broker.Publish(event("u4"))
+		last := <-live
+
+		backlog, _ = broker.Subscribe(context.Background(), last.ID-2, all)
+		require.Len(t, backlog, 2)
+		require.Equal(t, []string{"u3"}, backlog[0].UserIDs)
+		require.Equal(t, last.ID, backlog[1].ID)
+	})
+
+	t.Run("Good: history is bounded", func(t *testing.T) {
+		broker := NewBroker(2)
+		broker.Publish(event("u1"), event("u2"), event("u3"))
+
+		backlog, _ := broker.Subscribe(context.Background(), 1, all)
+		require.Len(t, backlog, 2)
+		require.Equal(t, []string{"u2"}, backlog[0].UserIDs)
+	})
+
+	t.Run("Bad: slow subscriber is disconnected", func(t *testing.T) {
+		broker := NewBroker(10)
+		_, events := broker.Subscribe(context.Background(), 0, all)
+
+		for range subscriberBuffer + 1 {
+			broker.Publish(event("u1"))
+		}
+
+		for range subscriberBuffer {
+			<-events
+		}
+
+		_, ok := <-events
+		require.False(t, ok)
+	})
+
+	t.Run("Good: cancel closes the channel", func(t *testing.T) {
+		broker := NewBroker(10)
+		ctx, cancel := context.WithCancel(context.Background())
+
+		_, events := broker.Subscribe(ctx, 0, all)
+		cancel()
+
+		_, ok := <-events
+		require.False(t, ok)
+	})
+}
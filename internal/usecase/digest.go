@@ -0,0 +1,21 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/6ermvH/avito-reviewchecker/internal/model"
+)
+
+// ReviewDigest lists the open pull requests userID reviews together with the
+// time the user was assigned, longest waiting first.
+func (s *Service) ReviewDigest(ctx context.Context, userID string) ([]model.DigestItem, error) {
+	s.logger.Debug("review digest", "userID", userID)
+
+	items, err := s.repo.ListOpenReviews(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("list open reviews of user %q: %w", userID, err)
+	}
+
+	return items, nil
+}
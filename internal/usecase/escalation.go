@@ -0,0 +1,264 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/6ermvH/avito-reviewchecker/internal/model"
+	"github.com/6ermvH/avito-reviewchecker/internal/repository"
+)
+
+// maxReviewersWithLead is the number of reviewer slots once a team lead is
+// added on escalation.
+const maxReviewersWithLead = 3
+
+// EscalateOverdueReviews escalates the members of rule.TeamName assigned to an
+// open pull request longer than rule.SLA before now. The service has no notion
+// of a review response, so the escalation stands for it: every assignment is
+// escalated once, which the repository keeps track of, and the escalation is
+// recorded in the pull request history. A reviewer assigned again starts a new
+// assignment.
+func (s *Service) EscalateOverdueReviews(
+	ctx context.Context,
+	rule model.EscalationRule,
+	now time.Time,
+) ([]model.Escalation, error) {
+	s.logger.Debug("escalate overdue reviews", "team", rule.TeamName, "sla", rule.SLA)
+
+	overdue, err := s.repo.ListOverdueAssignments(ctx, rule.TeamName, now.Add(-rule.SLA))
+	if err != nil {
+		return nil, fmt.Errorf("list overdue assignments for team %q: %w", rule.TeamName, err)
+	}
+
+	var escalations []model.Escalation
+
+	for _, assignment := range overdue {
+		escalation, ok, err := s.escalateReview(ctx, rule, assignment)
+		if err != nil {
+			return escalations, err
+		}
+
+		if ok {
+			escalations = append(escalations, escalation)
+		}
+	}
+
+	return escalations, nil
+}
+
+// escalateReview escalates assignment if the reviewer is still assigned and
+// the assignment is not escalated yet. The pull request is locked while
+// checking, so concurrent schedulers escalate it once.
+func (s *Service) escalateReview(
+	ctx context.Context,
+	rule model.EscalationRule,
+	assignment model.Assignment,
+) (model.Escalation, bool, error) {
+	var (
+		escalation model.Escalation
+		escalated  bool
+	)
+
+	err := s.inTx(ctx, func(ctx context.Context) error {
+		pr, err := s.repo.GetPullRequestForUpdate(ctx, assignment.PullRequestID)
+		if err != nil {
+			return fmt.Errorf("find pr %q: %w", assignment.PullRequestID, err)
+		}
+
+		if pr.Status != model.PRStatusOpen || !isReviewerAssigned(pr, assignment.ReviewerID) {
+			return nil
+		}
+
+		recorded, err := s.repo.RecordEscalation(ctx, assignment)
+		if err != nil {
+			return fmt.Errorf("record escalation for pr %q: %w", pr.ID, err)
+		}
+
+		if !recorded {
+			return nil
+		}
+
+		escalation, err = s.applyEscalation(ctx, rule, pr, assignment.ReviewerID)
+		if err != nil {
+			return err
+		}
+
+		escalation.AssignedAt = assignment.AssignedAt
+		escalated = true
+
+		return nil
+	})
+	if err != nil {
+		return model.Escalation{}, false, translateTxError(err)
+	}
+
+	return escalation, escalated, nil
+}
+
+// applyEscalation applies the policy of rule to reviewerID on pr. Reviewers
+// escalated on pr before are not reassigned to it again. Reassignment without
+// a candidate and a lead who can not be added fall back to notifying.
+func (s *Service) applyEscalation(
+	ctx context.Context,
+	rule model.EscalationRule,
+	pr model.PullRequest,
+	reviewerID string,
+) (model.Escalation, error) {
+	info := model.ChangeInfo{Reason: "no review within " + formatSLA(rule.SLA)}
+	escalation := model.Escalation{
+		PullRequestID: pr.ID,
+		ReviewerID:    reviewerID,
+		Policy:        model.EscalationNotify,
+	}
+
+	switch rule.Policy {
+	case model.EscalationReassign:
+		members, err := s.repo.ListTeamMembers(ctx, rule.TeamName)
+		if err != nil {
+			return model.Escalation{}, fmt.Errorf(
+				"list team members for team %q: %w", rule.TeamName, err,
+			)
+		}
+
+		escalated, err := s.repo.ListEscalatedReviewers(ctx, pr.ID)
+		if err != nil {
+			return model.Escalation{}, fmt.Errorf(
+				"list escalated reviewers of pr %q: %w", pr.ID, err,
+			)
+		}
+
+		s.rngMu.Lock()
+		candidates := filterCandidates(members, pr, reviewerID, s.rng)
+		s.rngMu.Unlock()
+
+		candidates = slices.DeleteFunc(candidates, func(userID string) bool {
+			return slices.Contains(escalated, userID)
+		})
+
+		if len(candidates) > 0 {
+			_, err := s.replaceReviewer(
+				ctx,
+				pr.ID,
+				reviewerID,
+				candidates[0],
+				model.AssignmentEventEscalationReassigned,
+				info,
+			)
+			if err != nil {
+				return model.Escalation{}, err
+			}
+
+			escalation.Policy = model.EscalationReassign
+			escalation.NewReviewerID = candidates[0]
+
+			return escalation, nil
+		}
+
+		s.logger.Warn("no replacement for overdue reviewer", "prID", pr.ID, "userID", reviewerID)
+	case model.EscalationAddLead:
+		added, err := s.addLead(ctx, pr, reviewerID, rule.LeadID, info)
+		if err != nil {
+			return model.Escalation{}, err
+		}
+
+		if added {
+			escalation.Policy = model.EscalationAddLead
+			escalation.NewReviewerID = rule.LeadID
+
+			return escalation, nil
+		}
+
+		s.logger.Warn("team lead can not be added", "prID", pr.ID, "leadID", rule.LeadID)
+	case model.EscalationNotify:
+	}
+
+	err := s.repo.AppendAssignmentEvents(ctx, []model.AssignmentEvent{{
+		PullRequestID: pr.ID,
+		Type:          model.AssignmentEventEscalationNotified,
+		OldReviewerID: reviewerID,
+		Reason:        info.Reason,
+	}})
+	if err != nil {
+		return model.Escalation{}, fmt.Errorf("record escalation for pr %q: %w", pr.ID, err)
+	}
+
+	err = s.publish(ctx, model.EventReviewEscalated, pr, eventDetails{
+		OldReviewerID: reviewerID,
+		Reason:        info.Reason,
+		Escalation:    model.EscalationNotify,
+	})
+	if err != nil {
+		return model.Escalation{}, err
+	}
+
+	return escalation, nil
+}
+
+// addLead adds leadID as an extra reviewer of pr on behalf of reviewerID. It
+// reports false when the lead is the author, already assigned, inactive or
+// there is no free slot.
+func (s *Service) addLead(
+	ctx context.Context,
+	pr model.PullRequest,
+	reviewerID, leadID string,
+	info model.ChangeInfo,
+) (bool, error) {
+	if leadID == "" || leadID == pr.AuthorID || isReviewerAssigned(pr, leadID) ||
+		len(pr.Reviewers) >= maxReviewersWithLead {
+		return false, nil
+	}
+
+	lead, err := s.repo.GetUserByID(ctx, leadID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return false, nil
+		}
+
+		return false, fmt.Errorf("find team lead %q: %w", leadID, err)
+	}
+
+	if !lead.IsActive {
+		return false, nil
+	}
+
+	updated, err := s.repo.AddReviewer(ctx, pr.ID, leadID)
+	if err != nil {
+		if errors.Is(err, repository.ErrAlreadyExists) {
+			return false, ErrConflict
+		}
+
+		return false, fmt.Errorf("add reviewer %q to pr %q: %w", leadID, pr.ID, err)
+	}
+
+	err = s.repo.AppendAssignmentEvents(ctx, []model.AssignmentEvent{{
+		PullRequestID: pr.ID,
+		Type:          model.AssignmentEventEscalationLeadAdded,
+		OldReviewerID: reviewerID,
+		NewReviewerID: leadID,
+		Reason:        info.Reason,
+	}})
+	if err != nil {
+		return false, fmt.Errorf("record escalation for pr %q: %w", pr.ID, err)
+	}
+
+	err = s.publish(ctx, model.EventReviewEscalated, updated, eventDetails{
+		OldReviewerID: reviewerID,
+		NewReviewerID: leadID,
+		Reason:        info.Reason,
+		Escalation:    model.EscalationAddLead,
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// formatSLA drops the zero minutes and seconds of d, "24h0m0s" becomes "24h".
+func formatSLA(d time.Duration) string {
+	return strings.TrimSuffix(strings.TrimSuffix(d.String(), "0s"), "0m")
+}
@@ -0,0 +1,133 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"math"
+	"slices"
+
+	"github.com/6ermvH/avito-reviewchecker/internal/model"
+)
+
+// ReviewFairness measures how evenly the assignments within the window of
+// filter are spread over the active members of every team, or of the
+// filtered one. Members further than sigma standard deviations from the mean
+// of either count are reported as outliers. Teams without active members are
+// left out.
+func (s *Service) ReviewFairness(
+	ctx context.Context,
+	filter model.StatsFilter,
+	sigma float64,
+) ([]model.TeamFairness, error) {
+	s.logger.Debug(
+		"review fairness",
+		"from", filter.From,
+		"to", filter.To,
+		"team", filter.TeamName,
+		"sigma", sigma,
+	)
+
+	stats, err := s.repo.ListReviewerStats(ctx, filter)
+	if err != nil {
+		return nil, fmt.Errorf("list reviewer stats: %w", err)
+	}
+
+	byTeam := make(map[string][]model.ReviewerStat)
+
+	for _, stat := range stats {
+		if stat.IsActive {
+			byTeam[stat.TeamName] = append(byTeam[stat.TeamName], stat)
+		}
+	}
+
+	fairness := make([]model.TeamFairness, 0, len(byTeam))
+
+	for _, teamName := range slices.Sorted(maps.Keys(byTeam)) {
+		fairness = append(fairness, teamFairness(teamName, byTeam[teamName], sigma))
+	}
+
+	return fairness, nil
+}
+
+func teamFairness(teamName string, stats []model.ReviewerStat, sigma float64) model.TeamFairness {
+	total := make([]float64, 0, len(stats))
+	open := make([]float64, 0, len(stats))
+
+	for _, stat := range stats {
+		total = append(total, float64(stat.TotalAssigned))
+		open = append(open, float64(stat.OpenAssigned))
+	}
+
+	fairness := model.TeamFairness{
+		TeamName:      teamName,
+		ActiveMembers: len(stats),
+		TotalAssigned: distribution(total),
+		OpenAssigned:  distribution(open),
+	}
+
+	for i, stat := range stats {
+		totalScore := score(total[i], fairness.TotalAssigned)
+		openScore := score(open[i], fairness.OpenAssigned)
+
+		if math.Abs(totalScore) > sigma || math.Abs(openScore) > sigma {
+			fairness.Outliers = append(fairness.Outliers, model.ReviewerOutlier{
+				UserID:        stat.UserID,
+				Username:      stat.Username,
+				TotalAssigned: stat.TotalAssigned,
+				OpenAssigned:  stat.OpenAssigned,
+				TotalScore:    totalScore,
+				OpenScore:     openScore,
+			})
+		}
+	}
+
+	return fairness
+}
+
+// distribution computes the mean, the population standard deviation and the
+// Gini coefficient of values, which must not be empty.
+func distribution(values []float64) model.Distribution {
+	n := float64(len(values))
+
+	var sum float64
+	for _, v := range values {
+		sum += v
+	}
+
+	mean := sum / n
+
+	var variance float64
+	for _, v := range values {
+		variance += (v - mean) * (v - mean)
+	}
+
+	dist := model.Distribution{Mean: mean, StdDev: math.Sqrt(variance / n)}
+
+	if sum == 0 {
+		return dist
+	}
+
+	// with ascending values the Gini coefficient is
+	// 2 * sum(i * v_i) / (n * sum) - (n + 1) / n for ranks i from 1.
+	sorted := slices.Sorted(slices.Values(values))
+
+	var weighted float64
+	for i, v := range sorted {
+		weighted += float64(i+1) * v
+	}
+
+	dist.Gini = 2*weighted/(n*sum) - (n+1)/n
+
+	return dist
+}
+
+// score is the distance of v from the mean of dist in standard deviations,
+// zero when all values are equal.
+func score(v float64, dist model.Distribution) float64 {
+	if dist.StdDev == 0 {
+		return 0
+	}
+
+	return (v - dist.Mean) / dist.StdDev
+}
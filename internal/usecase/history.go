@@ -0,0 +1,64 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/6ermvH/avito-reviewchecker/internal/model"
+)
+
+const (
+	reasonCreated    = "pull request created"
+	reasonReassigned = "reassigned on request"
+	reasonMerged     = "pull request merged"
+)
+
+func (s *Service) GetPullRequestHistory(
+	ctx context.Context,
+	prID string,
+) ([]model.AssignmentEvent, error) {
+	s.logger.Debug("get pull request history", "prID", prID)
+
+	if _, err := s.repo.GetPullRequest(ctx, prID); err != nil {
+		return nil, fmt.Errorf("find pr %q: %w", prID, err)
+	}
+
+	events, err := s.repo.ListAssignmentEvents(ctx, prID)
+	if err != nil {
+		return nil, fmt.Errorf("list assignment events for pr %q: %w", prID, err)
+	}
+
+	return events, nil
+}
+
+// creationEvents records the initial reviewers of a new pull request, with
+// the author as the actor.
+func creationEvents(pr model.PullRequest) []model.AssignmentEvent {
+	event := model.AssignmentEvent{
+		PullRequestID: pr.ID,
+		Type:          model.AssignmentEventCreated,
+		ActorID:       pr.AuthorID,
+		Reason:        reasonCreated,
+	}
+
+	if len(pr.Reviewers) == 0 {
+		return []model.AssignmentEvent{event}
+	}
+
+	events := make([]model.AssignmentEvent, 0, len(pr.Reviewers))
+
+	for _, reviewerID := range pr.Reviewers {
+		event.NewReviewerID = reviewerID
+		events = append(events, event)
+	}
+
+	return events
+}
+
+func withDefaultReason(info model.ChangeInfo, reason string) model.ChangeInfo {
+	if info.Reason == "" {
+		info.Reason = reason
+	}
+
+	return info
+}
@@ -0,0 +1,95 @@
+package usecase
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/6ermvH/avito-reviewchecker/internal/model"
+)
+
+// eventPayload is the JSON document stored in the outbox and delivered to
+// subscribers as the event data.
+type eventPayload struct {
+	PullRequest pullRequestPayload `json:"pull_request"`
+	eventDetails
+}
+
+type eventDetails struct {
+	OldReviewerID string `json:"old_reviewer_id,omitempty"`
+	NewReviewerID string `json:"new_reviewer_id,omitempty"`
+	ActorID       string `json:"actor_id,omitempty"`
+	Reason        string `json:"reason,omitempty"`
+	// Escalation is the policy applied to a review.escalated event, and
+	// EscalationReassign for a reviewer.reassigned event of an escalation.
+	Escalation model.EscalationPolicy `json:"escalation,omitempty"`
+}
+
+type pullRequestPayload struct {
+	ID        string     `json:"pull_request_id"`
+	Name      string     `json:"pull_request_name"`
+	AuthorID  string     `json:"author_id"`
+	Status    string     `json:"status"`
+	Reviewers []string   `json:"assigned_reviewers"`
+	Version   int        `json:"version"`
+	CreatedAt time.Time  `json:"created_at"`
+	MergedAt  *time.Time `json:"merged_at,omitempty"`
+}
+
+// publish writes a domain event to the outbox and records it for the event
+// stream. It must run in the transaction of the change it describes.
+func (s *Service) publish(
+	ctx context.Context,
+	eventType model.DomainEventType,
+	pr model.PullRequest,
+	details eventDetails,
+) error {
+	reviewers := pr.Reviewers
+	if reviewers == nil {
+		reviewers = []string{}
+	}
+
+	payload, err := json.Marshal(eventPayload{
+		PullRequest: pullRequestPayload{
+			ID:        pr.ID,
+			Name:      pr.Name,
+			AuthorID:  pr.AuthorID,
+			Status:    string(pr.Status),
+			Reviewers: reviewers,
+			Version:   pr.Version,
+			CreatedAt: pr.CreatedAt,
+			MergedAt:  pr.MergedAt,
+		},
+		eventDetails: details,
+	})
+	if err != nil {
+		return fmt.Errorf("encode %s event: %w", eventType, err)
+	}
+
+	err = s.repo.AppendOutboxEvents(ctx, []model.OutboxEvent{{
+		Type:          eventType,
+		PullRequestID: pr.ID,
+		Payload:       payload,
+	}})
+	if err != nil {
+		return fmt.Errorf("publish %s event for pr %q: %w", eventType, pr.ID, err)
+	}
+
+	s.record(ctx, model.StreamEvent{
+		Type:    eventType,
+		UserIDs: involvedUsers(pr, details),
+		Payload: payload,
+	})
+
+	return nil
+}
+
+func involvedUsers(pr model.PullRequest, details eventDetails) []string {
+	users := append([]string{pr.AuthorID}, pr.Reviewers...)
+	if details.OldReviewerID != "" {
+		users = append(users, details.OldReviewerID)
+	}
+
+	return users
+}
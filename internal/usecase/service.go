@@ -6,16 +6,24 @@ import (
 	"fmt"
 	"log/slog"
 	"math/rand"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/6ermvH/avito-reviewchecker/internal/model"
 	"github.com/6ermvH/avito-reviewchecker/internal/repository"
+	"github.com/6ermvH/avito-reviewchecker/internal/stream"
 )
 
 type Service struct {
 	repo   Repository
 	logger *slog.Logger
+	stream *stream.Broker
+	rngMu  sync.Mutex
 	rng    *rand.Rand
+	// noCandidates counts reassignments that failed with
+	// ErrNoReplacementCandidate.
+	noCandidates atomic.Int64
 }
 
 var (
@@ -24,13 +32,29 @@ var (
 	ErrPRMerged               = errors.New("pull request already merged")
 	ErrTeamExists             = errors.New("team already exists")
 	ErrPullRequestExists      = errors.New("pull request already exists")
+	ErrConflict               = errors.New("concurrent modification, retry the request")
+	ErrVersionMismatch        = errors.New("pull request version does not match")
 )
 
-const shuffleThreshold = 2
+// AnyVersion disables the expected version check of MergePR and
+// ReassignReviewer; any other value makes them fail with ErrVersionMismatch
+// when the stored pull request has a different version.
+const AnyVersion = 0
+
+const (
+	shuffleThreshold   = 2
+	defaultReviewLimit = 50
+	maxReviewLimit     = 500
+)
 
 //go:generate mockgen -source=service.go -destination=../repository/mocks/repository_mock.go -package=mocks_repository
 //nolint:interfacebloat
 type Repository interface {
+	// InTx runs fn in a single transaction, committed when fn returns nil and
+	// rolled back otherwise. Repository calls made with the context passed to
+	// fn take part in the transaction; nested InTx calls join it.
+	InTx(ctx context.Context, fn func(ctx context.Context) error) error
+
 	GetTeamByName(ctx context.Context, name string) (model.Team, error)
 	CreateTeam(ctx context.Context, name string) (model.Team, error)
 	InsertTeamMembers(ctx context.Context, teamName string, users []model.User) error
@@ -41,25 +65,112 @@ type Repository interface {
 
 	CreatePullRequest(ctx context.Context, pr model.PullRequest) (model.PullRequest, error)
 	GetPullRequest(ctx context.Context, prID string) (model.PullRequest, error)
+	// GetPullRequestForUpdate works like GetPullRequest and additionally locks
+	// the pull request until the surrounding transaction ends.
+	GetPullRequestForUpdate(ctx context.Context, prID string) (model.PullRequest, error)
 	UpdatePullRequestStatus(
 		ctx context.Context,
 		prID string,
 		status model.PRStatus,
 		mergedAt *time.Time,
 	) (model.PullRequest, error)
-	ListReviewerPullRequests(ctx context.Context, userID string) ([]model.PullRequest, error)
+	ListReviewerPullRequests(
+		ctx context.Context,
+		userID string,
+		filter model.ReviewFilter,
+	) ([]model.PullRequest, error)
+	// ListOpenReviews lists the open pull requests userID reviews with the
+	// assigned_at of the user, longest waiting first.
+	ListOpenReviews(ctx context.Context, userID string) ([]model.DigestItem, error)
 	ReplaceReviewer(
 		ctx context.Context,
 		prID, oldUserID, newUserID string,
 	) (model.PullRequest, error)
-	ListReviewerStats(ctx context.Context) ([]model.ReviewerStat, error)
-	GetPullRequestStats(ctx context.Context) (model.PullRequestStats, error)
+	// AddReviewer assigns userID to prID in the slot after the last one.
+	AddReviewer(ctx context.Context, prID, userID string) (model.PullRequest, error)
+	// ListReviewerStats returns every user of the filtered team, users
+	// without assignments included, and counts assignments by assigned_at.
+	ListReviewerStats(ctx context.Context, filter model.StatsFilter) ([]model.ReviewerStat, error)
+	// GetPullRequestStats filters by created_at, merged_at for Merged, and the
+	// team of the author.
+	GetPullRequestStats(
+		ctx context.Context,
+		filter model.StatsFilter,
+	) (model.PullRequestStats, error)
+	// ListTeamStats filters pull requests by created_at and teams by name.
+	// Members and open assignments are counted as of now.
+	ListTeamStats(ctx context.Context, filter model.StatsFilter) ([]model.TeamStat, error)
+	// CountOpenPullRequests returns every team by name, teams without open
+	// pull requests included.
+	CountOpenPullRequests(ctx context.Context) ([]model.TeamCount, error)
+	// ListTimeseries counts metric per bucket within the window and team of
+	// filter in ascending order. Buckets without events are left out.
+	ListTimeseries(
+		ctx context.Context,
+		metric model.TimeseriesMetric,
+		bucket model.TimeseriesBucket,
+		filter model.StatsFilter,
+	) ([]model.TimeseriesPoint, error)
+
+	// ListOverdueAssignments lists the members of teamName assigned to an open
+	// pull request before assignedBefore whose assignment is not escalated.
+	ListOverdueAssignments(
+		ctx context.Context,
+		teamName string,
+		assignedBefore time.Time,
+	) ([]model.Assignment, error)
+	// RecordEscalation marks assignment as escalated. It reports false when
+	// the assignment already is.
+	RecordEscalation(ctx context.Context, assignment model.Assignment) (bool, error)
+	// ListEscalatedReviewers lists the reviewers ever escalated on prID.
+	ListEscalatedReviewers(ctx context.Context, prID string) ([]string, error)
+
+	AppendAssignmentEvents(ctx context.Context, events []model.AssignmentEvent) error
+	ListAssignmentEvents(ctx context.Context, prID string) ([]model.AssignmentEvent, error)
+
+	AppendOutboxEvents(ctx context.Context, events []model.OutboxEvent) error
+	// ClaimOutboxEvents returns up to limit undispatched events in id order and
+	// keeps concurrent callers from claiming them until the transaction ends.
+	ClaimOutboxEvents(ctx context.Context, limit int) ([]model.OutboxEvent, error)
+	MarkOutboxEventsDispatched(ctx context.Context, ids []int64) error
+
+	CreateWebhookSubscription(
+		ctx context.Context,
+		sub model.WebhookSubscription,
+	) (model.WebhookSubscription, error)
+	ListWebhookSubscriptions(ctx context.Context) ([]model.WebhookSubscription, error)
+	DeleteWebhookSubscription(ctx context.Context, id string) error
+	// CreateWebhookDeliveries skips deliveries that already exist for the
+	// same subscription and event.
+	CreateWebhookDeliveries(ctx context.Context, deliveries []model.WebhookDelivery) error
+	// ClaimDueDeliveries returns up to limit pending deliveries due at now and
+	// postpones them by lease, so that a crashed dispatcher's deliveries are
+	// retried once the lease expires.
+	ClaimDueDeliveries(
+		ctx context.Context,
+		now time.Time,
+		lease time.Duration,
+		limit int,
+	) ([]model.PendingDelivery, error)
+	// UpdateWebhookDelivery records the outcome of an attempt only while the
+	// delivery is pending with next_attempt_at at leaseUntil, the end of the
+	// lease it was claimed with, and fails with ErrLeaseLost otherwise.
+	UpdateWebhookDelivery(
+		ctx context.Context,
+		delivery model.WebhookDelivery,
+		leaseUntil time.Time,
+	) error
+	ListWebhookDeliveries(
+		ctx context.Context,
+		filter model.DeliveryFilter,
+	) ([]model.WebhookDelivery, error)
 }
 
 func New(repo Repository, logger *slog.Logger) *Service {
 	return &Service{
 		repo:   repo,
 		logger: logger,
+		stream: stream.NewBroker(streamHistorySize),
 		rng:    rand.New(rand.NewSource(time.Now().UnixNano())),
 	}
 }
@@ -67,25 +178,33 @@ func New(repo Repository, logger *slog.Logger) *Service {
 func (s *Service) UpdateTeam(ctx context.Context, teamName string, users []model.User) error {
 	s.logger.Debug("update team", "teamName", teamName, "users", users)
 
-	_, err := s.repo.GetTeamByName(ctx, teamName)
+	err := s.inTx(ctx, func(ctx context.Context) error {
+		_, err := s.repo.GetTeamByName(ctx, teamName)
 
-	switch {
-	case err == nil:
-		return ErrTeamExists
-	case !errors.Is(err, repository.ErrNotFound):
-		return fmt.Errorf("find team %q: %w", teamName, err)
-	}
+		switch {
+		case err == nil:
+			return ErrTeamExists
+		case !errors.Is(err, repository.ErrNotFound):
+			return fmt.Errorf("find team %q: %w", teamName, err)
+		}
 
-	team, err := s.repo.CreateTeam(ctx, teamName)
-	if err != nil {
-		return fmt.Errorf("create team %q: %w", teamName, err)
-	}
+		team, err := s.repo.CreateTeam(ctx, teamName)
+		if err != nil {
+			if errors.Is(err, repository.ErrAlreadyExists) {
+				return ErrTeamExists
+			}
 
-	if err := s.repo.InsertTeamMembers(ctx, team.Name, users); err != nil {
-		return fmt.Errorf("upsert team %q members: %w", teamName, err)
-	}
+			return fmt.Errorf("create team %q: %w", teamName, err)
+		}
+
+		if err := s.repo.InsertTeamMembers(ctx, team.Name, users); err != nil {
+			return fmt.Errorf("upsert team %q members: %w", teamName, err)
+		}
+
+		return nil
+	})
 
-	return nil
+	return translateTxError(err)
 }
 
 func (s *Service) GetTeam(ctx context.Context, teamName string) (model.Team, []model.User, error) {
@@ -104,27 +223,73 @@ func (s *Service) GetTeam(ctx context.Context, teamName string) (model.Team, []m
 	return team, users, nil
 }
 
-func (s *Service) ListReviews(ctx context.Context, userID string) ([]model.PullRequest, error) {
-	s.logger.Debug("list reviews", "userID", userID)
+func (s *Service) ListReviews(
+	ctx context.Context,
+	userID string,
+	filter model.ReviewFilter,
+) (model.PullRequestPage, error) {
+	s.logger.Debug("list reviews", "userID", userID, "filter", filter)
+
+	// clients that predate pagination send neither limit nor cursor and get
+	// every review in one page
+	paged := filter.Limit > 0 || filter.After != nil
 
-	pullRequests, err := s.repo.ListReviewerPullRequests(ctx, userID)
+	switch {
+	case !paged:
+	case filter.Limit <= 0:
+		filter.Limit = defaultReviewLimit
+	case filter.Limit > maxReviewLimit:
+		filter.Limit = maxReviewLimit
+	}
+
+	limit := filter.Limit
+	if paged {
+		// one extra row tells us whether there is a next page
+		filter.Limit++
+	}
+
+	pullRequests, err := s.repo.ListReviewerPullRequests(ctx, userID, filter)
 	if err != nil {
-		return nil, fmt.Errorf("find prs, where user %q reviewed: %w", userID, err)
+		return model.PullRequestPage{}, fmt.Errorf(
+			"find prs, where user %q reviewed: %w",
+			userID,
+			err,
+		)
+	}
+
+	page := model.PullRequestPage{PullRequests: pullRequests}
+
+	if paged && len(pullRequests) > limit {
+		page.PullRequests = pullRequests[:limit]
+		last := page.PullRequests[limit-1]
+		page.Next = &model.ReviewCursor{CreatedAt: last.CreatedAt, ID: last.ID}
 	}
 
-	return pullRequests, nil
+	return page, nil
 }
 
 func (s *Service) SetUserActive(
 	ctx context.Context,
 	userID string,
 	active bool,
+	info model.ChangeInfo,
 ) (model.User, error) {
 	s.logger.Debug("set user active", "userID", userID, "active", active)
 
-	user, err := s.repo.SetUserActivity(ctx, userID, active)
+	var user model.User
+
+	err := s.inTx(ctx, func(ctx context.Context) error {
+		var err error
+
+		user, err = s.repo.SetUserActivity(ctx, userID, active)
+		if err != nil {
+			return fmt.Errorf("change is_active to user %q: %w", userID, err)
+		}
+
+		return s.recordUserActivity(ctx, user, info)
+	})
 	if err != nil {
-		return model.User{}, fmt.Errorf("change is_active to user %q: %w", userID, err)
+		return model.User{}, translateTxError(err)
 	}
 
 	return user, nil
@@ -146,7 +311,9 @@ func (s *Service) CreatePR(
 		return model.PullRequest{}, fmt.Errorf("list team members for author %q: %w", authorID, err)
 	}
 
+	s.rngMu.Lock()
 	reviewerIDs := selectInitialReviewers(author.ID, members, s.rng)
+	s.rngMu.Unlock()
 
 	pr := model.PullRequest{
 		ID:        prID,
@@ -156,98 +323,262 @@ func (s *Service) CreatePR(
 		Reviewers: reviewerIDs,
 	}
 
-	created, err := s.repo.CreatePullRequest(ctx, pr)
-	if err != nil {
-		if errors.Is(err, repository.ErrAlreadyExists) {
-			return model.PullRequest{}, ErrPullRequestExists
+	var created model.PullRequest
+
+	err = s.inTx(ctx, func(ctx context.Context) error {
+		var err error
+
+		created, err = s.repo.CreatePullRequest(ctx, pr)
+		if err != nil {
+			if errors.Is(err, repository.ErrAlreadyExists) {
+				return ErrPullRequestExists
+			}
+
+			return fmt.Errorf(
+				"create pr with id %q name %q for user %q: %w",
+				prID,
+				prName,
+				authorID,
+				err,
+			)
 		}
 
-		return model.PullRequest{}, fmt.Errorf(
-			"create pr with id %q name %q for user %q: %w",
-			prID,
-			prName,
-			authorID,
-			err,
-		)
+		if err := s.repo.AppendAssignmentEvents(ctx, creationEvents(created)); err != nil {
+			return fmt.Errorf("record creation of pr %q: %w", prID, err)
+		}
+
+		return s.publish(ctx, model.EventPRCreated, created, eventDetails{ActorID: authorID})
+	})
+	if err != nil {
+		return model.PullRequest{}, translateTxError(err)
 	}
 
 	return created, nil
 }
 
-func (s *Service) MergePR(ctx context.Context, prID string) (model.PullRequest, error) {
-	s.logger.Debug("merge pull request", "prID", prID)
+// GetPullRequest returns the pull request with its current version, the
+// value MergePR and ReassignReviewer expect.
+func (s *Service) GetPullRequest(ctx context.Context, prID string) (model.PullRequest, error) {
+	s.logger.Debug("get pull request", "prID", prID)
 
 	pr, err := s.repo.GetPullRequest(ctx, prID)
 	if err != nil {
-		return model.PullRequest{}, fmt.Errorf("set pr %q is merged: %w", prID, err)
+		return model.PullRequest{}, fmt.Errorf("find pr %q: %w", prID, err)
 	}
 
-	if pr.Status == model.PRStatusMerged {
-		return pr, nil
-	}
+	return pr, nil
+}
+
+func (s *Service) MergePR(
+	ctx context.Context,
+	prID string,
+	expectedVersion int,
+	info model.ChangeInfo,
+) (model.PullRequest, error) {
+	s.logger.Debug("merge pull request", "prID", prID, "expectedVersion", expectedVersion)
+
+	var merged model.PullRequest
+
+	err := s.inTx(ctx, func(ctx context.Context) error {
+		pr, err := s.repo.GetPullRequestForUpdate(ctx, prID)
+		if err != nil {
+			return fmt.Errorf("set pr %q is merged: %w", prID, err)
+		}
 
-	now := time.Now().UTC()
+		if err := checkVersion(pr, expectedVersion); err != nil {
+			return err
+		}
+
+		if pr.Status == model.PRStatusMerged {
+			merged = pr
+
+			return nil
+		}
 
-	pr, err = s.repo.UpdatePullRequestStatus(ctx, prID, model.PRStatusMerged, &now)
+		now := time.Now().UTC()
+
+		merged, err = s.repo.UpdatePullRequestStatus(ctx, prID, model.PRStatusMerged, &now)
+		if err != nil {
+			return fmt.Errorf("set pr %q is merged: %w", prID, err)
+		}
+
+		info = withDefaultReason(info, reasonMerged)
+
+		err = s.repo.AppendAssignmentEvents(ctx, []model.AssignmentEvent{{
+			PullRequestID: prID,
+			Type:          model.AssignmentEventMerged,
+			ActorID:       info.ActorID,
+			Reason:        info.Reason,
+		}})
+		if err != nil {
+			return fmt.Errorf("record merge of pr %q: %w", prID, err)
+		}
+
+		return s.publish(ctx, model.EventPRMerged, merged, eventDetails{
+			ActorID: info.ActorID,
+			Reason:  info.Reason,
+		})
+	})
 	if err != nil {
-		return model.PullRequest{}, fmt.Errorf("set pr %q is merged: %w", prID, err)
+		return model.PullRequest{}, translateTxError(err)
 	}
 
-	return pr, nil
+	return merged, nil
 }
 
 func (s *Service) ReassignReviewer(
 	ctx context.Context,
 	prID, oldUserID string,
+	expectedVersion int,
+	info model.ChangeInfo,
 ) (model.PullRequest, string, error) {
-	s.logger.Debug("reassign reviewer", "prID", prID, "oldUserID", oldUserID)
+	s.logger.Debug(
+		"reassign reviewer",
+		"prID", prID,
+		"oldUserID", oldUserID,
+		"expectedVersion", expectedVersion,
+	)
+
+	var (
+		updated  model.PullRequest
+		targetID string
+	)
+
+	err := s.inTx(ctx, func(ctx context.Context) error {
+		pr, err := s.repo.GetPullRequestForUpdate(ctx, prID)
+		if err != nil {
+			return fmt.Errorf("find pr %q: %w", prID, err)
+		}
 
-	pr, err := s.repo.GetPullRequest(ctx, prID)
-	if err != nil {
-		return model.PullRequest{}, "", fmt.Errorf("find pr %q: %w", prID, err)
-	}
+		if err := checkVersion(pr, expectedVersion); err != nil {
+			return err
+		}
 
-	if pr.Status == model.PRStatusMerged {
-		return model.PullRequest{}, "", ErrPRMerged
-	}
+		if pr.Status == model.PRStatusMerged {
+			return ErrPRMerged
+		}
 
-	if !isReviewerAssigned(pr, oldUserID) {
-		return model.PullRequest{}, "", ErrReviewerNotAssigned
-	}
+		if !isReviewerAssigned(pr, oldUserID) {
+			return ErrReviewerNotAssigned
+		}
 
-	reviewer, err := s.repo.GetUserByID(ctx, oldUserID)
-	if err != nil {
-		return model.PullRequest{}, "", fmt.Errorf("find reviewer %q: %w", oldUserID, err)
-	}
+		reviewer, err := s.repo.GetUserByID(ctx, oldUserID)
+		if err != nil {
+			return fmt.Errorf("find reviewer %q: %w", oldUserID, err)
+		}
 
-	members, err := s.repo.ListTeamMembers(ctx, reviewer.TeamName)
-	if err != nil {
-		return model.PullRequest{}, "", fmt.Errorf(
-			"list team members for team %q: %w",
-			reviewer.TeamName,
-			err,
+		members, err := s.repo.ListTeamMembers(ctx, reviewer.TeamName)
+		if err != nil {
+			return fmt.Errorf("list team members for team %q: %w", reviewer.TeamName, err)
+		}
+
+		s.rngMu.Lock()
+		candidates := filterCandidates(members, pr, oldUserID, s.rng)
+		s.rngMu.Unlock()
+
+		if len(candidates) == 0 {
+			return ErrNoReplacementCandidate
+		}
+
+		targetID = candidates[0]
+
+		updated, err = s.replaceReviewer(
+			ctx,
+			prID,
+			oldUserID,
+			targetID,
+			model.AssignmentEventReassigned,
+			withDefaultReason(info, reasonReassigned),
 		)
-	}
 
-	candidates := filterCandidates(members, pr, oldUserID, s.rng)
-	if len(candidates) == 0 {
-		return model.PullRequest{}, "", ErrNoReplacementCandidate
+		return err
+	})
+	if err != nil {
+		if errors.Is(err, ErrNoReplacementCandidate) {
+			s.noCandidates.Add(1)
+		}
+
+		return model.PullRequest{}, "", translateTxError(err)
 	}
 
-	targetID := candidates[0]
+	return updated, targetID, nil
+}
+
+// NoReplacementCandidates returns how many reassignments failed with
+// ErrNoReplacementCandidate since the service was created.
+func (s *Service) NoReplacementCandidates() int64 {
+	return s.noCandidates.Load()
+}
 
-	updated, err := s.repo.ReplaceReviewer(ctx, prID, oldUserID, targetID)
+// replaceReviewer swaps the reviewer and records the event in the same
+// transaction.
+func (s *Service) replaceReviewer(
+	ctx context.Context,
+	prID, oldUserID, newUserID string,
+	eventType model.AssignmentEventType,
+	info model.ChangeInfo,
+) (model.PullRequest, error) {
+	updated, err := s.repo.ReplaceReviewer(ctx, prID, oldUserID, newUserID)
 	if err != nil {
-		return model.PullRequest{}, "", fmt.Errorf(
+		if errors.Is(err, repository.ErrAlreadyExists) {
+			return model.PullRequest{}, ErrConflict
+		}
+
+		return model.PullRequest{}, fmt.Errorf(
 			"replace reviewer %q -> %q for pr %q: %w",
 			oldUserID,
-			targetID,
+			newUserID,
 			prID,
 			err,
 		)
 	}
 
-	return updated, targetID, nil
+	err = s.repo.AppendAssignmentEvents(ctx, []model.AssignmentEvent{{
+		PullRequestID: prID,
+		Type:          eventType,
+		OldReviewerID: oldUserID,
+		NewReviewerID: newUserID,
+		ActorID:       info.ActorID,
+		Reason:        info.Reason,
+	}})
+	if err != nil {
+		return model.PullRequest{}, fmt.Errorf("record reassignment for pr %q: %w", prID, err)
+	}
+
+	details := eventDetails{
+		OldReviewerID: oldUserID,
+		NewReviewerID: newUserID,
+		ActorID:       info.ActorID,
+		Reason:        info.Reason,
+	}
+	if eventType == model.AssignmentEventEscalationReassigned {
+		details.Escalation = model.EscalationReassign
+	}
+
+	err = s.publish(ctx, model.EventReviewerReassigned, updated, details)
+	if err != nil {
+		return model.PullRequest{}, err
+	}
+
+	return updated, nil
+}
+
+func checkVersion(pr model.PullRequest, expectedVersion int) error {
+	if expectedVersion == AnyVersion || pr.Version == expectedVersion {
+		return nil
+	}
+
+	return fmt.Errorf("pr %q has version %d, expected %d: %w",
+		pr.ID, pr.Version, expectedVersion, ErrVersionMismatch)
+}
+
+// translateTxError reports storage level write conflicts as ErrConflict.
+func translateTxError(err error) error {
+	if errors.Is(err, repository.ErrConflict) {
+		return ErrConflict
+	}
+
+	return err
 }
 
 func isReviewerAssigned(pr model.PullRequest, reviewerID string) bool {
@@ -315,9 +646,8 @@ func selectInitialReviewers(authorID string, members []model.User, rng *rand.Ran
 
 	shuffleStrings(candidates, rng)
 
-	//nolint:mnd
-	if len(candidates) > 2 {
-		return candidates[:2]
+	if len(candidates) > model.DesiredReviewers {
+		return candidates[:model.DesiredReviewers]
 	}
 
 	return candidates
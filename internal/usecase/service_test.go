@@ -2,8 +2,11 @@ package usecase
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"log/slog"
+	"math"
 	"testing"
 	"time"
 
@@ -25,6 +28,8 @@ func TestUpdateTeam(t *testing.T) {
 	members := []model.User{}
 
 	t.Run("Bad: team exists", func(t *testing.T) {
+		expectTx(repo)
+
 		team := model.Team{Name: "team"}
 		repo.EXPECT().
 			GetTeamByName(gomock.Any(), "team").
@@ -35,6 +40,8 @@ func TestUpdateTeam(t *testing.T) {
 	})
 
 	t.Run("Good: create new team", func(t *testing.T) {
+		expectTx(repo)
+
 		team := model.Team{Name: "created"}
 		repo.EXPECT().
 			GetTeamByName(gomock.Any(), "created").
@@ -50,6 +57,8 @@ func TestUpdateTeam(t *testing.T) {
 	})
 
 	t.Run("Bad: get team error", func(t *testing.T) {
+		expectTx(repo)
+
 		repo.EXPECT().
 			GetTeamByName(gomock.Any(), "boom").
 			Return(model.Team{}, errors.New("get error"))
@@ -58,6 +67,8 @@ func TestUpdateTeam(t *testing.T) {
 	})
 
 	t.Run("Bad: create team error", func(t *testing.T) {
+		expectTx(repo)
+
 		repo.EXPECT().
 			GetTeamByName(gomock.Any(), "team").
 			Return(model.Team{}, repository.ErrNotFound)
@@ -69,6 +80,8 @@ func TestUpdateTeam(t *testing.T) {
 	})
 
 	t.Run("Bad: insert members error", func(t *testing.T) {
+		expectTx(repo)
+
 		team := model.Team{Name: "team"}
 		repo.EXPECT().
 			GetTeamByName(gomock.Any(), "team").
@@ -140,25 +153,73 @@ func TestListReviews(t *testing.T) {
 	repo := mocks_repository.NewMockRepository(ctrl)
 	service := New(repo, slog.Default())
 
-	t.Run("Good: success", func(t *testing.T) {
+	t.Run("Good: no limit and cursor lists every review", func(t *testing.T) {
 		expected := []model.PullRequest{
 			{ID: "pr1"},
 		}
 		repo.EXPECT().
-			ListReviewerPullRequests(gomock.Any(), "user").
+			ListReviewerPullRequests(gomock.Any(), "user", model.ReviewFilter{}).
 			Return(expected, nil)
 
-		result, err := service.ListReviews(context.Background(), "user")
+		result, err := service.ListReviews(context.Background(), "user", model.ReviewFilter{})
+		require.NoError(t, err)
+		require.Equal(t, expected, result.PullRequests)
+		require.Nil(t, result.Next)
+	})
+
+	t.Run("Good: cursor without limit uses the default page size", func(t *testing.T) {
+		after := &model.ReviewCursor{CreatedAt: time.Now().UTC(), ID: "pr0"}
+		repo.EXPECT().
+			ListReviewerPullRequests(gomock.Any(), "user", model.ReviewFilter{
+				Limit: defaultReviewLimit + 1,
+				After: after,
+			}).
+			Return(nil, nil)
+
+		result, err := service.ListReviews(context.Background(), "user", model.ReviewFilter{After: after})
+		require.NoError(t, err)
+		require.Nil(t, result.Next)
+	})
+
+	t.Run("Good: has next page", func(t *testing.T) {
+		createdAt := time.Now().UTC()
+		after := &model.ReviewCursor{CreatedAt: createdAt.Add(-time.Hour), ID: "pr0"}
+		filter := model.ReviewFilter{Status: model.PRStatusOpen, Limit: 2, After: after}
+		prs := []model.PullRequest{
+			{ID: "pr1", CreatedAt: createdAt},
+			{ID: "pr2", CreatedAt: createdAt},
+			{ID: "pr3", CreatedAt: createdAt},
+		}
+
+		repo.EXPECT().
+			ListReviewerPullRequests(gomock.Any(), "user", model.ReviewFilter{
+				Status: model.PRStatusOpen,
+				Limit:  3,
+				After:  after,
+			}).
+			Return(prs, nil)
+
+		result, err := service.ListReviews(context.Background(), "user", filter)
+		require.NoError(t, err)
+		require.Equal(t, prs[:2], result.PullRequests)
+		require.Equal(t, &model.ReviewCursor{CreatedAt: createdAt, ID: "pr2"}, result.Next)
+	})
+
+	t.Run("Good: limit is capped", func(t *testing.T) {
+		repo.EXPECT().
+			ListReviewerPullRequests(gomock.Any(), "user", model.ReviewFilter{Limit: maxReviewLimit + 1}).
+			Return(nil, nil)
+
+		_, err := service.ListReviews(context.Background(), "user", model.ReviewFilter{Limit: 100000})
 		require.NoError(t, err)
-		require.Equal(t, expected, result)
 	})
 
 	t.Run("Bad: repo error", func(t *testing.T) {
 		repo.EXPECT().
-			ListReviewerPullRequests(gomock.Any(), "user").
+			ListReviewerPullRequests(gomock.Any(), "user", gomock.Any()).
 			Return(nil, errors.New("list error"))
 
-		_, err := service.ListReviews(context.Background(), "user")
+		_, err := service.ListReviews(context.Background(), "user", model.ReviewFilter{})
 		require.Error(t, err)
 	})
 }
@@ -171,22 +232,44 @@ func TestSetUserActive(t *testing.T) {
 	service := New(repo, slog.Default())
 
 	t.Run("Good: updated", func(t *testing.T) {
+		expectTx(repo)
+
 		user := model.User{ID: "user", IsActive: true}
 		repo.EXPECT().
 			SetUserActivity(gomock.Any(), "user", true).
 			Return(user, nil)
 
-		result, err := service.SetUserActive(context.Background(), "user", true)
+		result, err := service.SetUserActive(context.Background(), "user", true, model.ChangeInfo{})
+		require.NoError(t, err)
+		require.Equal(t, user, result)
+	})
+
+	t.Run("Good: deactivation keeps open reviews", func(t *testing.T) {
+		expectTx(repo)
+
+		user := model.User{ID: "user", TeamName: "team", IsActive: false}
+		repo.EXPECT().
+			SetUserActivity(gomock.Any(), "user", false).
+			Return(user, nil)
+
+		result, err := service.SetUserActive(
+			context.Background(),
+			"user",
+			false,
+			model.ChangeInfo{ActorID: "lead"},
+		)
 		require.NoError(t, err)
 		require.Equal(t, user, result)
 	})
 
 	t.Run("Bad: repo error", func(t *testing.T) {
+		expectTx(repo)
+
 		repo.EXPECT().
 			SetUserActivity(gomock.Any(), "user", false).
 			Return(model.User{}, errors.New("update error"))
 
-		_, err := service.SetUserActive(context.Background(), "user", false)
+		_, err := service.SetUserActive(context.Background(), "user", false, model.ChangeInfo{})
 		require.Error(t, err)
 	})
 }
@@ -207,6 +290,8 @@ func TestCreatePR(t *testing.T) {
 	}
 
 	t.Run("Good: created", func(t *testing.T) {
+		expectTx(repo)
+
 		repo.EXPECT().
 			GetUserByID(gomock.Any(), "author").
 			Return(author, nil)
@@ -224,6 +309,21 @@ func TestCreatePR(t *testing.T) {
 				require.ElementsMatch(t, []string{"u1", "u2"}, pr.Reviewers)
 				return pr, nil
 			})
+		repo.EXPECT().
+			AppendAssignmentEvents(gomock.Any(), gomock.Any()).
+			DoAndReturn(func(_ context.Context, events []model.AssignmentEvent) error {
+				require.Len(t, events, 2)
+
+				for _, event := range events {
+					require.Equal(t, "pr-1", event.PullRequestID)
+					require.Equal(t, model.AssignmentEventCreated, event.Type)
+					require.Equal(t, "author", event.ActorID)
+					require.Contains(t, []string{"u1", "u2"}, event.NewReviewerID)
+				}
+
+				return nil
+			})
+		expectOutboxEvent(t, repo, model.EventPRCreated)
 
 		result, err := service.CreatePR(context.Background(), "pr-1", "new feature", "author")
 		require.NoError(t, err)
@@ -252,6 +352,8 @@ func TestCreatePR(t *testing.T) {
 	})
 
 	t.Run("Bad: create pr error", func(t *testing.T) {
+		expectTx(repo)
+
 		repo.EXPECT().
 			GetUserByID(gomock.Any(), "author").
 			Return(author, nil)
@@ -267,6 +369,35 @@ func TestCreatePR(t *testing.T) {
 	})
 }
 
+func TestGetPullRequest(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	repo := mocks_repository.NewMockRepository(ctrl)
+	service := New(repo, slog.Default())
+
+	t.Run("Good: pull request with version", func(t *testing.T) {
+		expected := model.PullRequest{ID: "pr", Status: model.PRStatusOpen, Version: 3}
+
+		repo.EXPECT().
+			GetPullRequest(gomock.Any(), "pr").
+			Return(expected, nil)
+
+		pr, err := service.GetPullRequest(context.Background(), "pr")
+		require.NoError(t, err)
+		require.Equal(t, expected, pr)
+	})
+
+	t.Run("Bad: unknown PR", func(t *testing.T) {
+		repo.EXPECT().
+			GetPullRequest(gomock.Any(), "missing").
+			Return(model.PullRequest{}, repository.ErrNotFound)
+
+		_, err := service.GetPullRequest(context.Background(), "missing")
+		require.ErrorIs(t, err, repository.ErrNotFound)
+	})
+}
+
 func TestMergePR(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
@@ -275,24 +406,28 @@ func TestMergePR(t *testing.T) {
 	service := New(repo, slog.Default())
 
 	t.Run("Good: already merged", func(t *testing.T) {
+		expectTx(repo)
+
 		pr := model.PullRequest{ID: "pr", Status: model.PRStatusMerged}
 		repo.EXPECT().
-			GetPullRequest(gomock.Any(), "pr").
+			GetPullRequestForUpdate(gomock.Any(), "pr").
 			Return(pr, nil)
 
-		result, err := service.MergePR(context.Background(), "pr")
+		result, err := service.MergePR(context.Background(), "pr", AnyVersion, model.ChangeInfo{})
 		require.NoError(t, err)
 		require.Equal(t, pr, result)
 	})
 
 	t.Run("Good: merge now", func(t *testing.T) {
+		expectTx(repo)
+
 		pr := model.PullRequest{ID: "pr", Status: model.PRStatusOpen}
 		merged := pr
 		merged.Status = model.PRStatusMerged
 		now := time.Now().UTC()
 
 		repo.EXPECT().
-			GetPullRequest(gomock.Any(), "pr").
+			GetPullRequestForUpdate(gomock.Any(), "pr").
 			Return(pr, nil)
 		repo.EXPECT().
 			UpdatePullRequestStatus(gomock.Any(), "pr", model.PRStatusMerged, gomock.AssignableToTypeOf(&now)).
@@ -301,31 +436,54 @@ func TestMergePR(t *testing.T) {
 				require.NotNil(t, mergedAt)
 				return merged, nil
 			})
+		repo.EXPECT().
+			AppendAssignmentEvents(gomock.Any(), []model.AssignmentEvent{{
+				PullRequestID: "pr",
+				Type:          model.AssignmentEventMerged,
+				Reason:        reasonMerged,
+			}}).
+			Return(nil)
+		expectOutboxEvent(t, repo, model.EventPRMerged)
 
-		result, err := service.MergePR(context.Background(), "pr")
+		result, err := service.MergePR(context.Background(), "pr", AnyVersion, model.ChangeInfo{})
 		require.NoError(t, err)
 		require.Equal(t, merged, result)
 	})
 
 	t.Run("Bad: get PR error", func(t *testing.T) {
+		expectTx(repo)
+
 		repo.EXPECT().
-			GetPullRequest(gomock.Any(), "missing").
+			GetPullRequestForUpdate(gomock.Any(), "missing").
 			Return(model.PullRequest{}, errors.New("not found"))
 
-		_, err := service.MergePR(context.Background(), "missing")
+		_, err := service.MergePR(context.Background(), "missing", AnyVersion, model.ChangeInfo{})
 		require.Error(t, err)
 	})
 
+	t.Run("Bad: version mismatch", func(t *testing.T) {
+		expectTx(repo)
+
+		repo.EXPECT().
+			GetPullRequestForUpdate(gomock.Any(), "pr").
+			Return(model.PullRequest{ID: "pr", Status: model.PRStatusOpen, Version: 3}, nil)
+
+		_, err := service.MergePR(context.Background(), "pr", 2, model.ChangeInfo{})
+		require.ErrorIs(t, err, ErrVersionMismatch)
+	})
+
 	t.Run("Bad: update error", func(t *testing.T) {
+		expectTx(repo)
+
 		pr := model.PullRequest{ID: "pr", Status: model.PRStatusOpen}
 		repo.EXPECT().
-			GetPullRequest(gomock.Any(), "pr").
+			GetPullRequestForUpdate(gomock.Any(), "pr").
 			Return(pr, nil)
 		repo.EXPECT().
 			UpdatePullRequestStatus(gomock.Any(), "pr", model.PRStatusMerged, gomock.Any()).
 			Return(model.PullRequest{}, errors.New("update error"))
 
-		_, err := service.MergePR(context.Background(), "pr")
+		_, err := service.MergePR(context.Background(), "pr", AnyVersion, model.ChangeInfo{})
 		require.Error(t, err)
 	})
 }
@@ -338,6 +496,8 @@ func TestReassignReviewer(t *testing.T) {
 	service := New(repo, slog.Default())
 
 	t.Run("Good: reassign", func(t *testing.T) {
+		expectTx(repo)
+
 		pr := model.PullRequest{
 			ID:        "pr",
 			AuthorID:  "author",
@@ -354,7 +514,7 @@ func TestReassignReviewer(t *testing.T) {
 		updated.Reviewers = []string{"new", "other"}
 
 		repo.EXPECT().
-			GetPullRequest(gomock.Any(), "pr").
+			GetPullRequestForUpdate(gomock.Any(), "pr").
 			Return(pr, nil)
 		repo.EXPECT().
 			GetUserByID(gomock.Any(), "old").
@@ -365,58 +525,96 @@ func TestReassignReviewer(t *testing.T) {
 		repo.EXPECT().
 			ReplaceReviewer(gomock.Any(), "pr", "old", "new").
 			Return(updated, nil)
-
-		result, replaced, err := service.ReassignReviewer(context.Background(), "pr", "old")
+		repo.EXPECT().
+			AppendAssignmentEvents(gomock.Any(), []model.AssignmentEvent{{
+				PullRequestID: "pr",
+				Type:          model.AssignmentEventReassigned,
+				OldReviewerID: "old",
+				NewReviewerID: "new",
+				ActorID:       "bot",
+				Reason:        "load balancing",
+			}}).
+			Return(nil)
+		expectOutboxEvent(t, repo, model.EventReviewerReassigned)
+
+		result, replaced, err := service.ReassignReviewer(
+			context.Background(),
+			"pr",
+			"old",
+			AnyVersion,
+			model.ChangeInfo{ActorID: "bot", Reason: "load balancing"},
+		)
 		require.NoError(t, err)
 		require.Equal(t, "new", replaced)
 		require.Equal(t, updated, result)
 	})
 
 	t.Run("Bad: get PR error", func(t *testing.T) {
+		expectTx(repo)
+
 		repo.EXPECT().
-			GetPullRequest(gomock.Any(), "pr").
+			GetPullRequestForUpdate(gomock.Any(), "pr").
 			Return(model.PullRequest{}, errors.New("get error"))
 
-		_, _, err := service.ReassignReviewer(context.Background(), "pr", "old")
+		_, _, err := service.ReassignReviewer(context.Background(), "pr", "old", AnyVersion, model.ChangeInfo{})
 		require.Error(t, err)
 	})
 
 	t.Run("Bad: already merged", func(t *testing.T) {
+		expectTx(repo)
+
 		repo.EXPECT().
-			GetPullRequest(gomock.Any(), "pr").
+			GetPullRequestForUpdate(gomock.Any(), "pr").
 			Return(model.PullRequest{Status: model.PRStatusMerged}, nil)
 
-		_, _, err := service.ReassignReviewer(context.Background(), "pr", "old")
+		_, _, err := service.ReassignReviewer(context.Background(), "pr", "old", AnyVersion, model.ChangeInfo{})
 		require.ErrorIs(t, err, ErrPRMerged)
 	})
 
+	t.Run("Bad: version mismatch", func(t *testing.T) {
+		expectTx(repo)
+
+		repo.EXPECT().
+			GetPullRequestForUpdate(gomock.Any(), "pr").
+			Return(model.PullRequest{Status: model.PRStatusOpen, Reviewers: []string{"old"}, Version: 2}, nil)
+
+		_, _, err := service.ReassignReviewer(context.Background(), "pr", "old", 1, model.ChangeInfo{})
+		require.ErrorIs(t, err, ErrVersionMismatch)
+	})
+
 	t.Run("Bad: reviewer not assigned", func(t *testing.T) {
+		expectTx(repo)
+
 		repo.EXPECT().
-			GetPullRequest(gomock.Any(), "pr").
+			GetPullRequestForUpdate(gomock.Any(), "pr").
 			Return(model.PullRequest{Status: model.PRStatusOpen, Reviewers: []string{"other"}}, nil)
 
-		_, _, err := service.ReassignReviewer(context.Background(), "pr", "old")
+		_, _, err := service.ReassignReviewer(context.Background(), "pr", "old", AnyVersion, model.ChangeInfo{})
 		require.ErrorIs(t, err, ErrReviewerNotAssigned)
 	})
 
 	t.Run("Bad: get reviewer error", func(t *testing.T) {
+		expectTx(repo)
+
 		pr := model.PullRequest{Status: model.PRStatusOpen, Reviewers: []string{"old"}}
 		repo.EXPECT().
-			GetPullRequest(gomock.Any(), "pr").
+			GetPullRequestForUpdate(gomock.Any(), "pr").
 			Return(pr, nil)
 		repo.EXPECT().
 			GetUserByID(gomock.Any(), "old").
 			Return(model.User{}, errors.New("user error"))
 
-		_, _, err := service.ReassignReviewer(context.Background(), "pr", "old")
+		_, _, err := service.ReassignReviewer(context.Background(), "pr", "old", AnyVersion, model.ChangeInfo{})
 		require.Error(t, err)
 	})
 
 	t.Run("Bad: list members error", func(t *testing.T) {
+		expectTx(repo)
+
 		pr := model.PullRequest{Status: model.PRStatusOpen, Reviewers: []string{"old"}}
 		reviewer := model.User{ID: "old", TeamName: "team"}
 		repo.EXPECT().
-			GetPullRequest(gomock.Any(), "pr").
+			GetPullRequestForUpdate(gomock.Any(), "pr").
 			Return(pr, nil)
 		repo.EXPECT().
 			GetUserByID(gomock.Any(), "old").
@@ -425,11 +623,13 @@ func TestReassignReviewer(t *testing.T) {
 			ListTeamMembers(gomock.Any(), "team").
 			Return(nil, errors.New("list error"))
 
-		_, _, err := service.ReassignReviewer(context.Background(), "pr", "old")
+		_, _, err := service.ReassignReviewer(context.Background(), "pr", "old", AnyVersion, model.ChangeInfo{})
 		require.Error(t, err)
 	})
 
 	t.Run("Bad: no candidates", func(t *testing.T) {
+		expectTx(repo)
+
 		pr := model.PullRequest{AuthorID: "author", Status: model.PRStatusOpen, Reviewers: []string{"old"}}
 		reviewer := model.User{ID: "old", TeamName: "team"}
 		members := []model.User{
@@ -438,7 +638,7 @@ func TestReassignReviewer(t *testing.T) {
 		}
 
 		repo.EXPECT().
-			GetPullRequest(gomock.Any(), "pr").
+			GetPullRequestForUpdate(gomock.Any(), "pr").
 			Return(pr, nil)
 		repo.EXPECT().
 			GetUserByID(gomock.Any(), "old").
@@ -447,11 +647,13 @@ func TestReassignReviewer(t *testing.T) {
 			ListTeamMembers(gomock.Any(), "team").
 			Return(members, nil)
 
-		_, _, err := service.ReassignReviewer(context.Background(), "pr", "old")
+		_, _, err := service.ReassignReviewer(context.Background(), "pr", "old", AnyVersion, model.ChangeInfo{})
 		require.ErrorIs(t, err, ErrNoReplacementCandidate)
 	})
 
 	t.Run("Bad: replace error", func(t *testing.T) {
+		expectTx(repo)
+
 		pr := model.PullRequest{AuthorID: "author", Status: model.PRStatusOpen, Reviewers: []string{"old"}}
 		reviewer := model.User{ID: "old", TeamName: "team"}
 		members := []model.User{
@@ -460,7 +662,7 @@ func TestReassignReviewer(t *testing.T) {
 		}
 
 		repo.EXPECT().
-			GetPullRequest(gomock.Any(), "pr").
+			GetPullRequestForUpdate(gomock.Any(), "pr").
 			Return(pr, nil)
 		repo.EXPECT().
 			GetUserByID(gomock.Any(), "old").
@@ -472,35 +674,95 @@ func TestReassignReviewer(t *testing.T) {
 			ReplaceReviewer(gomock.Any(), "pr", "old", "new").
 			Return(model.PullRequest{}, errors.New("replace error"))
 
-		_, _, err := service.ReassignReviewer(context.Background(), "pr", "old")
+		_, _, err := service.ReassignReviewer(context.Background(), "pr", "old", AnyVersion, model.ChangeInfo{})
 		require.Error(t, err)
 	})
 }
 
-func TestListReviewerStats(t *testing.T) {
+func TestReassignReviewerConflict(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
 
 	repo := mocks_repository.NewMockRepository(ctrl)
 	service := New(repo, slog.Default())
 
-	expected := []model.ReviewerStat{
-		{UserID: "u1", Username: "alice", TeamName: "team", TotalAssigned: 3, OpenAssigned: 1},
+	pr := model.PullRequest{AuthorID: "author", Status: model.PRStatusOpen, Reviewers: []string{"old"}}
+	reviewer := model.User{ID: "old", TeamName: "team"}
+	members := []model.User{
+		{ID: "old", TeamName: "team", IsActive: true},
+		{ID: "new", TeamName: "team", IsActive: true},
 	}
 
-	repo.EXPECT().
-		ListReviewerStats(gomock.Any()).
-		Return(expected, nil)
+	t.Run("Bad: reviewer assigned concurrently", func(t *testing.T) {
+		expectTx(repo)
+
+		repo.EXPECT().
+			GetPullRequestForUpdate(gomock.Any(), "pr").
+			Return(pr, nil)
+		repo.EXPECT().
+			GetUserByID(gomock.Any(), "old").
+			Return(reviewer, nil)
+		repo.EXPECT().
+			ListTeamMembers(gomock.Any(), "team").
+			Return(members, nil)
+		repo.EXPECT().
+			ReplaceReviewer(gomock.Any(), "pr", "old", "new").
+			Return(model.PullRequest{}, repository.ErrAlreadyExists)
+
+		_, _, err := service.ReassignReviewer(context.Background(), "pr", "old", AnyVersion, model.ChangeInfo{})
+		require.ErrorIs(t, err, ErrConflict)
+	})
+
+	t.Run("Bad: transaction conflict", func(t *testing.T) {
+		repo.EXPECT().
+			InTx(gomock.Any(), gomock.Any()).
+			Return(fmt.Errorf("%w: deadlock detected", repository.ErrConflict))
 
-	stats, err := service.ListReviewerStats(context.Background())
+		_, _, err := service.ReassignReviewer(context.Background(), "pr", "old", AnyVersion, model.ChangeInfo{})
+		require.ErrorIs(t, err, ErrConflict)
+	})
+}
+
+func TestListReviewerStats(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	repo := mocks_repository.NewMockRepository(ctrl)
+	service := New(repo, slog.Default())
+
+	from := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+	filter := model.StatsFilter{From: &from, TeamName: "team"}
+
+	lastAssigned := time.Now().Add(-(3*24 + 1) * time.Hour)
+
+	repo.EXPECT().
+		ListReviewerStats(gomock.Any(), filter).
+		Return([]model.ReviewerStat{
+			{
+				UserID:         "u1",
+				Username:       "alice",
+				TeamName:       "team",
+				IsActive:       true,
+				TotalAssigned:  3,
+				OpenAssigned:   1,
+				LastAssignedAt: &lastAssigned,
+			},
+			{UserID: "u2", Username: "bob", TeamName: "team", IsActive: true},
+		}, nil)
+
+	stats, err := service.ListReviewerStats(context.Background(), filter)
 	require.NoError(t, err)
-	require.Equal(t, expected, stats)
+	require.Len(t, stats, 2)
+	require.Equal(t, 3, stats[0].TotalAssigned)
+	require.NotNil(t, stats[0].DaysSinceLastReview)
+	require.Equal(t, 3, *stats[0].DaysSinceLastReview)
+	require.Nil(t, stats[1].DaysSinceLastReview, "u2 has never been assigned")
 
 	repo.EXPECT().
-		ListReviewerStats(gomock.Any()).
+		ListReviewerStats(gomock.Any(), gomock.Any()).
 		Return(nil, errors.New("boom"))
 
-	_, err = service.ListReviewerStats(context.Background())
+	_, err = service.ListReviewerStats(context.Background(), filter)
 	require.Error(t, err)
 }
 
@@ -511,6 +773,9 @@ func TestGetPullRequestStats(t *testing.T) {
 	repo := mocks_repository.NewMockRepository(ctrl)
 	service := New(repo, slog.Default())
 
+	to := time.Date(2025, 3, 15, 0, 0, 0, 0, time.UTC)
+	filter := model.StatsFilter{To: &to}
+
 	expected := model.PullRequestStats{
 		Total:         2,
 		Open:          1,
@@ -519,17 +784,352 @@ func TestGetPullRequestStats(t *testing.T) {
 	}
 
 	repo.EXPECT().
-		GetPullRequestStats(gomock.Any()).
+		GetPullRequestStats(gomock.Any(), filter).
 		Return(expected, nil)
 
-	stats, err := service.GetPullRequestStats(context.Background())
+	stats, err := service.GetPullRequestStats(context.Background(), filter)
 	require.NoError(t, err)
 	require.Equal(t, expected, stats)
 
 	repo.EXPECT().
-		GetPullRequestStats(gomock.Any()).
+		GetPullRequestStats(gomock.Any(), gomock.Any()).
 		Return(model.PullRequestStats{}, errors.New("boom"))
 
-	_, err = service.GetPullRequestStats(context.Background())
+	_, err = service.GetPullRequestStats(context.Background(), filter)
 	require.Error(t, err)
 }
+
+func TestListTeamStats(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	repo := mocks_repository.NewMockRepository(ctrl)
+	service := New(repo, slog.Default())
+
+	filter := model.StatsFilter{TeamName: "backend"}
+
+	expected := []model.TeamStat{{
+		TeamName:         "backend",
+		OpenPRs:          2,
+		UnderstaffedPRs:  1,
+		ActiveMembers:    3,
+		MaxOpenAssigned:  2,
+		MeanOpenAssigned: 1,
+	}}
+
+	repo.EXPECT().
+		ListTeamStats(gomock.Any(), filter).
+		Return(expected, nil)
+
+	stats, err := service.ListTeamStats(context.Background(), filter)
+	require.NoError(t, err)
+	require.Equal(t, expected, stats)
+
+	repo.EXPECT().
+		ListTeamStats(gomock.Any(), gomock.Any()).
+		Return(nil, errors.New("boom"))
+
+	_, err = service.ListTeamStats(context.Background(), filter)
+	require.Error(t, err)
+}
+
+func TestCountOpenPullRequests(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	repo := mocks_repository.NewMockRepository(ctrl)
+	service := New(repo, slog.Default())
+
+	expected := []model.TeamCount{{TeamName: "backend", Count: 2}, {TeamName: "ops"}}
+
+	repo.EXPECT().
+		CountOpenPullRequests(gomock.Any()).
+		Return(expected, nil)
+
+	counts, err := service.CountOpenPullRequests(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, expected, counts)
+
+	repo.EXPECT().
+		CountOpenPullRequests(gomock.Any()).
+		Return(nil, errors.New("boom"))
+
+	_, err = service.CountOpenPullRequests(context.Background())
+	require.Error(t, err)
+}
+
+func TestReviewFairness(t *testing.T) {
+	ctx := context.Background()
+
+	setup := func(t *testing.T) (*Service, *mocks_repository.MockRepository) {
+		t.Helper()
+
+		ctrl := gomock.NewController(t)
+		repo := mocks_repository.NewMockRepository(ctrl)
+
+		return New(repo, slog.Default()), repo
+	}
+
+	t.Run("Good: only active members count", func(t *testing.T) {
+		service, repo := setup(t)
+		filter := model.StatsFilter{TeamName: "backend"}
+
+		repo.EXPECT().
+			ListReviewerStats(gomock.Any(), filter).
+			Return([]model.ReviewerStat{
+				{
+					UserID:        "u4",
+					Username:      "dave",
+					TeamName:      "backend",
+					IsActive:      true,
+					TotalAssigned: 4,
+					OpenAssigned:  2,
+				},
+				{UserID: "u1", Username: "alice", TeamName: "backend", IsActive: true},
+				{UserID: "u2", Username: "bob", TeamName: "backend", IsActive: true},
+				{UserID: "u3", Username: "carol", TeamName: "backend", IsActive: true},
+				{UserID: "u5", Username: "eve", TeamName: "backend"},
+			}, nil).
+			Times(2)
+
+		fairness, err := service.ReviewFairness(ctx, filter, 1.5)
+		require.NoError(t, err)
+		require.Len(t, fairness, 1)
+
+		team := fairness[0]
+		require.Equal(t, "backend", team.TeamName)
+		require.Equal(t, 4, team.ActiveMembers)
+		require.InDelta(t, 1, team.TotalAssigned.Mean, 1e-9)
+		require.InDelta(t, math.Sqrt(3), team.TotalAssigned.StdDev, 1e-9)
+		require.InDelta(t, 0.75, team.TotalAssigned.Gini, 1e-9)
+		require.InDelta(t, 0.5, team.OpenAssigned.Mean, 1e-9)
+		require.InDelta(t, 0.75, team.OpenAssigned.Gini, 1e-9)
+
+		require.Len(t, team.Outliers, 1)
+		require.Equal(t, "u4", team.Outliers[0].UserID)
+		require.InDelta(t, math.Sqrt(3), team.Outliers[0].TotalScore, 1e-9)
+
+		fairness, err = service.ReviewFairness(ctx, filter, 2)
+		require.NoError(t, err)
+		require.Empty(t, fairness[0].Outliers, "u4 is within two standard deviations")
+	})
+
+	t.Run("Good: equal load is fair", func(t *testing.T) {
+		service, repo := setup(t)
+
+		repo.EXPECT().
+			ListReviewerStats(gomock.Any(), model.StatsFilter{}).
+			Return([]model.ReviewerStat{
+				{UserID: "u1", TeamName: "backend", IsActive: true, TotalAssigned: 2, OpenAssigned: 1},
+				{UserID: "u2", TeamName: "backend", IsActive: true, TotalAssigned: 2, OpenAssigned: 1},
+				{UserID: "u3", TeamName: "frontend"},
+			}, nil)
+
+		fairness, err := service.ReviewFairness(ctx, model.StatsFilter{}, 2)
+		require.NoError(t, err)
+		require.Len(t, fairness, 1, "frontend has no active members")
+		require.Zero(t, fairness[0].TotalAssigned.Gini)
+		require.Zero(t, fairness[0].TotalAssigned.StdDev)
+		require.Empty(t, fairness[0].Outliers)
+	})
+
+	t.Run("Bad: stats fail", func(t *testing.T) {
+		service, repo := setup(t)
+
+		repo.EXPECT().
+			ListReviewerStats(gomock.Any(), gomock.Any()).
+			Return(nil, errors.New("boom"))
+
+		_, err := service.ReviewFairness(ctx, model.StatsFilter{}, 2)
+		require.Error(t, err)
+	})
+}
+
+func TestListTimeseries(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	repo := mocks_repository.NewMockRepository(ctrl)
+	service := New(repo, slog.Default())
+
+	filter := model.StatsFilter{TeamName: "backend"}
+	week := func(day int) time.Time { return time.Date(2025, 3, day, 0, 0, 0, 0, time.UTC) }
+
+	repo.EXPECT().
+		ListTimeseries(gomock.Any(), model.MetricPRsMerged, model.BucketWeek, filter).
+		Return([]model.TimeseriesPoint{
+			{Start: week(3), Count: 2},
+			{Start: week(24), Count: 1},
+		}, nil)
+
+	points, err := service.ListTimeseries(
+		context.Background(), model.MetricPRsMerged, model.BucketWeek, filter,
+	)
+	require.NoError(t, err)
+	require.Equal(t, []model.TimeseriesPoint{
+		{Start: week(3), Count: 2},
+		{Start: week(10)},
+		{Start: week(17)},
+		{Start: week(24), Count: 1},
+	}, points, "empty weeks are filled with zeros")
+
+	repo.EXPECT().
+		ListTimeseries(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+		Return(nil, errors.New("boom"))
+
+	_, err = service.ListTimeseries(
+		context.Background(), model.MetricAssignments, model.BucketDay, filter,
+	)
+	require.Error(t, err)
+}
+
+func TestGetPullRequestHistory(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	repo := mocks_repository.NewMockRepository(ctrl)
+	service := New(repo, slog.Default())
+
+	t.Run("Good: events", func(t *testing.T) {
+		expected := []model.AssignmentEvent{
+			{ID: 1, PullRequestID: "pr", Type: model.AssignmentEventCreated, NewReviewerID: "u1"},
+			{ID: 2, PullRequestID: "pr", Type: model.AssignmentEventMerged},
+		}
+
+		repo.EXPECT().
+			GetPullRequest(gomock.Any(), "pr").
+			Return(model.PullRequest{ID: "pr"}, nil)
+		repo.EXPECT().
+			ListAssignmentEvents(gomock.Any(), "pr").
+			Return(expected, nil)
+
+		events, err := service.GetPullRequestHistory(context.Background(), "pr")
+		require.NoError(t, err)
+		require.Equal(t, expected, events)
+	})
+
+	t.Run("Bad: unknown PR", func(t *testing.T) {
+		repo.EXPECT().
+			GetPullRequest(gomock.Any(), "missing").
+			Return(model.PullRequest{}, repository.ErrNotFound)
+
+		_, err := service.GetPullRequestHistory(context.Background(), "missing")
+		require.ErrorIs(t, err, repository.ErrNotFound)
+	})
+}
+
+func TestSubscribeEvents(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	repo := mocks_repository.NewMockRepository(ctrl)
+	service := New(repo, slog.Default())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	repo.EXPECT().
+		GetTeamByName(gomock.Any(), "team").
+		Return(model.Team{Name: "team"}, nil)
+	repo.EXPECT().
+		ListTeamMembers(gomock.Any(), "team").
+		Return([]model.User{{ID: "u1", TeamName: "team"}}, nil)
+
+	_, events, err := service.SubscribeEvents(ctx, model.StreamFilter{TeamName: "team"}, 0)
+	require.NoError(t, err)
+
+	t.Run("Good: rolled back changes are not streamed", func(t *testing.T) {
+		expectTx(repo)
+		repo.EXPECT().
+			SetUserActivity(gomock.Any(), "u1", true).
+			Return(model.User{}, errors.New("db error"))
+
+		_, err := service.SetUserActive(ctx, "u1", true, model.ChangeInfo{})
+		require.Error(t, err)
+		require.Empty(t, events)
+	})
+
+	t.Run("Good: committed changes are streamed", func(t *testing.T) {
+		for _, userID := range []string{"stranger", "u1"} {
+			expectTx(repo)
+			repo.EXPECT().
+				SetUserActivity(gomock.Any(), userID, true).
+				Return(model.User{ID: userID, IsActive: true}, nil)
+
+			_, err := service.SetUserActive(ctx, userID, true, model.ChangeInfo{ActorID: "lead"})
+			require.NoError(t, err)
+		}
+
+		event := <-events
+		require.Equal(t, model.EventUserActivityChanged, event.Type)
+		require.JSONEq(t,
+			`{"user":{"user_id":"u1","username":"","team_name":"","is_active":true},"actor_id":"lead"}`,
+			string(event.Payload),
+		)
+		require.Empty(t, events, "events of other teams are filtered out")
+	})
+
+	t.Run("Bad: unknown team", func(t *testing.T) {
+		repo.EXPECT().
+			GetTeamByName(gomock.Any(), "missing").
+			Return(model.Team{}, repository.ErrNotFound)
+
+		_, _, err := service.SubscribeEvents(ctx, model.StreamFilter{TeamName: "missing"}, 0)
+		require.ErrorIs(t, err, repository.ErrNotFound)
+	})
+}
+
+func expectTx(repo *mocks_repository.MockRepository) {
+	repo.EXPECT().
+		InTx(gomock.Any(), gomock.Any()).
+		DoAndReturn(func(ctx context.Context, fn func(context.Context) error) error {
+			return fn(ctx)
+		})
+}
+
+func expectOutboxEvent(
+	t *testing.T,
+	repo *mocks_repository.MockRepository,
+	eventType model.DomainEventType,
+) {
+	t.Helper()
+
+	repo.EXPECT().
+		AppendOutboxEvents(gomock.Any(), gomock.Any()).
+		DoAndReturn(func(_ context.Context, events []model.OutboxEvent) error {
+			require.Len(t, events, 1)
+			require.Equal(t, eventType, events[0].Type)
+			require.True(t, json.Valid(events[0].Payload))
+
+			return nil
+		})
+}
+
+func TestReviewDigest(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	repo := mocks_repository.NewMockRepository(ctrl)
+	service := New(repo, slog.Default())
+
+	created := time.Date(2025, 1, 1, 9, 0, 0, 0, time.UTC)
+
+	t.Run("Good: open reviews with their assignment time", func(t *testing.T) {
+		expected := []model.DigestItem{
+			{PullRequest: model.PullRequest{ID: "pr-2"}, AssignedAt: created},
+			{PullRequest: model.PullRequest{ID: "pr-1"}, AssignedAt: created.Add(3 * time.Hour)},
+		}
+		repo.EXPECT().ListOpenReviews(gomock.Any(), "u2").Return(expected, nil)
+
+		items, err := service.ReviewDigest(context.Background(), "u2")
+		require.NoError(t, err)
+		require.Equal(t, expected, items)
+	})
+
+	t.Run("Bad: repository error", func(t *testing.T) {
+		repo.EXPECT().ListOpenReviews(gomock.Any(), "u2").Return(nil, errors.New("db down"))
+
+		_, err := service.ReviewDigest(context.Background(), "u2")
+		require.Error(t, err)
+	})
+}
@@ -3,28 +3,124 @@ package usecase
 import (
 	"context"
 	"fmt"
+	"time"
 
 	"github.com/6ermvH/avito-reviewchecker/internal/model"
 )
 
-func (s *Service) ListReviewerStats(ctx context.Context) ([]model.ReviewerStat, error) {
-	s.logger.Debug("list reviewer stats")
+// ListReviewerStats counts the assignments made within the window of filter
+// per user of the filtered team, users without assignments included.
+func (s *Service) ListReviewerStats(
+	ctx context.Context,
+	filter model.StatsFilter,
+) ([]model.ReviewerStat, error) {
+	s.logger.Debug(
+		"list reviewer stats", "from", filter.From, "to", filter.To, "team", filter.TeamName,
+	)
 
-	stats, err := s.repo.ListReviewerStats(ctx)
+	stats, err := s.repo.ListReviewerStats(ctx, filter)
 	if err != nil {
 		return nil, fmt.Errorf("list reviewer stats: %w", err)
 	}
 
+	now := time.Now()
+
+	for i, stat := range stats {
+		if stat.LastAssignedAt != nil {
+			days := int(now.Sub(*stat.LastAssignedAt) / (24 * time.Hour))
+			stats[i].DaysSinceLastReview = &days
+		}
+	}
+
 	return stats, nil
 }
 
-func (s *Service) GetPullRequestStats(ctx context.Context) (model.PullRequestStats, error) {
-	s.logger.Debug("get pull request stats")
+// GetPullRequestStats aggregates the pull requests of authors of the filtered
+// team created within the window of filter. Merged and the time to merge
+// percentiles count those merged within the window instead.
+func (s *Service) GetPullRequestStats(
+	ctx context.Context,
+	filter model.StatsFilter,
+) (model.PullRequestStats, error) {
+	s.logger.Debug(
+		"get pull request stats", "from", filter.From, "to", filter.To, "team", filter.TeamName,
+	)
 
-	stats, err := s.repo.GetPullRequestStats(ctx)
+	stats, err := s.repo.GetPullRequestStats(ctx, filter)
 	if err != nil {
 		return model.PullRequestStats{}, fmt.Errorf("get pull request stats: %w", err)
 	}
 
 	return stats, nil
 }
+
+// ListTeamStats describes every team, or the filtered one, by the pull
+// requests its members authored within the window of filter and by the
+// current review load of its members.
+func (s *Service) ListTeamStats(
+	ctx context.Context,
+	filter model.StatsFilter,
+) ([]model.TeamStat, error) {
+	s.logger.Debug(
+		"list team stats", "from", filter.From, "to", filter.To, "team", filter.TeamName,
+	)
+
+	stats, err := s.repo.ListTeamStats(ctx, filter)
+	if err != nil {
+		return nil, fmt.Errorf("list team stats: %w", err)
+	}
+
+	return stats, nil
+}
+
+// CountOpenPullRequests counts the open pull requests of every team by the
+// team of the author, regardless of when they were created.
+func (s *Service) CountOpenPullRequests(ctx context.Context) ([]model.TeamCount, error) {
+	counts, err := s.repo.CountOpenPullRequests(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("count open pull requests: %w", err)
+	}
+
+	return counts, nil
+}
+
+// ListTimeseries counts metric per bucket within the window and team of
+// filter. Buckets between the first and the last event without any are
+// returned with a zero count, so charts do not skip them.
+func (s *Service) ListTimeseries(
+	ctx context.Context,
+	metric model.TimeseriesMetric,
+	bucket model.TimeseriesBucket,
+	filter model.StatsFilter,
+) ([]model.TimeseriesPoint, error) {
+	s.logger.Debug(
+		"list timeseries",
+		"metric", metric,
+		"bucket", bucket,
+		"from", filter.From,
+		"to", filter.To,
+		"team", filter.TeamName,
+	)
+
+	points, err := s.repo.ListTimeseries(ctx, metric, bucket, filter)
+	if err != nil {
+		return nil, fmt.Errorf("list %s timeseries: %w", metric, err)
+	}
+
+	if len(points) == 0 {
+		return points, nil
+	}
+
+	filled := []model.TimeseriesPoint{points[0]}
+
+	for _, point := range points[1:] {
+		last := filled[len(filled)-1].Start
+		for start := bucket.Next(last); start.Before(point.Start); start = bucket.Next(start) {
+			filled = append(filled, model.TimeseriesPoint{Start: start})
+		}
+
+		filled = append(filled, point)
+	}
+
+	return filled, nil
+}
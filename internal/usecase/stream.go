@@ -0,0 +1,140 @@
+package usecase
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/6ermvH/avito-reviewchecker/internal/model"
+)
+
+// streamHistorySize is how many recent events are kept for Last-Event-ID
+// resume.
+const streamHistorySize = 1000
+
+type pendingStreamKey struct{}
+
+// pendingStream collects the stream events of a transaction until it commits.
+type pendingStream struct {
+	events []model.StreamEvent
+}
+
+type userEventPayload struct {
+	User    userPayload `json:"user"`
+	ActorID string      `json:"actor_id,omitempty"`
+	Reason  string      `json:"reason,omitempty"`
+}
+
+type userPayload struct {
+	ID       string `json:"user_id"`
+	Username string `json:"username"`
+	TeamName string `json:"team_name"`
+	IsActive bool   `json:"is_active"`
+}
+
+// SubscribeEvents returns the retained events after lastEventID matching
+// filter and a channel of new ones, closed when ctx is done. The team filter
+// matches events concerning anyone who is a member when the subscription
+// starts.
+func (s *Service) SubscribeEvents(
+	ctx context.Context,
+	filter model.StreamFilter,
+	lastEventID int64,
+) ([]model.StreamEvent, <-chan model.StreamEvent, error) {
+	s.logger.Debug("subscribe events", "filter", filter, "lastEventID", lastEventID)
+
+	var members map[string]struct{}
+
+	if filter.TeamName != "" {
+		_, users, err := s.GetTeam(ctx, filter.TeamName)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		members = make(map[string]struct{}, len(users))
+		for _, user := range users {
+			members[user.ID] = struct{}{}
+		}
+	}
+
+	match := func(event model.StreamEvent) bool {
+		if filter.UserID != "" && !event.Involves(filter.UserID) {
+			return false
+		}
+
+		if members == nil {
+			return true
+		}
+
+		for _, userID := range event.UserIDs {
+			if _, ok := members[userID]; ok {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	backlog, events := s.stream.Subscribe(ctx, lastEventID, match)
+
+	return backlog, events, nil
+}
+
+// inTx runs fn in a repository transaction and publishes the stream events
+// recorded by fn once the outermost transaction commits, so subscribers never
+// see changes that were rolled back.
+func (s *Service) inTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	if _, ok := ctx.Value(pendingStreamKey{}).(*pendingStream); ok {
+		return s.repo.InTx(ctx, fn)
+	}
+
+	pending := &pendingStream{}
+
+	if err := s.repo.InTx(context.WithValue(ctx, pendingStreamKey{}, pending), fn); err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	s.stream.Publish(pending.events...)
+
+	return nil
+}
+
+// record queues event for publishing after the current transaction commits.
+func (s *Service) record(ctx context.Context, event model.StreamEvent) {
+	pending, ok := ctx.Value(pendingStreamKey{}).(*pendingStream)
+	if !ok {
+		s.stream.Publish(event)
+
+		return
+	}
+
+	pending.events = append(pending.events, event)
+}
+
+func (s *Service) recordUserActivity(
+	ctx context.Context,
+	user model.User,
+	info model.ChangeInfo,
+) error {
+	payload, err := json.Marshal(userEventPayload{
+		User: userPayload{
+			ID:       user.ID,
+			Username: user.Username,
+			TeamName: user.TeamName,
+			IsActive: user.IsActive,
+		},
+		ActorID: info.ActorID,
+		Reason:  info.Reason,
+	})
+	if err != nil {
+		return fmt.Errorf("encode %s event: %w", model.EventUserActivityChanged, err)
+	}
+
+	s.record(ctx, model.StreamEvent{
+		Type:    model.EventUserActivityChanged,
+		UserIDs: []string{user.ID},
+		Payload: payload,
+	})
+
+	return nil
+}
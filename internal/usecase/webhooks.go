@@ -0,0 +1,100 @@
+package usecase
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/6ermvH/avito-reviewchecker/internal/model"
+)
+
+const (
+	subscriptionIDBytes     = 8
+	subscriptionSecretBytes = 32
+	defaultDeliveryLimit    = 100
+)
+
+// CreateWebhookSubscription registers url for events of eventTypes, or for
+// all events when eventTypes is empty. A random secret is generated when
+// secret is empty.
+func (s *Service) CreateWebhookSubscription(
+	ctx context.Context,
+	url, secret string,
+	eventTypes []model.DomainEventType,
+) (model.WebhookSubscription, error) {
+	s.logger.Debug("create webhook subscription", "url", url, "eventTypes", eventTypes)
+
+	id, err := randomHex(subscriptionIDBytes)
+	if err != nil {
+		return model.WebhookSubscription{}, err
+	}
+
+	if secret == "" {
+		if secret, err = randomHex(subscriptionSecretBytes); err != nil {
+			return model.WebhookSubscription{}, err
+		}
+	}
+
+	sub, err := s.repo.CreateWebhookSubscription(ctx, model.WebhookSubscription{
+		ID:         "wh_" + id,
+		URL:        url,
+		Secret:     secret,
+		EventTypes: eventTypes,
+	})
+	if err != nil {
+		return model.WebhookSubscription{}, fmt.Errorf("create webhook subscription: %w", err)
+	}
+
+	return sub, nil
+}
+
+func (s *Service) ListWebhookSubscriptions(
+	ctx context.Context,
+) ([]model.WebhookSubscription, error) {
+	s.logger.Debug("list webhook subscriptions")
+
+	subs, err := s.repo.ListWebhookSubscriptions(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("list webhook subscriptions: %w", err)
+	}
+
+	return subs, nil
+}
+
+func (s *Service) DeleteWebhookSubscription(ctx context.Context, id string) error {
+	s.logger.Debug("delete webhook subscription", "id", id)
+
+	if err := s.repo.DeleteWebhookSubscription(ctx, id); err != nil {
+		return fmt.Errorf("delete webhook subscription %q: %w", id, err)
+	}
+
+	return nil
+}
+
+func (s *Service) ListWebhookDeliveries(
+	ctx context.Context,
+	filter model.DeliveryFilter,
+) ([]model.WebhookDelivery, error) {
+	s.logger.Debug("list webhook deliveries", "filter", filter)
+
+	if filter.Limit <= 0 || filter.Limit > defaultDeliveryLimit {
+		filter.Limit = defaultDeliveryLimit
+	}
+
+	deliveries, err := s.repo.ListWebhookDeliveries(ctx, filter)
+	if err != nil {
+		return nil, fmt.Errorf("list webhook deliveries: %w", err)
+	}
+
+	return deliveries, nil
+}
+
+func randomHex(size int) (string, error) {
+	buf := make([]byte, size)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("generate random id: %w", err)
+	}
+
+	return hex.EncodeToString(buf), nil
+}
@@ -0,0 +1,77 @@
+package webhook
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"syscall"
+	"time"
+)
+
+// dialTimeout bounds connecting to a subscriber, the request is bounded by
+// Config.Timeout.
+const dialTimeout = 10 * time.Second
+
+var errForbiddenAddress = errors.New("address is not allowed for webhooks")
+
+// sharedAddressSpace is the carrier-grade NAT range, used by some clouds for
+// their metadata services.
+var sharedAddressSpace = netip.MustParsePrefix("100.64.0.0/10")
+
+// NewClient returns the client deliveries are sent with. Subscriptions are
+// registered by any caller, so unless allowPrivate is set the client refuses
+// to connect to loopback, private, link-local and other non-public addresses.
+// The check runs on the resolved address of every connection, so DNS names
+// pointing inside the network are refused too. Proxies from the environment
+// are not used and redirects are not followed, a redirect fails the attempt.
+func NewClient(allowPrivate bool) *http.Client {
+	dialer := &net.Dialer{Timeout: dialTimeout}
+	if !allowPrivate {
+		dialer.Control = denyNonPublic
+	}
+
+	//nolint:forcetypeassert
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+
+	return &http.Client{
+		Transport: transport,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// denyNonPublic is a net.Dialer Control function failing connections to
+// addresses that are not publicly routable.
+func denyNonPublic(_, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return fmt.Errorf("parse address %q: %w", address, err)
+	}
+
+	ip, err := netip.ParseAddr(host)
+	if err != nil {
+		return fmt.Errorf("parse address %q: %w", address, err)
+	}
+
+	if !isPublic(ip.Unmap()) {
+		return fmt.Errorf("%w: %s", errForbiddenAddress, ip)
+	}
+
+	return nil
+}
+
+func isPublic(ip netip.Addr) bool {
+	return !ip.IsLoopback() &&
+		!ip.IsPrivate() &&
+		!ip.IsLinkLocalUnicast() &&
+		!ip.IsLinkLocalMulticast() &&
+		!ip.IsInterfaceLocalMulticast() &&
+		!ip.IsMulticast() &&
+		!ip.IsUnspecified() &&
+		!sharedAddressSpace.Contains(ip)
+}
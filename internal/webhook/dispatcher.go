@@ -0,0 +1,306 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/6ermvH/avito-reviewchecker/internal/model"
+	"github.com/6ermvH/avito-reviewchecker/internal/repository"
+)
+
+const (
+	EventHeader     = "X-Reviewchecker-Event"
+	DeliveryHeader  = "X-Reviewchecker-Delivery"
+	SignatureHeader = "X-Reviewchecker-Signature-256"
+
+	signaturePrefix = "sha256="
+)
+
+var errUnexpectedStatus = errors.New("unexpected status")
+
+// Store is the part of the repository the dispatcher works with.
+type Store interface {
+	InTx(ctx context.Context, fn func(ctx context.Context) error) error
+	ClaimOutboxEvents(ctx context.Context, limit int) ([]model.OutboxEvent, error)
+	MarkOutboxEventsDispatched(ctx context.Context, ids []int64) error
+	ListWebhookSubscriptions(ctx context.Context) ([]model.WebhookSubscription, error)
+	CreateWebhookDeliveries(ctx context.Context, deliveries []model.WebhookDelivery) error
+	ClaimDueDeliveries(
+		ctx context.Context,
+		now time.Time,
+		lease time.Duration,
+		limit int,
+	) ([]model.PendingDelivery, error)
+	UpdateWebhookDelivery(
+		ctx context.Context,
+		delivery model.WebhookDelivery,
+		leaseUntil time.Time,
+	) error
+}
+
+type Config struct {
+	PollInterval time.Duration
+	// Timeout bounds a single delivery attempt.
+	Timeout   time.Duration
+	BatchSize int
+	// MaxAttempts is the number of failed attempts after which a delivery
+	// becomes dead.
+	MaxAttempts int
+	BaseBackoff time.Duration
+	MaxBackoff  time.Duration
+}
+
+// Dispatcher moves outbox events into per-subscription deliveries and sends
+// them. Failed deliveries are retried with exponential backoff until
+// MaxAttempts is reached, then marked dead.
+type Dispatcher struct {
+	store  Store
+	client *http.Client
+	logger *slog.Logger
+	cfg    Config
+	now    func() time.Time
+}
+
+// envelope is the body of every webhook request.
+type envelope struct {
+	EventID   int64                 `json:"event_id"`
+	Type      model.DomainEventType `json:"type"`
+	CreatedAt time.Time             `json:"created_at"`
+	Data      json.RawMessage       `json:"data"`
+}
+
+func NewDispatcher(store Store, client *http.Client, logger *slog.Logger, cfg Config) *Dispatcher {
+	return &Dispatcher{
+		store:  store,
+		client: client,
+		logger: logger,
+		cfg:    cfg,
+		now:    time.Now,
+	}
+}
+
+// Run dispatches every PollInterval until ctx is done.
+func (d *Dispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.cfg.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := d.DispatchOnce(ctx); err != nil && ctx.Err() == nil {
+			d.logger.Error("dispatch webhooks", "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// DispatchOnce fans out one batch of outbox events and sends one batch of
+// due deliveries.
+func (d *Dispatcher) DispatchOnce(ctx context.Context) error {
+	if err := d.fanOut(ctx); err != nil {
+		return err
+	}
+
+	return d.deliverDue(ctx)
+}
+
+func (d *Dispatcher) fanOut(ctx context.Context) error {
+	err := d.store.InTx(ctx, func(ctx context.Context) error {
+		events, err := d.store.ClaimOutboxEvents(ctx, d.cfg.BatchSize)
+		if err != nil || len(events) == 0 {
+			return err
+		}
+
+		subs, err := d.store.ListWebhookSubscriptions(ctx)
+		if err != nil {
+			return err
+		}
+
+		now := d.now()
+		ids := make([]int64, 0, len(events))
+
+		var deliveries []model.WebhookDelivery
+
+		for _, event := range events {
+			ids = append(ids, event.ID)
+
+			for _, sub := range subs {
+				if !sub.Accepts(event.Type) {
+					continue
+				}
+
+				deliveries = append(deliveries, model.WebhookDelivery{
+					SubscriptionID: sub.ID,
+					EventID:        event.ID,
+					NextAttemptAt:  now,
+				})
+			}
+		}
+
+		if err := d.store.CreateWebhookDeliveries(ctx, deliveries); err != nil {
+			return err
+		}
+
+		return d.store.MarkOutboxEventsDispatched(ctx, ids)
+	})
+	if err != nil {
+		return fmt.Errorf("fan out outbox events: %w", err)
+	}
+
+	return nil
+}
+
+// deliverDue sends up to BatchSize due deliveries. They are claimed one at a
+// time, so the lease only has to outlive a single attempt: a delivery is
+// claimed again only if the dispatcher died or stalled past it, and the late
+// result of the stalled attempt is then dropped.
+func (d *Dispatcher) deliverDue(ctx context.Context) error {
+	lease := 2 * d.cfg.Timeout
+
+	for range d.cfg.BatchSize {
+		pending, err := d.store.ClaimDueDeliveries(ctx, d.now(), lease, 1)
+		if err != nil {
+			return fmt.Errorf("claim due deliveries: %w", err)
+		}
+
+		if len(pending) == 0 {
+			return nil
+		}
+
+		// claiming moved the next attempt to the end of the lease
+		leaseUntil := pending[0].Delivery.NextAttemptAt
+		delivery := d.attempt(ctx, pending[0])
+
+		err = d.store.UpdateWebhookDelivery(ctx, delivery, leaseUntil)
+		if errors.Is(err, repository.ErrLeaseLost) {
+			d.logger.Warn("webhook delivery was claimed again, dropping the attempt",
+				"deliveryID", delivery.ID,
+				"attempts", delivery.Attempts,
+			)
+
+			continue
+		}
+
+		if err != nil {
+			return fmt.Errorf("update delivery %d: %w", delivery.ID, err)
+		}
+	}
+
+	return nil
+}
+
+// attempt sends the delivery once and returns it with the outcome applied.
+func (d *Dispatcher) attempt(ctx context.Context, p model.PendingDelivery) model.WebhookDelivery {
+	delivery := p.Delivery
+	delivery.Attempts++
+
+	err := d.send(ctx, p)
+	if err == nil {
+		delivery.Status = model.DeliveryDelivered
+		delivery.LastError = ""
+
+		return delivery
+	}
+
+	delivery.LastError = err.Error()
+
+	if delivery.Attempts >= d.cfg.MaxAttempts {
+		delivery.Status = model.DeliveryDead
+
+		d.logger.Warn("webhook delivery is dead",
+			"deliveryID", delivery.ID,
+			"subscriptionID", delivery.SubscriptionID,
+			"attempts", delivery.Attempts,
+			"error", err,
+		)
+
+		return delivery
+	}
+
+	delivery.Status = model.DeliveryPending
+	delivery.NextAttemptAt = d.now().Add(d.backoff(delivery.Attempts))
+
+	return delivery
+}
+
+func (d *Dispatcher) send(ctx context.Context, p model.PendingDelivery) error {
+	body, err := json.Marshal(envelope{
+		EventID:   p.Event.ID,
+		Type:      p.Event.Type,
+		CreatedAt: p.Event.CreatedAt,
+		Data:      p.Event.Payload,
+	})
+	if err != nil {
+		return fmt.Errorf("encode event: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, d.cfg.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(
+		ctx,
+		http.MethodPost,
+		p.Subscription.URL,
+		bytes.NewReader(body),
+	)
+	if err != nil {
+		return fmt.Errorf("build request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventHeader, string(p.Event.Type))
+	req.Header.Set(DeliveryHeader, strconv.FormatInt(p.Delivery.ID, 10))
+	req.Header.Set(SignatureHeader, Sign(p.Subscription.Secret, body))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("send request: %w", err)
+	}
+	//nolint:errcheck
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusOK && resp.StatusCode < http.StatusMultipleChoices {
+		return nil
+	}
+
+	// the body is not kept: last_error is readable through the API, and the
+	// response may come from a service the caller could not reach otherwise
+	return fmt.Errorf("%w %d", errUnexpectedStatus, resp.StatusCode)
+}
+
+// backoff doubles the delay after every failed attempt, starting at
+// BaseBackoff and capped by MaxBackoff.
+func (d *Dispatcher) backoff(attempts int) time.Duration {
+	delay := d.cfg.BaseBackoff
+
+	for range attempts - 1 {
+		delay *= 2
+		if delay >= d.cfg.MaxBackoff {
+			return d.cfg.MaxBackoff
+		}
+	}
+
+	return min(delay, d.cfg.MaxBackoff)
+}
+
+// Sign returns the signature header value for body: the hex encoded
+// HMAC-SHA256 of body keyed with secret, prefixed with "sha256=".
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+
+	return signaturePrefix + hex.EncodeToString(mac.Sum(nil))
+}
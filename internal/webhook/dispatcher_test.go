@@ -0,0 +1,412 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/6ermvH/avito-reviewchecker/internal/model"
+	"github.com/6ermvH/avito-reviewchecker/internal/repository/memory"
+)
+
+type receiver struct {
+	mu       sync.Mutex
+	statuses []int
+	requests []*http.Request
+	bodies   [][]byte
+}
+
+func (rc *receiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	body, _ := io.ReadAll(r.Body)
+	rc.requests = append(rc.requests, r)
+	rc.bodies = append(rc.bodies, body)
+
+	status := http.StatusOK
+	if len(rc.statuses) > 0 {
+		status, rc.statuses = rc.statuses[0], rc.statuses[1:]
+	}
+
+	w.WriteHeader(status)
+
+	if status != http.StatusOK {
+		_, _ = w.Write([]byte("internal details"))
+	}
+}
+
+func TestDispatcher(t *testing.T) {
+	ctx := context.Background()
+
+	setup := func(t *testing.T, statuses ...int) (*memory.Repository, *Dispatcher, *receiver, *time.Time) {
+		t.Helper()
+
+		repo := memory.New()
+		_, err := repo.CreateTeam(ctx, "backend")
+		require.NoError(t, err)
+		require.NoError(t, repo.InsertTeamMembers(ctx, "backend", []model.User{
+			{ID: "author", Username: "Author", IsActive: true},
+		}))
+		_, err = repo.CreatePullRequest(ctx, model.PullRequest{
+			ID:       "pr-1",
+			Name:     "feature",
+			AuthorID: "author",
+			Status:   model.PRStatusOpen,
+		})
+		require.NoError(t, err)
+
+		rc := &receiver{statuses: statuses}
+		srv := httptest.NewServer(rc)
+		t.Cleanup(srv.Close)
+
+		_, err = repo.CreateWebhookSubscription(ctx, model.WebhookSubscription{
+			ID:     "wh_1",
+			URL:    srv.URL,
+			Secret: "secret",
+		})
+		require.NoError(t, err)
+
+		now := time.Now()
+		dispatcher := NewDispatcher(repo, srv.Client(), slog.New(slog.DiscardHandler), Config{
+			PollInterval: time.Second,
+			Timeout:      time.Second,
+			BatchSize:    10,
+			MaxAttempts:  3,
+			BaseBackoff:  time.Minute,
+			MaxBackoff:   90 * time.Second,
+		})
+		dispatcher.now = func() time.Time { return now }
+
+		return repo, dispatcher, rc, &now
+	}
+
+	publish := func(t *testing.T, repo *memory.Repository, eventType model.DomainEventType) {
+		t.Helper()
+
+		require.NoError(t, repo.AppendOutboxEvents(ctx, []model.OutboxEvent{{
+			Type:          eventType,
+			PullRequestID: "pr-1",
+			Payload:       json.RawMessage(`{"pull_request":{"pull_request_id":"pr-1"}}`),
+		}}))
+	}
+
+	deliveries := func(t *testing.T, repo *memory.Repository) []model.WebhookDelivery {
+		t.Helper()
+
+		list, err := repo.ListWebhookDeliveries(ctx, model.DeliveryFilter{})
+		require.NoError(t, err)
+
+		return list
+	}
+
+	t.Run("Good: delivers signed event", func(t *testing.T) {
+		repo, dispatcher, rc, _ := setup(t)
+		publish(t, repo, model.EventPRCreated)
+
+		require.NoError(t, dispatcher.DispatchOnce(ctx))
+
+		require.Len(t, rc.requests, 1)
+		req, body := rc.requests[0], rc.bodies[0]
+		require.Equal(t, string(model.EventPRCreated), req.Header.Get(EventHeader))
+		require.NotEmpty(t, req.Header.Get(DeliveryHeader))
+		require.Equal(t, Sign("secret", body), req.Header.Get(SignatureHeader))
+
+		var got struct {
+			Type model.DomainEventType `json:"type"`
+			Data json.RawMessage       `json:"data"`
+		}
+		require.NoError(t, json.Unmarshal(body, &got))
+		require.Equal(t, model.EventPRCreated, got.Type)
+		require.JSONEq(t, `{"pull_request":{"pull_request_id":"pr-1"}}`, string(got.Data))
+
+		list := deliveries(t, repo)
+		require.Len(t, list, 1)
+		require.Equal(t, model.DeliveryDelivered, list[0].Status)
+		require.Equal(t, 1, list[0].Attempts)
+
+		require.NoError(t, dispatcher.DispatchOnce(ctx))
+		require.Len(t, rc.requests, 1, "delivered events are not sent again")
+	})
+
+	t.Run("Good: retries with backoff", func(t *testing.T) {
+		repo, dispatcher, rc, now := setup(t, http.StatusInternalServerError)
+		publish(t, repo, model.EventPRMerged)
+
+		require.NoError(t, dispatcher.DispatchOnce(ctx))
+
+		list := deliveries(t, repo)
+		require.Equal(t, model.DeliveryPending, list[0].Status)
+		require.Equal(t, 1, list[0].Attempts)
+		require.Equal(t, "unexpected status 500", list[0].LastError)
+		require.WithinDuration(t, now.Add(time.Minute), list[0].NextAttemptAt, time.Millisecond)
+
+		require.NoError(t, dispatcher.DispatchOnce(ctx))
+		require.Len(t, rc.requests, 1, "retry waits for backoff")
+
+		*now = now.Add(time.Minute)
+		require.NoError(t, dispatcher.DispatchOnce(ctx))
+
+		list = deliveries(t, repo)
+		require.Len(t, rc.requests, 2)
+		require.Equal(t, model.DeliveryDelivered, list[0].Status)
+		require.Equal(t, 2, list[0].Attempts)
+	})
+
+	t.Run("Bad: dead after max attempts", func(t *testing.T) {
+		repo, dispatcher, rc, now := setup(t,
+			http.StatusBadGateway, http.StatusBadGateway, http.StatusBadGateway,
+		)
+		publish(t, repo, model.EventPRMerged)
+
+		for range 3 {
+			require.NoError(t, dispatcher.DispatchOnce(ctx))
+
+			*now = now.Add(time.Hour)
+		}
+
+		list := deliveries(t, repo)
+		require.Len(t, rc.requests, 3)
+		require.Equal(t, model.DeliveryDead, list[0].Status)
+		require.Equal(t, 3, list[0].Attempts)
+
+		require.NoError(t, dispatcher.DispatchOnce(ctx))
+		require.Len(t, rc.requests, 3, "dead deliveries are not retried")
+	})
+
+	t.Run("Good: subscriptions filter event types", func(t *testing.T) {
+		repo, dispatcher, rc, _ := setup(t)
+
+		subs, err := repo.ListWebhookSubscriptions(ctx)
+		require.NoError(t, err)
+		require.NoError(t, repo.DeleteWebhookSubscription(ctx, "wh_1"))
+
+		_, err = repo.CreateWebhookSubscription(ctx, model.WebhookSubscription{
+			ID:         "wh_merged",
+			URL:        subs[0].URL,
+			EventTypes: []model.DomainEventType{model.EventPRMerged},
+		})
+		require.NoError(t, err)
+
+		publish(t, repo, model.EventPRCreated)
+		publish(t, repo, model.EventPRMerged)
+
+		require.NoError(t, dispatcher.DispatchOnce(ctx))
+
+		list := deliveries(t, repo)
+		require.Len(t, list, 1)
+		require.Equal(t, "wh_merged", list[0].SubscriptionID)
+		require.Len(t, rc.requests, 1)
+		require.Equal(t, string(model.EventPRMerged), rc.requests[0].Header.Get(EventHeader))
+	})
+}
+
+// slowReceiver answers with the next status after moving the shared clock by
+// step. While a request of first is in flight, second polls once, the way
+// another instance sharing the store would.
+type slowReceiver struct {
+	mu       sync.Mutex
+	now      time.Time
+	step     time.Duration
+	statuses []int
+	sent     map[string]int
+	polling  bool
+	second   *Dispatcher
+	pollErr  error
+}
+
+func (rc *slowReceiver) clock() time.Time {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	return rc.now
+}
+
+func (rc *slowReceiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rc.mu.Lock()
+	rc.sent[r.Header.Get(DeliveryHeader)]++
+	rc.now = rc.now.Add(rc.step)
+
+	status := http.StatusOK
+	if len(rc.statuses) > 0 {
+		status, rc.statuses = rc.statuses[0], rc.statuses[1:]
+	}
+
+	poll := !rc.polling
+	rc.polling = true
+	rc.mu.Unlock()
+
+	if poll {
+		err := rc.second.DispatchOnce(r.Context())
+
+		rc.mu.Lock()
+		rc.polling = false
+		rc.pollErr = errors.Join(rc.pollErr, err)
+		rc.mu.Unlock()
+	}
+
+	w.WriteHeader(status)
+}
+
+func TestDispatcherSharedStore(t *testing.T) {
+	ctx := context.Background()
+
+	const timeout = time.Second
+
+	setup := func(
+		t *testing.T,
+		events int,
+		step time.Duration,
+		statuses ...int,
+	) (*memory.Repository, *Dispatcher, *slowReceiver) {
+		t.Helper()
+
+		repo := memory.New()
+		_, err := repo.CreateTeam(ctx, "backend")
+		require.NoError(t, err)
+		require.NoError(t, repo.InsertTeamMembers(ctx, "backend", []model.User{
+			{ID: "author", Username: "Author", IsActive: true},
+		}))
+		_, err = repo.CreatePullRequest(ctx, model.PullRequest{
+			ID:       "pr-1",
+			Name:     "feature",
+			AuthorID: "author",
+			Status:   model.PRStatusOpen,
+		})
+		require.NoError(t, err)
+
+		rc := &slowReceiver{now: time.Now(), step: step, statuses: statuses, sent: map[string]int{}}
+		srv := httptest.NewServer(rc)
+		t.Cleanup(srv.Close)
+
+		_, err = repo.CreateWebhookSubscription(ctx, model.WebhookSubscription{
+			ID:     "wh_1",
+			URL:    srv.URL,
+			Secret: "secret",
+		})
+		require.NoError(t, err)
+
+		for range events {
+			require.NoError(t, repo.AppendOutboxEvents(ctx, []model.OutboxEvent{{
+				Type:          model.EventPRCreated,
+				PullRequestID: "pr-1",
+				Payload:       json.RawMessage(`{}`),
+			}}))
+		}
+
+		newDispatcher := func(batchSize int) *Dispatcher {
+			dispatcher := NewDispatcher(repo, srv.Client(), slog.New(slog.DiscardHandler), Config{
+				PollInterval: time.Second,
+				Timeout:      timeout,
+				BatchSize:    batchSize,
+				MaxAttempts:  3,
+				BaseBackoff:  time.Minute,
+				MaxBackoff:   time.Hour,
+			})
+			dispatcher.now = rc.clock
+
+			return dispatcher
+		}
+
+		rc.second = newDispatcher(1)
+
+		return repo, newDispatcher(10), rc
+	}
+
+	t.Run("Good: slow deliveries are sent once", func(t *testing.T) {
+		// a batch of three takes longer than two timeouts to send
+		repo, first, rc := setup(t, 3, timeout*4/5)
+
+		require.NoError(t, first.DispatchOnce(ctx))
+		require.NoError(t, rc.pollErr)
+
+		require.Len(t, rc.sent, 3)
+
+		for id, count := range rc.sent {
+			require.Equal(t, 1, count, "delivery %s", id)
+		}
+
+		list, err := repo.ListWebhookDeliveries(ctx, model.DeliveryFilter{})
+		require.NoError(t, err)
+
+		for _, delivery := range list {
+			require.Equal(t, model.DeliveryDelivered, delivery.Status)
+			require.Equal(t, 1, delivery.Attempts)
+		}
+	})
+
+	t.Run("Good: a stalled attempt does not overwrite the newer one", func(t *testing.T) {
+		// the first attempt outlives its lease, the second one fails
+		repo, first, rc := setup(t, 1, 3*timeout, http.StatusOK, http.StatusBadGateway)
+
+		require.NoError(t, first.DispatchOnce(ctx))
+		require.NoError(t, rc.pollErr)
+
+		list, err := repo.ListWebhookDeliveries(ctx, model.DeliveryFilter{})
+		require.NoError(t, err)
+		require.Len(t, list, 1)
+		require.Equal(t, 2, rc.sent[strconv.FormatInt(list[0].ID, 10)])
+		require.Equal(t, model.DeliveryPending, list[0].Status)
+		require.Equal(t, 1, list[0].Attempts)
+		require.Equal(t, "unexpected status 502", list[0].LastError)
+	})
+}
+
+func TestNewClient(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	t.Cleanup(srv.Close)
+
+	t.Run("Good: private addresses allowed by config", func(t *testing.T) {
+		resp, err := NewClient(true).Post(srv.URL, "application/json", nil)
+		require.NoError(t, err)
+		require.NoError(t, resp.Body.Close())
+		require.Equal(t, http.StatusNoContent, resp.StatusCode)
+	})
+
+	t.Run("Bad: loopback refused", func(t *testing.T) {
+		_, err := NewClient(false).Post(srv.URL, "application/json", nil)
+		require.ErrorIs(t, err, errForbiddenAddress)
+	})
+
+	t.Run("Bad: non-public addresses", func(t *testing.T) {
+		for _, address := range []string{
+			"127.0.0.1:80",
+			"10.1.2.3:80",
+			"192.168.0.1:443",
+			"169.254.169.254:80",
+			"100.100.100.200:80",
+			"0.0.0.0:80",
+			"[::1]:80",
+			"[fe80::1]:80",
+			"[fd00::1]:80",
+			"[::ffff:127.0.0.1]:80",
+		} {
+			require.ErrorIs(t, denyNonPublic("tcp", address, nil), errForbiddenAddress, address)
+		}
+
+		require.NoError(t, denyNonPublic("tcp", "93.184.216.34:443", nil))
+		require.NoError(t, denyNonPublic("tcp", "[2606:2800:220:1::]:443", nil))
+	})
+}
+
+func TestBackoff(t *testing.T) {
+	d := &Dispatcher{cfg: Config{BaseBackoff: time.Second, MaxBackoff: 10 * time.Second}}
+
+	require.Equal(t, time.Second, d.backoff(1))
+	require.Equal(t, 2*time.Second, d.backoff(2))
+	require.Equal(t, 8*time.Second, d.backoff(4))
+	require.Equal(t, 10*time.Second, d.backoff(5))
+	require.Equal(t, 10*time.Second, d.backoff(60))
+}
@@ -0,0 +1,3 @@
+DROP TRIGGER IF EXISTS assignment_events_append_only ON assignment_events;
+DROP FUNCTION IF EXISTS assignment_events_append_only();
+DROP TABLE IF EXISTS assignment_events;
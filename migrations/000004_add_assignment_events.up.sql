@@ -0,0 +1,23 @@
+CREATE TABLE assignment_events (
+    id BIGSERIAL PRIMARY KEY,
+    pull_request_id TEXT NOT NULL REFERENCES pull_requests(id),
+    event_type TEXT NOT NULL
+        CHECK (event_type IN ('CREATED', 'REASSIGNED', 'MERGED')),
+    old_reviewer_id TEXT NULL REFERENCES users(id),
+    new_reviewer_id TEXT NULL REFERENCES users(id),
+    actor_id TEXT NULL,
+    reason TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX idx_assignment_events_pr ON assignment_events(pull_request_id, id);
+
+CREATE FUNCTION assignment_events_append_only() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'assignment_events is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER assignment_events_append_only
+    BEFORE UPDATE OR DELETE ON assignment_events
+    FOR EACH ROW EXECUTE FUNCTION assignment_events_append_only();
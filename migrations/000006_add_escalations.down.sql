@@ -0,0 +1,16 @@
+DELETE FROM pull_request_reviewers WHERE slot = 3;
+
+ALTER TABLE pull_request_reviewers
+    DROP CONSTRAINT pull_request_reviewers_slot_check,
+    ADD CONSTRAINT pull_request_reviewers_slot_check CHECK (slot BETWEEN 1 AND 2);
+
+ALTER TABLE assignment_events DISABLE TRIGGER assignment_events_append_only;
+
+DELETE FROM assignment_events WHERE event_type LIKE 'ESCALATION\_%' ESCAPE '\';
+
+ALTER TABLE assignment_events ENABLE TRIGGER assignment_events_append_only;
+
+ALTER TABLE assignment_events
+    DROP CONSTRAINT assignment_events_event_type_check,
+    ADD CONSTRAINT assignment_events_event_type_check
+        CHECK (event_type IN ('CREATED', 'REASSIGNED', 'MERGED'));
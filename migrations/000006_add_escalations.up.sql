@@ -0,0 +1,12 @@
+-- A team lead may be added as a third reviewer when a review is escalated.
+ALTER TABLE pull_request_reviewers
+    DROP CONSTRAINT pull_request_reviewers_slot_check,
+    ADD CONSTRAINT pull_request_reviewers_slot_check CHECK (slot BETWEEN 1 AND 3);
+
+ALTER TABLE assignment_events
+    DROP CONSTRAINT assignment_events_event_type_check,
+    ADD CONSTRAINT assignment_events_event_type_check
+        CHECK (event_type IN (
+            'CREATED', 'REASSIGNED', 'MERGED',
+            'ESCALATION_NOTIFIED', 'ESCALATION_REASSIGNED', 'ESCALATION_LEAD_ADDED'
+        ));
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_pull_requests_merged_at;
+DROP INDEX IF EXISTS idx_pull_requests_created_at;
+DROP INDEX IF EXISTS idx_pull_request_reviewers_assigned_at;
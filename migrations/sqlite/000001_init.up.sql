@@ -0,0 +1,36 @@
+-- SQLite schema mirroring ../000001_init.up.sql.
+-- pgcrypto is not needed, pr_status is a CHECK constraint and timestamps are
+-- stored as fixed-width UTC text (YYYY-MM-DDTHH:MM:SS.ffffffZ) so that they
+-- compare lexicographically in time order.
+
+CREATE TABLE teams (
+    name TEXT PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%dT%H:%M:%f000Z', 'now'))
+);
+
+CREATE TABLE users (
+    id TEXT PRIMARY KEY,
+    team_name TEXT NOT NULL REFERENCES teams(name),
+    username TEXT NOT NULL,
+    is_active BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%dT%H:%M:%f000Z', 'now')),
+    updated_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%dT%H:%M:%f000Z', 'now'))
+);
+
+CREATE TABLE pull_requests (
+    id TEXT PRIMARY KEY,
+    name TEXT NOT NULL,
+    author_id TEXT NOT NULL REFERENCES users(id),
+    status TEXT NOT NULL DEFAULT 'OPEN' CHECK (status IN ('OPEN', 'MERGED')),
+    created_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%dT%H:%M:%f000Z', 'now')),
+    merged_at TIMESTAMP NULL
+);
+
+CREATE TABLE pull_request_reviewers (
+    pull_request_id TEXT NOT NULL REFERENCES pull_requests(id) ON DELETE CASCADE,
+    slot SMALLINT NOT NULL CHECK (slot BETWEEN 1 AND 2),
+    reviewer_id TEXT NOT NULL REFERENCES users(id),
+    assigned_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%dT%H:%M:%f000Z', 'now')),
+    PRIMARY KEY (pull_request_id, slot),
+    UNIQUE (pull_request_id, reviewer_id)
+);
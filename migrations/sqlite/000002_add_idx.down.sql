@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_pull_request_reviewers_reviewer;
+DROP INDEX IF EXISTS idx_pull_requests_author;
+DROP INDEX IF EXISTS idx_users_team_name;
@@ -0,0 +1,3 @@
+DROP TRIGGER IF EXISTS assignment_events_no_delete;
+DROP TRIGGER IF EXISTS assignment_events_no_update;
+DROP TABLE IF EXISTS assignment_events;
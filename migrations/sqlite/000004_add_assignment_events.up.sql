@@ -0,0 +1,25 @@
+CREATE TABLE assignment_events (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    pull_request_id TEXT NOT NULL REFERENCES pull_requests(id),
+    event_type TEXT NOT NULL
+        CHECK (event_type IN ('CREATED', 'REASSIGNED', 'MERGED')),
+    old_reviewer_id TEXT NULL REFERENCES users(id),
+    new_reviewer_id TEXT NULL REFERENCES users(id),
+    actor_id TEXT NULL,
+    reason TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%dT%H:%M:%f000Z', 'now'))
+);
+
+CREATE INDEX idx_assignment_events_pr ON assignment_events(pull_request_id, id);
+
+CREATE TRIGGER assignment_events_no_update
+    BEFORE UPDATE ON assignment_events
+BEGIN
+    SELECT RAISE(ABORT, 'assignment_events is append-only');
+END;
+
+CREATE TRIGGER assignment_events_no_delete
+    BEFORE DELETE ON assignment_events
+BEGIN
+    SELECT RAISE(ABORT, 'assignment_events is append-only');
+END;
@@ -0,0 +1,45 @@
+CREATE TABLE pull_request_reviewers_old (
+    pull_request_id TEXT NOT NULL REFERENCES pull_requests(id) ON DELETE CASCADE,
+    slot SMALLINT NOT NULL CHECK (slot BETWEEN 1 AND 2),
+    reviewer_id TEXT NOT NULL REFERENCES users(id),
+    assigned_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%dT%H:%M:%f000Z', 'now')),
+    PRIMARY KEY (pull_request_id, slot),
+    UNIQUE (pull_request_id, reviewer_id)
+);
+
+INSERT INTO pull_request_reviewers_old SELECT * FROM pull_request_reviewers WHERE slot <= 2;
+DROP TABLE pull_request_reviewers;
+ALTER TABLE pull_request_reviewers_old RENAME TO pull_request_reviewers;
+
+CREATE INDEX idx_pull_request_reviewers_reviewer ON pull_request_reviewers (reviewer_id);
+
+CREATE TABLE assignment_events_old (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    pull_request_id TEXT NOT NULL REFERENCES pull_requests(id),
+    event_type TEXT NOT NULL
+        CHECK (event_type IN ('CREATED', 'REASSIGNED', 'MERGED')),
+    old_reviewer_id TEXT NULL REFERENCES users(id),
+    new_reviewer_id TEXT NULL REFERENCES users(id),
+    actor_id TEXT NULL,
+    reason TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%dT%H:%M:%f000Z', 'now'))
+);
+
+INSERT INTO assignment_events_old
+SELECT * FROM assignment_events WHERE event_type NOT LIKE 'ESCALATION\_%' ESCAPE '\';
+DROP TABLE assignment_events;
+ALTER TABLE assignment_events_old RENAME TO assignment_events;
+
+CREATE INDEX idx_assignment_events_pr ON assignment_events(pull_request_id, id);
+
+CREATE TRIGGER assignment_events_no_update
+    BEFORE UPDATE ON assignment_events
+BEGIN
+    SELECT RAISE(ABORT, 'assignment_events is append-only');
+END;
+
+CREATE TRIGGER assignment_events_no_delete
+    BEFORE DELETE ON assignment_events
+BEGIN
+    SELECT RAISE(ABORT, 'assignment_events is append-only');
+END;
@@ -0,0 +1,50 @@
+-- SQLite can not alter CHECK constraints, so both tables are rebuilt to allow
+-- a third reviewer slot for the team lead and the escalation event types.
+
+CREATE TABLE pull_request_reviewers_new (
+    pull_request_id TEXT NOT NULL REFERENCES pull_requests(id) ON DELETE CASCADE,
+    slot SMALLINT NOT NULL CHECK (slot BETWEEN 1 AND 3),
+    reviewer_id TEXT NOT NULL REFERENCES users(id),
+    assigned_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%dT%H:%M:%f000Z', 'now')),
+    PRIMARY KEY (pull_request_id, slot),
+    UNIQUE (pull_request_id, reviewer_id)
+);
+
+INSERT INTO pull_request_reviewers_new SELECT * FROM pull_request_reviewers;
+DROP TABLE pull_request_reviewers;
+ALTER TABLE pull_request_reviewers_new RENAME TO pull_request_reviewers;
+
+CREATE INDEX idx_pull_request_reviewers_reviewer ON pull_request_reviewers (reviewer_id);
+
+CREATE TABLE assignment_events_new (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    pull_request_id TEXT NOT NULL REFERENCES pull_requests(id),
+    event_type TEXT NOT NULL
+        CHECK (event_type IN (
+            'CREATED', 'REASSIGNED', 'MERGED',
+            'ESCALATION_NOTIFIED', 'ESCALATION_REASSIGNED', 'ESCALATION_LEAD_ADDED'
+        )),
+    old_reviewer_id TEXT NULL REFERENCES users(id),
+    new_reviewer_id TEXT NULL REFERENCES users(id),
+    actor_id TEXT NULL,
+    reason TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%dT%H:%M:%f000Z', 'now'))
+);
+
+INSERT INTO assignment_events_new SELECT * FROM assignment_events;
+DROP TABLE assignment_events;
+ALTER TABLE assignment_events_new RENAME TO assignment_events;
+
+CREATE INDEX idx_assignment_events_pr ON assignment_events(pull_request_id, id);
+
+CREATE TRIGGER assignment_events_no_update
+    BEFORE UPDATE ON assignment_events
+BEGIN
+    SELECT RAISE(ABORT, 'assignment_events is append-only');
+END;
+
+CREATE TRIGGER assignment_events_no_delete
+    BEFORE DELETE ON assignment_events
+BEGIN
+    SELECT RAISE(ABORT, 'assignment_events is append-only');
+END;
@@ -0,0 +1,3 @@
+CREATE INDEX IF NOT EXISTS idx_pull_request_reviewers_assigned_at ON pull_request_reviewers (assigned_at);
+CREATE INDEX IF NOT EXISTS idx_pull_requests_created_at ON pull_requests (created_at);
+CREATE INDEX IF NOT EXISTS idx_pull_requests_merged_at ON pull_requests (merged_at);
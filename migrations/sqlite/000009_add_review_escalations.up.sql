@@ -0,0 +1,19 @@
+-- An assignment, a reviewer of a pull request since assigned_at, is escalated
+-- at most once.
+CREATE TABLE review_escalations (
+    pull_request_id TEXT NOT NULL REFERENCES pull_requests(id),
+    reviewer_id TEXT NOT NULL REFERENCES users(id),
+    assigned_at TIMESTAMP NOT NULL,
+    escalated_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%dT%H:%M:%f000Z', 'now')),
+    PRIMARY KEY (pull_request_id, reviewer_id, assigned_at)
+);
+
+INSERT INTO review_escalations (pull_request_id, reviewer_id, assigned_at, escalated_at)
+SELECT e.pull_request_id, e.old_reviewer_id, COALESCE(r.assigned_at, e.created_at), e.created_at
+FROM assignment_events e
+LEFT JOIN pull_request_reviewers r
+    ON r.pull_request_id = e.pull_request_id
+   AND r.reviewer_id = e.old_reviewer_id
+   AND r.assigned_at <= e.created_at
+WHERE e.event_type IN ('ESCALATION_NOTIFIED', 'ESCALATION_REASSIGNED', 'ESCALATION_LEAD_ADDED')
+ON CONFLICT DO NOTHING;
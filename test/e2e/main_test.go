@@ -83,6 +83,11 @@ func TestEndToEndFlow(t *testing.T) {
 	if prStats.Total == 0 || prStats.Open+prStats.Merged == 0 {
 		t.Fatalf("unexpected pull request stats: %+v", prStats)
 	}
+
+	teamStats := getTeamStats(t, client, teamName)
+	if len(teamStats.Teams) != 1 || teamStats.Teams[0].Members.Active != len(members) {
+		t.Fatalf("unexpected team stats: %+v", teamStats)
+	}
 }
 
 func addTeam(t *testing.T, client *http.Client, teamName string, members []httpmodel.TeamMember) {
@@ -171,6 +176,15 @@ func getPRStats(t *testing.T, client *http.Client) httpmodel.PullRequestStatsRes
 	return resp
 }
 
+func getTeamStats(t *testing.T, client *http.Client, teamName string) httpmodel.TeamStatsResponse {
+	t.Helper()
+
+	var resp httpmodel.TeamStatsResponse
+	doJSONRequest(t, client, http.MethodGet, "/stats/teams?team_name="+teamName, nil, http.StatusOK, &resp)
+
+	return resp
+}
+
 func doJSONRequest(
 	t *testing.T,
 	client *http.Client,